@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// configSensitiveFields are setting names redacted by config print in
+// addition to the logger's default sensitive fields
+var configSensitiveFields = []string{"hashkey"}
+
+// settingView is the printed form of a configuration setting
+type settingView struct {
+	Key    string      `json:"key" yaml:"key"`
+	Value  interface{} `json:"value" yaml:"value"`
+	Source string      `json:"source" yaml:"source"`
+}
+
+// configCommand groups the configuration commands
+func (c *cli) configCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	var redacted bool
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration and where each value came from",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.configPrint(redacted)
+		},
+	}
+	printCmd.Flags().BoolVar(&redacted, "redacted", true, "hide secrets such as passwords and tokens")
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration and report every invalid setting",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.configValidate()
+		},
+	}
+
+	cmd.AddCommand(printCmd, validateCmd)
+	return cmd
+}
+
+// configPrint writes every effective setting with its source
+func (c *cli) configPrint(redacted bool) error {
+	loaded, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	redaction := logger.DefaultRedactionConfig()
+	redaction.SensitiveFields = append(redaction.SensitiveFields, configSensitiveFields...)
+	redactor := logger.NewRedactor(redaction)
+
+	settings := []settingView{}
+	tbl := &table{headers: []string{"KEY", "VALUE", "SOURCE"}}
+	for _, setting := range loaded.Settings() {
+		value := setting.Value
+		if redacted {
+			value = redactSetting(redactor, setting)
+		}
+		// Durations would otherwise be encoded as nanoseconds
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		settings = append(settings, settingView{Key: setting.Key, Value: value, Source: setting.Source.String()})
+		tbl.addRow(setting.Key, value, setting.Source)
+	}
+	return c.print(settings, tbl)
+}
+
+// redactSetting hides the value of a sensitive setting. Empty values are
+// shown so missing secrets are easy to spot.
+func redactSetting(redactor *logger.Redactor, setting configs.Setting) interface{} {
+	if s, ok := setting.Value.(string); ok && s == "" {
+		return s
+	}
+	name := setting.Key[strings.LastIndex(setting.Key, ".")+1:]
+	return redactor.Field(name, setting.Value)
+}
+
+// configValidate loads the configuration and reports whether it is valid
+func (c *cli) configValidate() error {
+	loaded, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	files := strings.Join(loaded.Files, ", ")
+	if files == "" {
+		files = "no config file, defaults and environment only"
+	}
+	fmt.Fprintf(c.stdout, "Configuration is valid (%s)\n", files)
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/repository"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/postgres"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/replica"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// openDatabase connects to the configured PostgreSQL database, routing
+// reads to replicas and failing over between hosts when those are
+// configured
+func openDatabase(ctx context.Context, config configs.DatabaseConfig, log logger.Logger, opts ...postgres.Option) (database.Connection, error) {
+	database.Register(postgres.NewProvider(log, opts...))
+
+	provider, err := database.Get("postgres")
+	if err != nil {
+		return nil, err
+	}
+	provider = database.InterceptProvider(provider, databaseInterceptors(config, log)...)
+
+	if len(config.FailoverHosts) == 0 && len(config.Replicas) == 0 {
+		return provider.Connect(databaseConfig(config))
+	}
+	return replica.New(ctx, provider,
+		databaseNodes(config, append([]string{config.Host}, config.FailoverHosts...)),
+		databaseNodes(config, config.Replicas),
+		replica.WithBalancer(replica.Balancer(config.ReplicaBalancer)),
+		replica.WithMaxLag(config.MaxReplicaLag),
+		replica.WithLogger(log),
+	)
+}
+
+// databaseInterceptors returns the interceptors enabled by config
+func databaseInterceptors(config configs.DatabaseConfig, log logger.Logger) []database.Interceptor {
+	var interceptors []database.Interceptor
+	if config.QueryLimit > 0 {
+		interceptors = append(interceptors, database.QueryLimit(config.QueryLimit))
+	}
+	if config.SlowQueryThreshold > 0 {
+		interceptors = append(interceptors, database.SlowQueryLog(config.SlowQueryThreshold, log.Named(postgres.LoggerName)))
+	}
+	return interceptors
+}
+
+// databaseNodes describes a node per host, each using the other database
+// settings
+func databaseNodes(config configs.DatabaseConfig, hosts []string) []replica.Node {
+	nodes := make([]replica.Node, 0, len(hosts))
+	for _, host := range hosts {
+		hostConfig := config
+		hostConfig.Host = host
+		nodes = append(nodes, replica.Node{Name: host, Config: databaseConfig(hostConfig)})
+	}
+	return nodes
+}
+
+// primaryDatabase returns the connection to the primary of db, for work
+// that must not read from replicas
+func primaryDatabase(db database.Connection) database.Connection {
+	if router, ok := db.(*replica.Router); ok {
+		return router.Primary()
+	}
+	return db
+}
+
+// databaseConfig converts the application database settings into the
+// provider-agnostic database.Config
+func databaseConfig(config configs.DatabaseConfig) database.Config {
+	params := []string{
+		"host=" + quoteParam(config.Host),
+		"user=" + quoteParam(config.Username),
+		"password=" + quoteParam(config.Password),
+		"dbname=" + quoteParam(config.Database),
+	}
+	if config.Port != 0 {
+		params = append(params, fmt.Sprintf("port=%d", config.Port))
+	}
+
+	return database.Config{
+		Driver:           "postgres",
+		ConnectionString: strings.Join(params, " "),
+		MaxOpenConns:     config.MaxOpenConns,
+		MaxIdleConns:     config.MaxIdleConns,
+		ConnMaxLifetime:  config.ConnMaxLifetime,
+		SSLMode:          config.SSLMode,
+	}
+}
+
+// quoteParam quotes a value for use in a key/value connection string
+func quoteParam(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// connectDatabase resolves the database credentials and connects to the
+// configured database for a command
+func connectDatabase(ctx context.Context, config configs.Config, log logger.Logger) (database.Connection, error) {
+	if config.Database.Host == "" {
+		return nil, errors.New("no database configured, set database.host")
+	}
+
+	resolver := newSecretResolver(config.Secrets, log.Named("secrets"))
+	credentials, err := resolveCredentials(ctx, resolver, config.Database)
+	if err != nil {
+		return nil, err
+	}
+	return openDatabase(ctx, credentials, log)
+}
+
+// repositoryOptions applies the configured operation timeouts and change
+// feed to a repository
+func repositoryOptions(config configs.DatabaseConfig) []repository.Option {
+	return []repository.Option{
+		repository.WithTimeout(config.QueryTimeout),
+		repository.WithOperationTimeouts(config.QueryTimeouts),
+		repository.WithChangeFeed(config.ChangeChannel),
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/health"
+	"github.com/spf13/cobra"
+)
+
+// healthCommand groups the health commands
+func (c *cli) healthCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Query the health of a running server",
+	}
+
+	var url string
+	var timeout time.Duration
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Report the health of a running server, failing when it is not ready",
+		Long: "Fetches the health report of a running server and exits with a non-zero " +
+			"code when it is not ready, for use as a container HEALTHCHECK.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if url == "" {
+				loaded, err := c.loadConfig()
+				if err != nil {
+					return err
+				}
+				url = fmt.Sprintf("http://127.0.0.1:%d/api/v1/health", loaded.Config.Server.Port)
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			return c.healthCheck(ctx, url)
+		},
+	}
+	checkCmd.Flags().StringVar(&url, "url", "", "health report URL, defaults to the configured server port on localhost")
+	checkCmd.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "how long to wait for the report")
+
+	cmd.AddCommand(checkCmd)
+	return cmd
+}
+
+// healthCheck fetches and prints the health report at url
+func (c *cli) healthCheck(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var report health.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("health check failed: %s returned %s", url, resp.Status)
+	}
+
+	tbl := &table{headers: []string{"CHECK", "STATUS", "CRITICAL", "LATENCY", "ERROR"}}
+	for _, result := range report.Checks {
+		tbl.addRow(result.Name, result.Status, result.Critical, fmt.Sprintf("%.1fms", result.LatencyMS), result.Error)
+	}
+	if err := c.print(report, tbl); err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK || !report.Ready() {
+		return errors.New("server is not ready: status " + string(report.Status))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger/sink"
+)
+
+// setupLogging replaces the standard logger with one built from config.
+// The returned closer flushes and releases the log output.
+func setupLogging(config configs.LoggingConfig) (io.Closer, error) {
+	redaction := redactionConfig(config)
+
+	sinkConfig, err := sinkConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	out, err := sink.Open(sinkConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := logger.Configure(logger.Options{
+		Backend:   config.Backend,
+		Format:    config.Format,
+		Output:    out,
+		Redaction: &redaction,
+	}); err != nil {
+		out.Close()
+		return nil, err
+	}
+
+	// LOG_LEVEL remains the default root level
+	if err := logger.ApplyLevels(config.Level, config.Levels); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// redactionConfig converts the logging settings into redaction rules
+func redactionConfig(config configs.LoggingConfig) logger.RedactionConfig {
+	redaction := logger.DefaultRedactionConfig()
+	redaction.SensitiveFields = append(redaction.SensitiveFields, config.RedactFields...)
+	redaction.HashEmails = config.HashEmails
+	redaction.HashKey = config.EmailHashKey
+	return redaction
+}
+
+// sinkConfig converts the logging settings into the log output configuration
+func sinkConfig(config configs.LoggingConfig) (sink.Config, error) {
+	out := sink.Config{
+		Output: config.Output,
+		File: sink.RotatingFileConfig{
+			Path:       config.File.Path,
+			MaxSizeMB:  config.File.MaxSizeMB,
+			MaxAgeDays: config.File.MaxAgeDays,
+			MaxBackups: config.File.MaxBackups,
+			Compress:   config.File.Compress,
+		},
+		Syslog: sink.SyslogConfig{
+			Network:  config.Syslog.Network,
+			Address:  config.Syslog.Address,
+			Facility: config.Syslog.Facility,
+			AppName:  config.Syslog.AppName,
+		},
+	}
+
+	if config.Syslog.CAFile != "" {
+		pem, err := os.ReadFile(config.Syslog.CAFile)
+		if err != nil {
+			return out, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return out, fmt.Errorf("no certificates found in %s", config.Syslog.CAFile)
+		}
+		out.Syslog.TLSConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	if config.Async.Enabled {
+		out.Async = &sink.AsyncConfig{
+			BufferSize: config.Async.BufferSize,
+			Policy:     sink.DropPolicy(config.Async.DropPolicy),
+		}
+	}
+	return out, nil
+}
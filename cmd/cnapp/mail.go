@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/repository"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/mailer"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/token"
+)
+
+// errInvitationsDisabled is returned when invitations are not configured
+var errInvitationsDisabled = errors.New("invitations are disabled, set users.invitations.secret and mail.driver")
+
+// newMailer creates the mailer selected by mail.driver, or nil for none
+func newMailer(config configs.MailConfig) (mailer.Mailer, error) {
+	switch config.Driver {
+	case "smtp":
+		if config.SMTP.Host == "" {
+			return nil, errors.New("the smtp mail driver requires mail.smtp.host")
+		}
+		return mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     config.SMTP.Host,
+			Port:     config.SMTP.Port,
+			Username: config.SMTP.Username,
+			Password: config.SMTP.Password,
+			TLS:      config.SMTP.TLS,
+			Timeout:  config.SMTP.Timeout,
+		}), nil
+	case "file":
+		return mailer.NewFile(config.Dir)
+	case "memory":
+		return mailer.NewMemory(), nil
+	case "none", "":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", config.Driver)
+}
+
+// newInvitationService creates the invitation service for users, or
+// returns errInvitationsDisabled
+func newInvitationService(config configs.Config, db database.Connection, users *service.UserService) (*service.InvitationService, error) {
+	invitations := config.Users.Invitations
+	if invitations.Secret == "" {
+		return nil, errInvitationsDisabled
+	}
+	m, err := newMailer(config.Mail)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errInvitationsDisabled
+	}
+	signer, err := token.NewSigner([]byte(invitations.Secret))
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewInvitationService(users,
+		repository.NewPostgresInvitationRepository(db, repositoryOptions(config.Database)...),
+		m,
+		signer,
+		service.WithInvitationTTL(invitations.TTL),
+		service.WithSender(config.Mail.From),
+		service.WithAcceptURL(invitations.AcceptURL),
+	), nil
+}
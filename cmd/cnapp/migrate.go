@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/repository"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/migrate"
+	"github.com/spf13/cobra"
+)
+
+// migrationView is the printed form of a migration
+type migrationView struct {
+	Version   int        `json:"version" yaml:"version"`
+	Name      string     `json:"name" yaml:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty" yaml:"applied_at,omitempty"`
+}
+
+// migrateCommand applies pending database migrations
+func (c *cli) migrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending database migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.withMigrator(cmd.Context(), func(migrator *migrate.Migrator) error {
+				applied, err := migrator.Up(cmd.Context())
+				for _, migration := range applied {
+					fmt.Fprintf(c.stdout, "Applied migration %d %s\n", migration.Version, migration.Name)
+				}
+				if err != nil {
+					return err
+				}
+				if len(applied) == 0 {
+					fmt.Fprintln(c.stdout, "Database is up to date")
+				}
+				return nil
+			})
+		},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "List migrations and when they were applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.withMigrator(cmd.Context(), func(migrator *migrate.Migrator) error {
+				applied, err := migrator.Applied(cmd.Context())
+				if err != nil {
+					return err
+				}
+
+				migrations := []migrationView{}
+				tbl := &table{headers: []string{"VERSION", "NAME", "APPLIED"}}
+				for _, migration := range migrator.Migrations() {
+					view := migrationView{Version: migration.Version, Name: migration.Name}
+					appliedAt := "pending"
+					if at, ok := applied[migration.Version]; ok {
+						view.AppliedAt = &at
+						appliedAt = at.Format(time.RFC3339)
+					}
+					migrations = append(migrations, view)
+					tbl.addRow(migration.Version, migration.Name, appliedAt)
+				}
+				return c.print(migrations, tbl)
+			})
+		},
+	}
+
+	cmd.AddCommand(statusCmd)
+	return cmd
+}
+
+// withMigrator connects to the configured database and runs fn with a
+// migrator for the application's migrations
+func (c *cli) withMigrator(ctx context.Context, fn func(migrator *migrate.Migrator) error) error {
+	loaded, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	log, err := c.logger(loaded.Config)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectDatabase(ctx, loaded.Config, log)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(primaryDatabase(db), repository.Migrations())
+	if err != nil {
+		return err
+	}
+	return fn(migrator)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats selected with --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// validateOutput checks that format is a supported output format
+func validateOutput(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table, json or yaml", format)
+}
+
+// table is the tabular rendering of a command's result
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+// addRow appends a row, formatting each value with %v
+func (t *table) addRow(values ...interface{}) {
+	row := make([]string, len(values))
+	for i, value := range values {
+		row[i] = fmt.Sprint(value)
+	}
+	t.rows = append(t.rows, row)
+}
+
+// write renders the table with aligned columns
+func (t *table) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// render writes value to w in format. Table output uses tbl, while JSON and
+// YAML encode value itself.
+func render(w io.Writer, format string, value interface{}, tbl *table) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case outputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return tbl.write(w)
+}
+
+// print writes a command's result in the selected output format
+func (c *cli) print(value interface{}, tbl *table) error {
+	return render(c.stdout, c.output, value, tbl)
+}
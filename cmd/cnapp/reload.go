@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// watchConfig applies reloadable settings when the config files change and
+// records every reload in the audit log
+func watchConfig(manager *configs.Manager, recorder *audit.Recorder, log logger.Logger) {
+	configs.Subscribe(manager, func(c configs.Config) configs.LoggingConfig { return c.Logging },
+		func(old, new configs.LoggingConfig) {
+			logger.SetRedaction(redactionConfig(new))
+			if err := logger.ApplyLevels(new.Level, new.Levels); err != nil {
+				log.WithError(err).Error("Failed to apply log levels")
+			}
+		})
+
+	manager.OnReload(func(reload configs.Reload) {
+		recordReload(recorder, reload, log)
+
+		if reload.Err != nil {
+			log.WithError(reload.Err).Error("Rejected configuration reload, keeping the previous configuration")
+			return
+		}
+		entry := log.WithField("changed", reload.Changed)
+		if len(reload.RestartRequired) > 0 {
+			entry.WithField("restart_required", reload.RestartRequired).
+				Warn("Configuration reloaded, some changes take effect only after a restart")
+			return
+		}
+		entry.Info("Configuration reloaded")
+	})
+
+	if err := manager.Watch(); err != nil {
+		log.WithError(err).Warn("Failed to watch config files, changes take effect only after a restart")
+	}
+}
+
+// recordReload appends an audit entry for a reload attempt. Only the
+// changed settings are recorded, with secrets redacted.
+func recordReload(recorder *audit.Recorder, reload configs.Reload, log logger.Logger) {
+	event := audit.Event{
+		Action:   "config.reload",
+		Resource: audit.Resource{Type: "config", ID: strings.Join(reload.Old.Files, ",")},
+		Metadata: map[string]string{},
+	}
+
+	if reload.Err != nil {
+		event.Action = "config.reload_rejected"
+		event.Metadata["error"] = reload.Err.Error()
+	} else {
+		event.Before = changedSettings(reload.Old, reload.Changed)
+		event.After = changedSettings(reload.New, reload.Changed)
+		if len(reload.RestartRequired) > 0 {
+			event.Metadata["restart_required"] = strings.Join(reload.RestartRequired, ",")
+		}
+	}
+
+	if _, err := recorder.Record(context.Background(), event); err != nil {
+		log.WithError(err).Error("Failed to record audit entry")
+	}
+}
+
+// changedSettings returns the redacted values of the changed keys
+func changedSettings(loaded *configs.Loaded, changed []string) map[string]interface{} {
+	redaction := logger.DefaultRedactionConfig()
+	redaction.SensitiveFields = append(redaction.SensitiveFields, configSensitiveFields...)
+	redactor := logger.NewRedactor(redaction)
+
+	keys := make(map[string]bool, len(changed))
+	for _, key := range changed {
+		keys[key] = true
+	}
+
+	values := make(map[string]interface{}, len(changed))
+	for _, setting := range loaded.Settings() {
+		if keys[setting.Key] {
+			values[setting.Key] = redactSetting(redactor, setting)
+		}
+	}
+	return values
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// Process exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	// exitUsage is returned for unknown commands and invalid flags
+	exitUsage = 2
+)
+
+// cli holds the state shared by every command
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	configFile string
+	profile    string
+	output     string
+
+	// ran is set once a command starts running, which tells usage errors
+	// apart from failures of the command itself
+	ran bool
+	// openUsers opens the user service. Tests replace it to avoid a database.
+	openUsers func(ctx context.Context, config configs.Config, log logger.Logger) (*userSession, error)
+}
+
+// newCLI creates the command-line interface writing to stdout and stderr
+func newCLI(stdout, stderr io.Writer) *cli {
+	return &cli{
+		stdout:    stdout,
+		stderr:    stderr,
+		openUsers: openUserSession,
+	}
+}
+
+// configOptions returns the options selecting the configuration files
+func (c *cli) configOptions() configs.Options {
+	return configs.Options{File: c.configFile, Profile: c.profile}
+}
+
+// loadConfig discovers, loads and validates the configuration
+func (c *cli) loadConfig() (*configs.Loaded, error) {
+	return configs.Load(c.configOptions())
+}
+
+// logger returns the logger used by commands other than serve. It writes
+// warnings and errors as text to stderr so they never mix with the
+// command's output.
+func (c *cli) logger(config configs.Config) (logger.Logger, error) {
+	redaction := redactionConfig(config.Logging)
+	return logger.New(logger.Options{
+		Backend:   config.Logging.Backend,
+		Format:    logger.FormatText,
+		Output:    c.stderr,
+		Levels:    logger.NewLevelRegistry(logger.WarnLevel),
+		Redaction: &redaction,
+	})
+}
+
+// rootCommand builds the command tree
+func (c *cli) rootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "scrutiny",
+		Short: "Scrutiny cloud-native application protection platform",
+		Long: "Scrutiny serves the HTTP API and provides commands to manage its database, " +
+			"users, configuration and audit log. Without a command it serves the API.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutput(c.output); err != nil {
+				return err
+			}
+			c.ran = true
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.serve(cmd.Context())
+		},
+	}
+	root.SetOut(c.stdout)
+	root.SetErr(c.stderr)
+
+	flags := root.PersistentFlags()
+	flags.StringVarP(&c.configFile, "config", "c", "", "config file, overriding "+configs.ConfigEnvVar+" and the search paths")
+	flags.StringVar(&c.profile, "profile", "", "config profile overlay, overriding "+configs.ProfileEnvVar)
+	flags.StringVarP(&c.output, "output", "o", outputTable, "output format: table, json or yaml")
+
+	root.AddCommand(
+		c.serveCommand(),
+		c.migrateCommand(),
+		c.userCommand(),
+		c.configCommand(),
+		c.auditCommand(),
+		c.healthCommand(),
+		c.versionCommand(),
+	)
+	return root
+}
+
+// execute runs the command selected by args until it finishes or ctx is
+// cancelled and returns the process exit code
+func (c *cli) execute(ctx context.Context, args []string) int {
+	root := c.rootCommand()
+	root.SetArgs(args)
+
+	err := root.ExecuteContext(ctx)
+	if err == nil {
+		return exitOK
+	}
+
+	if !c.ran {
+		fmt.Fprintf(c.stderr, "%v\nRun 'scrutiny --help' for usage.\n", err)
+		return exitUsage
+	}
+	fmt.Fprintln(c.stderr, err)
+	return exitError
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// run executes the command line with a fresh CLI and returns its exit
+// code and output
+func run(t *testing.T, c *cli, args ...string) (int, string, string) {
+	t.Helper()
+	// Keep the search paths away from config files in the working tree
+	t.Chdir(t.TempDir())
+	t.Setenv(configs.ConfigEnvVar, "")
+
+	var stdout, stderr bytes.Buffer
+	c.stdout, c.stderr = &stdout, &stderr
+	code := c.execute(context.Background(), args)
+	return code, stdout.String(), stderr.String()
+}
+
+// withMockUsers returns a CLI whose user commands use repo
+func withMockUsers(repo *service.MockUserRepository) *cli {
+	c := newCLI(nil, nil)
+	c.openUsers = func(context.Context, configs.Config, logger.Logger) (*userSession, error) {
+		return &userSession{users: service.NewUserService(repo)}, nil
+	}
+	return c
+}
+
+func TestCLI_Execute(t *testing.T) {
+	t.Run("Should print build information in the selected format", func(t *testing.T) {
+		code, stdout, _ := run(t, newCLI(nil, nil), "--output", "json", "version")
+		require.Equal(t, exitOK, code)
+
+		var info buildInfo
+		require.NoError(t, json.Unmarshal([]byte(stdout), &info))
+		assert.Equal(t, "dev", info.Version)
+		assert.NotEmpty(t, info.GoVersion)
+	})
+
+	t.Run("Should exit with a usage error for unknown commands and formats", func(t *testing.T) {
+		code, _, stderr := run(t, newCLI(nil, nil), "bogus")
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, `unknown command "bogus"`)
+
+		code, _, stderr = run(t, newCLI(nil, nil), "-o", "xml", "version")
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, "unknown output format")
+	})
+
+	t.Run("Should report invalid configuration", func(t *testing.T) {
+		t.Setenv("SCRUTINY_SERVER_PORT", "0")
+
+		code, _, stderr := run(t, newCLI(nil, nil), "config", "validate")
+
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr, "Server.Port")
+	})
+
+	t.Run("Should report serve setup failures instead of exiting", func(t *testing.T) {
+		t.Setenv("SCRUTINY_AUDIT_PATH", filepath.Join(t.TempDir(), "missing", "audit.log"))
+
+		code, _, stderr := run(t, newCLI(nil, nil), "serve")
+
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr, "failed to open audit log")
+	})
+}
+
+func TestCLI_User(t *testing.T) {
+	t.Run("Should list users as YAML", func(t *testing.T) {
+		repo := new(service.MockUserRepository)
+		opts := query.Options{Limit: 1, Filters: []query.Filter{{Field: "email", Op: query.OpContains, Value: "@example.com"}}}
+		repo.On("List", mock.Anything, opts).Return(query.Page[service.User]{
+			Items:      []service.User{{ID: 1, Name: "Ada", Email: "ada@example.com", Role: "admin", Active: true}},
+			NextCursor: "next",
+		}, nil)
+
+		code, stdout, stderr := run(t, withMockUsers(repo), "user", "list", "-o", "yaml", "--limit", "1", "--filter", "email~=@example.com")
+		require.Equal(t, exitOK, code, stderr)
+
+		var page struct {
+			Items      []map[string]interface{} `yaml:"items"`
+			NextCursor string                   `yaml:"next_cursor"`
+		}
+		require.NoError(t, yaml.Unmarshal([]byte(stdout), &page))
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "Ada", page.Items[0]["name"])
+		assert.Equal(t, "next", page.NextCursor)
+	})
+
+	t.Run("Should create users through the service", func(t *testing.T) {
+		repo := new(service.MockUserRepository)
+		repo.On("Create", mock.Anything, service.User{Name: "Ada", Email: "ada@example.com", Role: defaultRole, Active: true}).
+			Return(service.User{ID: 7, Name: "Ada", Email: "ada@example.com", Role: defaultRole, Active: true}, nil)
+
+		code, stdout, stderr := run(t, withMockUsers(repo), "user", "create", "--name", "Ada", "--email", "ada@example.com")
+		require.Equal(t, exitOK, code, stderr)
+
+		assert.Contains(t, stdout, "ada@example.com")
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("Should change the role of a user", func(t *testing.T) {
+		repo := new(service.MockUserRepository)
+		user := service.User{ID: 7, Name: "Ada", Email: "ada@example.com", Role: defaultRole, Active: true, Version: 1}
+		repo.On("FindByID", mock.Anything, 7).Return(user, nil)
+		repo.On("Update", mock.Anything, mock.MatchedBy(func(u service.User) bool { return u.Role == "admin" && u.Version == 1 })).
+			Return(service.User{ID: 7, Name: "Ada", Email: "ada@example.com", Role: "admin", Active: true, Version: 2}, nil)
+
+		code, _, stderr := run(t, withMockUsers(repo), "user", "set-role", "7", "admin")
+
+		require.Equal(t, exitOK, code, stderr)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("Should fail when the service fails", func(t *testing.T) {
+		repo := new(service.MockUserRepository)
+		repo.On("FindByID", mock.Anything, 7).Return(service.User{}, errors.New("user not found"))
+
+		code, _, stderr := run(t, withMockUsers(repo), "user", "deactivate", "7")
+
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr, "user not found")
+	})
+
+	t.Run("Should reject missing arguments as usage errors", func(t *testing.T) {
+		code, _, _ := run(t, withMockUsers(new(service.MockUserRepository)), "user", "deactivate")
+		assert.Equal(t, exitUsage, code)
+	})
+}
+
+func TestCLI_HealthCheck(t *testing.T) {
+	serve := func(status int, body string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("Should succeed when the server is ready", func(t *testing.T) {
+		server := serve(http.StatusOK, `{"status":"up","checks":[{"name":"disk","status":"up"}]}`)
+
+		code, stdout, _ := run(t, newCLI(nil, nil), "health", "check", "--url", server.URL)
+
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "disk")
+	})
+
+	t.Run("Should fail when the server is not ready", func(t *testing.T) {
+		server := serve(http.StatusServiceUnavailable, `{"status":"down","checks":[{"name":"database","status":"down","critical":true}]}`)
+
+		code, _, stderr := run(t, newCLI(nil, nil), "health", "check", "--url", server.URL)
+
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr, "not ready")
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/secrets"
+)
+
+// newSecretResolver creates the resolver for secret references in the
+// configuration, with the Vault backend enabled when it is configured
+func newSecretResolver(config configs.SecretsConfig, log logger.Logger) *secrets.Resolver {
+	opts := []secrets.Option{secrets.WithDefaultTTL(config.TTL)}
+	if config.Vault.Address != "" {
+		opts = append(opts, secrets.WithProvider(secrets.SchemeVault, secrets.NewVault(secrets.VaultConfig{
+			Address:   config.Vault.Address,
+			Token:     config.Vault.Token,
+			Namespace: config.Vault.Namespace,
+		})))
+	}
+	return secrets.NewResolver(log, opts...)
+}
+
+// resolveCredentials replaces secret references in the database username
+// and password with their current values
+func resolveCredentials(ctx context.Context, resolver *secrets.Resolver, config configs.DatabaseConfig) (configs.DatabaseConfig, error) {
+	username, err := resolver.Resolve(ctx, config.Username)
+	if err != nil {
+		return config, fmt.Errorf("database username: %w", err)
+	}
+	password, err := resolver.Resolve(ctx, config.Password)
+	if err != nil {
+		return config, fmt.Errorf("database password: %w", err)
+	}
+
+	config.Username = username
+	config.Password = password
+	return config, nil
+}
+
+// watchCredentials reconnects db whenever the secrets referenced by the
+// database username or password are rotated. It returns when ctx is
+// cancelled.
+func watchCredentials(ctx context.Context, resolver *secrets.Resolver, config configs.DatabaseConfig, db database.Connection, log logger.Logger) error {
+	reconnector, ok := db.(database.Reconnector)
+	if !ok {
+		return nil
+	}
+
+	refs := []string{config.Username, config.Password}
+	return resolver.Watch(ctx, refs, func(values map[string]string) error {
+		updated := config
+		if value, ok := values[config.Username]; ok {
+			updated.Username = value
+		}
+		if value, ok := values[config.Password]; ok {
+			updated.Password = value
+		}
+
+		if err := reconnector.Reconnect(databaseConfig(updated)); err != nil {
+			return fmt.Errorf("failed to reconnect with rotated database credentials: %w", err)
+		}
+		log.Info("Database credentials rotated")
+		return nil
+	})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/handler"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/repository"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/migrate"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/postgres"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/replica"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/health"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/metrics"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/server"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+	"github.com/spf13/cobra"
+
+	"github.com/gorilla/mux"
+)
+
+// serveCommand serves the HTTP API
+func (c *cli) serveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the HTTP API until interrupted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.serve(cmd.Context())
+		},
+	}
+}
+
+// serve runs the server until ctx is cancelled, then shuts down gracefully.
+// When setting up fails, what was set up so far is closed again.
+func (c *cli) serve(ctx context.Context) (err error) {
+	// Set up logger
+	log := logger.GetLogger()
+
+	// Load configuration
+	configManager, err := configs.NewManager(c.configOptions())
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	loaded := configManager.Current()
+	config := loaded.Config
+
+	// Apply the configured logging backend, output, redaction rules and
+	// levels before anything else is logged
+	logOutput, err := setupLogging(config.Logging)
+	if err != nil {
+		return fmt.Errorf("invalid logging configuration: %w", err)
+	}
+	log = logger.GetLogger()
+	log.WithField("files", loaded.Files).Info("Configuration loaded")
+
+	// Set up router
+	r := mux.NewRouter()
+	m := metrics.New()
+	srv := server.New(serverConfig(config.Server), r, log)
+	srv.RegisterCloser("log output", logOutput)
+	serving := false
+	defer func() {
+		if err != nil && !serving {
+			err = errors.Join(err, srv.Close())
+		}
+	}()
+
+	// Set up tracing
+	tp, err := tracing.NewProvider(ctx, tracing.Config{
+		Exporter:    config.Tracing.Exporter,
+		Endpoint:    config.Tracing.Endpoint,
+		Insecure:    config.Tracing.Insecure,
+		FilePath:    config.Tracing.FilePath,
+		ServiceName: config.Tracing.ServiceName,
+		SampleRatio: config.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	srv.Register("tracing", tp.Shutdown)
+
+	// Open the audit log
+	auditStore, err := audit.OpenFileStore(config.Audit.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	srv.RegisterCloser("audit log", auditStore)
+	auditRecorder := audit.NewRecorder(auditStore)
+
+	// Apply configuration changes without restarting
+	watchConfig(configManager, auditRecorder, log)
+	srv.RegisterCloser("config watcher", configManager)
+
+	healthRegistry := health.NewRegistry(config.Health.CacheTTL)
+	healthRegistry.Register(health.Check{
+		Name:    "disk",
+		Check:   health.DiskSpaceCheck(config.Health.DiskPath, config.Health.MinFreeDiskMB<<20),
+		Timeout: config.Health.Timeout,
+	})
+
+	deps := handler.Dependencies{
+		AuditStore: auditStore,
+		Readiness:  srv,
+		Health:     healthRegistry,
+		Metrics:    m,
+		AdminToken: config.Admin.Token,
+	}
+
+	// Connect to the database when one is configured
+	if config.Database.Host != "" {
+		// Credentials may be secret references, which are resolved now and
+		// watched for rotation while the server runs
+		resolver := newSecretResolver(config.Secrets, log.Named("secrets"))
+		credentials, err := resolveCredentials(ctx, resolver, config.Database)
+		if err != nil {
+			return fmt.Errorf("failed to resolve database credentials: %w", err)
+		}
+
+		db, err := openDatabase(ctx, credentials, log,
+			postgres.WithQueryObserver(m.ObserveQuery),
+			postgres.WithTracerProvider(tp),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		srv.RegisterCloser("database", db)
+		srv.Go("database credentials", func(ctx context.Context) error {
+			return watchCredentials(ctx, resolver, config.Database, db, log)
+		})
+		if router, ok := db.(*replica.Router); ok {
+			srv.Go("database replicas", func(ctx context.Context) error {
+				return router.Run(ctx, config.Database.ProbeInterval)
+			})
+		}
+
+		if stats, ok := db.(database.StatsProvider); ok {
+			if err := m.RegisterDatabase("primary", stats); err != nil {
+				return fmt.Errorf("failed to register database metrics: %w", err)
+			}
+		}
+
+		// Migration state and liveness are only meaningful on the primary
+		primary := primaryDatabase(db)
+		migrator, err := migrate.New(primary, repository.Migrations())
+		if err != nil {
+			return fmt.Errorf("failed to load migrations: %w", err)
+		}
+
+		healthRegistry.Register(health.Check{
+			Name:     "database",
+			Check:    health.DatabaseCheck(primary),
+			Timeout:  config.Health.Timeout,
+			Critical: true,
+		})
+		healthRegistry.Register(health.Check{
+			Name:     "migrations",
+			Check:    health.MigrationsCheck(migrator),
+			Timeout:  config.Health.Timeout,
+			Critical: true,
+		})
+
+		userRepo := repository.NewPostgresUserRepository(db, log, repositoryOptions(config.Database)...)
+		deps.UserService = service.NewUserService(userRepo,
+			service.WithAuditRecorder(auditRecorder),
+			service.WithMetrics(m.Users),
+			service.WithTracerProvider(tp),
+		)
+		deps.Teams = service.NewTeamService(
+			repository.NewPostgresTeamRepository(db, repositoryOptions(config.Database)...),
+			deps.UserService,
+			service.WithTeamAuditRecorder(auditRecorder),
+			service.WithTeamTracerProvider(tp),
+		)
+
+		invitations, err := newInvitationService(config, db, deps.UserService)
+		switch {
+		case errors.Is(err, errInvitationsDisabled):
+			log.Info("Invitations are disabled")
+		case err != nil:
+			return fmt.Errorf("failed to set up invitations: %w", err)
+		default:
+			deps.Invitations = invitations
+		}
+
+		if retention := config.Users.Retention; retention.Period > 0 {
+			users := deps.UserService
+			srv.Go("user retention", func(ctx context.Context) error {
+				return users.RunRetention(logger.WithContext(ctx, log), retentionPolicy(retention), retention.Interval)
+			})
+		}
+	} else {
+		log.Warn("No database configured, user endpoints are disabled")
+	}
+
+	// Register handlers
+	handler.RegisterHandlers(r, deps)
+
+	// Set up middleware
+	r.Use(handler.TracingMiddleware(tp))
+	r.Use(handler.RequestIDMiddleware)
+	r.Use(handler.LoggingMiddleware)
+	r.Use(handler.MetricsMiddleware(m))
+	r.Use(handler.AuditMiddleware(auditRecorder))
+	r.Use(handler.RecoveryMiddleware)
+	r.Use(handler.DatabaseSessionMiddleware)
+	r.Use(handler.QueryCounterMiddleware)
+
+	// Serve until ctx is cancelled, then shut down gracefully
+	serving = true
+	if err := srv.Run(ctx); err != nil {
+		return fmt.Errorf("server error: %w", err)
+	}
+	return nil
+}
+
+// retentionPolicy converts the retention settings into the service policy
+func retentionPolicy(config configs.RetentionConfig) service.RetentionPolicy {
+	return service.RetentionPolicy{
+		Period:    config.Period,
+		Mode:      service.RetentionMode(config.Mode),
+		BatchSize: config.BatchSize,
+	}
+}
+
+// serverConfig converts the application server settings into the
+// server lifecycle configuration
+func serverConfig(config configs.ServerConfig) server.Config {
+	timeout := time.Duration(config.Timeout) * time.Second
+
+	readTimeout := config.ReadTimeout
+	if readTimeout == 0 {
+		readTimeout = timeout
+	}
+	writeTimeout := config.WriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = timeout
+	}
+
+	return server.Config{
+		Addr:              fmt.Sprintf(":%d", config.Port),
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		DrainPeriod:       config.DrainPeriod,
+		ShutdownTimeout:   config.ShutdownTimeout,
+	}
+}
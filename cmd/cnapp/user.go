@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/robertfischer3/scrutiny_cnapp/configs"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/repository"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// defaultRole is the role given to users created without one
+const defaultRole = "user"
+
+// userSession is a user service together with the resources it holds
+type userSession struct {
+	users *service.UserService
+	// invitations is nil when invitations are disabled
+	invitations *service.InvitationService
+	close       func() error
+}
+
+// Close releases the resources held by the session
+func (s *userSession) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// openUserSession connects to the database and opens the audit log so
+// user changes made from the command line are recorded like API changes
+func openUserSession(ctx context.Context, config configs.Config, log logger.Logger) (*userSession, error) {
+	db, err := connectDatabase(ctx, config, log)
+	if err != nil {
+		return nil, err
+	}
+
+	auditStore, err := audit.OpenFileStore(config.Audit.Path)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	users := service.NewUserService(repository.NewPostgresUserRepository(db, log, repositoryOptions(config.Database)...),
+		service.WithAuditRecorder(audit.NewRecorder(auditStore)),
+	)
+	invitations, err := newInvitationService(config, db, users)
+	if err != nil && !errors.Is(err, errInvitationsDisabled) {
+		auditStore.Close()
+		db.Close()
+		return nil, err
+	}
+
+	return &userSession{
+		users:       users,
+		invitations: invitations,
+		close: func() error {
+			auditErr := auditStore.Close()
+			if err := db.Close(); err != nil {
+				return err
+			}
+			return auditErr
+		},
+	}, nil
+}
+
+// userCommand groups the user management commands
+func (c *cli) userCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage users",
+	}
+
+	var name, email, role string
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				created, err := users.CreateUser(ctx, service.User{Name: name, Email: email, Role: role, Active: true})
+				if err != nil {
+					return err
+				}
+				return c.printUsers(created, []service.User{created})
+			})
+		},
+	}
+	createCmd.Flags().StringVar(&name, "name", "", "name of the user")
+	createCmd.Flags().StringVar(&email, "email", "", "email address of the user")
+	createCmd.Flags().StringVar(&role, "role", defaultRole, "role of the user")
+	createCmd.MarkFlagRequired("name")
+	createCmd.MarkFlagRequired("email")
+
+	var opts query.Options
+	var sortExpr string
+	var filters []string
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List users a page at a time",
+		Example: "  scrutiny user list --filter role=admin --filter email~=@corp --sort -created_at\n" +
+			"  scrutiny user list --limit 20 --cursor <next cursor>",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sortExpr != "" {
+				sorts, err := query.ParseSort(sortExpr)
+				if err != nil {
+					return err
+				}
+				opts.Sort = sorts
+			}
+			for _, expr := range filters {
+				filter, err := query.ParseFilter(expr)
+				if err != nil {
+					return err
+				}
+				opts.Filters = append(opts.Filters, filter)
+			}
+
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				page, err := users.ListUsers(ctx, opts)
+				if err != nil {
+					return err
+				}
+				if err := c.printUsers(page, page.Items); err != nil {
+					return err
+				}
+				if page.NextCursor != "" && c.output == outputTable {
+					fmt.Fprintf(c.stderr, "More users follow, continue with --cursor %s\n", page.NextCursor)
+				}
+				return nil
+			})
+		},
+	}
+	listCmd.Flags().IntVar(&opts.Limit, "limit", 0, "maximum number of users to list")
+	listCmd.Flags().StringVar(&opts.Cursor, "cursor", "", "continue after the page that returned this cursor")
+	listCmd.Flags().StringVar(&sortExpr, "sort", "", "comma-separated fields to sort by, prefixed with - for descending order")
+	listCmd.Flags().StringArrayVar(&filters, "filter", nil, "only list users matching field=value, field!=value, field~=text, field>=value or field<=value")
+
+	deactivateCmd := &cobra.Command{
+		Use:   "deactivate <id>",
+		Short: "Deactivate a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseUserID(args[0])
+			if err != nil {
+				return err
+			}
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				if err := users.DeactivateUser(ctx, id); err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "User %d deactivated\n", id)
+				return nil
+			})
+		},
+	}
+
+	setRoleCmd := &cobra.Command{
+		Use:   "set-role <id> <role>",
+		Short: "Change the role of a user",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseUserID(args[0])
+			if err != nil {
+				return err
+			}
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				user, err := users.GetUserByID(ctx, id)
+				if err != nil {
+					return err
+				}
+				user.Role = args[1]
+				updated, err := users.UpdateUser(ctx, user)
+				if err != nil {
+					return err
+				}
+				return c.printUsers(updated, []service.User{updated})
+			})
+		},
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a user, who can be restored until the retention period ends",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseUserID(args[0])
+			if err != nil {
+				return err
+			}
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				if err := users.DeleteUser(ctx, id); err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "User %d deleted\n", id)
+				return nil
+			})
+		},
+	}
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore <id>",
+		Short: "Restore a deleted user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseUserID(args[0])
+			if err != nil {
+				return err
+			}
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				restored, err := users.RestoreUser(ctx, id)
+				if err != nil {
+					return err
+				}
+				return c.printUsers(restored, []service.User{restored})
+			})
+		},
+	}
+
+	retentionCmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Anonymize or purge users deleted longer than users.retention.period ago",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loaded, err := c.loadConfig()
+			if err != nil {
+				return err
+			}
+			retention := loaded.Config.Users.Retention
+			if retention.Period <= 0 {
+				return fmt.Errorf("retention is disabled, set users.retention.period")
+			}
+			return c.withUsers(cmd.Context(), func(ctx context.Context, users *service.UserService) error {
+				count, err := users.ApplyRetention(ctx, retentionPolicy(retention))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "Applied %s retention to %d users\n", retention.Mode, count)
+				return nil
+			})
+		},
+	}
+
+	var inviteName, inviteEmail, inviteRole string
+	inviteCmd := &cobra.Command{
+		Use:   "invite",
+		Short: "Create an inactive user and email them an invitation",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.withSession(cmd.Context(), func(ctx context.Context, session *userSession) error {
+				if session.invitations == nil {
+					return errInvitationsDisabled
+				}
+				invitation, err := session.invitations.Invite(ctx, service.User{Name: inviteName, Email: inviteEmail, Role: inviteRole})
+				if err != nil {
+					return err
+				}
+				tbl := &table{headers: []string{"ID", "USER", "EMAIL", "EXPIRES"}}
+				tbl.addRow(invitation.ID, invitation.UserID, invitation.Email, invitation.ExpiresAt)
+				return c.print(invitation, tbl)
+			})
+		},
+	}
+	inviteCmd.Flags().StringVar(&inviteName, "name", "", "name of the user")
+	inviteCmd.Flags().StringVar(&inviteEmail, "email", "", "email address the invitation is sent to")
+	inviteCmd.Flags().StringVar(&inviteRole, "role", defaultRole, "role of the user")
+	inviteCmd.MarkFlagRequired("name")
+	inviteCmd.MarkFlagRequired("email")
+
+	cmd.AddCommand(createCmd, listCmd, deactivateCmd, setRoleCmd, deleteCmd, restoreCmd, retentionCmd, inviteCmd)
+	return cmd
+}
+
+// withUsers loads the configuration, opens a user session and runs fn with
+// its user service
+func (c *cli) withUsers(ctx context.Context, fn func(ctx context.Context, users *service.UserService) error) error {
+	return c.withSession(ctx, func(ctx context.Context, session *userSession) error {
+		return fn(ctx, session.users)
+	})
+}
+
+// withSession loads the configuration, opens a user session and runs fn
+// with it
+func (c *cli) withSession(ctx context.Context, fn func(ctx context.Context, session *userSession) error) error {
+	loaded, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	log, err := c.logger(loaded.Config)
+	if err != nil {
+		return err
+	}
+
+	session, err := c.openUsers(ctx, loaded.Config, log)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return fn(ctx, session)
+}
+
+// printUsers writes users as a table, or value as JSON or YAML
+func (c *cli) printUsers(value interface{}, users []service.User) error {
+	tbl := &table{headers: []string{"ID", "NAME", "EMAIL", "ROLE", "ACTIVE", "CREATED"}}
+	for _, user := range users {
+		tbl.addRow(user.ID, user.Name, user.Email, user.Role, user.Active, user.CreatedAt)
+	}
+	return c.print(value, tbl)
+}
+
+// parseUserID parses a user ID argument
+func parseUserID(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid user ID %q", arg)
+	}
+	return id, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=abc123 -X main.buildDate=2024-01-02T15:04:05Z"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version   string `json:"version" yaml:"version"`
+	Commit    string `json:"commit" yaml:"commit"`
+	BuildDate string `json:"build_date" yaml:"build_date"`
+	GoVersion string `json:"go_version" yaml:"go_version"`
+	Platform  string `json:"platform" yaml:"platform"`
+}
+
+// currentBuildInfo returns the build information, falling back to the
+// version control details Go embeds when ldflags did not set them
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range embedded.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// versionCommand prints the build information
+func (c *cli) versionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and build information",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := currentBuildInfo()
+
+			tbl := &table{headers: []string{"KEY", "VALUE"}}
+			tbl.addRow("version", info.Version)
+			tbl.addRow("commit", info.Commit)
+			tbl.addRow("build date", info.BuildDate)
+			tbl.addRow("go version", info.GoVersion)
+			tbl.addRow("platform", info.Platform)
+			return c.print(info, tbl)
+		},
+	}
+}
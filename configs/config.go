@@ -1,45 +1,252 @@
 package configs
 
 import (
-    "github.com/spf13/viper"
+	"time"
 )
 
-// Config holds all configuration for our application
+// Config holds all configuration for our application.
+//
+// Settings tagged reload:"restart", or inside a section tagged so, are only
+// read at startup. Changing them in a running process is reported as
+// requiring a restart.
 type Config struct {
-    Server   ServerConfig
-    Database DatabaseConfig
-    // Add other configurations as needed
+	Server   ServerConfig   `reload:"restart"`
+	Database DatabaseConfig `reload:"restart"`
+	Audit    AuditConfig    `reload:"restart"`
+	Health   HealthConfig   `reload:"restart"`
+	Tracing  TracingConfig  `reload:"restart"`
+	Logging  LoggingConfig
+	Admin    AdminConfig   `reload:"restart"`
+	Secrets  SecretsConfig `reload:"restart"`
+	Users    UsersConfig   `reload:"restart"`
+	Mail     MailConfig    `reload:"restart"`
+	// Add other configurations as needed
 }
 
 // ServerConfig holds all server-related configuration
 type ServerConfig struct {
-    Port    int
-    Timeout int
+	Port int `validate:"min=1,max=65535"`
+	// Timeout is the read and write timeout in seconds, used when
+	// ReadTimeout or WriteTimeout are not set
+	Timeout           int           `validate:"min=0"`
+	ReadTimeout       time.Duration `validate:"min=0"`
+	ReadHeaderTimeout time.Duration `validate:"min=0"`
+	WriteTimeout      time.Duration `validate:"min=0"`
+	IdleTimeout       time.Duration `validate:"min=0"`
+	// DrainPeriod is how long readiness fails before the server stops
+	// accepting connections on shutdown
+	DrainPeriod     time.Duration `validate:"min=0"`
+	ShutdownTimeout time.Duration `validate:"min=0"`
 }
 
 // DatabaseConfig holds all database-related configuration
 type DatabaseConfig struct {
-    Host     string
-    Port     int
-    Username string
-    Password string
-    Database string
+	// Host is the database server. The user API is disabled when empty.
+	Host string
+	Port int `validate:"min=1,max=65535"`
+	// Username and Password may be secret references such as
+	// secret://file/run/secrets/db_password or vault://secret/data/db#password,
+	// which are refreshed while the server runs
+	Username        string `validate:"required_with=Host"`
+	Password        string
+	Database        string        `validate:"required_with=Host"`
+	SSLMode         string        `validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"`
+	MaxOpenConns    int           `validate:"min=0"`
+	MaxIdleConns    int           `validate:"min=0"`
+	ConnMaxLifetime time.Duration `validate:"min=0"`
+	// QueryTimeout bounds each repository operation. A shorter request
+	// deadline takes precedence.
+	QueryTimeout time.Duration `validate:"min=0"`
+	// QueryTimeouts overrides QueryTimeout per operation, keyed by query
+	// name such as "users.list"
+	QueryTimeouts map[string]time.Duration `validate:"dive,min=0"`
+	// FailoverHosts are tried in order when Host stops answering health
+	// checks. Credential rotation is not applied while failover hosts or
+	// replicas are configured.
+	FailoverHosts []string
+	// Replicas are read replica hosts which receive queries outside of
+	// transactions
+	Replicas []string
+	// ReplicaBalancer chooses among healthy replicas
+	ReplicaBalancer string `validate:"omitempty,oneof=round-robin least-latency"`
+	// MaxReplicaLag excludes replicas lagging further behind the primary.
+	// Zero disables the lag check.
+	MaxReplicaLag time.Duration `validate:"min=0"`
+	// ProbeInterval is how often the primary and replicas are health
+	// checked
+	ProbeInterval time.Duration `validate:"min=0"`
+	// SlowQueryThreshold logs statements taking at least as long as
+	// warnings. Zero disables the log.
+	SlowQueryThreshold time.Duration `validate:"min=0"`
+	// QueryLimit fails requests running more statements, to catch N+1
+	// query patterns. Zero disables the limit.
+	QueryLimit int `validate:"min=0"`
+	// ChangeChannel is the LISTEN/NOTIFY channel repositories publish
+	// their changes on. Empty disables publishing.
+	ChangeChannel string `validate:"max=63"`
 }
 
-// LoadConfig reads configuration from files or environment variables
+// AuditConfig holds all audit log configuration
+type AuditConfig struct {
+	// Path is the JSON Lines file the hash-chained audit log is written to
+	Path string `validate:"required"`
+}
+
+// HealthConfig holds all health check configuration
+type HealthConfig struct {
+	// CacheTTL is how long check results are reused between probes
+	CacheTTL time.Duration
+	// Timeout bounds each individual check
+	Timeout time.Duration `validate:"min=0"`
+	// DiskPath is the filesystem checked for free space
+	DiskPath string `validate:"required"`
+	// MinFreeDiskMB is the free space below which the disk check fails
+	MinFreeDiskMB uint64
+}
+
+// TracingConfig holds all OpenTelemetry tracing configuration
+type TracingConfig struct {
+	// Exporter is one of none, stdout, file or otlphttp
+	Exporter    string `validate:"oneof=none stdout file otlphttp"`
+	Endpoint    string
+	Insecure    bool
+	FilePath    string  `validate:"required_if=Exporter file"`
+	ServiceName string  `validate:"required"`
+	SampleRatio float64 `validate:"min=0,max=1"`
+}
+
+// LoggingConfig holds all logging configuration
+type LoggingConfig struct {
+	// RedactFields are additional field names whose values are redacted
+	RedactFields []string
+	// HashEmails logs a keyed hash of email addresses instead of removing them
+	HashEmails   bool
+	EmailHashKey string `validate:"required_if=HashEmails true"`
+	// Level is the root log level
+	Level string `validate:"omitempty,oneof=debug info warn error fatal"`
+	// Levels overrides the level of named loggers such as "database.postgres"
+	Levels map[string]string `validate:"dive,oneof=debug info warn error fatal"`
+	// Backend is logrus (the default) or slog
+	Backend string `validate:"oneof=logrus slog" reload:"restart"`
+	// Format is json (the default) or text
+	Format string `validate:"oneof=json text" reload:"restart"`
+	// Output is stdout (the default), stderr, file or syslog
+	Output string         `validate:"oneof=stdout stderr file syslog" reload:"restart"`
+	File   LogFileConfig  `reload:"restart"`
+	Syslog SyslogConfig   `reload:"restart"`
+	Async  LogAsyncConfig `reload:"restart"`
+}
+
+// LogFileConfig holds the settings of the rotating log file output
+type LogFileConfig struct {
+	Path       string
+	MaxSizeMB  int `validate:"min=0"`
+	MaxAgeDays int `validate:"min=0"`
+	MaxBackups int `validate:"min=0"`
+	Compress   bool
+}
+
+// SyslogConfig holds the settings of the syslog output
+type SyslogConfig struct {
+	// Network is udp, tcp or tls
+	Network  string `validate:"omitempty,oneof=udp tcp tls"`
+	Address  string `validate:"omitempty,hostname_port"`
+	Facility int    `validate:"min=0,max=23"`
+	AppName  string
+	// CAFile verifies the server certificate when Network is tls
+	CAFile string `validate:"omitempty,file"`
+}
+
+// LogAsyncConfig holds the settings of the buffered asynchronous writer
+type LogAsyncConfig struct {
+	Enabled    bool
+	BufferSize int `validate:"min=0"`
+	// DropPolicy is block, drop_newest (the default) or drop_oldest
+	DropPolicy string `validate:"omitempty,oneof=block drop_newest drop_oldest"`
+}
+
+// AdminConfig holds all admin API configuration
+type AdminConfig struct {
+	// Token is the bearer token required by the admin endpoints, which are
+	// disabled when it is empty
+	Token string `validate:"omitempty,min=16"`
+}
+
+// SecretsConfig holds the settings used to resolve secret references
+type SecretsConfig struct {
+	// TTL is how long secrets without their own lease are cached before
+	// they are read again
+	TTL   time.Duration `validate:"min=0"`
+	Vault VaultConfig
+}
+
+// VaultConfig holds the settings of the Vault secrets backend, which is
+// enabled when Address is set
+type VaultConfig struct {
+	Address   string `validate:"omitempty,url"`
+	Token     string `validate:"required_with=Address"`
+	Namespace string
+}
+
+// UsersConfig holds user management configuration
+type UsersConfig struct {
+	Retention   RetentionConfig
+	Invitations InvitationConfig
+}
+
+// RetentionConfig holds the settings of the job that anonymizes or purges
+// deleted users
+type RetentionConfig struct {
+	// Period is how long deleted users can be restored before the job
+	// handles them. The job is disabled when it is zero.
+	Period time.Duration `validate:"min=0"`
+	// Mode is anonymize, which keeps the rows so references to the users
+	// stay valid, or purge
+	Mode      string        `validate:"oneof=anonymize purge"`
+	Interval  time.Duration `validate:"gt=0"`
+	BatchSize int           `validate:"min=1"`
+}
+
+// InvitationConfig holds the settings of user invitations
+type InvitationConfig struct {
+	// Secret signs invitation tokens. Invitations are disabled when it is
+	// empty or no mail driver is configured.
+	Secret string        `validate:"omitempty,min=32"`
+	TTL    time.Duration `validate:"gt=0"`
+	// AcceptURL is the page invitation emails link to. It receives the
+	// token in the token query parameter.
+	AcceptURL string `validate:"omitempty,url"`
+}
+
+// MailConfig holds the settings used to send email
+type MailConfig struct {
+	// Driver is smtp, file, which writes messages to Dir, memory, which
+	// keeps them in the process for tests, or none
+	Driver string `validate:"oneof=none smtp file memory"`
+	// From is the sender of every message, such as
+	// "Scrutiny <noreply@example.com>"
+	From string
+	Dir  string
+	SMTP SMTPConfig
+}
+
+// SMTPConfig holds the settings of the SMTP server used by the smtp driver
+type SMTPConfig struct {
+	Host     string
+	Port     int `validate:"min=0,max=65535"`
+	Username string
+	Password string
+	// TLS is starttls, tls for implicit TLS, or none for local relays
+	TLS     string        `validate:"oneof=starttls tls none"`
+	Timeout time.Duration `validate:"min=0"`
+}
+
+// LoadConfig reads configuration from the config file in path, if there is
+// one, and environment variables, and validates the result
 func LoadConfig(path string) (config Config, err error) {
-    viper.AddConfigPath(path)
-    viper.SetConfigName("config")
-    viper.SetConfigType("yaml")
-    
-    // Also read from environment variables
-    viper.AutomaticEnv()
-    
-    err = viper.ReadInConfig()
-    if err != nil {
-        return
-    }
-    
-    err = viper.Unmarshal(&config)
-    return
-}
\ No newline at end of file
+	loaded, err := Load(Options{SearchPaths: []string{path}})
+	if err != nil {
+		return
+	}
+	return loaded.Config, nil
+}
@@ -0,0 +1,149 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfig writes a config.yaml with contents to a new directory
+func writeConfig(t *testing.T, contents string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(contents), 0o600))
+	return dir
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Run("Should not require a config file", func(t *testing.T) {
+		loaded, err := Load(Options{SearchPaths: []string{t.TempDir()}})
+		require.NoError(t, err)
+
+		assert.Empty(t, loaded.Files)
+		assert.Equal(t, 8080, loaded.Config.Server.Port)
+		assert.Equal(t, 5*time.Second, loaded.Config.Health.CacheTTL)
+		assert.Equal(t, "audit.log", loaded.Config.Audit.Path)
+		assert.Equal(t, Source{Kind: SourceDefault}, loaded.Sources["server.port"])
+	})
+
+	t.Run("Should report malformed config files", func(t *testing.T) {
+		_, err := Load(Options{SearchPaths: []string{writeConfig(t, "server: [unclosed")}})
+		assert.Error(t, err)
+	})
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := writeConfig(t, `
+server:
+  port: 9000
+  readTimeout: 10s
+database:
+  queryTimeouts:
+    users.list: 2s
+logging:
+  levels:
+    database.postgres: debug
+`)
+
+	t.Run("Should read values from the config file", func(t *testing.T) {
+		loaded, err := Load(Options{SearchPaths: []string{dir}})
+		require.NoError(t, err)
+
+		assert.Equal(t, 9000, loaded.Config.Server.Port)
+		assert.Equal(t, 10*time.Second, loaded.Config.Server.ReadTimeout)
+		assert.Equal(t, map[string]string{"database.postgres": "debug"}, loaded.Config.Logging.Levels)
+		assert.Equal(t, map[string]time.Duration{"users.list": 2 * time.Second}, loaded.Config.Database.QueryTimeouts)
+		assert.Equal(t, SourceFile, loaded.Sources["server.port"].Kind)
+	})
+
+	t.Run("Should override nested keys from the environment", func(t *testing.T) {
+		t.Setenv("SCRUTINY_SERVER_PORT", "9100")
+		t.Setenv("SCRUTINY_DATABASE_HOST", "db.internal")
+		t.Setenv("SCRUTINY_DATABASE_USERNAME", "scrutiny")
+		t.Setenv("SCRUTINY_DATABASE_DATABASE", "scrutiny")
+		t.Setenv("SCRUTINY_LOGGING_REDACTFIELDS", "ssn,iban")
+
+		loaded, err := Load(Options{SearchPaths: []string{dir}})
+		require.NoError(t, err)
+
+		assert.Equal(t, 9100, loaded.Config.Server.Port)
+		assert.Equal(t, "db.internal", loaded.Config.Database.Host)
+		assert.Equal(t, []string{"ssn", "iban"}, loaded.Config.Logging.RedactFields)
+		assert.Equal(t, Source{Kind: SourceEnv, Name: "SCRUTINY_SERVER_PORT"}, loaded.Sources["server.port"])
+	})
+
+	t.Run("Should read secrets from _FILE variables", func(t *testing.T) {
+		secret := filepath.Join(t.TempDir(), "password")
+		require.NoError(t, os.WriteFile(secret, []byte("s3cret\n"), 0o600))
+		t.Setenv("SCRUTINY_DATABASE_PASSWORD_FILE", secret)
+
+		loaded, err := Load(Options{SearchPaths: []string{dir}})
+		require.NoError(t, err)
+
+		assert.Equal(t, "s3cret", loaded.Config.Database.Password)
+		assert.Equal(t, Source{Kind: SourceSecretFile, Name: "SCRUTINY_DATABASE_PASSWORD_FILE"}, loaded.Sources["database.password"])
+
+		t.Setenv("SCRUTINY_DATABASE_PASSWORD", "other")
+		_, err = Load(Options{SearchPaths: []string{dir}})
+		assert.ErrorContains(t, err, "only one of SCRUTINY_DATABASE_PASSWORD and SCRUTINY_DATABASE_PASSWORD_FILE")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Should report every invalid setting", func(t *testing.T) {
+		dir := writeConfig(t, `
+server:
+  port: 70000
+tracing:
+  exporter: jaeger
+  sampleRatio: 2
+logging:
+  output: file
+  levels:
+    handler: loud
+admin:
+  token: short
+`)
+
+		_, err := Load(Options{SearchPaths: []string{dir}})
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+
+		assert.ElementsMatch(t, []string{
+			"Server.Port must be at most 65535, got 70000",
+			"Tracing.Exporter must be one of none, stdout, file, otlphttp, got \"jaeger\"",
+			"Tracing.SampleRatio must be at most 1, got 2",
+			"Logging.Levels[handler] must be one of debug, info, warn, error, fatal, got \"loud\"",
+			"Logging.File.Path is required when Output is file",
+			"Admin.Token must be at least 16 characters long",
+		}, validationErr.Problems)
+		assert.NotContains(t, err.Error(), "short")
+	})
+
+	t.Run("Should require credentials once a database host is set", func(t *testing.T) {
+		t.Setenv("SCRUTINY_DATABASE_HOST", "db.internal")
+
+		_, err := Load(Options{SearchPaths: []string{t.TempDir()}})
+		assert.ErrorContains(t, err, "Database.Username is required when Host is set")
+	})
+}
+
+func TestLoaded_Settings(t *testing.T) {
+	t.Setenv("SCRUTINY_ADMIN_TOKEN", "0123456789abcdef")
+	loaded, err := Load(Options{SearchPaths: []string{t.TempDir()}})
+	require.NoError(t, err)
+
+	settings := loaded.Settings()
+	require.NotEmpty(t, settings)
+	for _, setting := range settings {
+		if setting.Key == "admin.token" {
+			assert.Equal(t, "0123456789abcdef", setting.Value)
+			assert.Equal(t, "env SCRUTINY_ADMIN_TOKEN", setting.Source.String())
+			return
+		}
+	}
+	t.Fatal("admin.token not found")
+}
@@ -0,0 +1,69 @@
+package configs
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaults holds the value of every setting not provided by a config file
+// or the environment. Keys use the same dotted form as Loaded.Sources.
+var defaults = map[string]interface{}{
+	"server.port":              8080,
+	"server.timeout":           30,
+	"server.readheadertimeout": 5 * time.Second,
+	"server.idletimeout":       60 * time.Second,
+	"server.shutdowntimeout":   15 * time.Second,
+
+	"database.port":               5432,
+	"database.maxopenconns":       25,
+	"database.maxidleconns":       5,
+	"database.connmaxlifetime":    5 * time.Minute,
+	"database.querytimeout":       5 * time.Second,
+	"database.replicabalancer":    "round-robin",
+	"database.probeinterval":      10 * time.Second,
+	"database.slowquerythreshold": 500 * time.Millisecond,
+
+	"audit.path": "audit.log",
+
+	"health.cachettl":      5 * time.Second,
+	"health.timeout":       2 * time.Second,
+	"health.diskpath":      ".",
+	"health.minfreediskmb": 100,
+
+	"tracing.exporter":    "none",
+	"tracing.servicename": "scrutiny",
+	"tracing.sampleratio": 1.0,
+
+	"secrets.ttl": 5 * time.Minute,
+
+	"users.retention.mode":      "anonymize",
+	"users.retention.interval":  time.Hour,
+	"users.retention.batchsize": 500,
+	"users.invitations.ttl":     72 * time.Hour,
+
+	"mail.driver":       "none",
+	"mail.from":         "noreply@localhost",
+	"mail.dir":          "mail",
+	"mail.smtp.port":    587,
+	"mail.smtp.tls":     "starttls",
+	"mail.smtp.timeout": 30 * time.Second,
+
+	"logging.backend":          "logrus",
+	"logging.format":           "json",
+	"logging.output":           "stdout",
+	"logging.file.maxsizemb":   100,
+	"logging.file.maxagedays":  28,
+	"logging.file.maxbackups":  7,
+	"logging.syslog.network":   "udp",
+	"logging.syslog.facility":  16,
+	"logging.async.buffersize": 1024,
+	"logging.async.droppolicy": "drop_newest",
+}
+
+// setDefaults registers the defaults with v
+func setDefaults(v *viper.Viper) {
+	for key, value := range defaults {
+		v.SetDefault(viperKey(key), value)
+	}
+}
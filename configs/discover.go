@@ -0,0 +1,133 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables controlling config discovery
+const (
+	// ConfigEnvVar names an explicit config file
+	ConfigEnvVar = EnvPrefix + "_CONFIG"
+	// ProfileEnvVar selects the environment profile overlay
+	ProfileEnvVar = EnvPrefix + "_PROFILE"
+)
+
+// configName is the base name of config files found in search paths
+const configName = "config"
+
+// Extensions lists the supported config file formats, in the order they
+// are tried within a directory
+var Extensions = []string{".yaml", ".yml", ".json", ".toml"}
+
+// Options controls where configuration is loaded from
+type Options struct {
+	// File is an explicit config file, usually from --config. It takes
+	// precedence over SCRUTINY_CONFIG and the search paths.
+	File string
+	// Profile selects an overlay such as config.production.yaml, read from
+	// the same directory as the base file. It defaults to SCRUTINY_PROFILE.
+	Profile string
+	// SearchPaths are the directories searched, in order, when no file is
+	// named explicitly. They default to SearchPaths().
+	SearchPaths []string
+}
+
+// SearchPaths returns the default config directories in precedence order:
+// the XDG config directory, /etc/scrutiny, then the working directory and
+// its configs subdirectory
+func SearchPaths() []string {
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "scrutiny"))
+	}
+	return append(paths, "/etc/scrutiny", ".", "configs")
+}
+
+// Discover returns the config files to load, base file first followed by
+// the profile overlay, if any. It returns no files when nothing was found
+// in the search paths, but an explicitly named file must exist.
+func Discover(opts Options) ([]string, error) {
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv(ProfileEnvVar)
+	}
+	if strings.ContainsAny(profile, `/\`) || strings.HasPrefix(profile, ".") {
+		return nil, fmt.Errorf("invalid config profile %q", profile)
+	}
+
+	base, err := discoverBase(opts)
+	if err != nil || base == "" {
+		return nil, err
+	}
+	files := []string{base}
+
+	if profile != "" {
+		if overlay, ok := findOverlay(base, profile); ok {
+			files = append(files, overlay)
+		}
+	}
+	return files, nil
+}
+
+// discoverBase finds the base config file
+func discoverBase(opts Options) (string, error) {
+	explicit, origin := opts.File, "--config"
+	if explicit == "" {
+		explicit, origin = os.Getenv(ConfigEnvVar), ConfigEnvVar
+	}
+	if explicit != "" {
+		if !supported(explicit) {
+			return "", fmt.Errorf("%s: unsupported config format %q", origin, filepath.Ext(explicit))
+		}
+		if _, err := os.Stat(explicit); err != nil {
+			return "", fmt.Errorf("%s: %w", origin, err)
+		}
+		return explicit, nil
+	}
+
+	paths := opts.SearchPaths
+	if paths == nil {
+		paths = SearchPaths()
+	}
+	for _, dir := range paths {
+		for _, ext := range Extensions {
+			file := filepath.Join(dir, configName+ext)
+			info, err := os.Stat(file)
+			if err == nil && !info.IsDir() {
+				return file, nil
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+	return "", nil
+}
+
+// findOverlay returns the profile overlay next to base. The overlay may
+// use a different format than the base file.
+func findOverlay(base, profile string) (string, bool) {
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, ext := range Extensions {
+		file := stem + "." + profile + ext
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// supported reports whether file has a supported config extension
+func supported(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, supported := range Extensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile writes contents to name in dir and returns its path
+func writeFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+// clearDiscoveryEnv unsets the discovery variables for the test
+func clearDiscoveryEnv(t *testing.T) {
+	t.Setenv(ConfigEnvVar, "")
+	t.Setenv(ProfileEnvVar, "")
+}
+
+func TestDiscover_Precedence(t *testing.T) {
+	clearDiscoveryEnv(t)
+	first, second := t.TempDir(), t.TempDir()
+	firstFile := writeFile(t, first, "config.yaml", "server:\n  port: 9001\n")
+	secondFile := writeFile(t, second, "config.yaml", "server:\n  port: 9002\n")
+	explicit := writeFile(t, t.TempDir(), "scrutiny.yaml", "server:\n  port: 9003\n")
+	fromEnv := writeFile(t, t.TempDir(), "scrutiny.json", `{"server": {"port": 9004}}`)
+	paths := []string{first, second}
+
+	t.Run("Should use the first search path containing a config file", func(t *testing.T) {
+		files, err := Discover(Options{SearchPaths: paths})
+		require.NoError(t, err)
+		assert.Equal(t, []string{firstFile}, files)
+
+		files, err = Discover(Options{SearchPaths: []string{t.TempDir(), second}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{secondFile}, files)
+	})
+
+	t.Run("Should prefer SCRUTINY_CONFIG over the search paths", func(t *testing.T) {
+		t.Setenv(ConfigEnvVar, fromEnv)
+
+		files, err := Discover(Options{SearchPaths: paths})
+		require.NoError(t, err)
+		assert.Equal(t, []string{fromEnv}, files)
+	})
+
+	t.Run("Should prefer --config over SCRUTINY_CONFIG", func(t *testing.T) {
+		t.Setenv(ConfigEnvVar, fromEnv)
+
+		files, err := Discover(Options{File: explicit, SearchPaths: paths})
+		require.NoError(t, err)
+		assert.Equal(t, []string{explicit}, files)
+	})
+
+	t.Run("Should fail when an explicit file is missing or unsupported", func(t *testing.T) {
+		_, err := Discover(Options{File: filepath.Join(first, "missing.yaml")})
+		assert.ErrorContains(t, err, "--config")
+
+		t.Setenv(ConfigEnvVar, filepath.Join(first, "missing.yaml"))
+		_, err = Discover(Options{})
+		assert.ErrorContains(t, err, ConfigEnvVar)
+
+		_, err = Discover(Options{File: writeFile(t, first, "config.ini", "")})
+		assert.ErrorContains(t, err, "unsupported config format")
+	})
+
+	t.Run("Should return no files when nothing is found", func(t *testing.T) {
+		files, err := Discover(Options{SearchPaths: []string{t.TempDir()}})
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+}
+
+func TestDiscover_Formats(t *testing.T) {
+	clearDiscoveryEnv(t)
+
+	t.Run("Should prefer yaml over json and toml in the same directory", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "config.toml", "")
+		writeFile(t, dir, "config.json", "{}")
+		yaml := writeFile(t, dir, "config.yaml", "")
+
+		files, err := Discover(Options{SearchPaths: []string{dir}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{yaml}, files)
+	})
+
+	for name, contents := range map[string]string{
+		"config.yml":  "server:\n  port: 9100\n",
+		"config.json": `{"server": {"port": 9100}}`,
+		"config.toml": "[server]\nport = 9100\n",
+	} {
+		t.Run("Should load "+filepath.Ext(name)+" files", func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, name, contents)
+
+			loaded, err := Load(Options{SearchPaths: []string{dir}})
+			require.NoError(t, err)
+			assert.Equal(t, 9100, loaded.Config.Server.Port)
+		})
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	clearDiscoveryEnv(t)
+	dir := t.TempDir()
+	base := writeFile(t, dir, "config.yaml", `
+server:
+  port: 9000
+  timeout: 45
+logging:
+  levels:
+    handler: info
+`)
+	overlay := writeFile(t, dir, "config.production.toml", `
+[server]
+port = 443
+
+[logging.levels]
+"database.postgres" = "warn"
+`)
+
+	t.Run("Should layer the profile overlay over the base file", func(t *testing.T) {
+		loaded, err := Load(Options{SearchPaths: []string{dir}, Profile: "production"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{base, overlay}, loaded.Files)
+		assert.Equal(t, 443, loaded.Config.Server.Port)
+		assert.Equal(t, 45, loaded.Config.Server.Timeout)
+		assert.Equal(t, map[string]string{"handler": "info", "database.postgres": "warn"}, loaded.Config.Logging.Levels)
+		assert.Equal(t, Source{Kind: SourceFile, Name: overlay}, loaded.Sources["server.port"])
+		assert.Equal(t, Source{Kind: SourceFile, Name: base}, loaded.Sources["server.timeout"])
+	})
+
+	t.Run("Should read the profile from SCRUTINY_PROFILE", func(t *testing.T) {
+		t.Setenv(ProfileEnvVar, "production")
+
+		loaded, err := Load(Options{SearchPaths: []string{dir}})
+		require.NoError(t, err)
+		assert.Equal(t, 443, loaded.Config.Server.Port)
+	})
+
+	t.Run("Should let the environment override the profile", func(t *testing.T) {
+		t.Setenv("SCRUTINY_SERVER_PORT", "8443")
+
+		loaded, err := Load(Options{SearchPaths: []string{dir}, Profile: "production"})
+		require.NoError(t, err)
+		assert.Equal(t, 8443, loaded.Config.Server.Port)
+	})
+
+	t.Run("Should ignore a profile without an overlay", func(t *testing.T) {
+		loaded, err := Load(Options{SearchPaths: []string{dir}, Profile: "staging"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{base}, loaded.Files)
+	})
+
+	t.Run("Should reject profiles containing paths", func(t *testing.T) {
+		_, err := Discover(Options{SearchPaths: []string{dir}, Profile: "../production"})
+		assert.Error(t, err)
+	})
+}
+
+func TestSearchPaths_Order(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG_CONFIG_HOME is only used on Linux")
+	}
+	clearDiscoveryEnv(t)
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+
+	paths := SearchPaths()
+	assert.Equal(t, []string{filepath.Join(xdg, "scrutiny"), "/etc/scrutiny", ".", "configs"}, paths)
+
+	t.Run("Should prefer the XDG directory over the working directory", func(t *testing.T) {
+		wd := t.TempDir()
+		t.Chdir(wd)
+		writeFile(t, wd, "config.yaml", "")
+		require.NoError(t, os.MkdirAll(filepath.Join(xdg, "scrutiny"), 0o700))
+		xdgFile := writeFile(t, filepath.Join(xdg, "scrutiny"), "config.yaml", "")
+
+		files, err := Discover(Options{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{xdgFile}, files)
+	})
+
+	t.Run("Should fall back to the working directory", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+		wd := t.TempDir()
+		t.Chdir(wd)
+		require.NoError(t, os.Mkdir(filepath.Join(wd, "configs"), 0o700))
+		writeFile(t, filepath.Join(wd, "configs"), "config.yaml", "")
+
+		files, err := Discover(Options{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join("configs", "config.yaml")}, files)
+	})
+}
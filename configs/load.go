@@ -0,0 +1,223 @@
+package configs
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables settings are read from, so
+// database.host is read from SCRUTINY_DATABASE_HOST
+const EnvPrefix = "SCRUTINY"
+
+// SecretFileSuffix marks an environment variable holding the path of a
+// file with the setting's value, as mounted by Docker and Kubernetes secrets
+const SecretFileSuffix = "_FILE"
+
+// keyDelimiter separates nested viper keys. The default "." would split
+// map keys such as logger names, so a delimiter that cannot appear in
+// them is used instead.
+const keyDelimiter = "::"
+
+// Kinds of configuration sources
+const (
+	SourceDefault    = "default"
+	SourceFile       = "file"
+	SourceEnv        = "env"
+	SourceSecretFile = "secret file"
+)
+
+// Source describes where the effective value of a setting came from
+type Source struct {
+	// Kind is one of SourceDefault, SourceFile, SourceEnv or SourceSecretFile
+	Kind string
+	// Name is the file or environment variable the value was read from
+	Name string
+}
+
+// String returns the kind followed by the name, if any
+func (s Source) String() string {
+	if s.Name == "" {
+		return s.Kind
+	}
+	return s.Kind + " " + s.Name
+}
+
+// Setting is the effective value of a single setting
+type Setting struct {
+	Key    string
+	Value  interface{}
+	Source Source
+}
+
+// Loaded is a validated configuration together with its origin
+type Loaded struct {
+	Config Config
+	// Files are the config files that were read, base file first, empty
+	// when none was found
+	Files []string
+	// Sources records where each setting came from, keyed by dotted,
+	// lower-case setting name such as "database.host"
+	Sources map[string]Source
+}
+
+// Settings returns every setting with its effective value, sorted by key
+func (l *Loaded) Settings() []Setting {
+	var settings []Setting
+	walk(reflect.ValueOf(l.Config), "", func(key string, value reflect.Value) {
+		source, ok := l.Sources[key]
+		if !ok {
+			source = Source{Kind: SourceDefault}
+		}
+		settings = append(settings, Setting{Key: key, Value: value.Interface(), Source: source})
+	})
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+	return settings
+}
+
+// Load discovers and reads the config files described by opts, applies
+// defaults and environment overrides, and validates the result. Later
+// sources take precedence: defaults, the base file, the profile overlay,
+// environment variables and finally secret files.
+func Load(opts Options) (*Loaded, error) {
+	files, err := Discover(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	v := viper.NewWithOptions(viper.KeyDelimiter(keyDelimiter))
+	setDefaults(v)
+
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(keyDelimiter, "_"))
+	v.AutomaticEnv()
+
+	loaded := &Loaded{Files: files, Sources: make(map[string]Source)}
+	layers := make([]*viper.Viper, len(files))
+	for i, file := range files {
+		layer := viper.NewWithOptions(viper.KeyDelimiter(keyDelimiter))
+		layer.SetConfigFile(file)
+		if err := layer.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", file, err)
+		}
+		if err := v.MergeConfigMap(layer.AllSettings()); err != nil {
+			return nil, fmt.Errorf("failed to merge config file %s: %w", file, err)
+		}
+		layers[i] = layer
+	}
+
+	var problems []string
+	walk(reflect.ValueOf(Config{}), "", func(key string, value reflect.Value) {
+		source, err := applyEnv(v, key, value.Kind())
+		if err != nil {
+			problems = append(problems, err.Error())
+			return
+		}
+		if source.Kind == SourceDefault {
+			// The last file setting the key wins
+			for i := len(layers) - 1; i >= 0; i-- {
+				if layers[i].InConfig(viperKey(key)) {
+					source = Source{Kind: SourceFile, Name: files[i]}
+					break
+				}
+			}
+		}
+		loaded.Sources[key] = source
+	})
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	if err := v.Unmarshal(&loaded.Config); err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	if err := Validate(loaded.Config); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// applyEnv binds the environment variable of key and reads its secret
+// file, if one is given, returning the resulting source
+func applyEnv(v *viper.Viper, key string, kind reflect.Kind) (Source, error) {
+	// Maps cannot be expressed as a single environment variable
+	if kind == reflect.Map {
+		return Source{Kind: SourceDefault}, nil
+	}
+
+	name := EnvVar(key)
+	if err := v.BindEnv(viperKey(key), name); err != nil {
+		return Source{}, err
+	}
+
+	secretName := name + SecretFileSuffix
+	secretPath, hasSecret := os.LookupEnv(secretName)
+	_, hasValue := os.LookupEnv(name)
+	switch {
+	case hasSecret && hasValue:
+		return Source{}, fmt.Errorf("only one of %s and %s may be set", name, secretName)
+	case hasSecret:
+		data, err := os.ReadFile(secretPath)
+		if err != nil {
+			return Source{}, fmt.Errorf("%s: %v", secretName, err)
+		}
+		v.Set(viperKey(key), strings.TrimRight(string(data), "\r\n"))
+		return Source{Kind: SourceSecretFile, Name: secretName}, nil
+	case hasValue:
+		return Source{Kind: SourceEnv, Name: name}, nil
+	}
+	return Source{Kind: SourceDefault}, nil
+}
+
+// EnvVar returns the environment variable read for a dotted setting key
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// viperKey converts a dotted setting key into the viper key
+func viperKey(key string) string {
+	return strings.ReplaceAll(key, ".", keyDelimiter)
+}
+
+// durationType is treated as a leaf value rather than a number
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walk calls fn for every leaf setting of the struct value v, keyed by its
+// dotted, lower-case path
+func walk(v reflect.Value, prefix string, fn func(key string, value reflect.Value)) {
+	walkFields(v, prefix, false, func(key string, value reflect.Value, _ bool) {
+		fn(key, value)
+	})
+}
+
+// walkFields is walk, also reporting whether a setting or one of its
+// enclosing sections is tagged reload:"restart"
+func walkFields(v reflect.Value, prefix string, restart bool, fn func(key string, value reflect.Value, restart bool)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := strings.ToLower(field.Name)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		value := v.Field(i)
+		fieldRestart := restart || field.Tag.Get("reload") == "restart"
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			walkFields(value, key, fieldRestart, fn)
+			continue
+		}
+		fn(key, value, fieldRestart)
+	}
+}
@@ -0,0 +1,261 @@
+package configs
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce coalesces the burst of file events editors and
+// Kubernetes ConfigMap updates produce for a single change
+const reloadDebounce = 200 * time.Millisecond
+
+// Reload describes the outcome of reloading the configuration
+type Reload struct {
+	Old *Loaded
+	// New is nil when the reload was rejected
+	New *Loaded
+	// Changed lists the keys whose effective value changed
+	Changed []string
+	// RestartRequired lists the changed keys that only take effect after
+	// a restart
+	RestartRequired []string
+	// Err is the reason the new configuration was rejected. The previous
+	// configuration stays in effect.
+	Err error
+}
+
+// Manager holds the current configuration and reloads it when its files
+// change. Readers always see a complete, validated snapshot.
+type Manager struct {
+	opts    Options
+	current atomic.Pointer[Loaded]
+
+	mu          sync.Mutex
+	subscribers []func(old, new Config)
+	listeners   []func(Reload)
+	timer       *time.Timer
+	watcher     *fsnotify.Watcher
+	closed      bool
+}
+
+// NewManager loads the configuration described by opts
+func NewManager(opts Options) (*Manager, error) {
+	loaded, err := Load(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{opts: opts}
+	m.current.Store(loaded)
+	return m, nil
+}
+
+// Current returns the current configuration snapshot
+func (m *Manager) Current() *Loaded {
+	return m.current.Load()
+}
+
+// Config returns the current configuration
+func (m *Manager) Config() Config {
+	return m.current.Load().Config
+}
+
+// Subscribe calls fn with the old and new value of a configuration section
+// whenever a reload changes it. The section is selected by section, for
+// example func(c Config) LoggingConfig { return c.Logging }. Both values
+// have been validated.
+func Subscribe[T any](m *Manager, section func(Config) T, fn func(old, new T)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscribers = append(m.subscribers, func(old, new Config) {
+		before, after := section(old), section(new)
+		if !reflect.DeepEqual(before, after) {
+			fn(before, after)
+		}
+	})
+}
+
+// OnReload calls fn after every reload attempt that changed the
+// configuration or was rejected
+func (m *Manager) OnReload(fn func(Reload)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listeners = append(m.listeners, fn)
+}
+
+// Reload loads the configuration again and, if it is valid, swaps it in
+// and notifies subscribers. An invalid configuration is rejected and the
+// previous one kept.
+func (m *Manager) Reload() (Reload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.current.Load()
+	loaded, err := Load(m.opts)
+	if err != nil {
+		reload := Reload{Old: old, Err: err}
+		m.notify(reload)
+		return reload, err
+	}
+
+	reload := compare(old, loaded)
+	if len(reload.Changed) == 0 {
+		return reload, nil
+	}
+
+	m.current.Store(loaded)
+	for _, subscriber := range m.subscribers {
+		subscriber(old.Config, loaded.Config)
+	}
+	m.notify(reload)
+	return reload, nil
+}
+
+// notify calls the reload listeners. m.mu must be held.
+func (m *Manager) notify(reload Reload) {
+	for _, listener := range m.listeners {
+		listener(reload)
+	}
+}
+
+// Watch reloads the configuration whenever one of its files changes. The
+// outcome is reported to OnReload listeners. The directories holding the
+// files are watched rather than the files, so files replaced by a rename,
+// as editors and Kubernetes ConfigMap updates do, keep being watched.
+func (m *Manager) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config files: %w", err)
+	}
+
+	// files maps each config file to the file it resolves to, which changes
+	// when a symlink such as a ConfigMap's ..data is swapped
+	files := make(map[string]string)
+	for _, file := range m.Current().Files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch config file %s: %w", file, err)
+		}
+		files[path], _ = filepath.EvalSymlinks(path)
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch config file %s: %w", file, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || m.watcher != nil {
+		watcher.Close()
+		return nil
+	}
+	m.watcher = watcher
+	go m.watch(watcher, files)
+	return nil
+}
+
+// watch schedules a reload for every event changing one of files until the
+// watcher is closed
+func (m *Manager) watch(watcher *fsnotify.Watcher, files map[string]string) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if changed(event, files) {
+				m.scheduleReload()
+			}
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped, so reload to be safe
+			m.scheduleReload()
+		}
+	}
+}
+
+// changed reports whether event changes one of files, either directly or
+// by retargeting a symlink leading to it
+func changed(event fsnotify.Event, files map[string]string) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	result := false
+	for path, target := range files {
+		if filepath.Clean(event.Name) == path {
+			result = true
+		}
+		if current, err := filepath.EvalSymlinks(path); err == nil && current != target {
+			files[path] = current
+			result = true
+		}
+	}
+	return result
+}
+
+// scheduleReload reloads once file events stop arriving
+func (m *Manager) scheduleReload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer = time.AfterFunc(reloadDebounce, func() {
+		m.Reload()
+	})
+}
+
+// Close stops reacting to file changes. The current configuration remains
+// available.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	if m.watcher != nil {
+		return m.watcher.Close()
+	}
+	return nil
+}
+
+// compare lists the settings that differ between old and new
+func compare(old, new *Loaded) Reload {
+	reload := Reload{Old: old, New: new}
+
+	before := make(map[string]interface{})
+	walk(reflect.ValueOf(old.Config), "", func(key string, value reflect.Value) {
+		before[key] = value.Interface()
+	})
+	walkFields(reflect.ValueOf(new.Config), "", false, func(key string, value reflect.Value, restart bool) {
+		if reflect.DeepEqual(before[key], value.Interface()) {
+			return
+		}
+		reload.Changed = append(reload.Changed, key)
+		if restart {
+			reload.RestartRequired = append(reload.RestartRequired, key)
+		}
+	})
+
+	sort.Strings(reload.Changed)
+	sort.Strings(reload.RestartRequired)
+	return reload
+}
@@ -0,0 +1,157 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_Reload(t *testing.T) {
+	clearDiscoveryEnv(t)
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yaml", "logging:\n  level: info\n")
+
+	m, err := NewManager(Options{SearchPaths: []string{dir}})
+	require.NoError(t, err)
+
+	var loggingChanges [][2]string
+	Subscribe(m, func(c Config) LoggingConfig { return c.Logging }, func(old, new LoggingConfig) {
+		loggingChanges = append(loggingChanges, [2]string{old.Level, new.Level})
+	})
+	var serverChanges int
+	Subscribe(m, func(c Config) ServerConfig { return c.Server }, func(old, new ServerConfig) {
+		serverChanges++
+	})
+	var reloads []Reload
+	m.OnReload(func(r Reload) { reloads = append(reloads, r) })
+
+	t.Run("Should notify only the subscribers of changed sections", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte("logging:\n  level: debug\n"), 0o600))
+
+		reload, err := m.Reload()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"logging.level"}, reload.Changed)
+		assert.Empty(t, reload.RestartRequired)
+		assert.Equal(t, [][2]string{{"info", "debug"}}, loggingChanges)
+		assert.Zero(t, serverChanges)
+		assert.Equal(t, "debug", m.Config().Logging.Level)
+		assert.Len(t, reloads, 1)
+	})
+
+	t.Run("Should report settings that require a restart", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte("server:\n  port: 9090\nlogging:\n  level: debug\n"), 0o600))
+
+		reload, err := m.Reload()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"server.port"}, reload.Changed)
+		assert.Equal(t, []string{"server.port"}, reload.RestartRequired)
+		assert.Equal(t, 1, serverChanges)
+	})
+
+	t.Run("Should keep the previous configuration when the new one is invalid", func(t *testing.T) {
+		previous := m.Current()
+		require.NoError(t, os.WriteFile(file, []byte("logging:\n  level: loud\n"), 0o600))
+
+		reload, err := m.Reload()
+		require.Error(t, err)
+
+		assert.Same(t, previous, m.Current())
+		assert.Nil(t, reload.New)
+		assert.Equal(t, err, reloads[len(reloads)-1].Err)
+		assert.Len(t, loggingChanges, 1)
+	})
+
+	t.Run("Should not notify anyone when nothing changed", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte("server:\n  port: 9090\nlogging:\n  level: debug\n"), 0o600))
+		_, err := m.Reload()
+		require.NoError(t, err)
+		count := len(reloads)
+
+		_, err = m.Reload()
+		require.NoError(t, err)
+		assert.Len(t, reloads, count)
+	})
+}
+
+func TestManager_Watch(t *testing.T) {
+	clearDiscoveryEnv(t)
+
+	// watch starts watching the config in dir and returns a function
+	// waiting for the logging level to become level
+	watch := func(t *testing.T, dir string) (*Manager, func(level string)) {
+		m, err := NewManager(Options{SearchPaths: []string{dir}})
+		require.NoError(t, err)
+		t.Cleanup(func() { m.Close() })
+
+		var mu sync.Mutex
+		var current string
+		Subscribe(m, func(c Config) string { return c.Logging.Level }, func(old, new string) {
+			mu.Lock()
+			defer mu.Unlock()
+			current = new
+		})
+		require.NoError(t, m.Watch())
+
+		return m, func(level string) {
+			assert.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return current == level
+			}, 5*time.Second, 20*time.Millisecond)
+		}
+	}
+
+	t.Run("Should reload when a file is written", func(t *testing.T) {
+		dir := t.TempDir()
+		file := writeFile(t, dir, "config.yaml", "logging:\n  level: info\n")
+		_, waitFor := watch(t, dir)
+
+		require.NoError(t, os.WriteFile(file, []byte("logging:\n  level: warn\n"), 0o600))
+		waitFor("warn")
+	})
+
+	t.Run("Should keep watching files replaced by a rename", func(t *testing.T) {
+		dir := t.TempDir()
+		file := writeFile(t, dir, "config.yaml", "logging:\n  level: info\n")
+		_, waitFor := watch(t, dir)
+
+		for _, level := range []string{"warn", "debug"} {
+			temp := writeFile(t, dir, "config.yaml.tmp", "logging:\n  level: "+level+"\n")
+			require.NoError(t, os.Rename(temp, file))
+			waitFor(level)
+		}
+	})
+
+	t.Run("Should follow ConfigMap symlink swaps", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "v1"), 0o700))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "v2"), 0o700))
+		writeFile(t, filepath.Join(dir, "v1"), "config.yaml", "logging:\n  level: info\n")
+		writeFile(t, filepath.Join(dir, "v2"), "config.yaml", "logging:\n  level: warn\n")
+		require.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+		require.NoError(t, os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")))
+		_, waitFor := watch(t, dir)
+
+		require.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+		waitFor("warn")
+	})
+
+	t.Run("Should stop watching when closed", func(t *testing.T) {
+		dir := t.TempDir()
+		file := writeFile(t, dir, "config.yaml", "logging:\n  level: info\n")
+		m, _ := watch(t, dir)
+		require.NoError(t, m.Close())
+
+		require.NoError(t, os.WriteFile(file, []byte("logging:\n  level: warn\n"), 0o600))
+		time.Sleep(2 * reloadDebounce)
+		assert.Equal(t, "info", m.Config().Logging.Level)
+	})
+}
@@ -0,0 +1,101 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// validate checks the struct tags of Config and the rules that span
+// several fields
+var validate = newValidator()
+
+// newValidator creates the validator used by Validate
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterStructValidation(validateLogging, LoggingConfig{})
+	return v
+}
+
+// validateLogging requires the settings of the selected log output
+func validateLogging(sl validator.StructLevel) {
+	config := sl.Current().Interface().(LoggingConfig)
+
+	switch config.Output {
+	case "file":
+		if config.File.Path == "" {
+			sl.ReportError(config.File.Path, "File.Path", "Path", "required_for_output", config.Output)
+		}
+	case "syslog":
+		if config.Syslog.Address == "" {
+			sl.ReportError(config.Syslog.Address, "Syslog.Address", "Address", "required_for_output", config.Output)
+		}
+	}
+}
+
+// Validate checks config and returns a *ValidationError describing every
+// invalid setting
+func Validate(config Config) error {
+	err := validate.Struct(config)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	problems := make([]string, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		field := strings.TrimPrefix(fe.Namespace(), "Config.")
+		problems = append(problems, field+" "+describe(fe))
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// describe explains why a field failed validation
+func describe(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_with":
+		return fmt.Sprintf("is required when %s is set", fe.Param())
+	case "required_if":
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("is required when %s is %s", field, value)
+	case "required_for_output":
+		return fmt.Sprintf("is required when Output is %s", fe.Param())
+	case "min":
+		// String values may be secrets, so only their length is described
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s, got %v", fe.Param(), fe.Value())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s, got %v", fe.Param(), fe.Value())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s, got %q", strings.ReplaceAll(fe.Param(), " ", ", "), fe.Value())
+	case "hostname_port":
+		return fmt.Sprintf("must be a host:port address, got %q", fe.Value())
+	case "file":
+		return fmt.Sprintf("must be an existing file, got %q", fe.Value())
+	}
+	return fmt.Sprintf("failed the %s check", fe.Tag())
+}
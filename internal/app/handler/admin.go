@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// maxLogLevelTTL bounds how long a temporary level change can last
+const maxLogLevelTTL = 24 * time.Hour
+
+// AdminAuthMiddleware only lets through requests carrying the admin bearer
+// token
+func AdminAuthMiddleware(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeProblem(w, r, http.StatusUnauthorized, "admin credentials required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LogLevelHandler exposes the levels of the named loggers
+type LogLevelHandler struct {
+	levels *logger.LevelRegistry
+}
+
+// NewLogLevelHandler creates a new LogLevelHandler
+func NewLogLevelHandler(levels *logger.LevelRegistry) *LogLevelHandler {
+	return &LogLevelHandler{
+		levels: levels,
+	}
+}
+
+// LogLevelRequest changes the level of one logger. An empty Level resets
+// the logger so it inherits from its parent again; a TTL such as "15m"
+// reverts the change once it elapses.
+type LogLevelRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	TTL    string `json:"ttl,omitempty"`
+}
+
+// GetLevels handles GET requests listing the logger levels
+func (h *LogLevelHandler) GetLevels(w http.ResponseWriter, r *http.Request) {
+	h.writeLevels(w, r)
+}
+
+// SetLevel handles PUT requests changing a logger level
+func (h *LogLevelHandler) SetLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > maxLogLevelTTL {
+			writeProblem(w, r, http.StatusBadRequest, "ttl must be a positive duration of at most 24h")
+			return
+		}
+	}
+
+	name := req.Logger
+	if name == "" {
+		name = logger.RootLoggerName
+	}
+
+	if req.Level == "" {
+		if name == logger.RootLoggerName {
+			writeProblem(w, r, http.StatusBadRequest, "the root logger level cannot be reset")
+			return
+		}
+		h.levels.ResetLevel(name)
+	} else {
+		level, err := logger.ParseLevel(req.Level)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.levels.SetLevelFor(name, level, ttl)
+	}
+
+	logger.FromContext(r.Context()).WithFields(map[string]interface{}{
+		"target_logger": name,
+		"new_level":     req.Level,
+		"ttl":           req.TTL,
+	}).Info("Log level changed")
+
+	h.writeLevels(w, r)
+}
+
+// writeLevels writes the current logger levels as JSON
+func (h *LogLevelHandler) writeLevels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.levels.List()); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode log levels response: %v", err)
+	}
+}
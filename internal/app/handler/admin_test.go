@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevelEndpoint(t *testing.T) {
+	levels := logger.NewLevelRegistry(logger.InfoLevel)
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{AdminToken: "s3cret", LogLevels: levels})
+
+	put := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/v1/admin/log-levels", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Should reject requests without the admin token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, put("", `{"logger":"handler","level":"debug"}`).Code)
+		assert.Equal(t, http.StatusUnauthorized, put("wrong", `{"logger":"handler","level":"debug"}`).Code)
+		assert.Equal(t, logger.InfoLevel, levels.Level("handler"))
+	})
+
+	t.Run("Should change a logger level", func(t *testing.T) {
+		rec := put("s3cret", `{"logger":"database.postgres","level":"debug","ttl":"10m"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, logger.DebugLevel, levels.Level("database.postgres"))
+
+		var infos []logger.LevelInfo
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &infos))
+		var found bool
+		for _, info := range infos {
+			if info.Name == "database.postgres" {
+				found = true
+				assert.Equal(t, "debug", info.Level)
+				assert.NotNil(t, info.ExpiresAt)
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("Should reject invalid levels and TTLs", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, put("s3cret", `{"logger":"handler","level":"loud"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, put("s3cret", `{"logger":"handler","level":"debug","ttl":"-1m"}`).Code)
+	})
+
+	t.Run("Should not register admin routes without a token", func(t *testing.T) {
+		r := mux.NewRouter()
+		RegisterHandlers(r, Dependencies{})
+		req := httptest.NewRequest("PUT", "/api/v1/admin/log-levels", nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// Headers used to identify the caller of a request. They are expected to be
+// set by the authenticating proxy in front of the API, but the API cannot
+// tell, so audit entries mark the actor as unverified.
+const (
+	ActorHeader     = "X-Actor-ID"
+	TenantHeader    = "X-Tenant-ID"
+	RequestIDHeader = "X-Request-ID"
+)
+
+// MaxExportEntries bounds the number of entries returned by an export. Use
+// the from and to parameters to export a larger log in pieces.
+const MaxExportEntries = 10000
+
+// AuditHandler handles HTTP requests for audit log resources
+type AuditHandler struct {
+	store audit.Store
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(store audit.Store) *AuditHandler {
+	return &AuditHandler{
+		store: store,
+	}
+}
+
+// GetEvents handles GET requests for audit entries matching the query filters
+func (h *AuditHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.store.Query(r.Context(), filter)
+	if err != nil {
+		logger.FromContext(r.Context()).WithError(err).Error("Failed to query audit log")
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode audit response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// Export handles GET requests exporting audit entries as JSON Lines, at
+// most MaxExportEntries of them
+func (h *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Limit == 0 || filter.Limit > MaxExportEntries {
+		filter.Limit = MaxExportEntries
+	}
+
+	entries, err := h.store.Query(r.Context(), filter)
+	if err != nil {
+		logger.FromContext(r.Context()).WithError(err).Error("Failed to query audit log")
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := audit.ExportJSONL(w, entries); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to export audit log: %v", err)
+	}
+}
+
+// parseAuditFilter builds an audit filter from the request query string
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Actor:        q.Get("actor"),
+		Tenant:       q.Get("tenant"),
+		Action:       q.Get("action"),
+		ResourceType: q.Get("resource_type"),
+		ResourceID:   q.Get("resource_id"),
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return audit.Filter{}, errors.New("invalid from parameter")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return audit.Filter{}, errors.New("invalid to parameter")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return audit.Filter{}, errors.New("invalid limit parameter")
+		}
+	}
+
+	return filter, nil
+}
+
+// AuditMiddleware attaches the request origin to the context and records
+// an audit entry for every mutating request
+func AuditMiddleware(recorder *audit.Recorder) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := audit.Origin{
+				Actor:     r.Header.Get(ActorHeader),
+				Tenant:    r.Header.Get(TenantHeader),
+				SourceIP:  sourceIP(r),
+				RequestID: RequestIDFromContext(r.Context()),
+			}
+			origin.ActorUnverified = origin.Actor != ""
+			if origin.RequestID == "" {
+				origin.RequestID = r.Header.Get(RequestIDHeader)
+			}
+			ctx := audit.NewContext(r.Context(), origin)
+			r = r.WithContext(ctx)
+
+			if !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sw := NewResponseWriter(w)
+			// Record in a defer so requests whose handler panicked are
+			// audited too
+			defer func() {
+				status := sw.Status()
+				p := recover()
+				if p != nil {
+					status = http.StatusInternalServerError
+				}
+
+				_, err := recorder.Record(ctx, audit.Event{
+					Action:   "http." + r.Method,
+					Resource: audit.Resource{Type: "http", ID: r.URL.Path},
+					Metadata: map[string]string{
+						"method": r.Method,
+						"status": strconv.Itoa(status),
+					},
+				})
+				if err != nil {
+					logger.FromContext(r.Context()).WithError(err).Error("Failed to record audit entry")
+				}
+
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// isMutating reports whether the HTTP method changes server state
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// sourceIP returns the IP address of the client that sent the request
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEndpoints(t *testing.T) {
+	store := audit.NewMemoryStore()
+	recorder := audit.NewRecorder(store)
+	for i := 0; i <= MaxExportEntries; i++ {
+		_, err := recorder.Record(context.Background(), audit.Event{
+			Action:   "user.update",
+			Resource: audit.Resource{Type: "user", ID: strconv.Itoa(i)},
+		})
+		require.NoError(t, err)
+	}
+
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{AuditStore: store, AdminToken: "s3cret"})
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Should reject requests without the admin token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, get("/api/v1/audit/events", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, get("/api/v1/audit/export", "wrong").Code)
+	})
+
+	t.Run("Should bound the export", func(t *testing.T) {
+		rec := get("/api/v1/audit/export", "s3cret")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		lines := 0
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			lines++
+		}
+		assert.Equal(t, MaxExportEntries, lines)
+	})
+
+	t.Run("Should not register audit routes without a token", func(t *testing.T) {
+		r := mux.NewRouter()
+		RegisterHandlers(r, Dependencies{AuditStore: store})
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/audit/events", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	store := audit.NewMemoryStore()
+	r := mux.NewRouter()
+	r.Use(AuditMiddleware(audit.NewRecorder(store)))
+	r.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+
+	t.Run("Should mark the actor claimed by the client as unverified", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/users", nil)
+		req.Header.Set(ActorHeader, "alice")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		entries, err := store.Query(context.Background(), audit.Filter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "alice", entries[0].Actor)
+		assert.True(t, entries[0].ActorUnverified)
+	})
+
+	t.Run("Should audit requests whose handler panicked", func(t *testing.T) {
+		store := audit.NewMemoryStore()
+		r := mux.NewRouter()
+		r.Use(RecoveryMiddleware)
+		r.Use(AuditMiddleware(audit.NewRecorder(store)))
+		r.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) { panic("boom") }).Methods("POST")
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/users", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		entries, err := store.Query(context.Background(), audit.Filter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "500", entries[0].Metadata["status"])
+	})
+}
@@ -1,14 +1,20 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/health"
 	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/metrics"
 )
 
 // UserHandler handles HTTP requests for user resources
@@ -23,7 +29,8 @@ func NewUserHandler(userService *service.UserService) *UserHandler {
 	}
 }
 
-// GetUser handles GET requests for a specific user
+// GetUser handles GET requests for a specific user. The ETag header
+// carries the user's version for conditional updates.
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID, err := strconv.Atoi(vars["id"])
@@ -32,34 +39,89 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(userID)
+	user, err := h.userService.GetUserByID(r.Context(), userID)
+	if writeContextError(w, r, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		logger.GetLogger().Errorf("Failed to encode user response: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-	}
+	writeUser(w, r, user)
 }
 
-// GetAllUsers handles GET requests for all users
-func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userService.GetAllUsers()
+// ListUsers handles GET requests for a page of users. The query string
+// selects the page with limit and cursor, the order with sort and filters
+// the users, e.g. ?sort=-created_at&role=admin&email~=@corp. The next page
+// is linked from the Link header and next_cursor.
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	opts, err := query.Parse(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.userService.ListUsers(r.Context(), opts)
+	if writeContextError(w, r, err) {
+		return
+	}
 	if err != nil {
+		if isValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.FromContext(r.Context()).WithError(err).Error("Failed to list users")
 		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
 		return
 	}
 
+	if page.NextCursor != "" {
+		w.Header().Set("Link", nextLink(r, page.NextCursor))
+	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(users); err != nil {
-		logger.GetLogger().Errorf("Failed to encode users response: %v", err)
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode users response: %v", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
 
+// nextLink returns the Link header value pointing at the page after the
+// current one, keeping the other query parameters
+func nextLink(r *http.Request, cursor string) string {
+	next := *r.URL
+	values := next.Query()
+	values.Set(query.ParamCursor, cursor)
+	next.RawQuery = values.Encode()
+	return "<" + next.RequestURI() + `>; rel="next"`
+}
+
+// statusClientClosedRequest is logged for requests the client abandoned
+// before they completed
+const statusClientClosedRequest = 499
+
+// writeContextError answers a request whose deadline passed or whose
+// client went away before the service finished, reporting whether err was
+// caused by that
+func writeContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Request timed out", http.StatusGatewayTimeout)
+		return true
+	case errors.Is(err, context.Canceled):
+		// Nobody reads the response, the status only shows up in logs and metrics
+		w.WriteHeader(statusClientClosedRequest)
+		return true
+	}
+	return false
+}
+
+// isValidationError reports whether err is an application validation error
+func isValidationError(err error) bool {
+	var appErr *appErrors.Error
+	return errors.As(err, &appErr) && appErr.Type == appErrors.ErrorTypeValidation
+}
+
 // CreateUser handles POST requests to create a new user
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var user service.User
@@ -68,71 +130,180 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	createdUser, err := h.userService.CreateUser(user)
+	createdUser, err := h.userService.CreateUser(r.Context(), user)
 	if err != nil {
-		http.Error(w, "Failed to create user: "+err.Error(), http.StatusBadRequest)
+		writeUserError(w, r, err, false)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(createdUser); err != nil {
-		logger.GetLogger().Errorf("Failed to encode created user response: %v", err)
+		logger.FromContext(r.Context()).Errorf("Failed to encode created user response: %v", err)
 		// Note: Since we already wrote the status code, we can't use http.Error here
-		logger.GetLogger().Error("Failed to send response after header was written")
+		logger.FromContext(r.Context()).Error("Failed to send response after header was written")
+	}
+}
+
+// DeleteUser handles DELETE requests for a user. The user is kept, and
+// can be restored, until the retention period has passed.
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.DeleteUser(r.Context(), userID); err != nil {
+		writeUserError(w, r, err, false)
+		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// LoggingMiddleware logs information about each request
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		
-		// Call the next handler
-		next.ServeHTTP(w, r)
-		
-		// Log the request
-		log := logger.GetLogger()
-		log.WithFields(map[string]interface{}{
-			"method":     r.Method,
-			"path":       r.URL.Path,
-			"duration":   time.Since(start),
-			"remoteAddr": r.RemoteAddr,
-			"userAgent":  r.UserAgent(),
-		}).Info("Request handled")
-	})
+// RestoreUser handles POST requests restoring a deleted user
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	restored, err := h.userService.RestoreUser(r.Context(), userID)
+	if err != nil {
+		writeUserError(w, r, err, false)
+		return
+	}
+	writeUser(w, r, restored)
+}
+
+// Dependencies holds the collaborators used by the HTTP handlers
+type Dependencies struct {
+	// AuditStore backs the audit log query and export endpoints, which are
+	// registered only with an AdminToken
+	AuditStore audit.Store
+
+	// UserService backs the user endpoints. They are not registered when
+	// no database is configured.
+	UserService *service.UserService
+
+	// Invitations backs the invitation endpoints, which are not registered
+	// when it is nil
+	Invitations *service.InvitationService
+
+	// Teams backs the team and ownership endpoints, which are not
+	// registered when it is nil
+	Teams *service.TeamService
+
+	// Readiness reports whether the server is accepting traffic. Health
+	// checks fail once it reports false during shutdown.
+	Readiness Readiness
+
+	// Health holds the dependency checks reported by the health endpoints
+	Health *health.Registry
+
+	// Metrics is exposed on /metrics when set
+	Metrics *metrics.Metrics
+
+	// AdminToken guards the admin and audit endpoints. They are not
+	// registered when it is empty.
+	AdminToken string
+
+	// LogLevels is adjusted by the admin log level endpoint. It defaults
+	// to the standard logger's registry.
+	LogLevels *logger.LevelRegistry
+}
+
+// Readiness reports whether the server is ready to receive traffic
+type Readiness interface {
+	Ready() bool
 }
 
 // RegisterHandlers registers all HTTP handlers to the router
-func RegisterHandlers(r *mux.Router) {
-	// For now, we'll create a simple health check endpoint
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			logger.GetLogger().Errorf("Failed to write health check response: %v", err)
-		}
-	}).Methods("GET")
-	
+func RegisterHandlers(r *mux.Router, deps Dependencies) {
+	healthHandler := NewHealthHandler(deps.Health, deps.Readiness)
+
+	// Probe endpoints
+	r.HandleFunc("/livez", healthHandler.Livez).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Readyz).Methods("GET")
+	r.HandleFunc("/health", healthHandler.Readyz).Methods("GET")
+
+	// Prometheus metrics
+	if deps.Metrics != nil {
+		r.Handle("/metrics", deps.Metrics.Handler()).Methods("GET")
+	}
+
 	// Add API version prefix
 	apiRouter := r.PathPrefix("/api/v1").Subrouter()
-	
+
 	// Health routes
-	apiRouter.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		if err := json.NewEncoder(w).Encode(map[string]string{"status": "OK"}); err != nil {
-			logger.GetLogger().Errorf("Failed to encode health response: %v", err)
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	apiRouter.HandleFunc("/health", healthHandler.Report).Methods("GET")
+
+	// Audit routes expose user states, so they need the admin token too
+	if deps.AuditStore != nil && deps.AdminToken != "" {
+		auditHandler := NewAuditHandler(deps.AuditStore)
+
+		auditRouter := apiRouter.PathPrefix("/audit").Subrouter()
+		auditRouter.Use(AdminAuthMiddleware(deps.AdminToken))
+		auditRouter.HandleFunc("/events", auditHandler.GetEvents).Methods("GET")
+		auditRouter.HandleFunc("/export", auditHandler.Export).Methods("GET")
+	}
+
+	// Admin routes
+	if deps.AdminToken != "" {
+		levels := deps.LogLevels
+		if levels == nil {
+			levels = logger.Levels()
 		}
-	}).Methods("GET")
-	
-	// TODO: Add actual user handlers when repositories are implemented
-	// Example of how you would set up user routes:
-	/*
-	userService := service.NewUserService(userRepo)
-	userHandler := NewUserHandler(userService)
-	
-	userRouter := apiRouter.PathPrefix("/users").Subrouter()
-	userRouter.HandleFunc("", userHandler.GetAllUsers).Methods("GET")
-	userRouter.HandleFunc("/{id}", userHandler.GetUser).Methods("GET")
-	userRouter.HandleFunc("", userHandler.CreateUser).Methods("POST")
-	*/
-}
\ No newline at end of file
+		logLevelHandler := NewLogLevelHandler(levels)
+
+		adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+		adminRouter.Use(AdminAuthMiddleware(deps.AdminToken))
+		adminRouter.HandleFunc("/log-levels", logLevelHandler.GetLevels).Methods("GET")
+		adminRouter.HandleFunc("/log-levels", logLevelHandler.SetLevel).Methods("PUT")
+	}
+
+	// User routes
+	if deps.UserService != nil {
+		userHandler := NewUserHandler(deps.UserService)
+
+		userRouter := apiRouter.PathPrefix("/users").Subrouter()
+		userRouter.HandleFunc("", userHandler.ListUsers).Methods("GET")
+		userRouter.HandleFunc("/{id}", userHandler.GetUser).Methods("GET")
+		userRouter.HandleFunc("", userHandler.CreateUser).Methods("POST")
+		userRouter.HandleFunc("/{id}", userHandler.UpdateUser).Methods("PUT")
+		userRouter.HandleFunc("/{id}", userHandler.PatchUser).Methods("PATCH")
+		userRouter.HandleFunc("/{id}", userHandler.DeleteUser).Methods("DELETE")
+		userRouter.HandleFunc("/{id}/restore", userHandler.RestoreUser).Methods("POST")
+	}
+
+	// Invitation routes
+	if deps.Invitations != nil {
+		invitationHandler := NewInvitationHandler(deps.Invitations)
+
+		invitationRouter := apiRouter.PathPrefix("/invitations").Subrouter()
+		invitationRouter.HandleFunc("", invitationHandler.Invite).Methods("POST")
+		invitationRouter.HandleFunc("/accept", invitationHandler.Accept).Methods("POST")
+		invitationRouter.HandleFunc("/{id}/resend", invitationHandler.Resend).Methods("POST")
+		invitationRouter.HandleFunc("/{id}", invitationHandler.Revoke).Methods("DELETE")
+	}
+
+	// Team and ownership routes
+	if deps.Teams != nil {
+		teamHandler := NewTeamHandler(deps.Teams)
+
+		teamRouter := apiRouter.PathPrefix("/teams").Subrouter()
+		teamRouter.HandleFunc("", teamHandler.ListTeams).Methods("GET")
+		teamRouter.HandleFunc("", teamHandler.CreateTeam).Methods("POST")
+		teamRouter.HandleFunc("/{id}", teamHandler.GetTeam).Methods("GET")
+		teamRouter.HandleFunc("/{id}", teamHandler.DeleteTeam).Methods("DELETE")
+		teamRouter.HandleFunc("/{id}/members/{userID}", teamHandler.SetMember).Methods("PUT")
+		teamRouter.HandleFunc("/{id}/members/{userID}", teamHandler.RemoveMember).Methods("DELETE")
+
+		ownershipRouter := apiRouter.PathPrefix("/ownership").Subrouter()
+		ownershipRouter.HandleFunc("/resolve", teamHandler.Resolve).Methods("GET")
+		ownershipRouter.HandleFunc("/rules", teamHandler.ListRules).Methods("GET")
+		ownershipRouter.HandleFunc("/rules", teamHandler.CreateRule).Methods("POST")
+		ownershipRouter.HandleFunc("/rules/{id}", teamHandler.DeleteRule).Methods("DELETE")
+	}
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/mailer"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserHandler_ListUsers(t *testing.T) {
+	repo := new(service.MockUserRepository)
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{UserService: service.NewUserService(repo)})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	t.Run("Should return the page and link to the next one", func(t *testing.T) {
+		opts := query.Options{Limit: 1, Filters: []query.Filter{{Field: "role", Op: query.OpEq, Value: "admin"}}}
+		repo.On("List", mock.Anything, opts).Return(query.Page[service.User]{
+			Items:      []service.User{{ID: 1, Name: "Ada", Role: "admin"}},
+			NextCursor: "abc",
+		}, nil).Once()
+
+		rec := get("/api/v1/users?limit=1&role=admin")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `</api/v1/users?cursor=abc&limit=1&role=admin>; rel="next"`, rec.Header().Get("Link"))
+
+		var body struct {
+			Items      []service.User `json:"items"`
+			NextCursor string         `json:"next_cursor"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Len(t, body.Items, 1)
+		assert.Equal(t, "abc", body.NextCursor)
+	})
+
+	t.Run("Should reject invalid options", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("/api/v1/users?limit=x").Code)
+
+		opts := query.Options{Sort: []query.SortField{{Field: "password"}}}
+		repo.On("List", mock.Anything, opts).Return(query.Page[service.User]{}, appErrors.NewValidationError(`cannot sort by "password"`, nil)).Once()
+
+		rec := get("/api/v1/users?sort=password")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "cannot sort by")
+	})
+}
+
+func TestUserHandler_RequestContext(t *testing.T) {
+	repo := new(service.MockUserRepository)
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{UserService: service.NewUserService(repo)})
+
+	t.Run("Should pass the request context to the repository", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		repo.On("FindByID", mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == context.Canceled }), 1).
+			Return(service.User{}, appErrors.NewDatabaseError("error retrieving user", context.Canceled)).Once()
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/1", nil).WithContext(ctx))
+
+		assert.Equal(t, statusClientClosedRequest, rec.Code)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("Should report timed out queries as gateway timeouts", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 2).
+			Return(service.User{}, appErrors.NewDatabaseError("error retrieving user", context.DeadlineExceeded)).Once()
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/2", nil))
+
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	})
+}
+
+func TestUserHandler_UpdateUser(t *testing.T) {
+	repo := new(service.MockUserRepository)
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{UserService: service.NewUserService(repo)})
+
+	ada := service.User{ID: 1, Name: "Ada", Email: "ada@example.com", Role: "user", Active: true, Version: 3}
+	send := func(method, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/users/1", strings.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	updatedTo := func(role string) service.User {
+		updated := ada
+		updated.Role = role
+		updated.Version++
+		return updated
+	}
+
+	t.Run("Should return the version as ETag", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+
+		rec := send("GET", "", nil)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("Should update the version named by If-Match", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+		repo.On("Update", mock.Anything, mock.MatchedBy(func(u service.User) bool { return u.Version == 3 && u.Role == "admin" })).
+			Return(updatedTo("admin"), nil).Once()
+
+		rec := send("PUT", `{"Name":"Ada","Email":"ada@example.com","Role":"admin","Active":true}`, http.Header{"If-Match": {`"3"`}})
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("Should fail the precondition for a stale version", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+
+		rec := send("PUT", `{"Name":"Ada","Email":"ada@example.com","Role":"admin"}`, http.Header{"If-Match": {`"2"`}})
+
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	})
+
+	t.Run("Should fail the precondition when the user changes concurrently", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+		repo.On("Update", mock.Anything, mock.Anything).Return(service.User{}, appErrors.NewConflictError("stale", nil)).Once()
+
+		assert.Equal(t, http.StatusPreconditionFailed, send("PUT", `{"Name":"Ada","Email":"ada@example.com"}`, http.Header{"If-Match": {"*"}}).Code)
+
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+		repo.On("Update", mock.Anything, mock.Anything).Return(service.User{}, appErrors.NewConflictError("stale", nil)).Once()
+
+		assert.Equal(t, http.StatusConflict, send("PUT", `{"Name":"Ada","Email":"ada@example.com","Version":3}`, nil).Code)
+	})
+
+	t.Run("Should require a version or If-Match", func(t *testing.T) {
+		assert.Equal(t, http.StatusPreconditionRequired, send("PUT", `{"Name":"Ada","Email":"ada@example.com"}`, nil).Code)
+		assert.Equal(t, http.StatusPreconditionRequired, send("PATCH", `{"Role":"admin"}`, http.Header{"Content-Type": {mediaTypeMergePatch}}).Code)
+	})
+
+	t.Run("Should apply a merge patch", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Twice()
+		repo.On("Update", mock.Anything, mock.MatchedBy(func(u service.User) bool { return u.Role == "auditor" && u.Name == "Ada" })).
+			Return(updatedTo("auditor"), nil).Once()
+
+		rec := send("PATCH", `{"Role":"auditor"}`, http.Header{"Content-Type": {mediaTypeMergePatch}, "If-Match": {`"3"`}})
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("Should apply a JSON patch and honour its tests", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Twice()
+		repo.On("Update", mock.Anything, mock.MatchedBy(func(u service.User) bool { return u.Role == "admin" })).
+			Return(updatedTo("admin"), nil).Once()
+
+		rec := send("PATCH", `[{"op":"test","path":"/Role","value":"user"},{"op":"replace","path":"/Role","value":"admin"}]`,
+			http.Header{"Content-Type": {mediaTypeJSONPatch}, "If-Match": {"*"}})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+		rec = send("PATCH", `[{"op":"test","path":"/Role","value":"admin"}]`, http.Header{"Content-Type": {mediaTypeJSONPatch}, "If-Match": {"*"}})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("Should reject invalid patches", func(t *testing.T) {
+		rec := send("PATCH", `{"Role":"admin"}`, http.Header{"Content-Type": {"application/json"}})
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Contains(t, rec.Header().Get("Accept-Patch"), mediaTypeMergePatch)
+
+		repo.On("FindByID", mock.Anything, 1).Return(ada, nil).Once()
+		rec = send("PATCH", `{"Password":"secret"}`, http.Header{"Content-Type": {mediaTypeMergePatch}, "If-Match": {`"3"`}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	repo.AssertExpectations(t)
+}
+
+func TestUserHandler_DeleteUser(t *testing.T) {
+	repo := new(service.MockUserRepository)
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{UserService: service.NewUserService(repo)})
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	t.Run("Should delete and restore a user", func(t *testing.T) {
+		repo.On("FindByID", mock.Anything, 1).Return(service.User{ID: 1, Name: "Ada"}, nil).Once()
+		repo.On("Delete", mock.Anything, 1).Return(nil).Once()
+		repo.On("Restore", mock.Anything, 1).Return(service.User{ID: 1, Name: "Ada", Version: 3}, nil).Once()
+
+		assert.Equal(t, http.StatusNoContent, serve("DELETE", "/api/v1/users/1").Code)
+
+		rec := serve("POST", "/api/v1/users/1/restore")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("Should not find users that cannot be restored", func(t *testing.T) {
+		repo.On("Restore", mock.Anything, 2).Return(service.User{}, appErrors.NewNotFoundError("no restorable deleted user", nil)).Once()
+
+		assert.Equal(t, http.StatusNotFound, serve("POST", "/api/v1/users/2/restore").Code)
+	})
+
+	repo.AssertExpectations(t)
+}
+
+func TestUserHandler_CreateUser(t *testing.T) {
+	repo := new(service.MockUserRepository)
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{UserService: service.NewUserService(repo)})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/users", strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("Should reject invalid email addresses", func(t *testing.T) {
+		rec := post(`{"Name":"Ada","Email":"Ada <ada@example.com>"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid email address")
+	})
+
+	t.Run("Should report email addresses in use as conflicts", func(t *testing.T) {
+		repo.On("Create", mock.Anything, mock.Anything).Return(service.User{}, appErrors.NewConflictError("email address in use", nil)).Once()
+
+		assert.Equal(t, http.StatusConflict, post(`{"Name":"Ada","Email":"ada@example.com"}`).Code)
+	})
+}
+
+func TestInvitationHandler_Accept(t *testing.T) {
+	signer, err := token.NewSigner([]byte(strings.Repeat("k", token.MinSecretLength)))
+	require.NoError(t, err)
+	invitations := service.NewInvitationService(service.NewUserService(new(service.MockUserRepository)),
+		new(service.MockInvitationRepository), mailer.NewMemory(), signer)
+
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{Invitations: invitations})
+
+	accept := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/invitations/accept", strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("Should reject missing and forged tokens", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, accept(`{}`).Code)
+		assert.Equal(t, http.StatusBadRequest, accept(`{"token":"forged.token"}`).Code)
+	})
+
+	t.Run("Should report expired invitations as gone", func(t *testing.T) {
+		expired, err := signer.Sign("invitation", "1", -time.Minute)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusGone, accept(`{"token":"`+expired+`"}`).Code)
+	})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/health"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// HealthHandler handles liveness, readiness and health report requests
+type HealthHandler struct {
+	registry  *health.Registry
+	readiness Readiness
+}
+
+// NewHealthHandler creates a new HealthHandler. Either argument may be nil.
+func NewHealthHandler(registry *health.Registry, readiness Readiness) *HealthHandler {
+	if registry == nil {
+		registry = health.NewRegistry(0)
+	}
+	return &HealthHandler{
+		registry:  registry,
+		readiness: readiness,
+	}
+}
+
+// Livez handles liveness probes. It succeeds as long as the process can
+// serve requests and never depends on external systems.
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	writeText(w, r, http.StatusOK, "OK")
+}
+
+// Readyz handles readiness probes. It fails while the server is shutting
+// down or any critical check is failing.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !h.ready() {
+		writeText(w, r, http.StatusServiceUnavailable, "Shutting down")
+		return
+	}
+
+	report := h.registry.Run(r.Context())
+	if !report.Ready() {
+		writeText(w, r, http.StatusServiceUnavailable, "Not ready")
+		return
+	}
+	writeText(w, r, http.StatusOK, "OK")
+}
+
+// Report handles requests for the detailed JSON health report
+func (h *HealthHandler) Report(w http.ResponseWriter, r *http.Request) {
+	report := h.registry.Run(r.Context())
+
+	status := http.StatusOK
+	if !h.ready() {
+		report.Status = health.StatusDown
+	}
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode health response: %v", err)
+	}
+}
+
+// ready reports whether the server is accepting traffic
+func (h *HealthHandler) ready() bool {
+	return h.readiness == nil || h.readiness.Ready()
+}
+
+// writeText writes a plain text response with the given status
+func writeText(w http.ResponseWriter, r *http.Request, status int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(body)); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to write health check response: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// InvitationHandler handles HTTP requests for user invitations
+type InvitationHandler struct {
+	invitations *service.InvitationService
+}
+
+// NewInvitationHandler creates a new InvitationHandler
+func NewInvitationHandler(invitations *service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitations: invitations}
+}
+
+// Invite handles POST requests inviting a new user, given like a user to
+// create
+func (h *InvitationHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	var user service.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.invitations.Invite(r.Context(), user)
+	h.writeInvitation(w, r, invitation, err)
+}
+
+// Resend handles POST requests replacing an invitation with a new one
+func (h *InvitationHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.invitations.Resend(r.Context(), id)
+	h.writeInvitation(w, r, invitation, err)
+}
+
+// Revoke handles DELETE requests for an invitation
+func (h *InvitationHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.invitations.Revoke(r.Context(), id); err != nil {
+		writeInvitationError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Accept handles POST requests accepting an invitation with the emailed
+// token, given as {"token": "..."} or in the token query parameter, and
+// responds with the activated user
+func (h *InvitationHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	body.Token = r.URL.Query().Get("token")
+	if body.Token == "" {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+			http.Error(w, "Missing invitation token", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, err := h.invitations.Accept(r.Context(), body.Token)
+	if err != nil {
+		writeInvitationError(w, r, err)
+		return
+	}
+	writeUser(w, r, user)
+}
+
+// writeInvitation answers a request that created an invitation
+func (h *InvitationHandler) writeInvitation(w http.ResponseWriter, r *http.Request, invitation service.Invitation, err error) {
+	if err != nil && invitation.ID != 0 {
+		// The invitation exists but its email was not sent
+		logger.FromContext(r.Context()).WithError(err).Error("Failed to send invitation")
+		http.Error(w, fmt.Sprintf("Invitation %d was created but could not be sent, resend it later", invitation.ID), http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		writeInvitationError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(invitation); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode invitation response: %v", err)
+	}
+}
+
+// writeInvitationError answers a failed invitation request. Invitations
+// that can no longer be accepted are gone.
+func writeInvitationError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrInvitationExpired) || errors.Is(err, service.ErrInvitationRevoked) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	writeUserError(w, r, err, false)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/metrics"
+)
+
+// unknownRoute labels requests whose route template cannot be determined
+const unknownRoute = "unknown"
+
+// MetricsMiddleware records request counts, latencies and in-flight
+// requests. Requests are labelled by their mux route template rather than
+// the raw path to keep label cardinality bounded.
+func MetricsMiddleware(m *metrics.Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.HTTPInFlight.Inc()
+			defer m.HTTPInFlight.Dec()
+
+			start := time.Now()
+			sw := NewResponseWriter(w)
+			next.ServeHTTP(sw, r)
+
+			m.ObserveRequest(r.Method, routeTemplate(r), sw.Status(), time.Since(start))
+		})
+	}
+}
+
+// routeTemplate returns the path template of the matched mux route
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unknownRoute
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return unknownRoute
+	}
+	return template
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	m := metrics.New()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	r.Handle("/metrics", m.Handler())
+	r.Use(MetricsMiddleware(m))
+
+	for _, id := range []string{"1", "2", "3"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/"+id, nil))
+	}
+
+	t.Run("Should label requests by route template", func(t *testing.T) {
+		counter := m.HTTPRequests.WithLabelValues("GET", "/api/v1/users/{id}", "404")
+		assert.Equal(t, float64(3), testutil.ToFloat64(counter))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.HTTPRequests))
+	})
+
+	t.Run("Should return to zero in-flight requests", func(t *testing.T) {
+		assert.Equal(t, float64(0), testutil.ToFloat64(m.HTTPInFlight))
+	})
+
+	t.Run("Should expose metrics", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, strings.Contains(rec.Body.String(), `scrutiny_http_requests_total{method="GET",route="/api/v1/users/{id}",status="404"} 3`))
+	})
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/replica"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+)
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// LoggerName is the name of the request-scoped logger created by
+// RequestIDMiddleware
+const LoggerName = "handler"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID assigned by RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware propagates the X-Request-ID header, generating an ID
+// when the client did not send a usable one. The ID is echoed in the
+// response and attached, together with the caller and trace IDs, to a
+// request-scoped logger available through logger.FromContext.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		fields := map[string]interface{}{"request_id": id}
+		if actor := r.Header.Get(ActorHeader); actor != "" {
+			fields["user"] = actor
+		}
+		if tenant := r.Header.Get(TenantHeader); tenant != "" {
+			fields["tenant"] = tenant
+		}
+
+		ctx := r.Context()
+		log := tracing.WithTraceFields(ctx, logger.FromContext(ctx).Named(LoggerName)).WithFields(fields)
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+		ctx = logger.WithContext(ctx, log)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to
+// log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// LoggingMiddleware logs information about each request when it starts and
+// when it completes, including the response status and size
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"remoteAddr": r.RemoteAddr,
+			"userAgent":  r.UserAgent(),
+		})
+		log.Debug("Request started")
+
+		// Call the next handler
+		rw := NewResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		// Log the request
+		log.WithFields(map[string]interface{}{
+			"status":   rw.Status(),
+			"size":     rw.BytesWritten(),
+			"duration": time.Since(start),
+		}).Info("Request handled")
+	})
+}
+
+// RecoveryMiddleware recovers from panics in later handlers, logs the stack
+// trace and responds with a problem+json 500
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := NewResponseWriter(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// Let net/http abort the connection as the handler intended
+				panic(p)
+			}
+
+			logger.FromContext(r.Context()).WithFields(map[string]interface{}{
+				"panic": p,
+				"stack": string(debug.Stack()),
+			}).Error("Recovered from panic")
+
+			if rw.WroteHeader() {
+				// The response has already started, so it cannot be replaced
+				return
+			}
+			writeProblem(rw, r, http.StatusInternalServerError, "An unexpected error occurred")
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// DatabaseSessionMiddleware starts a read-your-writes database session per
+// request, so reads following a write in the same request are not served
+// by a lagging replica
+func DatabaseSessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(replica.WithSession(r.Context())))
+	})
+}
+
+// QueryCounterMiddleware counts the database statements of each request,
+// so the configured query limit applies per request
+func QueryCounterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(database.WithQueryCounter(r.Context())))
+	})
+}
+
+// Problem is an RFC 7807 problem details response body
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem writes an application/problem+json response
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode problem response: %v", err)
+	}
+}
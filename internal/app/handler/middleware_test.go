@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCapturingRequest returns a request whose context carries a logger
+// writing JSON entries to out
+func newCapturingRequest(method, target string, out *bytes.Buffer) *http.Request {
+	log := logger.NewLogger(logger.LoggerConfig{
+		Output:    out,
+		Formatter: &logrus.JSONFormatter{},
+		Level:     logrus.DebugLevel,
+	})
+	req := httptest.NewRequest(method, target, nil)
+	return req.WithContext(logger.WithContext(req.Context(), log))
+}
+
+// logEntries decodes every JSON log entry written to out
+func logEntries(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	t.Run("Should propagate a client request ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, "abc-123", seen)
+		assert.Equal(t, "abc-123", rec.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Should replace a missing or unsafe request ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, "bad id\nforged=entry")
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		assert.Len(t, seen, 32)
+		assert.Equal(t, seen, rec.Header().Get(RequestIDHeader))
+	})
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	h := RequestIDMiddleware(LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Info("inside handler")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})))
+
+	req := newCapturingRequest("GET", "/tea", &out)
+	req.Header.Set(RequestIDHeader, "req-42")
+	req.Header.Set(ActorHeader, "alice")
+	req.Header.Set(TenantHeader, "acme")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logEntries(t, &out)
+	require.Len(t, entries, 3)
+
+	t.Run("Should log when the request starts", func(t *testing.T) {
+		assert.Equal(t, "Request started", entries[0]["msg"])
+	})
+
+	t.Run("Should correlate handler logs with the request", func(t *testing.T) {
+		assert.Equal(t, "inside handler", entries[1]["msg"])
+		assert.Equal(t, "req-42", entries[1]["request_id"])
+		assert.Equal(t, "alice", entries[1]["user"])
+		assert.Equal(t, "acme", entries[1]["tenant"])
+	})
+
+	t.Run("Should log status and size on completion", func(t *testing.T) {
+		assert.Equal(t, "Request handled", entries[2]["msg"])
+		assert.Equal(t, float64(http.StatusTeapot), entries[2]["status"])
+		assert.Equal(t, float64(len("short and stout")), entries[2]["size"])
+		assert.Equal(t, "req-42", entries[2]["request_id"])
+	})
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	h := RequestIDMiddleware(RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})))
+
+	req := newCapturingRequest("GET", "/boom", &out)
+	req.Header.Set(RequestIDHeader, "req-7")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	t.Run("Should respond with problem+json", func(t *testing.T) {
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, http.StatusInternalServerError, problem.Status)
+		assert.Equal(t, "/boom", problem.Instance)
+		assert.Equal(t, "req-7", problem.RequestID)
+		assert.NotContains(t, rec.Body.String(), "something broke")
+	})
+
+	t.Run("Should log the panic with its stack", func(t *testing.T) {
+		entries := logEntries(t, &out)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "something broke", entries[0]["panic"])
+		assert.Contains(t, entries[0]["stack"], "middleware_test.go")
+		assert.Equal(t, "req-7", entries[0]["request_id"])
+	})
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// ResponseWriter wraps an http.ResponseWriter to capture the status code
+// and number of bytes written by a handler
+type ResponseWriter struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int
+	wroteHeader  bool
+}
+
+// NewResponseWriter wraps w. The status defaults to 200 until the handler
+// writes a header.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status code before delegating
+func (w *ResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes written before delegating
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += n
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer supports it
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for use by http.ResponseController
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status code written by the handler
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the size of the response body
+func (w *ResponseWriter) BytesWritten() int {
+	return w.bytesWritten
+}
+
+// WroteHeader reports whether the response has been started
+func (w *ResponseWriter) WroteHeader() bool {
+	return w.wroteHeader
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+)
+
+// TeamHandler handles HTTP requests for teams and resource ownership
+type TeamHandler struct {
+	teams *service.TeamService
+}
+
+// NewTeamHandler creates a new TeamHandler
+func NewTeamHandler(teams *service.TeamService) *TeamHandler {
+	return &TeamHandler{teams: teams}
+}
+
+// ListTeams handles GET requests for all teams
+func (h *TeamHandler) ListTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := h.teams.ListTeams(r.Context())
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	if teams == nil {
+		teams = []service.Team{}
+	}
+	writeJSON(w, r, http.StatusOK, teams)
+}
+
+// GetTeam handles GET requests for a team with its members
+func (h *TeamHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "Invalid team ID")
+	if !ok {
+		return
+	}
+
+	team, err := h.teams.GetTeam(r.Context(), id)
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, team)
+}
+
+// CreateTeam handles POST requests creating a team
+func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	var team service.Team
+	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.teams.CreateTeam(r.Context(), team)
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+// DeleteTeam handles DELETE requests for a team, which also deletes its
+// ownership rules
+func (h *TeamHandler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "Invalid team ID")
+	if !ok {
+		return
+	}
+
+	if err := h.teams.DeleteTeam(r.Context(), id); err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetMember handles PUT requests adding a user to a team, with an
+// optional {"Role": "lead"} body, and responds with the team
+func (h *TeamHandler) SetMember(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := pathID(w, r, "id", "Invalid team ID")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(w, r, "userID", "Invalid user ID")
+	if !ok {
+		return
+	}
+
+	member := service.TeamMember{UserID: userID}
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	member.UserID = userID
+
+	team, err := h.teams.SetMember(r.Context(), teamID, member)
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, team)
+}
+
+// RemoveMember handles DELETE requests removing a user from a team
+func (h *TeamHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := pathID(w, r, "id", "Invalid team ID")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(w, r, "userID", "Invalid user ID")
+	if !ok {
+		return
+	}
+
+	if err := h.teams.RemoveMember(r.Context(), teamID, userID); err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRules handles GET requests for all ownership rules
+func (h *TeamHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.teams.ListRules(r.Context())
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	if rules == nil {
+		rules = []ownership.Rule{}
+	}
+	writeJSON(w, r, http.StatusOK, rules)
+}
+
+// CreateRule handles POST requests creating an ownership rule
+func (h *TeamHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule ownership.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.teams.CreateRule(r.Context(), rule)
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+// DeleteRule handles DELETE requests for an ownership rule
+func (h *TeamHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "Invalid rule ID")
+	if !ok {
+		return
+	}
+
+	if err := h.teams.DeleteRule(r.Context(), id); err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Resolve handles GET requests for the owner of the resource given by the
+// resource query parameter, such as aws://123456789012/s3/invoices. Tags
+// are given as repeated tag=key=value parameters, and the account,
+// namespace and repository parameters override what the reference
+// implies.
+func (h *TeamHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	resource, err := ownership.ParseResource(params.Get("resource"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, tag := range params["tag"] {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			http.Error(w, "Invalid tag "+strconv.Quote(tag)+", use key=value", http.StatusBadRequest)
+			return
+		}
+		if resource.Tags == nil {
+			resource.Tags = make(map[string]string)
+		}
+		resource.Tags[key] = value
+	}
+	if account := params.Get("account"); account != "" {
+		resource.Account = account
+	}
+	if namespace := params.Get("namespace"); namespace != "" {
+		resource.Namespace = namespace
+	}
+	if repository := params.Get("repository"); repository != "" {
+		resource.Repository = repository
+	}
+
+	owner, err := h.teams.Resolve(r.Context(), resource)
+	if err != nil {
+		writeTeamError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, owner)
+}
+
+// pathID parses a positive ID from the named path variable, answering the
+// request with message when it is invalid
+func pathID(w http.ResponseWriter, r *http.Request, name, message string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil || id <= 0 {
+		http.Error(w, message, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON answers a request with v encoded as JSON
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// writeTeamError answers a failed team or ownership request
+func writeTeamError(w http.ResponseWriter, r *http.Request, err error) {
+	if writeContextError(w, r, err) {
+		return
+	}
+
+	var appErr *appErrors.Error
+	if !errors.As(err, &appErr) {
+		appErr = appErrors.New(appErrors.ErrorTypeUnknown, "", err)
+	}
+	switch appErr.Type {
+	case appErrors.ErrorTypeValidation:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case appErrors.ErrorTypeNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case appErrors.ErrorTypeConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.FromContext(r.Context()).WithError(err).Error("Failed to handle team request")
+		http.Error(w, "Failed to handle team request", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamHandler_Resolve(t *testing.T) {
+	teams := new(service.MockTeamRepository)
+	teams.On("ListRules", mock.Anything).Return([]ownership.Rule{
+		{ID: 1, TeamID: 1, Kind: ownership.KindTag, Pattern: "owner=payments"},
+		{ID: 2, TeamID: 2, Kind: ownership.KindNamespace, Pattern: "payments-*"},
+		{ID: 3, TeamID: 1, Kind: ownership.KindNamespace, Pattern: "*ents-prod"},
+	}, nil)
+	teams.On("ListTeams", mock.Anything).Return([]service.Team{{ID: 1, Name: "payments"}, {ID: 2, Name: "platform"}}, nil)
+	teams.On("FindTeam", mock.Anything, 1).Return(service.Team{ID: 1, Name: "payments"}, nil)
+	teams.On("FindTeam", mock.Anything, 2).Return(service.Team{ID: 2, Name: "platform"}, nil)
+
+	r := mux.NewRouter()
+	RegisterHandlers(r, Dependencies{Teams: service.NewTeamService(teams, service.NewUserService(new(service.MockUserRepository)))})
+
+	resolve := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/ownership/resolve?"+query, nil))
+		return rec
+	}
+
+	t.Run("Should resolve the owner from tags", func(t *testing.T) {
+		rec := resolve("resource=k8s://prod/payments-prod/deployments/api&tag=owner=payments")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var owner service.Ownership
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&owner))
+		assert.Equal(t, "payments", owner.Team.Name)
+		assert.Equal(t, 1, owner.Rule.ID)
+		assert.Len(t, owner.Matches, 3)
+	})
+
+	t.Run("Should report conflicting rules", func(t *testing.T) {
+		rec := resolve("resource=k8s://prod/payments-prod/deployments/api")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var owner service.Ownership
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&owner))
+		assert.Equal(t, 2, owner.Rule.ID)
+		require.Len(t, owner.Conflicts, 1)
+		assert.Equal(t, "payments", owner.Conflicts[0].Team)
+	})
+
+	t.Run("Should reject invalid resources and report unowned ones", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, resolve("resource=payments").Code)
+		assert.Equal(t, http.StatusBadRequest, resolve("resource=aws://1/s3&tag=owner").Code)
+		assert.Equal(t, http.StatusNotFound, resolve("resource=aws://999/s3").Code)
+	})
+}
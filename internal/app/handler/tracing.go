@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware continues the trace described by an incoming W3C
+// traceparent header, or starts a new one, and wraps the request in a
+// server span named after its route template
+func TracingMiddleware(tp trace.TracerProvider) mux.MiddlewareFunc {
+	tracer := tracing.Tracer(tp)
+	propagator := tracing.Propagator()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			route := routeTemplate(r)
+			ctx, span := tracer.Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			sw := NewResponseWriter(w)
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(sw.Status()))
+			if sw.Status() >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(sw.Status()))
+			}
+		})
+	}
+}
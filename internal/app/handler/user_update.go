@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gorilla/mux"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// Media types accepted by PATCH requests
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// maxPatchSize bounds the body of a PATCH request
+const maxPatchSize = 1 << 20
+
+// errPreconditionFailed is returned for If-Match headers that cannot match
+// any version of a user
+var errPreconditionFailed = errors.New("If-Match does not match the current version")
+
+// errPreconditionRequired is returned for changes that name no version, so
+// they could silently overwrite a concurrent change
+var errPreconditionRequired = errors.New("If-Match or a Version is required")
+
+// etag returns the entity tag of a version of a user
+func etag(user service.User) string {
+	return strconv.Quote(strconv.Itoa(user.Version))
+}
+
+// ifMatch returns the version required by the If-Match header and whether
+// the request is conditional. A version of zero matches any version, as
+// sent with If-Match: *.
+func ifMatch(r *http.Request) (version int, conditional bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+	if header == "*" {
+		return 0, true, nil
+	}
+
+	// Weak tags never match, If-Match uses the strong comparison
+	tag, err := strconv.Unquote(header)
+	if err != nil || strings.HasPrefix(header, "W/") {
+		return 0, true, errPreconditionFailed
+	}
+	version, err = strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return 0, true, errPreconditionFailed
+	}
+	return version, true, nil
+}
+
+// UpdateUser handles PUT requests replacing a user. With If-Match the
+// update only applies to the given version and otherwise fails with 412
+// Precondition Failed. Without it the Version of the body must match, or
+// the update fails with 409 Conflict. Requests naming neither fail with 428
+// Precondition Required; If-Match: * updates any version.
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	version, conditional, err := ifMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	var user service.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	user.ID = userID
+	if conditional {
+		user.Version = version
+	} else if user.Version <= 0 {
+		http.Error(w, errPreconditionRequired.Error(), http.StatusPreconditionRequired)
+		return
+	}
+
+	updated, err := h.userService.UpdateUser(r.Context(), user)
+	if err != nil {
+		writeUserError(w, r, err, conditional)
+		return
+	}
+	writeUser(w, r, updated)
+}
+
+// PatchUser handles PATCH requests changing part of a user, given as a
+// JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902). If-Match is
+// required and honoured as for PUT.
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mediaTypeMergePatch && mediaType != mediaTypeJSONPatch {
+		w.Header().Set("Accept-Patch", mediaTypeMergePatch+", "+mediaTypeJSONPatch)
+		http.Error(w, "Unsupported patch format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	version, conditional, err := ifMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if !conditional {
+		http.Error(w, errPreconditionRequired.Error(), http.StatusPreconditionRequired)
+		return
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxPatchSize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.userService.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeUserError(w, r, err, conditional)
+		return
+	}
+	if version != 0 && version != current.Version {
+		http.Error(w, errPreconditionFailed.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	patched, err := applyPatch(mediaType, current, patch)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		http.Error(w, "Patch test failed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid patch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The ID and version are not patchable, the update applies to the
+	// version the patch was computed against
+	patched.ID = current.ID
+	patched.Version = current.Version
+
+	updated, err := h.userService.UpdateUser(r.Context(), patched)
+	if err != nil {
+		writeUserError(w, r, err, conditional)
+		return
+	}
+	writeUser(w, r, updated)
+}
+
+// applyPatch applies a patch of the given media type to user
+func applyPatch(mediaType string, user service.User, patch []byte) (service.User, error) {
+	doc, err := json.Marshal(user)
+	if err != nil {
+		return service.User{}, err
+	}
+
+	if mediaType == mediaTypeMergePatch {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		var operations jsonpatch.Patch
+		operations, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			doc, err = operations.Apply(doc)
+		}
+	}
+	if err != nil {
+		return service.User{}, err
+	}
+
+	var patched service.User
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return service.User{}, err
+	}
+	return patched, nil
+}
+
+// writeUser writes a user together with its entity tag
+func writeUser(w http.ResponseWriter, r *http.Request, user service.User) {
+	w.Header().Set("ETag", etag(user))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to encode user response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// writeUserError answers a failed change to a user. Conflicts fail the
+// precondition of conditional requests and are reported as 409 Conflict
+// otherwise.
+func writeUserError(w http.ResponseWriter, r *http.Request, err error, conditional bool) {
+	if writeContextError(w, r, err) {
+		return
+	}
+
+	var appErr *appErrors.Error
+	if !errors.As(err, &appErr) {
+		appErr = appErrors.New(appErrors.ErrorTypeUnknown, "", err)
+	}
+	switch appErr.Type {
+	case appErrors.ErrorTypeValidation:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case appErrors.ErrorTypeNotFound:
+		http.Error(w, "User not found", http.StatusNotFound)
+	case appErrors.ErrorTypeConflict:
+		if conditional {
+			http.Error(w, errPreconditionFailed.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.FromContext(r.Context()).WithError(err).Error("Failed to change user")
+		http.Error(w, "Failed to change user", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+)
+
+// Actions of published changes
+const (
+	ChangeCreated    = "created"
+	ChangeUpdated    = "updated"
+	ChangeDeleted    = "deleted"
+	ChangeRestored   = "restored"
+	ChangeAnonymized = "anonymized"
+	ChangePurged     = "purged"
+)
+
+// Change is published on the change feed when a repository changes a row,
+// so other API instances can drop cached copies of it
+type Change struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	ID       int    `json:"id"`
+	// Version is the version after the change, when the resource has one
+	// and it is known
+	Version int `json:"version,omitempty"`
+}
+
+// publish publishes change on the change feed, if it is enabled, with
+// target, which is usually the transaction making the change
+func (o options) publish(ctx context.Context, target interface{}, change Change) error {
+	if o.changes == "" {
+		return nil
+	}
+	notifier, ok := target.(database.Notifier)
+	if !ok {
+		return nil
+	}
+	if err := database.Publish(ctx, notifier, o.changes, change); !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the SQL migrations for the repository schema
+func Migrations() fs.FS {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		// The directory is embedded at build time, so this cannot fail
+		panic(err)
+	}
+	return sub
+}
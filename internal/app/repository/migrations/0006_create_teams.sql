@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS teams (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role    TEXT NOT NULL DEFAULT 'member',
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_members_user_id_idx ON team_members (user_id);
+
+CREATE TABLE IF NOT EXISTS ownership_rules (
+    id         SERIAL PRIMARY KEY,
+    team_id    INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL,
+    pattern    TEXT NOT NULL,
+    priority   INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (team_id, kind, pattern)
+);
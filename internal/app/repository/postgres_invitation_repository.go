@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+)
+
+// PostgresInvitationRepository implements service.InvitationRepository
+// using PostgreSQL
+type PostgresInvitationRepository struct {
+	options
+	db database.Connection
+}
+
+// NewPostgresInvitationRepository creates a new PostgreSQL invitation
+// repository
+func NewPostgresInvitationRepository(db database.Connection, opts ...Option) *PostgresInvitationRepository {
+	return &PostgresInvitationRepository{
+		options: newOptions(opts),
+		db:      db,
+	}
+}
+
+// Create stores a new pending invitation
+func (r *PostgresInvitationRepository) Create(ctx context.Context, invitation service.Invitation) (service.Invitation, error) {
+	ctx, cancel := r.operation(ctx, "invitations.create")
+	defer cancel()
+
+	invitation.CreatedAt = time.Now().UTC()
+
+	query := `
+		INSERT INTO user_invitations (user_id, email, expires_at, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		invitation.UserID,
+		invitation.Email,
+		invitation.ExpiresAt,
+		invitation.CreatedAt,
+	).Scan(&invitation.ID)
+	if err != nil {
+		return service.Invitation{}, databaseError(ctx, "failed to create invitation", err)
+	}
+	return invitation, nil
+}
+
+// FindByID retrieves an invitation by its ID
+func (r *PostgresInvitationRepository) FindByID(ctx context.Context, id int) (service.Invitation, error) {
+	ctx, cancel := r.operation(ctx, "invitations.find_by_id")
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, email, expires_at, created_at, accepted_at, revoked_at
+		FROM user_invitations
+		WHERE id = $1
+	`
+
+	var invitation service.Invitation
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&invitation.ID,
+		&invitation.UserID,
+		&invitation.Email,
+		&invitation.ExpiresAt,
+		&invitation.CreatedAt,
+		&invitation.AcceptedAt,
+		&invitation.RevokedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, database.ErrNoRows) {
+		return service.Invitation{}, appErrors.NewNotFoundError(fmt.Sprintf("invitation with ID %d not found", id), nil)
+	}
+	if err != nil {
+		return service.Invitation{}, databaseError(ctx, "error retrieving invitation", err)
+	}
+	return invitation, nil
+}
+
+// Accept marks a pending invitation as accepted
+func (r *PostgresInvitationRepository) Accept(ctx context.Context, id int) error {
+	return r.close(ctx, "invitations.accept", "accepted_at", id)
+}
+
+// Revoke marks a pending invitation as revoked
+func (r *PostgresInvitationRepository) Revoke(ctx context.Context, id int) error {
+	return r.close(ctx, "invitations.revoke", "revoked_at", id)
+}
+
+// Reopen clears the acceptance of an invitation that was not revoked since
+func (r *PostgresInvitationRepository) Reopen(ctx context.Context, id int) error {
+	ctx, cancel := r.operation(ctx, "invitations.reopen")
+	defer cancel()
+
+	query := `
+		UPDATE user_invitations
+		SET accepted_at = NULL
+		WHERE id = $1 AND accepted_at IS NOT NULL AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.Execute(ctx, query, id); err != nil {
+		return databaseError(ctx, "failed to reopen invitation", err)
+	}
+	return nil
+}
+
+// close sets the given timestamp column of a pending invitation
+func (r *PostgresInvitationRepository) close(ctx context.Context, name, column string, id int) error {
+	ctx, cancel := r.operation(ctx, name)
+	defer cancel()
+
+	query := `
+		UPDATE user_invitations
+		SET ` + column + ` = $1
+		WHERE id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Execute(ctx, query, time.Now().UTC(), id)
+	if err != nil {
+		return databaseError(ctx, "failed to update invitation", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return databaseError(ctx, "failed to get affected rows", err)
+	}
+	if rowsAffected == 0 {
+		if _, err := r.FindByID(ctx, id); err != nil {
+			return err
+		}
+		return appErrors.NewConflictError(fmt.Sprintf("invitation with ID %d is no longer pending", id), nil)
+	}
+	return nil
+}
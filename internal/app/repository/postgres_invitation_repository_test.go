@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresInvitationRepository_Accept(t *testing.T) {
+	invitationColumns := []string{"id", "user_id", "email", "expires_at", "created_at", "accepted_at", "revoked_at"}
+
+	t.Run("Should accept pending invitations", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresInvitationRepository(users.db)
+		mock.ExpectExec("UPDATE user_invitations SET accepted_at").WithArgs(sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, repo.Accept(context.Background(), 3))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should report closed invitations as conflicts", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresInvitationRepository(users.db)
+		now := time.Now()
+		mock.ExpectExec("UPDATE user_invitations SET accepted_at").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT (.+) FROM user_invitations").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(invitationColumns).AddRow(3, 7, "ada@example.com", now, now, now, nil))
+
+		err := repo.Accept(context.Background(), 3)
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeConflict, appErr.Type)
+	})
+
+	t.Run("Should reopen accepted invitations", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresInvitationRepository(users.db)
+		mock.ExpectExec("UPDATE user_invitations SET accepted_at = NULL").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, repo.Reopen(context.Background(), 3))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
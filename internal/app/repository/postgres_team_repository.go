@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+)
+
+// PostgresTeamRepository implements service.TeamRepository using
+// PostgreSQL
+type PostgresTeamRepository struct {
+	options
+	db database.Connection
+}
+
+// NewPostgresTeamRepository creates a new PostgreSQL team repository
+func NewPostgresTeamRepository(db database.Connection, opts ...Option) *PostgresTeamRepository {
+	return &PostgresTeamRepository{
+		options: newOptions(opts),
+		db:      db,
+	}
+}
+
+// teamNotFound reports a missing team
+func teamNotFound(id int) error {
+	return appErrors.NewNotFoundError(fmt.Sprintf("team with ID %d not found", id), nil)
+}
+
+// ruleNotFound reports a missing ownership rule
+func ruleNotFound(id int) error {
+	return appErrors.NewNotFoundError(fmt.Sprintf("ownership rule with ID %d not found", id), nil)
+}
+
+// CreateTeam stores a new team
+func (r *PostgresTeamRepository) CreateTeam(ctx context.Context, team service.Team) (service.Team, error) {
+	ctx, cancel := r.operation(ctx, "teams.create")
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	query := `
+		INSERT INTO teams (name, description, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(ctx, query, team.Name, team.Description, now).Scan(&team.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return service.Team{}, appErrors.NewConflictError(fmt.Sprintf("team %q already exists", team.Name), nil)
+		}
+		return service.Team{}, databaseError(ctx, "failed to create team", err)
+	}
+
+	team.CreatedAt = now.Format(time.RFC3339)
+	return team, nil
+}
+
+// FindTeam retrieves a team with its members. Deleted users are not
+// members.
+func (r *PostgresTeamRepository) FindTeam(ctx context.Context, id int) (service.Team, error) {
+	ctx, cancel := r.operation(ctx, "teams.find_by_id")
+	defer cancel()
+
+	query := `
+		SELECT id, name, description, created_at
+		FROM teams
+		WHERE id = $1
+	`
+
+	var team service.Team
+	var createdAt time.Time
+	err := r.db.QueryRow(ctx, query, id).Scan(&team.ID, &team.Name, &team.Description, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, database.ErrNoRows) {
+		return service.Team{}, teamNotFound(id)
+	}
+	if err != nil {
+		return service.Team{}, databaseError(ctx, "error retrieving team", err)
+	}
+	team.CreatedAt = createdAt.Format(time.RFC3339)
+
+	query = `
+		SELECT u.id, u.name, u.email, m.role
+		FROM team_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.team_id = $1 AND u.deleted_at IS NULL
+		ORDER BY u.id
+	`
+
+	rows, err := r.db.Query(ctx, query, id)
+	if err != nil {
+		return service.Team{}, databaseError(ctx, "error retrieving team members", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member service.TeamMember
+		if err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.Role); err != nil {
+			return service.Team{}, databaseError(ctx, "error scanning team member", err)
+		}
+		team.Members = append(team.Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return service.Team{}, databaseError(ctx, "error iterating team members", err)
+	}
+	return team, nil
+}
+
+// ListTeams retrieves all teams by name, without their members
+func (r *PostgresTeamRepository) ListTeams(ctx context.Context) ([]service.Team, error) {
+	ctx, cancel := r.operation(ctx, "teams.list")
+	defer cancel()
+
+	query := `
+		SELECT id, name, description, created_at
+		FROM teams
+		ORDER BY name
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, databaseError(ctx, "error retrieving teams", err)
+	}
+	defer rows.Close()
+
+	var teams []service.Team
+	for rows.Next() {
+		var team service.Team
+		var createdAt time.Time
+		if err := rows.Scan(&team.ID, &team.Name, &team.Description, &createdAt); err != nil {
+			return nil, databaseError(ctx, "error scanning team", err)
+		}
+		team.CreatedAt = createdAt.Format(time.RFC3339)
+		teams = append(teams, team)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, databaseError(ctx, "error iterating teams", err)
+	}
+	return teams, nil
+}
+
+// DeleteTeam deletes a team. Its memberships and rules are deleted by the
+// database.
+func (r *PostgresTeamRepository) DeleteTeam(ctx context.Context, id int) error {
+	ctx, cancel := r.operation(ctx, "teams.delete")
+	defer cancel()
+
+	return r.deleteOne(ctx, `DELETE FROM teams WHERE id = $1`, teamNotFound(id), id)
+}
+
+// SetMember adds a user to a team or changes their role
+func (r *PostgresTeamRepository) SetMember(ctx context.Context, teamID int, member service.TeamMember) error {
+	ctx, cancel := r.operation(ctx, "teams.set_member")
+	defer cancel()
+
+	query := `
+		INSERT INTO team_members (team_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (team_id, user_id) DO UPDATE SET role = EXCLUDED.role
+	`
+
+	if _, err := r.db.Execute(ctx, query, teamID, member.UserID, member.Role); err != nil {
+		if isForeignKeyViolation(err) {
+			return appErrors.NewNotFoundError(fmt.Sprintf("team %d or user %d not found", teamID, member.UserID), nil)
+		}
+		return databaseError(ctx, "failed to set team member", err)
+	}
+	return nil
+}
+
+// RemoveMember removes a user from a team
+func (r *PostgresTeamRepository) RemoveMember(ctx context.Context, teamID, userID int) error {
+	ctx, cancel := r.operation(ctx, "teams.remove_member")
+	defer cancel()
+
+	return r.deleteOne(ctx, `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`,
+		appErrors.NewNotFoundError(fmt.Sprintf("user %d is not a member of team %d", userID, teamID), nil),
+		teamID, userID)
+}
+
+// CreateRule stores a new ownership rule
+func (r *PostgresTeamRepository) CreateRule(ctx context.Context, rule ownership.Rule) (ownership.Rule, error) {
+	ctx, cancel := r.operation(ctx, "ownership_rules.create")
+	defer cancel()
+
+	rule.CreatedAt = time.Now().UTC()
+
+	query := `
+		INSERT INTO ownership_rules (team_id, kind, pattern, priority, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(ctx, query, rule.TeamID, rule.Kind, rule.Pattern, rule.Priority, rule.CreatedAt).Scan(&rule.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ownership.Rule{}, appErrors.NewConflictError(fmt.Sprintf("team %d already has the %s rule %q", rule.TeamID, rule.Kind, rule.Pattern), nil)
+		}
+		if isForeignKeyViolation(err) {
+			return ownership.Rule{}, teamNotFound(rule.TeamID)
+		}
+		return ownership.Rule{}, databaseError(ctx, "failed to create ownership rule", err)
+	}
+	return rule, nil
+}
+
+// FindRule retrieves an ownership rule
+func (r *PostgresTeamRepository) FindRule(ctx context.Context, id int) (ownership.Rule, error) {
+	ctx, cancel := r.operation(ctx, "ownership_rules.find_by_id")
+	defer cancel()
+
+	query := `
+		SELECT id, team_id, kind, pattern, priority, created_at
+		FROM ownership_rules
+		WHERE id = $1
+	`
+
+	var rule ownership.Rule
+	err := r.db.QueryRow(ctx, query, id).Scan(&rule.ID, &rule.TeamID, &rule.Kind, &rule.Pattern, &rule.Priority, &rule.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, database.ErrNoRows) {
+		return ownership.Rule{}, ruleNotFound(id)
+	}
+	if err != nil {
+		return ownership.Rule{}, databaseError(ctx, "error retrieving ownership rule", err)
+	}
+	return rule, nil
+}
+
+// ListRules retrieves all ownership rules, oldest first
+func (r *PostgresTeamRepository) ListRules(ctx context.Context) ([]ownership.Rule, error) {
+	ctx, cancel := r.operation(ctx, "ownership_rules.list")
+	defer cancel()
+
+	query := `
+		SELECT id, team_id, kind, pattern, priority, created_at
+		FROM ownership_rules
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, databaseError(ctx, "error retrieving ownership rules", err)
+	}
+	defer rows.Close()
+
+	var rules []ownership.Rule
+	for rows.Next() {
+		var rule ownership.Rule
+		if err := rows.Scan(&rule.ID, &rule.TeamID, &rule.Kind, &rule.Pattern, &rule.Priority, &rule.CreatedAt); err != nil {
+			return nil, databaseError(ctx, "error scanning ownership rule", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, databaseError(ctx, "error iterating ownership rules", err)
+	}
+	return rules, nil
+}
+
+// DeleteRule deletes an ownership rule
+func (r *PostgresTeamRepository) DeleteRule(ctx context.Context, id int) error {
+	ctx, cancel := r.operation(ctx, "ownership_rules.delete")
+	defer cancel()
+
+	return r.deleteOne(ctx, `DELETE FROM ownership_rules WHERE id = $1`, ruleNotFound(id), id)
+}
+
+// deleteOne executes a delete statement and returns notFound when it
+// deleted nothing
+func (r *PostgresTeamRepository) deleteOne(ctx context.Context, query string, notFound error, args ...interface{}) error {
+	result, err := r.db.Execute(ctx, query, args...)
+	if err != nil {
+		return databaseError(ctx, "failed to delete", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return databaseError(ctx, "failed to get affected rows", err)
+	}
+	if rowsAffected == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresTeamRepository_FindTeam(t *testing.T) {
+	t.Run("Should load the team with its members", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresTeamRepository(users.db)
+		mock.ExpectQuery("SELECT (.+) FROM teams").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "created_at"}).AddRow(1, "payments", "", time.Now()))
+		mock.ExpectQuery("SELECT (.+) FROM team_members").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "role"}).AddRow(7, "Ada", "ada@example.com", "lead"))
+
+		team, err := repo.FindTeam(context.Background(), 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, "payments", team.Name)
+		require.Len(t, team.Members, 1)
+		assert.Equal(t, "lead", team.Members[0].Role)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresTeamRepository_CreateRule(t *testing.T) {
+	rule := ownership.Rule{TeamID: 1, Kind: ownership.KindTag, Pattern: "owner=payments"}
+
+	t.Run("Should store the rule", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresTeamRepository(users.db)
+		mock.ExpectQuery("INSERT INTO ownership_rules").
+			WithArgs(1, ownership.KindTag, "owner=payments", 0, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		created, err := repo.CreateRule(context.Background(), rule)
+
+		require.NoError(t, err)
+		assert.Equal(t, 5, created.ID)
+	})
+
+	t.Run("Should report duplicate rules as conflicts", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresTeamRepository(users.db)
+		mock.ExpectQuery("INSERT INTO ownership_rules").WillReturnError(&pq.Error{Code: uniqueViolation})
+
+		_, err := repo.CreateRule(context.Background(), rule)
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeConflict, appErr.Type)
+	})
+}
+
+func TestPostgresTeamRepository_FindRule(t *testing.T) {
+	t.Run("Should report missing rules as not found", func(t *testing.T) {
+		users, mock := newTestRepository(t)
+		repo := NewPostgresTeamRepository(users.db)
+		mock.ExpectQuery("SELECT (.+) FROM ownership_rules WHERE id").WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "team_id", "kind", "pattern", "priority", "created_at"}))
+
+		_, err := repo.FindRule(context.Background(), 5)
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeNotFound, appErr.Type)
+	})
+}
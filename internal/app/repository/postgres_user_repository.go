@@ -8,263 +8,452 @@ import (
 
 	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
 	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/sqlb"
 	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
 	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
 )
 
 // PostgresUserRepository implements service.UserRepository using PostgreSQL
 type PostgresUserRepository struct {
+	options
 	db     database.Connection
 	logger logger.Logger
 }
 
 // NewPostgresUserRepository creates a new PostgreSQL user repository
-func NewPostgresUserRepository(db database.Connection, logger logger.Logger) *PostgresUserRepository {
+func NewPostgresUserRepository(db database.Connection, logger logger.Logger, opts ...Option) *PostgresUserRepository {
 	return &PostgresUserRepository{
-		db:     db,
-		logger: logger,
+		options: newOptions(opts),
+		db:      db,
+		logger:  logger,
 	}
 }
 
-// FindByID retrieves a user by their ID
-func (r *PostgresUserRepository) FindByID(id int) (service.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// emailInUse reports an email address that belongs to another user
+func emailInUse(email string) error {
+	return appErrors.NewConflictError(fmt.Sprintf("email address %q is used by another user", email), nil)
+}
 
-	query := `
-		SELECT id, name, email, role, active, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
+// userRecord is a user as stored
+type userRecord struct {
+	ID        int       `db:"id"`
+	Name      string    `db:"name"`
+	Email     string    `db:"email"`
+	Role      string    `db:"role"`
+	Active    bool      `db:"active"`
+	Version   int       `db:"version"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
 
-	row := r.db.QueryRow(ctx, query, id)
+// listedUser is a listed user record, which may be deleted
+type listedUser struct {
+	userRecord
+	DeletedAt *time.Time `db:"deleted_at"`
+}
 
-	var user service.User
-	var createdAt, updatedAt time.Time
+// Columns selected for found and listed users
+var (
+	userColumns       = database.Columns[userRecord]()
+	listedUserColumns = database.Columns[listedUser]()
+)
 
-	err := row.Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.Role,
-		&user.Active,
-		&createdAt,
-		&updatedAt,
-	)
+// user converts the record to a service user
+func (u userRecord) user() service.User {
+	return service.User{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		Role:      u.Role,
+		Active:    u.Active,
+		Version:   u.Version,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// user converts the record to a service user
+func (u listedUser) user() service.User {
+	user := u.userRecord.user()
+	if u.DeletedAt != nil {
+		user.DeletedAt = u.DeletedAt.Format(time.RFC3339)
+	}
+	return user
+}
 
+// FindByID retrieves a user by their ID
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id int) (service.User, error) {
+	ctx, cancel := r.operation(ctx, "users.find_by_id")
+	defer cancel()
+
+	statement, args, err := sqlb.Select(userColumns...).
+		From("users").
+		Where("id = ? AND deleted_at IS NULL", id).
+		Build(sqlb.Postgres)
 	if err != nil {
+		return service.User{}, databaseError(ctx, "failed to build user query", err)
+	}
+
+	var record userRecord
+	if err := database.ScanStruct(r.db.QueryRow(ctx, statement, args...), &record); err != nil {
 		if errors.Is(err, database.ErrNoRows) {
 			return service.User{}, appErrors.NewNotFoundError("user not found", nil)
 		}
-		return service.User{}, appErrors.NewDatabaseError("error retrieving user", err)
+		return service.User{}, databaseError(ctx, "error retrieving user", err)
 	}
+	return record.user(), nil
+}
 
-	user.CreatedAt = createdAt.Format(time.RFC3339)
-	user.UpdatedAt = updatedAt.Format(time.RFC3339)
-
-	return user, nil
+// userSchema lists the user fields clients may sort and filter by
+var userSchema = query.Schema{
+	Fields: map[string]query.Field{
+		"id":         {Column: "id", Type: query.Int, Sortable: true, Filterable: true},
+		"name":       {Column: "name", Type: query.String, Sortable: true, Filterable: true},
+		"email":      {Column: "email", Type: query.String, Sortable: true, Filterable: true},
+		"role":       {Column: "role", Type: query.String, Sortable: true, Filterable: true},
+		"active":     {Column: "active", Type: query.Bool, Filterable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true, Filterable: true},
+		"updated_at": {Column: "updated_at", Type: query.Time, Sortable: true, Filterable: true},
+		"deleted":    {Column: "(deleted_at IS NOT NULL)", Type: query.Bool, Filterable: true},
+	},
+	Key: "id",
 }
 
-// FindAll retrieves all users
-func (r *PostgresUserRepository) FindAll() ([]service.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// withoutDeleted excludes deleted users from a list unless opts filter by
+// deletion explicitly, as in ?deleted=true
+func withoutDeleted(opts query.Options) query.Options {
+	for _, filter := range opts.Filters {
+		if filter.Field == "deleted" {
+			return opts
+		}
+	}
+	filters := make([]query.Filter, len(opts.Filters), len(opts.Filters)+1)
+	copy(filters, opts.Filters)
+	opts.Filters = append(filters, query.Filter{Field: "deleted", Op: query.OpEq, Value: "false"})
+	return opts
+}
 
-	query := `
-		SELECT id, name, email, role, active, created_at, updated_at
-		FROM users
-		ORDER BY id
-	`
+// sortValue returns the value of a sortable field of the record, with
+// timestamps at the full precision cursors need
+func (u listedUser) sortValue(field string) interface{} {
+	switch field {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "role":
+		return u.Role
+	case "created_at":
+		return u.CreatedAt
+	case "updated_at":
+		return u.UpdatedAt
+	}
+	return u.ID
+}
 
-	rows, err := r.db.Query(ctx, query)
+// List retrieves a page of users matching opts. Deleted users are only
+// listed when opts filter by deleted.
+func (r *PostgresUserRepository) List(ctx context.Context, opts query.Options) (query.Page[service.User], error) {
+	q, err := userSchema.Build(withoutDeleted(opts), 1)
 	if err != nil {
-		return nil, appErrors.NewDatabaseError("error retrieving users", err)
+		return query.Page[service.User]{}, err
 	}
-	defer rows.Close()
-
-	var users []service.User
-
-	for rows.Next() {
-		var user service.User
-		var createdAt, updatedAt time.Time
-
-		err := rows.Scan(
-			&user.ID,
-			&user.Name,
-			&user.Email,
-			&user.Role,
-			&user.Active,
-			&createdAt,
-			&updatedAt,
-		)
 
-		if err != nil {
-			return nil, appErrors.NewDatabaseError("error scanning user", err)
-		}
+	ctx, cancel := r.operation(ctx, "users.list")
+	defer cancel()
 
-		user.CreatedAt = createdAt.Format(time.RFC3339)
-		user.UpdatedAt = updatedAt.Format(time.RFC3339)
+	statement, _, err := sqlb.Select(listedUserColumns...).From("users").Build(sqlb.Postgres)
+	if err != nil {
+		return query.Page[service.User]{}, databaseError(ctx, "failed to build user query", err)
+	}
 
-		users = append(users, user)
+	rows, err := r.db.Query(ctx, statement+q.Clauses(), q.Args...)
+	if err != nil {
+		return query.Page[service.User]{}, databaseError(ctx, "error retrieving users", err)
+	}
+	users, err := database.ScanAll[listedUser](rows)
+	if err != nil {
+		return query.Page[service.User]{}, databaseError(ctx, "error scanning users", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, appErrors.NewDatabaseError("error iterating users", err)
+	page, err := query.NewPage(users, q, listedUser.sortValue)
+	if err != nil {
+		return query.Page[service.User]{}, err
 	}
+	return query.Map(page, listedUser.user), nil
+}
 
-	return users, nil
+// txOptions logs the transactions retried after serialization failures
+func (r *PostgresUserRepository) txOptions() []database.TxOption {
+	return []database.TxOption{
+		database.OnTxRetry(func(attempt int, err error) {
+			r.logger.WithError(err).WithField("attempt", attempt).Warn("Retrying user transaction")
+		}),
+	}
 }
 
 // Create creates a new user
-func (r *PostgresUserRepository) Create(user service.User) (service.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *PostgresUserRepository) Create(ctx context.Context, user service.User) (service.User, error) {
+	ctx, cancel := r.operation(ctx, "users.create")
 	defer cancel()
 
-	// Start a transaction
-	tx, err := r.db.Begin(ctx)
+	now := time.Now().UTC()
+
+	statement, args, err := sqlb.Insert("users").
+		Set("name", user.Name).
+		Set("email", user.Email).
+		Set("role", user.Role).
+		Set("active", user.Active).
+		Set("created_at", now).
+		Set("updated_at", now).
+		Returning("id", "version").
+		Build(sqlb.Postgres)
 	if err != nil {
-		return service.User{}, appErrors.NewDatabaseError("failed to begin transaction", err)
+		return service.User{}, databaseError(ctx, "failed to build user insert", err)
 	}
-	
-	// Use defer with a function to handle the rollback error
-	defer func() {
-		if err := tx.Rollback(); err != nil && !errors.Is(err, database.ErrTxDone) {
-			// Only log the error, don't override the function's error return
-			r.logger.WithError(err).Error("failed to rollback transaction")
+
+	err = database.WithTx(ctx, r.db, func(tx database.Transaction) error {
+		if err := tx.QueryRow(ctx, statement, args...).Scan(&user.ID, &user.Version); err != nil {
+			return err
+		}
+		return r.publish(ctx, tx, Change{Resource: "user", Action: ChangeCreated, ID: user.ID, Version: user.Version})
+	}, r.txOptions()...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return service.User{}, emailInUse(user.Email)
 		}
-	}()
+		return service.User{}, databaseError(ctx, "failed to create user", err)
+	}
 
-	now := time.Now().UTC()
+	user.CreatedAt = now.Format(time.RFC3339)
+	user.UpdatedAt = now.Format(time.RFC3339)
+	return user, nil
+}
 
-	query := `
-		INSERT INTO users (name, email, role, active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id
-	`
+// Update stores user if its Version is still the stored version, which is
+// then incremented. A user changed meanwhile is reported as a conflict.
+func (r *PostgresUserRepository) Update(ctx context.Context, user service.User) (service.User, error) {
+	ctx, cancel := r.operation(ctx, "users.update")
+	defer cancel()
 
-	row := tx.QueryRow(ctx, query,
-		user.Name,
-		user.Email,
-		user.Role,
-		user.Active,
-		now,
-		now,
-	)
+	now := time.Now().UTC()
 
-	err = row.Scan(&user.ID)
+	statement, args, err := sqlb.Update("users").
+		Set("name", user.Name).
+		Set("email", user.Email).
+		Set("role", user.Role).
+		Set("active", user.Active).
+		Set("updated_at", now).
+		SetExpr("version", "version + 1").
+		Where("id = ? AND version = ? AND deleted_at IS NULL", user.ID, user.Version).
+		Build(sqlb.Postgres)
 	if err != nil {
-		return service.User{}, appErrors.NewDatabaseError("failed to create user", err)
+		return service.User{}, databaseError(ctx, "failed to build user update", err)
 	}
 
-	user.CreatedAt = now.Format(time.RFC3339)
-	user.UpdatedAt = now.Format(time.RFC3339)
-
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return service.User{}, appErrors.NewDatabaseError("failed to commit user creation", err)
+	err = database.WithTx(ctx, r.db, func(tx database.Transaction) error {
+		result, err := tx.Execute(ctx, statement, args...)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return r.missingVersion(ctx, tx, user)
+		}
+		return r.publish(ctx, tx, Change{Resource: "user", Action: ChangeUpdated, ID: user.ID, Version: user.Version + 1})
+	}, r.txOptions()...)
+	if err != nil {
+		var appErr *appErrors.Error
+		switch {
+		case errors.As(err, &appErr):
+			return service.User{}, err
+		case isUniqueViolation(err):
+			return service.User{}, emailInUse(user.Email)
+		}
+		return service.User{}, databaseError(ctx, "failed to update user", err)
 	}
 
+	user.Version++
+	user.UpdatedAt = now.Format(time.RFC3339)
 	return user, nil
 }
 
-// Update updates an existing user
-func (r *PostgresUserRepository) Update(user service.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Start a transaction
-	tx, err := r.db.Begin(ctx)
+// missingVersion explains why a conditional update matched no row: either
+// the user does not exist or it has a newer version
+func (r *PostgresUserRepository) missingVersion(ctx context.Context, tx database.Transaction, user service.User) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`, user.ID).Scan(&exists)
 	if err != nil {
-		return appErrors.NewDatabaseError("failed to begin transaction", err)
+		return databaseError(ctx, "failed to check user", err)
 	}
-	
-	// Use defer with a function to handle the rollback error
-	defer func() {
-		if err := tx.Rollback(); err != nil && !errors.Is(err, database.ErrTxDone) {
-			// Only log the error, don't override the function's error return
-			r.logger.WithError(err).Error("failed to rollback transaction")
-		}
-	}()
+	if !exists {
+		return appErrors.NewNotFoundError(fmt.Sprintf("user with ID %d not found", user.ID), nil)
+	}
+	return appErrors.NewConflictError(fmt.Sprintf("user with ID %d was modified, version %d is stale", user.ID, user.Version), nil)
+}
+
+// Delete marks a user as deleted. The row is kept so references to the
+// user stay valid until the retention period ends.
+func (r *PostgresUserRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.operation(ctx, "users.delete")
+	defer cancel()
 
 	now := time.Now().UTC()
 
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, role = $3, active = $4, updated_at = $5
-		WHERE id = $6
+		SET deleted_at = $1, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL
 	`
 
-	result, err := tx.Execute(ctx, query,
-		user.Name,
-		user.Email,
-		user.Role,
-		user.Active,
-		now,
-		user.ID,
-	)
+	err := database.WithTx(ctx, r.db, func(tx database.Transaction) error {
+		result, err := tx.Execute(ctx, query, now, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return appErrors.NewNotFoundError(fmt.Sprintf("user with ID %d not found", id), nil)
+		}
+		return r.publish(ctx, tx, Change{Resource: "user", Action: ChangeDeleted, ID: id})
+	}, r.txOptions()...)
 	if err != nil {
-		return appErrors.NewDatabaseError("failed to update user", err)
+		var appErr *appErrors.Error
+		if errors.As(err, &appErr) {
+			return err
+		}
+		return databaseError(ctx, "failed to delete user", err)
 	}
+	return nil
+}
 
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return appErrors.NewDatabaseError("failed to get affected rows", err)
-	}
-	if rowsAffected == 0 {
-		return appErrors.NewNotFoundError(fmt.Sprintf("user with ID %d not found", user.ID), nil)
-	}
+// Restore undoes the deletion of a user that has not been anonymized yet
+func (r *PostgresUserRepository) Restore(ctx context.Context, id int) (service.User, error) {
+	restoreCtx, cancel := r.operation(ctx, "users.restore")
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NOT NULL AND anonymized_at IS NULL
+	`
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return appErrors.NewDatabaseError("failed to commit user update", err)
+	err := database.WithTx(restoreCtx, r.db, func(tx database.Transaction) error {
+		result, err := tx.Execute(restoreCtx, query, time.Now().UTC(), id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return appErrors.NewNotFoundError(fmt.Sprintf("no restorable deleted user with ID %d", id), nil)
+		}
+		return r.publish(restoreCtx, tx, Change{Resource: "user", Action: ChangeRestored, ID: id})
+	}, r.txOptions()...)
+	if err != nil {
+		var appErr *appErrors.Error
+		switch {
+		case errors.As(err, &appErr):
+			return service.User{}, err
+		case isUniqueViolation(err):
+			return service.User{}, appErrors.NewConflictError(fmt.Sprintf("email address of user %d is used by another user", id), nil)
+		}
+		return service.User{}, databaseError(restoreCtx, "failed to restore user", err)
 	}
 
-	return nil
+	return r.FindByID(ctx, id)
 }
 
-// Delete deletes a user by their ID
-func (r *PostgresUserRepository) Delete(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Anonymize replaces the personal data of up to limit users deleted before
+// the given time and returns their IDs. The rows are kept, so anything
+// referencing the users stays valid.
+func (r *PostgresUserRepository) Anonymize(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error) {
+	ctx, cancel := r.operation(ctx, "users.anonymize")
 	defer cancel()
 
-	// Start a transaction
-	tx, err := r.db.Begin(ctx)
-	if err != nil {
-		return appErrors.NewDatabaseError("failed to begin transaction", err)
-	}
-	
-	// Use defer with a function to handle the rollback error
-	defer func() {
-		if err := tx.Rollback(); err != nil && !errors.Is(err, database.ErrTxDone) {
-			// Only log the error, don't override the function's error return
-			r.logger.WithError(err).Error("failed to rollback transaction")
-		}
-	}()
+	query := `
+		UPDATE users
+		SET name = 'Deleted user', email = 'deleted-' || id || '@anonymized.invalid', active = FALSE,
+			anonymized_at = $1, updated_at = $1, version = version + 1
+		WHERE id IN (
+			SELECT id FROM users
+			WHERE deleted_at < $2 AND anonymized_at IS NULL
+			ORDER BY deleted_at
+			LIMIT $3
+		)
+		RETURNING id
+	`
+
+	return r.retain(ctx, ChangeAnonymized, query, time.Now().UTC(), deletedBefore, limit)
+}
+
+// Purge permanently removes up to limit users deleted before the given
+// time and returns their IDs
+func (r *PostgresUserRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error) {
+	ctx, cancel := r.operation(ctx, "users.purge")
+	defer cancel()
 
 	query := `
 		DELETE FROM users
-		WHERE id = $1
+		WHERE id IN (
+			SELECT id FROM users
+			WHERE deleted_at < $1
+			ORDER BY deleted_at
+			LIMIT $2
+		)
+		RETURNING id
 	`
 
-	result, err := tx.Execute(ctx, query, id)
+	return r.retain(ctx, ChangePurged, query, deletedBefore, limit)
+}
+
+// retain runs a retention statement returning the IDs of the users it
+// changed and publishes a change with action for each of them in the same
+// transaction
+func (r *PostgresUserRepository) retain(ctx context.Context, action, query string, args ...interface{}) ([]int, error) {
+	var ids []int
+	err := database.WithTx(ctx, r.db, func(tx database.Transaction) error {
+		var err error
+		if ids, err = retainedIDs(ctx, tx, query, args...); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := r.publish(ctx, tx, Change{Resource: "user", Action: action, ID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, r.txOptions()...)
 	if err != nil {
-		return appErrors.NewDatabaseError("failed to delete user", err)
+		return nil, databaseError(ctx, "failed to apply user retention", err)
 	}
+	return ids, nil
+}
 
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
+// retainedIDs runs a retention statement and scans the returned IDs
+func retainedIDs(ctx context.Context, tx database.Transaction, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(ctx, query, args...)
 	if err != nil {
-		return appErrors.NewDatabaseError("failed to get affected rows", err)
-	}
-	if rowsAffected == 0 {
-		return appErrors.NewNotFoundError(fmt.Sprintf("user with ID %d not found", id), nil)
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return appErrors.NewDatabaseError("failed to commit user deletion", err)
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
 	}
-
-	return nil
-}
\ No newline at end of file
+	return ids, rows.Err()
+}
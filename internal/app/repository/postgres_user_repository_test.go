@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/app/service"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/fake"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/postgres"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/replica"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRepository(t *testing.T, opts ...Option) (*PostgresUserRepository, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	log := logger.NewLogger(logger.LoggerConfig{
+		Output:    io.Discard,
+		Formatter: &logrus.JSONFormatter{},
+		Level:     logrus.InfoLevel,
+	})
+	return NewPostgresUserRepository(postgres.NewProvider(log).Wrap(db), log, opts...), mock
+}
+
+func userRows() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{"id", "name", "email", "role", "active", "version", "created_at", "updated_at"}).
+		AddRow(1, "Ada", "ada@example.com", "admin", true, 1, now, now)
+}
+
+func listRows(deletedAt interface{}) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{"id", "name", "email", "role", "active", "version", "created_at", "updated_at", "deleted_at"}).
+		AddRow(1, "Ada", "ada@example.com", "admin", true, 1, now, now, deletedAt)
+}
+
+func TestPostgresUserRepository_Cancellation(t *testing.T) {
+	t.Run("Should not query when the request was already cancelled", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := repo.FindByID(ctx, 1)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should abort a running query when the request is cancelled", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectQuery("SELECT (.+) FROM users").WillDelayFor(time.Minute).WillReturnRows(userRows())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := repo.List(ctx, query.Options{})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("Should apply the configured operation timeout", func(t *testing.T) {
+		repo, mock := newTestRepository(t, WithOperationTimeouts(map[string]time.Duration{"users.find_by_id": 50 * time.Millisecond}))
+		mock.ExpectQuery("SELECT (.+) FROM users").WillDelayFor(time.Minute).WillReturnRows(userRows())
+
+		_, err := repo.FindByID(context.Background(), 1)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Should complete queries within their timeout", func(t *testing.T) {
+		repo, mock := newTestRepository(t, WithTimeout(time.Second))
+		mock.ExpectQuery("SELECT (.+) FROM users").WithArgs(1).WillReturnRows(userRows())
+
+		user, err := repo.FindByID(context.Background(), 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Ada", user.Name)
+	})
+}
+
+func TestPostgresUserRepository_Update(t *testing.T) {
+	user := service.User{ID: 1, Name: "Ada", Email: "ada@example.com", Role: "admin", Active: true, Version: 3}
+
+	t.Run("Should update the expected version and increment it", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").
+			WithArgs("Ada", "ada@example.com", "admin", true, sqlmock.AnyArg(), 1, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		updated, err := repo.Update(context.Background(), user)
+
+		require.NoError(t, err)
+		assert.Equal(t, 4, updated.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should report a stale version as a conflict", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		_, err := repo.Update(context.Background(), user)
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeConflict, appErr.Type)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should report a missing user as not found", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectRollback()
+
+		_, err := repo.Update(context.Background(), user)
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeNotFound, appErr.Type)
+	})
+
+	t.Run("Should publish the change in the transaction", func(t *testing.T) {
+		repo, mock := newTestRepository(t, WithChangeFeed("changes"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`SELECT pg_notify`).
+			WithArgs("changes", `{"resource":"user","action":"updated","id":1,"version":4}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, err := repo.Update(context.Background(), user)
+
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should retry serialization failures", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnError(&pq.Error{Code: "40001"})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, err := repo.Update(context.Background(), user)
+
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresUserRepository_Create(t *testing.T) {
+	t.Run("Should insert the user and return its ID and version", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO users \(name, email, role, active, created_at, updated_at\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) RETURNING id, version`).
+			WithArgs("Ada", "ada@example.com", "admin", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(7, 1))
+		mock.ExpectCommit()
+
+		created, err := repo.Create(context.Background(), service.User{Name: "Ada", Email: "ada@example.com", Role: "admin", Active: true})
+
+		require.NoError(t, err)
+		assert.Equal(t, 7, created.ID)
+		assert.Equal(t, 1, created.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should report a used email as a conflict", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO users").WillReturnError(&pq.Error{Code: uniqueViolation})
+		mock.ExpectRollback()
+
+		_, err := repo.Create(context.Background(), service.User{Name: "Ada", Email: "ada@example.com"})
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeConflict, appErr.Type)
+	})
+}
+
+func TestPostgresUserRepository_SoftDelete(t *testing.T) {
+	t.Run("Should mark users as deleted instead of removing them", func(t *testing.T) {
+		repo, mock := newTestRepository(t, WithChangeFeed("changes"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`SELECT pg_notify`).
+			WithArgs("changes", `{"resource":"user","action":"deleted","id":1}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, repo.Delete(context.Background(), 1))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should report missing users and roll back", func(t *testing.T) {
+		repo, mock := newTestRepository(t, WithChangeFeed("changes"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.Delete(context.Background(), 2)
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeNotFound, appErr.Type)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should exclude deleted users from lists unless asked for", func(t *testing.T) {
+		repo, mock := newTestRepository(t)
+		mock.ExpectQuery(`WHERE \(deleted_at IS NOT NULL\) = \$1`).WithArgs(false).WillReturnRows(listRows(nil))
+
+		_, err := repo.List(context.Background(), query.Options{})
+		assert.NoError(t, err)
+
+		opts := query.Options{Filters: []query.Filter{{Field: "deleted", Op: query.OpEq, Value: "true"}}}
+		mock.ExpectQuery(`WHERE \(deleted_at IS NOT NULL\) = \$1 ORDER`).WithArgs(true).WillReturnRows(listRows(time.Now()))
+
+		page, err := repo.List(context.Background(), opts)
+		require.NoError(t, err)
+		assert.NotEmpty(t, page.Items[0].DeletedAt)
+	})
+
+	t.Run("Should anonymize deleted users in place", func(t *testing.T) {
+		repo, mock := newTestRepository(t, WithChangeFeed("changes"))
+		before := time.Now().Add(-time.Hour)
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE users SET name = 'Deleted user'").WithArgs(sqlmock.AnyArg(), before, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(5))
+		for _, id := range []string{"3", "5"} {
+			mock.ExpectExec(`SELECT pg_notify`).
+				WithArgs("changes", `{"resource":"user","action":"anonymized","id":`+id+`}`).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+
+		ids, err := repo.Anonymize(context.Background(), before, 10)
+
+		require.NoError(t, err)
+		assert.Equal(t, []int{3, 5}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresUserRepository_Replicas(t *testing.T) {
+	t.Run("Should read users from the primary before writing while replicas lag", func(t *testing.T) {
+		provider := fake.NewProvider()
+		log, _ := logger.NewCaptureLogger(logger.BackendLogrus)
+		node := func(name string) []replica.Node {
+			return []replica.Node{{Name: name, Config: database.Config{ConnectionString: name}}}
+		}
+		router, err := replica.New(context.Background(), provider, node("primary"), node("replica"),
+			replica.WithLogger(log),
+			replica.WithRecoveryFunc(func(context.Context, database.Connection) (bool, error) { return false, nil }))
+		require.NoError(t, err)
+		t.Cleanup(func() { router.Close() })
+
+		now := time.Now()
+		provider.Conn("primary").SetRows([]interface{}{1, "Ada", "ada@example.com", "admin", true, 2, now, now})
+		provider.Conn("replica").SetRows([]interface{}{1, "Ada", "ada@example.com", "admin", true, 1, now, now})
+
+		users := service.NewUserService(NewPostgresUserRepository(router, log))
+		_, err = users.UpdateUser(context.Background(), service.User{ID: 1, Name: "Ada Lovelace", Email: "ada@example.com", Role: "admin", Active: true, Version: 2})
+		require.NoError(t, err)
+		require.NoError(t, users.DeactivateUser(context.Background(), 1))
+		require.NoError(t, users.DeleteUser(context.Background(), 1))
+
+		assert.Empty(t, provider.Conn("replica").Statements())
+	})
+}
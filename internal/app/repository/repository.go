@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+)
+
+// DefaultTimeout bounds each repository operation unless configured
+// otherwise. A shorter deadline of the caller's context takes precedence.
+const DefaultTimeout = 5 * time.Second
+
+// options holds the settings shared by the repositories
+type options struct {
+	timeout  time.Duration
+	timeouts map[string]time.Duration
+	changes  string
+}
+
+// Option configures optional repository behaviour
+type Option func(*options)
+
+// WithTimeout bounds every operation that has no timeout of its own
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.timeout = timeout
+		}
+	}
+}
+
+// WithOperationTimeouts bounds individual operations, keyed by query name
+// such as "users.list"
+func WithOperationTimeouts(timeouts map[string]time.Duration) Option {
+	return func(o *options) {
+		for name, timeout := range timeouts {
+			o.timeouts[name] = timeout
+		}
+	}
+}
+
+// WithChangeFeed publishes a Change on channel for every row created,
+// updated or deleted, in the transaction making the change where there is
+// one. Connections that cannot notify publish nothing.
+func WithChangeFeed(channel string) Option {
+	return func(o *options) {
+		o.changes = channel
+	}
+}
+
+// newOptions applies opts to the defaults
+func newOptions(opts []Option) options {
+	o := options{
+		timeout:  DefaultTimeout,
+		timeouts: make(map[string]time.Duration),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// operation derives the context of a named operation from the caller's
+// context, bounded by the operation's timeout
+func (o options) operation(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	timeout, ok := o.timeouts[name]
+	if !ok || timeout <= 0 {
+		timeout = o.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return database.WithQueryName(ctx, name), cancel
+}
+
+// databaseError wraps a failed query. The driver reports aborted queries
+// in its own terms, so the context error is kept alongside it to let
+// callers tell timeouts and cancellations apart.
+func databaseError(ctx context.Context, message string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return appErrors.NewDatabaseError(message, err)
+}
+
+// PostgreSQL error codes of constraint violations
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// isUniqueViolation reports whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// isForeignKeyViolation reports whether err was caused by a reference to a
+// missing row
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"strings"
+	"time"
+)
+
+// The audit log is append-only and hash chained, so entries cannot be
+// anonymized or purged with the users they mention. Audited states
+// therefore leave out names and email addresses: users are identified by
+// ID, and only the fact that personal data changed is recorded.
+
+// PersonalDataChangedKey is the audit metadata key listing the personal
+// data fields a change modified, such as "Email,Name"
+const PersonalDataChangedKey = "personal_data_changed"
+
+// auditedUser is the state of a user recorded in the audit log
+type auditedUser struct {
+	ID        int
+	Role      string
+	Active    bool
+	Version   int
+	CreatedAt string
+	UpdatedAt string
+	DeletedAt string `json:",omitempty"`
+}
+
+// auditedInvitation is the state of an invitation recorded in the audit log
+type auditedInvitation struct {
+	ID         int
+	UserID     int
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	AcceptedAt *time.Time `json:",omitempty"`
+	RevokedAt  *time.Time `json:",omitempty"`
+}
+
+// auditedMember is a team member recorded in the audit log
+type auditedMember struct {
+	UserID int
+	Role   string
+}
+
+// auditedTeam is the state of a team recorded in the audit log
+type auditedTeam struct {
+	ID          int
+	Name        string
+	Description string
+	CreatedAt   string
+	Members     []auditedMember `json:",omitempty"`
+}
+
+// auditState returns the state to record for value, without personal data
+func auditState(value interface{}) interface{} {
+	switch v := value.(type) {
+	case User:
+		return auditedUser{
+			ID:        v.ID,
+			Role:      v.Role,
+			Active:    v.Active,
+			Version:   v.Version,
+			CreatedAt: v.CreatedAt,
+			UpdatedAt: v.UpdatedAt,
+			DeletedAt: v.DeletedAt,
+		}
+	case Invitation:
+		return auditedInvitation{
+			ID:         v.ID,
+			UserID:     v.UserID,
+			ExpiresAt:  v.ExpiresAt,
+			CreatedAt:  v.CreatedAt,
+			AcceptedAt: v.AcceptedAt,
+			RevokedAt:  v.RevokedAt,
+		}
+	case Team:
+		team := auditedTeam{ID: v.ID, Name: v.Name, Description: v.Description, CreatedAt: v.CreatedAt}
+		for _, member := range v.Members {
+			team.Members = append(team.Members, auditedMember{UserID: member.UserID, Role: member.Role})
+		}
+		return team
+	}
+	return value
+}
+
+// personalDataChanged lists the personal data fields that differ between
+// two states of a user, empty unless both are users
+func personalDataChanged(before, after interface{}) string {
+	old, ok := before.(User)
+	if !ok {
+		return ""
+	}
+	updated, ok := after.(User)
+	if !ok {
+		return ""
+	}
+
+	var fields []string
+	if old.Email != updated.Email {
+		fields = append(fields, "Email")
+	}
+	if old.Name != updated.Name {
+		fields = append(fields, "Name")
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/mailer"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/token"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Defaults used when an InvitationService leaves them unset
+const (
+	DefaultInvitationTTL = 72 * time.Hour
+	DefaultSender        = "noreply@localhost"
+)
+
+// invitationPurpose binds invitation tokens to the invitation flow
+const invitationPurpose = "invitation"
+
+// Invitation errors, wrapped in validation errors
+var (
+	ErrInvitationExpired = errors.New("invitation has expired")
+	ErrInvitationRevoked = errors.New("invitation has been revoked")
+)
+
+// Invitation is an invitation emailed to a new user, who becomes active
+// by accepting it
+type Invitation struct {
+	ID         int
+	UserID     int
+	Email      string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	AcceptedAt *time.Time `json:",omitempty" yaml:",omitempty"`
+	RevokedAt  *time.Time `json:",omitempty" yaml:",omitempty"`
+}
+
+// Pending reports whether the invitation can still be accepted or resent
+func (i Invitation) Pending() bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil
+}
+
+// InvitationRepository stores invitations
+type InvitationRepository interface {
+	Create(ctx context.Context, invitation Invitation) (Invitation, error)
+	FindByID(ctx context.Context, id int) (Invitation, error)
+	// Accept and Revoke close a pending invitation. Invitations closed
+	// already are reported as a conflict error.
+	Accept(ctx context.Context, id int) error
+	Revoke(ctx context.Context, id int) error
+	// Reopen undoes Accept, for an acceptance that could not be completed
+	Reopen(ctx context.Context, id int) error
+}
+
+// invitationTemplate is the body of invitation emails
+var invitationTemplate = template.Must(template.New("invitation").Parse(`Hello {{.Name}},
+
+You have been invited to Scrutiny. Accept the invitation to activate your
+account:
+
+{{.Link}}
+
+The invitation expires on {{.ExpiresAt.Format "2 January 2006 15:04 MST"}}.
+`))
+
+// InvitationService invites users by email and activates them when they
+// accept, which proves they own their address
+type InvitationService struct {
+	users       *UserService
+	invitations InvitationRepository
+	mailer      mailer.Mailer
+	signer      *token.Signer
+	ttl         time.Duration
+	sender      string
+	acceptURL   string
+}
+
+// InvitationOption configures optional InvitationService settings
+type InvitationOption func(*InvitationService)
+
+// WithInvitationTTL sets how long invitations can be accepted
+func WithInvitationTTL(ttl time.Duration) InvitationOption {
+	return func(s *InvitationService) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// WithSender sets the From address of invitation emails
+func WithSender(from string) InvitationOption {
+	return func(s *InvitationService) {
+		if from != "" {
+			s.sender = from
+		}
+	}
+}
+
+// WithAcceptURL links invitation emails to the page accepting them, which
+// receives the token in the token query parameter. Without it the email
+// contains the bare token.
+func WithAcceptURL(acceptURL string) InvitationOption {
+	return func(s *InvitationService) {
+		s.acceptURL = acceptURL
+	}
+}
+
+// NewInvitationService creates an InvitationService creating users with
+// users and signing invitation tokens with signer
+func NewInvitationService(users *UserService, invitations InvitationRepository, m mailer.Mailer, signer *token.Signer, opts ...InvitationOption) *InvitationService {
+	s := &InvitationService{
+		users:       users,
+		invitations: invitations,
+		mailer:      m,
+		signer:      signer,
+		ttl:         DefaultInvitationTTL,
+		sender:      DefaultSender,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Invite creates an inactive user and emails them an invitation. When the
+// email cannot be sent the invitation is kept and can be resent.
+func (s *InvitationService) Invite(ctx context.Context, user User) (invitation Invitation, err error) {
+	ctx, span := s.users.startSpan(ctx, "Invite")
+	defer func() { endSpan(span, err) }()
+
+	user.Active = false
+	created, err := s.users.CreateUser(ctx, user)
+	if err != nil {
+		return Invitation{}, err
+	}
+	return s.send(ctx, created, "user.invite")
+}
+
+// Resend replaces a pending invitation with a new one, with a new expiry,
+// and emails it. The previous invitation is revoked only once the new one
+// has been sent, so it stays valid when sending fails.
+func (s *InvitationService) Resend(ctx context.Context, id int) (invitation Invitation, err error) {
+	ctx, span := s.users.startSpan(ctx, "ResendInvitation", attribute.Int("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+
+	previous, err := s.invitations.FindByID(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if !previous.Pending() {
+		return Invitation{}, appErrors.NewConflictError(fmt.Sprintf("invitation with ID %d is no longer pending", id), nil)
+	}
+	user, err := s.users.GetUserByID(ctx, previous.UserID)
+	if err != nil {
+		return Invitation{}, err
+	}
+	invitation, err = s.send(ctx, user, "user.invite_resend")
+	if err != nil {
+		return invitation, err
+	}
+	if err := s.invitations.Revoke(ctx, id); err != nil {
+		return invitation, err
+	}
+	return invitation, nil
+}
+
+// Revoke revokes a pending invitation. The invited user stays inactive.
+func (s *InvitationService) Revoke(ctx context.Context, id int) (err error) {
+	ctx, span := s.users.startSpan(ctx, "RevokeInvitation", attribute.Int("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+
+	invitation, err := s.invitations.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.invitations.Revoke(ctx, id); err != nil {
+		return err
+	}
+	s.users.recordChange(ctx, "user.invite_revoke", invitation.UserID, invitation, nil)
+	return nil
+}
+
+// Accept activates the user invited with tok. Expired and revoked
+// invitations fail with ErrInvitationExpired and ErrInvitationRevoked.
+func (s *InvitationService) Accept(ctx context.Context, tok string) (user User, err error) {
+	ctx, span := s.users.startSpan(ctx, "AcceptInvitation")
+	defer func() { endSpan(span, err) }()
+
+	subject, err := s.signer.Verify(tok, invitationPurpose)
+	if errors.Is(err, token.ErrExpired) {
+		return User{}, appErrors.NewValidationError("cannot accept invitation", ErrInvitationExpired)
+	}
+	if err != nil {
+		return User{}, appErrors.NewValidationError("invalid invitation token", err)
+	}
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return User{}, appErrors.NewValidationError("invalid invitation token", err)
+	}
+
+	invitation, err := s.invitations.FindByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+	if invitation.RevokedAt != nil {
+		return User{}, appErrors.NewValidationError("cannot accept invitation", ErrInvitationRevoked)
+	}
+
+	user, err = s.users.GetUserByID(ctx, invitation.UserID)
+	if err != nil {
+		return User{}, err
+	}
+	if user.Email != invitation.Email {
+		// The address changed since, so the invitation proves nothing
+		return User{}, appErrors.NewValidationError("cannot accept invitation", ErrInvitationRevoked)
+	}
+
+	// Accepting first makes the token single use even for concurrent
+	// requests. It is reopened if the user cannot be activated, so the
+	// token can be used again.
+	if err := s.invitations.Accept(ctx, id); err != nil {
+		return User{}, err
+	}
+
+	user.Active = true
+	activated, err := s.users.update(ctx, user, "user.activate")
+	if err != nil {
+		if reopenErr := s.invitations.Reopen(context.WithoutCancel(ctx), id); reopenErr != nil {
+			logger.FromContext(ctx).Named(LoggerName).WithError(reopenErr).WithField("invitation_id", id).Error("Failed to reopen invitation")
+		}
+		return User{}, err
+	}
+	return activated, nil
+}
+
+// send creates an invitation for user and emails it
+func (s *InvitationService) send(ctx context.Context, user User, action string) (Invitation, error) {
+	invitation, err := s.invitations.Create(ctx, Invitation{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(s.ttl).UTC(),
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	s.users.recordChange(ctx, action, user.ID, nil, invitation)
+
+	tok, err := s.signer.Sign(invitationPurpose, strconv.Itoa(invitation.ID), s.ttl)
+	if err != nil {
+		return invitation, err
+	}
+
+	link := tok
+	if s.acceptURL != "" {
+		u, err := url.Parse(s.acceptURL)
+		if err != nil {
+			return invitation, fmt.Errorf("invalid accept URL: %w", err)
+		}
+		values := u.Query()
+		values.Set("token", tok)
+		u.RawQuery = values.Encode()
+		link = u.String()
+	}
+
+	var body bytes.Buffer
+	err = invitationTemplate.Execute(&body, struct {
+		Name      string
+		Link      string
+		ExpiresAt time.Time
+	}{user.Name, link, invitation.ExpiresAt})
+	if err != nil {
+		return invitation, err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		From:    s.sender,
+		To:      []string{user.Email},
+		Subject: "You have been invited to Scrutiny",
+		Body:    body.String(),
+	})
+	if err != nil {
+		return invitation, fmt.Errorf("failed to send invitation %d: %w", invitation.ID, err)
+	}
+	return invitation, nil
+}
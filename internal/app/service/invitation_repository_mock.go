@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockInvitationRepository is a mock implementation of the
+// InvitationRepository interface
+type MockInvitationRepository struct {
+	mock.Mock
+}
+
+// Create mocks the Create method of the InvitationRepository interface
+func (m *MockInvitationRepository) Create(ctx context.Context, invitation Invitation) (Invitation, error) {
+	args := m.Called(ctx, invitation)
+	return args.Get(0).(Invitation), args.Error(1)
+}
+
+// FindByID mocks the FindByID method of the InvitationRepository interface
+func (m *MockInvitationRepository) FindByID(ctx context.Context, id int) (Invitation, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(Invitation), args.Error(1)
+}
+
+// Accept mocks the Accept method of the InvitationRepository interface
+func (m *MockInvitationRepository) Accept(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Revoke mocks the Revoke method of the InvitationRepository interface
+func (m *MockInvitationRepository) Revoke(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Reopen mocks the Reopen method of the InvitationRepository interface
+func (m *MockInvitationRepository) Reopen(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/mailer"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var linkPattern = regexp.MustCompile(`https://app\.example\.com/\S+`)
+
+type invitationFixture struct {
+	users       *MockUserRepository
+	invitations *MockInvitationRepository
+	mail        *mailer.Memory
+	audit       *audit.MemoryStore
+	service     *InvitationService
+}
+
+func newInvitationFixture(t *testing.T, opts ...InvitationOption) invitationFixture {
+	signer, err := token.NewSigner([]byte(strings.Repeat("k", token.MinSecretLength)))
+	require.NoError(t, err)
+
+	f := invitationFixture{
+		users:       new(MockUserRepository),
+		invitations: new(MockInvitationRepository),
+		mail:        mailer.NewMemory(),
+		audit:       audit.NewMemoryStore(),
+	}
+	opts = append([]InvitationOption{WithAcceptURL("https://app.example.com/accept")}, opts...)
+	users := NewUserService(f.users, WithAuditRecorder(audit.NewRecorder(f.audit)))
+	f.service = NewInvitationService(users, f.invitations, f.mail, signer, opts...)
+	return f
+}
+
+// acceptedToken returns the token linked from the last email sent
+func (f invitationFixture) acceptedToken(t *testing.T) string {
+	messages := f.mail.Messages()
+	require.NotEmpty(t, messages)
+	link, err := url.Parse(linkPattern.FindString(messages[len(messages)-1].Body))
+	require.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func TestInvitationService(t *testing.T) {
+	ada := User{ID: 7, Name: "Ada", Email: "ada@example.com", Role: "user", Version: 1}
+
+	t.Run("Should invite an inactive user and activate them on accept", func(t *testing.T) {
+		f := newInvitationFixture(t)
+		f.users.On("Create", mock.Anything, mock.MatchedBy(func(u User) bool { return !u.Active })).Return(ada, nil)
+		f.invitations.On("Create", mock.Anything, mock.MatchedBy(func(i Invitation) bool { return i.UserID == 7 })).
+			Return(Invitation{ID: 3, UserID: 7, Email: ada.Email, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+
+		invitation, err := f.service.Invite(context.Background(), User{Name: "Ada", Email: "ada@example.com", Role: "user", Active: true})
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, invitation.ID)
+		require.Len(t, f.mail.Messages(), 1)
+		assert.Equal(t, []string{"ada@example.com"}, f.mail.Messages()[0].To)
+
+		f.invitations.On("FindByID", mock.Anything, 3).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email}, nil)
+		f.invitations.On("Accept", mock.Anything, 3).Return(nil).Once()
+		f.users.On("FindByID", mock.Anything, 7).Return(ada, nil)
+		activated := ada
+		activated.Active = true
+		activated.Version = 2
+		f.users.On("Update", mock.Anything, mock.MatchedBy(func(u User) bool { return u.Active })).Return(activated, nil)
+
+		user, err := f.service.Accept(context.Background(), f.acceptedToken(t))
+
+		require.NoError(t, err)
+		assert.True(t, user.Active)
+		f.invitations.AssertExpectations(t)
+
+		entries, err := f.audit.Query(context.Background(), audit.Filter{ResourceType: "user"})
+		require.NoError(t, err)
+		var actions []string
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		assert.Equal(t, []string{"user.create", "user.invite", "user.activate"}, actions)
+	})
+
+	t.Run("Should reopen the invitation when the user cannot be activated", func(t *testing.T) {
+		f := newInvitationFixture(t)
+		f.users.On("Create", mock.Anything, mock.Anything).Return(ada, nil)
+		f.invitations.On("Create", mock.Anything, mock.Anything).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+		_, err := f.service.Invite(context.Background(), ada)
+		require.NoError(t, err)
+
+		f.invitations.On("FindByID", mock.Anything, 3).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email}, nil)
+		f.invitations.On("Accept", mock.Anything, 3).Return(nil).Once()
+		f.invitations.On("Reopen", mock.Anything, 3).Return(nil).Once()
+		f.users.On("FindByID", mock.Anything, 7).Return(ada, nil)
+		f.users.On("Update", mock.Anything, mock.Anything).Return(User{}, errors.New("connection refused"))
+
+		_, err = f.service.Accept(context.Background(), f.acceptedToken(t))
+
+		assert.Error(t, err)
+		f.invitations.AssertExpectations(t)
+	})
+
+	t.Run("Should reject invalid and expired tokens", func(t *testing.T) {
+		f := newInvitationFixture(t, WithInvitationTTL(time.Nanosecond))
+		f.users.On("Create", mock.Anything, mock.Anything).Return(ada, nil)
+		f.invitations.On("Create", mock.Anything, mock.Anything).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email}, nil)
+		_, err := f.service.Invite(context.Background(), ada)
+		require.NoError(t, err)
+
+		_, err = f.service.Accept(context.Background(), f.acceptedToken(t))
+		assert.ErrorIs(t, err, ErrInvitationExpired)
+
+		_, err = f.service.Accept(context.Background(), "forged.token")
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeValidation, appErr.Type)
+		assert.NotErrorIs(t, err, ErrInvitationExpired)
+	})
+
+	t.Run("Should not accept revoked invitations", func(t *testing.T) {
+		f := newInvitationFixture(t)
+		f.users.On("Create", mock.Anything, mock.Anything).Return(ada, nil)
+		f.invitations.On("Create", mock.Anything, mock.Anything).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email}, nil)
+		_, err := f.service.Invite(context.Background(), ada)
+		require.NoError(t, err)
+
+		revokedAt := time.Now()
+		f.invitations.On("FindByID", mock.Anything, 3).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email, RevokedAt: &revokedAt}, nil)
+
+		_, err = f.service.Accept(context.Background(), f.acceptedToken(t))
+
+		assert.ErrorIs(t, err, ErrInvitationRevoked)
+	})
+
+	t.Run("Should revoke the previous invitation on resend", func(t *testing.T) {
+		f := newInvitationFixture(t)
+		f.invitations.On("FindByID", mock.Anything, 3).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email}, nil)
+		f.users.On("FindByID", mock.Anything, 7).Return(ada, nil)
+		f.invitations.On("Revoke", mock.Anything, 3).Return(nil).Once()
+		f.invitations.On("Create", mock.Anything, mock.Anything).Return(Invitation{ID: 4, UserID: 7, Email: ada.Email}, nil)
+
+		invitation, err := f.service.Resend(context.Background(), 3)
+
+		require.NoError(t, err)
+		assert.Equal(t, 4, invitation.ID)
+		assert.Len(t, f.mail.Messages(), 1)
+		f.invitations.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the previous invitation when resending fails", func(t *testing.T) {
+		f := newInvitationFixture(t)
+		f.invitations.On("FindByID", mock.Anything, 3).Return(Invitation{ID: 3, UserID: 7, Email: ada.Email}, nil)
+		f.users.On("FindByID", mock.Anything, 7).Return(ada, nil)
+		f.invitations.On("Create", mock.Anything, mock.Anything).Return(Invitation{}, errors.New("connection refused"))
+
+		_, err := f.service.Resend(context.Background(), 3)
+
+		assert.Error(t, err)
+		f.invitations.AssertNotCalled(t, "Revoke", mock.Anything, 3)
+	})
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RetentionMode is what happens to users once their retention period ends
+type RetentionMode string
+
+// Retention modes
+const (
+	// RetentionAnonymize replaces the personal data of deleted users but
+	// keeps their rows, so references to them stay valid
+	RetentionAnonymize RetentionMode = "anonymize"
+	// RetentionPurge removes deleted users permanently
+	RetentionPurge RetentionMode = "purge"
+)
+
+// DefaultRetentionBatchSize is the number of users handled per statement
+// when a RetentionPolicy leaves BatchSize unset
+const DefaultRetentionBatchSize = 500
+
+// RetentionPolicy decides how long deleted users are kept
+type RetentionPolicy struct {
+	// Period is how long after deletion users are anonymized or purged
+	Period    time.Duration
+	Mode      RetentionMode
+	BatchSize int
+}
+
+// ApplyRetention anonymizes or purges every user deleted longer than the
+// policy's period ago and returns how many there were
+func (s *UserService) ApplyRetention(ctx context.Context, policy RetentionPolicy) (count int, err error) {
+	ctx, span := s.startSpan(ctx, "ApplyRetention", attribute.String("retention.mode", string(policy.Mode)))
+	defer func() { endSpan(span, err) }()
+
+	retain := s.repository.Anonymize
+	switch policy.Mode {
+	case RetentionAnonymize:
+	case RetentionPurge:
+		retain = s.repository.Purge
+	default:
+		return 0, fmt.Errorf("unknown retention mode %q", policy.Mode)
+	}
+
+	batchSize := policy.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultRetentionBatchSize
+	}
+	deletedBefore := time.Now().Add(-policy.Period)
+
+	for {
+		ids, err := retain(ctx, deletedBefore, batchSize)
+		if err != nil {
+			return count, err
+		}
+
+		for _, id := range ids {
+			s.recordChange(ctx, "user."+string(policy.Mode), id, nil, nil)
+		}
+		if s.metrics != nil {
+			s.metrics.Retained.WithLabelValues(string(policy.Mode)).Add(float64(len(ids)))
+		}
+		count += len(ids)
+
+		if len(ids) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+// RunRetention applies the policy every interval until ctx is cancelled.
+// Failed runs are logged and retried at the next interval.
+func (s *UserService) RunRetention(ctx context.Context, policy RetentionPolicy, interval time.Duration) error {
+	log := logger.FromContext(ctx).Named(LoggerName).WithField("mode", string(policy.Mode))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.ApplyRetention(ctx, policy)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.WithError(err).Error("Failed to apply user retention")
+		case count > 0:
+			log.WithField("count", count).Info("Applied user retention")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserService_ApplyRetention(t *testing.T) {
+	t.Run("Should anonymize in batches and audit every user", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("Anonymize", mock.Anything, mock.Anything, 2).Return([]int{1, 2}, nil).Once()
+		mockRepo.On("Anonymize", mock.Anything, mock.Anything, 2).Return([]int{3}, nil).Once()
+
+		auditStore := audit.NewMemoryStore()
+		userService := NewUserService(mockRepo, WithAuditRecorder(audit.NewRecorder(auditStore)))
+
+		count, err := userService.ApplyRetention(context.Background(), RetentionPolicy{Period: time.Hour, Mode: RetentionAnonymize, BatchSize: 2})
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+		mockRepo.AssertExpectations(t)
+
+		entries, err := auditStore.Query(context.Background(), audit.Filter{})
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+		assert.Equal(t, "user.anonymize", entries[0].Action)
+	})
+
+	t.Run("Should only purge users deleted before the period", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		cutoff := time.Now().Add(-24 * time.Hour)
+		mockRepo.On("Purge", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+			return before.Sub(cutoff) >= 0 && before.Sub(cutoff) < time.Minute
+		}), DefaultRetentionBatchSize).Return(nil, nil).Once()
+
+		count, err := NewUserService(mockRepo).ApplyRetention(context.Background(), RetentionPolicy{Period: 24 * time.Hour, Mode: RetentionPurge})
+
+		require.NoError(t, err)
+		assert.Zero(t, count)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Should reject unknown modes", func(t *testing.T) {
+		_, err := NewUserService(new(MockUserRepository)).ApplyRetention(context.Background(), RetentionPolicy{Mode: "shred"})
+		assert.ErrorContains(t, err, "unknown retention mode")
+	})
+}
+
+func TestUserService_RunRetention(t *testing.T) {
+	t.Run("Should run until the context is cancelled", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		ran := make(chan struct{}, 1)
+		mockRepo.On("Anonymize", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Run(func(mock.Arguments) {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- NewUserService(mockRepo).RunRetention(ctx, RetentionPolicy{Mode: RetentionAnonymize}, time.Hour)
+		}()
+
+		<-ran
+		cancel()
+		assert.NoError(t, <-done)
+	})
+}
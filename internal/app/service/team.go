@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Team member roles
+const (
+	TeamRoleMember = "member"
+	TeamRoleLead   = "lead"
+)
+
+// teamName is the format of team names, which rules and tags such as
+// owner=payments refer to
+var teamName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Team is a group of users owning resources
+type Team struct {
+	ID          int
+	Name        string
+	Description string
+	CreatedAt   string
+	// Members is only loaded for single teams
+	Members []TeamMember `json:",omitempty" yaml:",omitempty"`
+}
+
+// TeamMember is a user belonging to a team
+type TeamMember struct {
+	UserID int
+	Name   string
+	Email  string
+	Role   string
+}
+
+// TeamRepository stores teams, their members and the ownership rules
+// assigning resources to them
+type TeamRepository interface {
+	CreateTeam(ctx context.Context, team Team) (Team, error)
+	// FindTeam returns a team with its members
+	FindTeam(ctx context.Context, id int) (Team, error)
+	ListTeams(ctx context.Context) ([]Team, error)
+	// DeleteTeam deletes a team with its memberships and rules
+	DeleteTeam(ctx context.Context, id int) error
+	// SetMember adds a user to a team or changes their role
+	SetMember(ctx context.Context, teamID int, member TeamMember) error
+	RemoveMember(ctx context.Context, teamID, userID int) error
+	CreateRule(ctx context.Context, rule ownership.Rule) (ownership.Rule, error)
+	FindRule(ctx context.Context, id int) (ownership.Rule, error)
+	ListRules(ctx context.Context) ([]ownership.Rule, error)
+	DeleteRule(ctx context.Context, id int) error
+}
+
+// OwnershipMatch is a rule matching a resource with the team it names
+type OwnershipMatch struct {
+	Rule ownership.Rule
+	Team string
+}
+
+// Ownership tells which team owns a resource and why
+type Ownership struct {
+	Resource ownership.Resource
+	// Team owns the resource as decided by Rule
+	Team *Team           `json:",omitempty" yaml:",omitempty"`
+	Rule *ownership.Rule `json:",omitempty" yaml:",omitempty"`
+	// Matches are all rules matching the resource, by precedence
+	Matches []OwnershipMatch
+	// Conflicts are rules as specific as Rule naming other teams
+	Conflicts []OwnershipMatch `json:",omitempty" yaml:",omitempty"`
+}
+
+// TeamService manages teams and resolves the owners of resources
+type TeamService struct {
+	teams    TeamRepository
+	users    *UserService
+	recorder *audit.Recorder
+	tracer   trace.Tracer
+}
+
+// TeamOption configures optional TeamService collaborators
+type TeamOption func(*TeamService)
+
+// WithTeamAuditRecorder records every team and ownership rule change in
+// the audit log
+func WithTeamAuditRecorder(recorder *audit.Recorder) TeamOption {
+	return func(s *TeamService) {
+		s.recorder = recorder
+	}
+}
+
+// WithTeamTracerProvider creates a span for every team service call
+func WithTeamTracerProvider(tp trace.TracerProvider) TeamOption {
+	return func(s *TeamService) {
+		s.tracer = tracing.Tracer(tp)
+	}
+}
+
+// NewTeamService creates a TeamService whose members are users of users
+func NewTeamService(teams TeamRepository, users *UserService, opts ...TeamOption) *TeamService {
+	s := &TeamService{
+		teams:  teams,
+		users:  users,
+		tracer: noop.NewTracerProvider().Tracer(tracing.InstrumentationName),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// CreateTeam creates a team without members
+func (s *TeamService) CreateTeam(ctx context.Context, team Team) (created Team, err error) {
+	ctx, span := s.startSpan(ctx, "CreateTeam")
+	defer func() { endSpan(span, err) }()
+
+	if !teamName.MatchString(team.Name) {
+		return Team{}, appErrors.NewValidationError(fmt.Sprintf("invalid team name %q, use lowercase letters, digits and dashes", team.Name), nil)
+	}
+	team.Members = nil
+
+	created, err = s.teams.CreateTeam(ctx, team)
+	if err != nil {
+		return Team{}, err
+	}
+	s.recordTeam(ctx, "team.create", created.ID, nil, created)
+	return created, nil
+}
+
+// GetTeam retrieves a team with its members
+func (s *TeamService) GetTeam(ctx context.Context, id int) (team Team, err error) {
+	ctx, span := s.startSpan(ctx, "GetTeam", attribute.Int("team.id", id))
+	defer func() { endSpan(span, err) }()
+
+	return s.teams.FindTeam(ctx, id)
+}
+
+// ListTeams retrieves all teams, without their members
+func (s *TeamService) ListTeams(ctx context.Context) (teams []Team, err error) {
+	ctx, span := s.startSpan(ctx, "ListTeams")
+	defer func() { endSpan(span, err) }()
+
+	return s.teams.ListTeams(ctx)
+}
+
+// DeleteTeam deletes a team along with its ownership rules
+func (s *TeamService) DeleteTeam(ctx context.Context, id int) (err error) {
+	ctx, span := s.startSpan(ctx, "DeleteTeam", attribute.Int("team.id", id))
+	defer func() { endSpan(span, err) }()
+
+	team, err := s.teams.FindTeam(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.teams.DeleteTeam(ctx, id); err != nil {
+		return err
+	}
+	s.recordTeam(ctx, "team.delete", id, team, nil)
+	return nil
+}
+
+// SetMember adds an existing user to a team, or changes their role. The
+// role defaults to member.
+func (s *TeamService) SetMember(ctx context.Context, teamID int, member TeamMember) (team Team, err error) {
+	ctx, span := s.startSpan(ctx, "SetMember", attribute.Int("team.id", teamID), attribute.Int("user.id", member.UserID))
+	defer func() { endSpan(span, err) }()
+
+	if member.Role == "" {
+		member.Role = TeamRoleMember
+	}
+	if member.Role != TeamRoleMember && member.Role != TeamRoleLead {
+		return Team{}, appErrors.NewValidationError(fmt.Sprintf("invalid team role %q, use member or lead", member.Role), nil)
+	}
+
+	if member.UserID <= 0 {
+		return Team{}, appErrors.NewValidationError("invalid user ID", nil)
+	}
+
+	before, err := s.teams.FindTeam(ctx, teamID)
+	if err != nil {
+		return Team{}, err
+	}
+	if _, err := s.users.GetUserByID(ctx, member.UserID); err != nil {
+		return Team{}, err
+	}
+	if err := s.teams.SetMember(ctx, teamID, member); err != nil {
+		return Team{}, err
+	}
+
+	team, err = s.teams.FindTeam(ctx, teamID)
+	if err != nil {
+		return Team{}, err
+	}
+	s.recordTeam(ctx, "team.member.set", teamID, before, team)
+	return team, nil
+}
+
+// RemoveMember removes a user from a team
+func (s *TeamService) RemoveMember(ctx context.Context, teamID, userID int) (err error) {
+	ctx, span := s.startSpan(ctx, "RemoveMember", attribute.Int("team.id", teamID), attribute.Int("user.id", userID))
+	defer func() { endSpan(span, err) }()
+
+	before, err := s.teams.FindTeam(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if err := s.teams.RemoveMember(ctx, teamID, userID); err != nil {
+		return err
+	}
+
+	after, err := s.teams.FindTeam(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	s.recordTeam(ctx, "team.member.remove", teamID, before, after)
+	return nil
+}
+
+// CreateRule adds an ownership rule assigning resources to a team
+func (s *TeamService) CreateRule(ctx context.Context, rule ownership.Rule) (created ownership.Rule, err error) {
+	ctx, span := s.startSpan(ctx, "CreateRule", attribute.Int("team.id", rule.TeamID))
+	defer func() { endSpan(span, err) }()
+
+	if err := rule.Validate(); err != nil {
+		return ownership.Rule{}, appErrors.NewValidationError(err.Error(), err)
+	}
+	if _, err := s.teams.FindTeam(ctx, rule.TeamID); err != nil {
+		return ownership.Rule{}, err
+	}
+
+	created, err = s.teams.CreateRule(ctx, rule)
+	if err != nil {
+		return ownership.Rule{}, err
+	}
+	s.recordRule(ctx, "ownership.rule.create", created.ID, nil, created)
+	return created, nil
+}
+
+// ListRules retrieves all ownership rules
+func (s *TeamService) ListRules(ctx context.Context) (rules []ownership.Rule, err error) {
+	ctx, span := s.startSpan(ctx, "ListRules")
+	defer func() { endSpan(span, err) }()
+
+	return s.teams.ListRules(ctx)
+}
+
+// DeleteRule deletes an ownership rule
+func (s *TeamService) DeleteRule(ctx context.Context, id int) (err error) {
+	ctx, span := s.startSpan(ctx, "DeleteRule", attribute.Int("rule.id", id))
+	defer func() { endSpan(span, err) }()
+
+	rule, err := s.teams.FindRule(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.teams.DeleteRule(ctx, id); err != nil {
+		return err
+	}
+	s.recordRule(ctx, "ownership.rule.delete", id, rule, nil)
+	return nil
+}
+
+// Resolve finds the team owning resource. Resources no rule matches are
+// reported as a not found error.
+func (s *TeamService) Resolve(ctx context.Context, resource ownership.Resource) (owner Ownership, err error) {
+	ctx, span := s.startSpan(ctx, "Resolve", attribute.String("resource", resource.ID))
+	defer func() { endSpan(span, err) }()
+
+	rules, err := s.teams.ListRules(ctx)
+	if err != nil {
+		return Ownership{}, err
+	}
+	resolution := ownership.Resolve(rules, resource)
+	if resolution.Rule == nil {
+		return Ownership{}, appErrors.NewNotFoundError(fmt.Sprintf("no ownership rule matches resource %q", resource.ID), nil)
+	}
+
+	teams, err := s.teams.ListTeams(ctx)
+	if err != nil {
+		return Ownership{}, err
+	}
+	names := make(map[int]string, len(teams))
+	for _, team := range teams {
+		names[team.ID] = team.Name
+	}
+	matches := func(rules []ownership.Rule) []OwnershipMatch {
+		var matches []OwnershipMatch
+		for _, rule := range rules {
+			matches = append(matches, OwnershipMatch{Rule: rule, Team: names[rule.TeamID]})
+		}
+		return matches
+	}
+
+	team, err := s.teams.FindTeam(ctx, resolution.Rule.TeamID)
+	if err != nil {
+		return Ownership{}, err
+	}
+	return Ownership{
+		Resource:  resource,
+		Team:      &team,
+		Rule:      resolution.Rule,
+		Matches:   matches(resolution.Matches),
+		Conflicts: matches(resolution.Conflicts),
+	}, nil
+}
+
+// recordTeam records a change to a team
+func (s *TeamService) recordTeam(ctx context.Context, action string, id int, before, after interface{}) {
+	recordAudit(ctx, s.recorder, audit.Resource{Type: "team", ID: strconv.Itoa(id)}, action, before, after)
+}
+
+// recordRule records a change to an ownership rule
+func (s *TeamService) recordRule(ctx context.Context, action string, id int, before, after interface{}) {
+	recordAudit(ctx, s.recorder, audit.Resource{Type: "ownership_rule", ID: strconv.Itoa(id)}, action, before, after)
+}
+
+// startSpan starts a span for a service method
+func (s *TeamService) startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "TeamService."+method, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTeamRepository is a mock implementation of the TeamRepository
+// interface
+type MockTeamRepository struct {
+	mock.Mock
+}
+
+// CreateTeam mocks the CreateTeam method of the TeamRepository interface
+func (m *MockTeamRepository) CreateTeam(ctx context.Context, team Team) (Team, error) {
+	args := m.Called(ctx, team)
+	return args.Get(0).(Team), args.Error(1)
+}
+
+// FindTeam mocks the FindTeam method of the TeamRepository interface
+func (m *MockTeamRepository) FindTeam(ctx context.Context, id int) (Team, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(Team), args.Error(1)
+}
+
+// ListTeams mocks the ListTeams method of the TeamRepository interface
+func (m *MockTeamRepository) ListTeams(ctx context.Context) ([]Team, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]Team), args.Error(1)
+}
+
+// DeleteTeam mocks the DeleteTeam method of the TeamRepository interface
+func (m *MockTeamRepository) DeleteTeam(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// SetMember mocks the SetMember method of the TeamRepository interface
+func (m *MockTeamRepository) SetMember(ctx context.Context, teamID int, member TeamMember) error {
+	args := m.Called(ctx, teamID, member)
+	return args.Error(0)
+}
+
+// RemoveMember mocks the RemoveMember method of the TeamRepository
+// interface
+func (m *MockTeamRepository) RemoveMember(ctx context.Context, teamID, userID int) error {
+	args := m.Called(ctx, teamID, userID)
+	return args.Error(0)
+}
+
+// CreateRule mocks the CreateRule method of the TeamRepository interface
+func (m *MockTeamRepository) CreateRule(ctx context.Context, rule ownership.Rule) (ownership.Rule, error) {
+	args := m.Called(ctx, rule)
+	return args.Get(0).(ownership.Rule), args.Error(1)
+}
+
+// FindRule mocks the FindRule method of the TeamRepository interface
+func (m *MockTeamRepository) FindRule(ctx context.Context, id int) (ownership.Rule, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(ownership.Rule), args.Error(1)
+}
+
+// ListRules mocks the ListRules method of the TeamRepository interface
+func (m *MockTeamRepository) ListRules(ctx context.Context) ([]ownership.Rule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]ownership.Rule), args.Error(1)
+}
+
+// DeleteRule mocks the DeleteRule method of the TeamRepository interface
+func (m *MockTeamRepository) DeleteRule(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/ownership"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamService(t *testing.T) {
+	payments := Team{ID: 1, Name: "payments"}
+	platform := Team{ID: 2, Name: "platform"}
+
+	t.Run("Should reject invalid team names and roles", func(t *testing.T) {
+		teams := new(MockTeamRepository)
+		s := NewTeamService(teams, NewUserService(new(MockUserRepository)))
+
+		_, err := s.CreateTeam(context.Background(), Team{Name: "Payments Team"})
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeValidation, appErr.Type)
+
+		_, err = s.SetMember(context.Background(), 1, TeamMember{UserID: 7, Role: "owner"})
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeValidation, appErr.Type)
+		teams.AssertNotCalled(t, "CreateTeam", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should add existing users as members", func(t *testing.T) {
+		teams := new(MockTeamRepository)
+		users := new(MockUserRepository)
+		s := NewTeamService(teams, NewUserService(users))
+		teams.On("FindTeam", mock.Anything, 1).Return(payments, nil)
+		users.On("FindByID", mock.Anything, 7).Return(User{ID: 7}, nil)
+		teams.On("SetMember", mock.Anything, 1, TeamMember{UserID: 7, Role: TeamRoleMember}).Return(nil).Once()
+
+		_, err := s.SetMember(context.Background(), 1, TeamMember{UserID: 7})
+
+		require.NoError(t, err)
+		teams.AssertExpectations(t)
+	})
+
+	t.Run("Should audit removed members and deleted rules with their states", func(t *testing.T) {
+		teams := new(MockTeamRepository)
+		store := audit.NewMemoryStore()
+		s := NewTeamService(teams, NewUserService(new(MockUserRepository)), WithTeamAuditRecorder(audit.NewRecorder(store)))
+		withMember := payments
+		withMember.Members = []TeamMember{{UserID: 7, Role: TeamRoleMember}}
+		teams.On("FindTeam", mock.Anything, 1).Return(withMember, nil).Once()
+		teams.On("FindTeam", mock.Anything, 1).Return(payments, nil).Once()
+		teams.On("RemoveMember", mock.Anything, 1, 7).Return(nil)
+		rule := ownership.Rule{ID: 5, TeamID: 1, Kind: ownership.KindTag, Pattern: "owner=payments"}
+		teams.On("FindRule", mock.Anything, 5).Return(rule, nil)
+		teams.On("DeleteRule", mock.Anything, 5).Return(nil)
+
+		require.NoError(t, s.RemoveMember(context.Background(), 1, 7))
+		require.NoError(t, s.DeleteRule(context.Background(), 5))
+
+		entries, err := store.Query(context.Background(), audit.Filter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.NotEmpty(t, entries[0].After)
+		assert.Equal(t, "Members", entries[0].Changes[0].Field)
+		assert.JSONEq(t, `{"ID":5,"TeamID":1,"Kind":"tag","Pattern":"owner=payments","Priority":0,"CreatedAt":"0001-01-01T00:00:00Z"}`, string(entries[1].Before))
+	})
+
+	t.Run("Should resolve the owner with the matching rules", func(t *testing.T) {
+		teams := new(MockTeamRepository)
+		s := NewTeamService(teams, NewUserService(new(MockUserRepository)))
+		teams.On("ListRules", mock.Anything).Return([]ownership.Rule{
+			{ID: 1, TeamID: 2, Kind: ownership.KindAccount, Pattern: "123456789012"},
+			{ID: 2, TeamID: 1, Kind: ownership.KindTag, Pattern: "owner=payments"},
+		}, nil)
+		teams.On("ListTeams", mock.Anything).Return([]Team{payments, platform}, nil)
+		teams.On("FindTeam", mock.Anything, 1).Return(payments, nil)
+
+		owner, err := s.Resolve(context.Background(), ownership.Resource{
+			ID:      "aws://123456789012/s3/invoices",
+			Account: "123456789012",
+			Tags:    map[string]string{"owner": "payments"},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "payments", owner.Team.Name)
+		assert.Equal(t, 2, owner.Rule.ID)
+		require.Len(t, owner.Matches, 2)
+		assert.Equal(t, "platform", owner.Matches[1].Team)
+	})
+
+	t.Run("Should report unowned resources as not found", func(t *testing.T) {
+		teams := new(MockTeamRepository)
+		s := NewTeamService(teams, NewUserService(new(MockUserRepository)))
+		teams.On("ListRules", mock.Anything).Return([]ownership.Rule{}, nil)
+
+		_, err := s.Resolve(context.Background(), ownership.Resource{ID: "k8s://prod/default", Namespace: "default"})
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeNotFound, appErr.Type)
+	})
+}
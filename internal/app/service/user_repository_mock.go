@@ -1,6 +1,10 @@
 package service
 
 import (
+	"context"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -10,31 +14,51 @@ type MockUserRepository struct {
 }
 
 // FindByID mocks the FindByID method of the UserRepository interface
-func (m *MockUserRepository) FindByID(id int) (User, error) {
-	args := m.Called(id)
+func (m *MockUserRepository) FindByID(ctx context.Context, id int) (User, error) {
+	args := m.Called(ctx, id)
 	return args.Get(0).(User), args.Error(1)
 }
 
-// FindAll mocks the FindAll method of the UserRepository interface
-func (m *MockUserRepository) FindAll() ([]User, error) {
-	args := m.Called()
-	return args.Get(0).([]User), args.Error(1)
+// List mocks the List method of the UserRepository interface
+func (m *MockUserRepository) List(ctx context.Context, opts query.Options) (query.Page[User], error) {
+	args := m.Called(ctx, opts)
+	return args.Get(0).(query.Page[User]), args.Error(1)
 }
 
 // Create mocks the Create method of the UserRepository interface
-func (m *MockUserRepository) Create(user User) (User, error) {
-	args := m.Called(user)
+func (m *MockUserRepository) Create(ctx context.Context, user User) (User, error) {
+	args := m.Called(ctx, user)
 	return args.Get(0).(User), args.Error(1)
 }
 
 // Update mocks the Update method of the UserRepository interface
-func (m *MockUserRepository) Update(user User) error {
-	args := m.Called(user)
-	return args.Error(0)
+func (m *MockUserRepository) Update(ctx context.Context, user User) (User, error) {
+	args := m.Called(ctx, user)
+	return args.Get(0).(User), args.Error(1)
 }
 
 // Delete mocks the Delete method of the UserRepository interface
-func (m *MockUserRepository) Delete(id int) error {
-	args := m.Called(id)
+func (m *MockUserRepository) Delete(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
-}
\ No newline at end of file
+}
+
+// Restore mocks the Restore method of the UserRepository interface
+func (m *MockUserRepository) Restore(ctx context.Context, id int) (User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(User), args.Error(1)
+}
+
+// Anonymize mocks the Anonymize method of the UserRepository interface
+func (m *MockUserRepository) Anonymize(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error) {
+	args := m.Called(ctx, deletedBefore, limit)
+	ids, _ := args.Get(0).([]int)
+	return ids, args.Error(1)
+}
+
+// Purge mocks the Purge method of the UserRepository interface
+func (m *MockUserRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error) {
+	args := m.Called(ctx, deletedBefore, limit)
+	ids, _ := args.Get(0).([]int)
+	return ids, args.Error(1)
+}
@@ -1,98 +1,346 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/replica"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/metrics"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+// LoggerName is the name of the logger used by the service layer
+const LoggerName = "service"
+
 // User represents a user entity in the system
 type User struct {
-	ID       int
-	Name     string
-	Email    string
-	Role     string
-	Active   bool
+	ID     int
+	Name   string
+	Email  string
+	Role   string
+	Active bool
+	// Version is incremented on every update. Updates carrying a stale
+	// version are rejected with a conflict error.
+	Version   int
 	CreatedAt string
 	UpdatedAt string
+	// DeletedAt is set on users deleted but not yet purged
+	DeletedAt string `json:",omitempty" yaml:",omitempty"`
 }
 
-// UserRepository defines the interface for user data operations
+// UserRepository defines the interface for user data operations. Every
+// operation is aborted when its context is cancelled.
 type UserRepository interface {
-	FindByID(id int) (User, error)
-	FindAll() ([]User, error)
-	Create(user User) (User, error)
-	Update(user User) error
-	Delete(id int) error
+	FindByID(ctx context.Context, id int) (User, error)
+	// List returns a page of users. Options naming unknown fields are
+	// rejected with a validation error.
+	List(ctx context.Context, opts query.Options) (query.Page[User], error)
+	Create(ctx context.Context, user User) (User, error)
+	// Update stores user if user.Version matches the stored version and
+	// returns it with its new version. Otherwise it returns a conflict
+	// error.
+	Update(ctx context.Context, user User) (User, error)
+	// Delete marks a user as deleted. Deleted users are not found and
+	// only listed when asked for.
+	Delete(ctx context.Context, id int) error
+	// Restore undoes Delete, unless the user was anonymized meanwhile
+	Restore(ctx context.Context, id int) (User, error)
+	// Anonymize and Purge apply retention to at most limit users deleted
+	// before the given time and return their IDs
+	Anonymize(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error)
+	Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error)
 }
 
 // UserService provides user-related operations
 type UserService struct {
 	repository UserRepository
+	recorder   *audit.Recorder
+	metrics    *metrics.UserMetrics
+	tracer     trace.Tracer
+}
+
+// Option configures optional UserService collaborators
+type Option func(*UserService)
+
+// WithAuditRecorder records every user change in the audit log
+func WithAuditRecorder(recorder *audit.Recorder) Option {
+	return func(s *UserService) {
+		s.recorder = recorder
+	}
+}
+
+// WithMetrics counts user changes in the given domain metrics
+func WithMetrics(m *metrics.UserMetrics) Option {
+	return func(s *UserService) {
+		s.metrics = m
+	}
+}
+
+// WithTracerProvider creates a span for every service call
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *UserService) {
+		s.tracer = tracing.Tracer(tp)
+	}
 }
 
 // NewUserService creates a new UserService with the given repository
-func NewUserService(repository UserRepository) *UserService {
-	return &UserService{
+func NewUserService(repository UserRepository, opts ...Option) *UserService {
+	s := &UserService{
 		repository: repository,
+		tracer:     noop.NewTracerProvider().Tracer(tracing.InstrumentationName),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // GetUserByID retrieves a user by their ID
-func (s *UserService) GetUserByID(id int) (User, error) {
+func (s *UserService) GetUserByID(ctx context.Context, id int) (user User, err error) {
+	ctx, span := s.startSpan(ctx, "GetUserByID", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+
 	if id <= 0 {
 		return User{}, errors.New("invalid user ID")
 	}
-	
-	return s.repository.FindByID(id)
+
+	return s.repository.FindByID(ctx, id)
 }
 
-// GetAllUsers retrieves all active users
-func (s *UserService) GetAllUsers() ([]User, error) {
-	return s.repository.FindAll()
+// ListUsers retrieves a page of users, filtered and sorted as opts request
+func (s *UserService) ListUsers(ctx context.Context, opts query.Options) (page query.Page[User], err error) {
+	ctx, span := s.startSpan(ctx, "ListUsers", attribute.Int("query.limit", opts.Limit))
+	defer func() { endSpan(span, err) }()
+
+	return s.repository.List(ctx, opts)
 }
 
 // CreateUser creates a new user
-func (s *UserService) CreateUser(user User) (User, error) {
+func (s *UserService) CreateUser(ctx context.Context, user User) (created User, err error) {
+	ctx, span := s.startSpan(ctx, "CreateUser")
+	defer func() { endSpan(span, err) }()
+
 	// Validate user data
-	if user.Name == "" {
-		return User{}, errors.New("user name cannot be empty")
-	}
-	if user.Email == "" {
-		return User{}, errors.New("user email cannot be empty")
+	if err := validateUser(user); err != nil {
+		return User{}, err
 	}
-	
+
 	// Create the user
-	return s.repository.Create(user)
+	created, err = s.repository.Create(ctx, user)
+	if err != nil {
+		return User{}, err
+	}
+
+	if s.metrics != nil {
+		s.metrics.Created.Inc()
+	}
+	s.recordChange(ctx, "user.create", created.ID, nil, created)
+	return created, nil
 }
 
-// UpdateUser updates an existing user
-func (s *UserService) UpdateUser(user User) error {
+// UpdateUser updates an existing user and returns it with its new version.
+// A non-zero user.Version must match the stored version; zero updates
+// whatever version is current, which is meant for internal callers such
+// as the CLI; the HTTP API requires a version. Either way a concurrent
+// change between reading and writing the user is reported as a conflict
+// error.
+func (s *UserService) UpdateUser(ctx context.Context, user User) (updated User, err error) {
+	ctx, span := s.startSpan(ctx, "UpdateUser", attribute.Int("user.id", user.ID))
+	defer func() { endSpan(span, err) }()
+
+	return s.update(ctx, user, "user.update")
+}
+
+// update implements UpdateUser, recording the change as action
+func (s *UserService) update(ctx context.Context, user User, action string) (User, error) {
 	if user.ID <= 0 {
-		return errors.New("invalid user ID")
+		return User{}, errors.New("invalid user ID")
 	}
-	
-	// Ensure user exists
-	_, err := s.repository.FindByID(user.ID)
+	if err := validateUser(user); err != nil {
+		return User{}, err
+	}
+
+	// Ensure user exists, reading from the primary since a lagging replica
+	// could report an outdated version
+	existing, err := s.repository.FindByID(replica.WithPrimary(ctx), user.ID)
 	if err != nil {
-		return err
+		return User{}, err
+	}
+	if user.Version == 0 {
+		user.Version = existing.Version
+	} else if user.Version != existing.Version {
+		return User{}, staleVersion(existing, user.Version)
+	}
+	user.CreatedAt = existing.CreatedAt
+
+	updated, err := s.repository.Update(ctx, user)
+	if err != nil {
+		return User{}, err
+	}
+
+	if s.metrics != nil {
+		s.metrics.Updated.Inc()
 	}
-	
-	return s.repository.Update(user)
+	s.recordChange(ctx, action, user.ID, existing, updated)
+	return updated, nil
 }
 
 // DeactivateUser deactivates a user
-func (s *UserService) DeactivateUser(id int) error {
+func (s *UserService) DeactivateUser(ctx context.Context, id int) (err error) {
+	ctx, span := s.startSpan(ctx, "DeactivateUser", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+
 	if id <= 0 {
 		return errors.New("invalid user ID")
 	}
-	
+
 	// Get the current user
-	user, err := s.repository.FindByID(id)
+	user, err := s.repository.FindByID(replica.WithPrimary(ctx), id)
 	if err != nil {
 		return err
 	}
-	
+
 	// Deactivate the user
+	before := user
 	user.Active = false
-	
-	return s.repository.Update(user)
-}
\ No newline at end of file
+
+	updated, err := s.repository.Update(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	if s.metrics != nil {
+		s.metrics.Deactivated.Inc()
+	}
+	s.recordChange(ctx, "user.deactivate", id, before, updated)
+	return nil
+}
+
+// validateUser checks the fields every stored user must have
+func validateUser(user User) error {
+	if user.Name == "" {
+		return appErrors.NewValidationError("user name cannot be empty", nil)
+	}
+	if user.Email == "" {
+		return appErrors.NewValidationError("user email cannot be empty", nil)
+	}
+	return ValidateEmail(user.Email)
+}
+
+// ValidateEmail checks that email is a bare RFC 5322 address such as
+// ada@example.com, without a display name or angle brackets
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || strings.ContainsAny(email, "<>") || strings.TrimSpace(email) != email {
+		return appErrors.NewValidationError(fmt.Sprintf("invalid email address %q", email), err)
+	}
+	return nil
+}
+
+// staleVersion reports an update based on an outdated version of a user
+func staleVersion(current User, version int) error {
+	return appErrors.NewConflictError(fmt.Sprintf("user with ID %d is at version %d, not %d", current.ID, current.Version, version), nil)
+}
+
+// DeleteUser deletes a user. The user can be restored until the retention
+// period has passed.
+func (s *UserService) DeleteUser(ctx context.Context, id int) (err error) {
+	ctx, span := s.startSpan(ctx, "DeleteUser", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+
+	if id <= 0 {
+		return errors.New("invalid user ID")
+	}
+
+	user, err := s.repository.FindByID(replica.WithPrimary(ctx), id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if s.metrics != nil {
+		s.metrics.Deleted.Inc()
+	}
+	s.recordChange(ctx, "user.delete", id, user, nil)
+	return nil
+}
+
+// RestoreUser restores a deleted user
+func (s *UserService) RestoreUser(ctx context.Context, id int) (restored User, err error) {
+	ctx, span := s.startSpan(ctx, "RestoreUser", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+
+	if id <= 0 {
+		return User{}, errors.New("invalid user ID")
+	}
+
+	restored, err = s.repository.Restore(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	if s.metrics != nil {
+		s.metrics.Restored.Inc()
+	}
+	s.recordChange(ctx, "user.restore", id, nil, restored)
+	return restored, nil
+}
+
+// recordChange records a change to a user. Failures are logged rather than
+// returned because the change itself has already been persisted, which is
+// also why the entry is written even if ctx was cancelled meanwhile.
+func (s *UserService) recordChange(ctx context.Context, action string, id int, before, after interface{}) {
+	recordAudit(ctx, s.recorder, audit.Resource{Type: "user", ID: strconv.Itoa(id)}, action, before, after)
+}
+
+// recordAudit records a change with recorder, if there is one, leaving
+// personal data out of the states. Failures are logged, see recordChange.
+func recordAudit(ctx context.Context, recorder *audit.Recorder, resource audit.Resource, action string, before, after interface{}) {
+	if recorder == nil {
+		return
+	}
+
+	event := audit.Event{
+		Action:   action,
+		Resource: resource,
+		Before:   auditState(before),
+		After:    auditState(after),
+	}
+	if fields := personalDataChanged(before, after); fields != "" {
+		event.Metadata = map[string]string{PersonalDataChangedKey: fields}
+	}
+	_, err := recorder.Record(context.WithoutCancel(ctx), event)
+	if err != nil {
+		logger.FromContext(ctx).Named(LoggerName).WithError(err).WithField("action", action).Error("Failed to record audit entry")
+	}
+}
+
+// startSpan starts a span for a service method
+func (s *UserService) startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "UserService."+method, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
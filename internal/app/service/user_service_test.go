@@ -1,97 +1,236 @@
 package service
 
 import (
+	"context"
 	"testing"
 
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/audit"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/query"
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUserService_GetUser(t *testing.T) {
 	// Setup mock repository
 	mockRepo := new(MockUserRepository)
-	
+
 	// Create test user
 	testUser := User{
-		ID:       1,
-		Name:     "John Doe",
-		Email:    "john@example.com",
-		Role:     "user",
-		Active:   true,
+		ID:        1,
+		Name:      "John Doe",
+		Email:     "john@example.com",
+		Role:      "user",
+		Active:    true,
 		CreatedAt: "2025-03-01T10:00:00Z",
 		UpdatedAt: "2025-03-01T10:00:00Z",
 	}
-	
+
 	// Setup expectations
-	mockRepo.On("FindByID", 1).Return(testUser, nil)
-	
+	mockRepo.On("FindByID", mock.Anything, 1).Return(testUser, nil)
+
 	// Create service with mock
 	userService := NewUserService(mockRepo)
-	
+
 	// Run test cases
 	t.Run("Should return user by ID", func(t *testing.T) {
 		// Test implementation
-		user, err := userService.GetUserByID(1)
-		
+		user, err := userService.GetUserByID(context.Background(), 1)
+
 		// Assertions
 		assert.NoError(t, err)
 		assert.Equal(t, 1, user.ID)
 		assert.Equal(t, "John Doe", user.Name)
 		assert.Equal(t, "john@example.com", user.Email)
-		
+
 		// Verify that our expectations were met
 		mockRepo.AssertExpectations(t)
 	})
-	
+
 	t.Run("Should handle invalid user ID", func(t *testing.T) {
 		// Test with invalid ID
-		user, err := userService.GetUserByID(-1)
-		
+		user, err := userService.GetUserByID(context.Background(), -1)
+
 		// Assertions
 		assert.Error(t, err)
 		assert.Equal(t, User{}, user)
 	})
 }
 
-func TestUserService_GetAllUsers(t *testing.T) {
+func TestUserService_ListUsers(t *testing.T) {
 	// Setup mock repository
 	mockRepo := new(MockUserRepository)
-	
+
 	// Create test users
 	testUsers := []User{
 		{
-			ID:       1,
-			Name:     "John Doe",
-			Email:    "john@example.com",
-			Role:     "user",
-			Active:   true,
+			ID:     1,
+			Name:   "John Doe",
+			Email:  "john@example.com",
+			Role:   "user",
+			Active: true,
 		},
 		{
-			ID:       2,
-			Name:     "Jane Smith",
-			Email:    "jane@example.com",
-			Role:     "admin",
-			Active:   true,
+			ID:     2,
+			Name:   "Jane Smith",
+			Email:  "jane@example.com",
+			Role:   "admin",
+			Active: true,
 		},
 	}
-	
+
 	// Setup expectations
-	mockRepo.On("FindAll").Return(testUsers, nil)
-	
+	opts := query.Options{Limit: 2, Filters: []query.Filter{{Field: "active", Op: query.OpEq, Value: "true"}}}
+	mockRepo.On("List", mock.Anything, opts).Return(query.Page[User]{Items: testUsers, NextCursor: "next"}, nil)
+
 	// Create service with mock
 	userService := NewUserService(mockRepo)
-	
+
 	// Run test
-	t.Run("Should return all users", func(t *testing.T) {
+	t.Run("Should return a page of users", func(t *testing.T) {
 		// Test implementation
-		users, err := userService.GetAllUsers()
-		
+		page, err := userService.ListUsers(context.Background(), opts)
+
 		// Assertions
 		assert.NoError(t, err)
-		assert.Len(t, users, 2)
-		assert.Equal(t, "John Doe", users[0].Name)
-		assert.Equal(t, "Jane Smith", users[1].Name)
-		
+		assert.Len(t, page.Items, 2)
+		assert.Equal(t, "John Doe", page.Items[0].Name)
+		assert.Equal(t, "Jane Smith", page.Items[1].Name)
+		assert.Equal(t, "next", page.NextCursor)
+
 		// Verify that our expectations were met
 		mockRepo.AssertExpectations(t)
 	})
-}
\ No newline at end of file
+}
+func TestUserService_DeactivateUser(t *testing.T) {
+	// Setup mock repository
+	mockRepo := new(MockUserRepository)
+
+	testUser := User{
+		ID:     1,
+		Name:   "John Doe",
+		Email:  "john@example.com",
+		Role:   "user",
+		Active: true,
+	}
+	deactivated := testUser
+	deactivated.Active = false
+
+	// Setup expectations
+	mockRepo.On("FindByID", mock.Anything, 1).Return(testUser, nil)
+	mockRepo.On("Update", mock.Anything, deactivated).Return(deactivated, nil)
+
+	// Create service with mock and an in-memory audit log
+	auditStore := audit.NewMemoryStore()
+	userService := NewUserService(mockRepo, WithAuditRecorder(audit.NewRecorder(auditStore)))
+
+	t.Run("Should deactivate and audit the change", func(t *testing.T) {
+		err := userService.DeactivateUser(context.Background(), 1)
+
+		// Assertions
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+
+		entries, err := auditStore.Query(context.Background(), audit.Filter{})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "user.deactivate", entries[0].Action)
+		assert.Equal(t, "1", entries[0].Resource.ID)
+		assert.Len(t, entries[0].Changes, 1)
+		assert.Equal(t, "Active", entries[0].Changes[0].Field)
+	})
+}
+
+func TestUserService_UpdateUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	current := User{ID: 1, Name: "John Doe", Email: "john@example.com", Role: "user", Active: true, Version: 2, CreatedAt: "2025-03-01T10:00:00Z"}
+	mockRepo.On("FindByID", mock.Anything, 1).Return(current, nil)
+
+	userService := NewUserService(mockRepo)
+
+	t.Run("Should update the current version when none is given", func(t *testing.T) {
+		change := User{ID: 1, Name: "John Doe", Email: "john@example.com", Role: "admin"}
+		expected := change
+		expected.Version = 2
+		expected.CreatedAt = current.CreatedAt
+		mockRepo.On("Update", mock.Anything, expected).Return(User{ID: 1, Role: "admin", Version: 3}, nil).Once()
+
+		updated, err := userService.UpdateUser(context.Background(), change)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, updated.Version)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Should reject a stale version without writing", func(t *testing.T) {
+		_, err := userService.UpdateUser(context.Background(), User{ID: 1, Name: "John Doe", Email: "john@example.com", Version: 1})
+
+		var appErr *appErrors.Error
+		assert.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeConflict, appErr.Type)
+		mockRepo.AssertNumberOfCalls(t, "Update", 1)
+	})
+
+	t.Run("Should keep personal data out of the audit log", func(t *testing.T) {
+		auditStore := audit.NewMemoryStore()
+		userService := NewUserService(mockRepo, WithAuditRecorder(audit.NewRecorder(auditStore)))
+		change := User{ID: 1, Name: "John Doe", Email: "jdoe@example.com", Role: "user", Active: true, Version: 2}
+		updated := change
+		updated.Version = 3
+		mockRepo.On("Update", mock.Anything, mock.Anything).Return(updated, nil).Once()
+
+		_, err := userService.UpdateUser(context.Background(), change)
+		require.NoError(t, err)
+
+		entries, err := auditStore.Query(context.Background(), audit.Filter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.NotContains(t, string(entries[0].Before), "John")
+		assert.NotContains(t, string(entries[0].Before), "john@example.com")
+		assert.NotContains(t, string(entries[0].After), "jdoe@example.com")
+		assert.Equal(t, "Email", entries[0].Metadata[PersonalDataChangedKey])
+	})
+}
+
+func TestUserService_DeleteUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	testUser := User{ID: 1, Name: "John Doe", Email: "john@example.com", Active: true}
+	mockRepo.On("FindByID", mock.Anything, 1).Return(testUser, nil)
+	mockRepo.On("Delete", mock.Anything, 1).Return(nil)
+	restored := testUser
+	restored.Version = 3
+	mockRepo.On("Restore", mock.Anything, 1).Return(restored, nil)
+
+	auditStore := audit.NewMemoryStore()
+	userService := NewUserService(mockRepo, WithAuditRecorder(audit.NewRecorder(auditStore)))
+
+	t.Run("Should delete, restore and audit both", func(t *testing.T) {
+		assert.NoError(t, userService.DeleteUser(context.Background(), 1))
+
+		user, err := userService.RestoreUser(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, user.Version)
+
+		entries, err := auditStore.Query(context.Background(), audit.Filter{})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "user.delete", entries[0].Action)
+		assert.Equal(t, "user.restore", entries[1].Action)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestValidateEmail(t *testing.T) {
+	t.Run("Should accept bare addresses", func(t *testing.T) {
+		for _, email := range []string{"ada@example.com", "ada.lovelace+test@mail.example.org", `"ada lovelace"@example.com`} {
+			assert.NoError(t, ValidateEmail(email), email)
+		}
+	})
+
+	t.Run("Should reject anything else", func(t *testing.T) {
+		for _, email := range []string{"ada", "ada@", "@example.com", "Ada <ada@example.com>", " ada@example.com", "ada@example.com,bob@example.com"} {
+			assert.Error(t, ValidateEmail(email), email)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Resource identifies the object an audited action was performed on
+type Resource struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// Change describes a single top-level field that differs between the
+// before and after states of a resource
+type Change struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Entry is a single, hash-chained record in the audit log
+type Entry struct {
+	Sequence  uint64    `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	// ActorUnverified marks an actor claimed by the client rather than
+	// established by authentication
+	ActorUnverified bool              `json:"actor_unverified,omitempty"`
+	Tenant          string            `json:"tenant,omitempty"`
+	Action          string            `json:"action"`
+	Resource        Resource          `json:"resource"`
+	Before          json.RawMessage   `json:"before,omitempty"`
+	After           json.RawMessage   `json:"after,omitempty"`
+	Changes         []Change          `json:"changes,omitempty"`
+	SourceIP        string            `json:"source_ip,omitempty"`
+	RequestID       string            `json:"request_id,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	PrevHash        string            `json:"prev_hash"`
+	Hash            string            `json:"hash"`
+}
+
+// ComputeHash returns the chain hash of the entry. The hash covers every
+// field except Hash itself, including the hash of the previous entry, so
+// modifying, removing or reordering entries breaks the chain.
+func (e Entry) ComputeHash() (string, error) {
+	e.Hash = ""
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Origin describes who performed an action and where it came from
+type Origin struct {
+	Actor string
+	// ActorUnverified reports that Actor was supplied by the client and
+	// not authenticated
+	ActorUnverified bool
+	Tenant          string
+	SourceIP        string
+	RequestID       string
+}
+
+// SystemActor is recorded when no origin is attached to the context
+const SystemActor = "system"
+
+type originKey struct{}
+
+// NewContext returns a copy of ctx carrying the given origin
+func NewContext(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// FromContext returns the origin stored in ctx. Actions without an
+// attached origin are attributed to SystemActor.
+func FromContext(ctx context.Context) Origin {
+	origin, ok := ctx.Value(originKey{}).(Origin)
+	if !ok || origin.Actor == "" {
+		origin.Actor = SystemActor
+		origin.ActorUnverified = false
+	}
+	return origin
+}
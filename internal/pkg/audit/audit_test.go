@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUser struct {
+	Name   string
+	Active bool
+}
+
+func TestRecorder_Record(t *testing.T) {
+	store := NewMemoryStore()
+	recorder := NewRecorder(store)
+
+	ctx := NewContext(context.Background(), Origin{
+		Actor:     "alice",
+		Tenant:    "acme",
+		SourceIP:  "10.0.0.1",
+		RequestID: "req-1",
+	})
+
+	first, err := recorder.Record(ctx, Event{
+		Action:   "user.create",
+		Resource: Resource{Type: "user", ID: "1"},
+		After:    testUser{Name: "John", Active: true},
+	})
+	require.NoError(t, err)
+
+	second, err := recorder.Record(context.Background(), Event{
+		Action:   "user.deactivate",
+		Resource: Resource{Type: "user", ID: "1"},
+		Before:   testUser{Name: "John", Active: true},
+		After:    testUser{Name: "John", Active: false},
+	})
+	require.NoError(t, err)
+
+	t.Run("Should capture the origin", func(t *testing.T) {
+		assert.Equal(t, "alice", first.Actor)
+		assert.Equal(t, "acme", first.Tenant)
+		assert.Equal(t, "10.0.0.1", first.SourceIP)
+		assert.Equal(t, "req-1", first.RequestID)
+		assert.Equal(t, SystemActor, second.Actor)
+	})
+
+	t.Run("Should chain entries", func(t *testing.T) {
+		assert.Equal(t, uint64(1), first.Sequence)
+		assert.Empty(t, first.PrevHash)
+		assert.Equal(t, uint64(2), second.Sequence)
+		assert.Equal(t, first.Hash, second.PrevHash)
+	})
+
+	t.Run("Should diff changed fields only", func(t *testing.T) {
+		require.Len(t, second.Changes, 1)
+		assert.Equal(t, "Active", second.Changes[0].Field)
+		assert.JSONEq(t, "true", string(second.Changes[0].Before))
+		assert.JSONEq(t, "false", string(second.Changes[0].After))
+	})
+}
+
+func TestVerify(t *testing.T) {
+	newChain := func(t *testing.T) []Entry {
+		recorder := NewRecorder(NewMemoryStore())
+		for i := 0; i < 3; i++ {
+			_, err := recorder.Record(context.Background(), Event{
+				Action:   "user.update",
+				Resource: Resource{Type: "user", ID: "1"},
+				After:    testUser{Name: "John", Active: i%2 == 0},
+			})
+			require.NoError(t, err)
+		}
+		entries, err := recorder.Store().Query(context.Background(), Filter{})
+		require.NoError(t, err)
+		return entries
+	}
+
+	t.Run("Should accept an intact chain", func(t *testing.T) {
+		assert.NoError(t, Verify(newChain(t)))
+	})
+
+	t.Run("Should detect a modified entry", func(t *testing.T) {
+		entries := newChain(t)
+		entries[1].Actor = "mallory"
+
+		err := Verify(entries)
+		var chainErr *ChainError
+		require.ErrorAs(t, err, &chainErr)
+		assert.Equal(t, uint64(2), chainErr.Sequence)
+	})
+
+	t.Run("Should detect a removed entry", func(t *testing.T) {
+		entries := newChain(t)
+		entries = append(entries[:1], entries[2:]...)
+
+		err := Verify(entries)
+		var chainErr *ChainError
+		require.ErrorAs(t, err, &chainErr)
+		assert.Equal(t, uint64(3), chainErr.Sequence)
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ctx := context.Background()
+
+	store, err := OpenFileStore(path)
+	require.NoError(t, err)
+
+	recorder := NewRecorder(store)
+	start := time.Now().UTC()
+	_, err = recorder.Record(ctx, Event{Action: "user.create", Resource: Resource{Type: "user", ID: "1"}})
+	require.NoError(t, err)
+	_, err = recorder.Record(ctx, Event{Action: "user.update", Resource: Resource{Type: "user", ID: "1"}})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// Reopening the store must continue the existing chain
+	store, err = OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = NewRecorder(store).Record(ctx, Event{Action: "user.deactivate", Resource: Resource{Type: "user", ID: "1"}})
+	require.NoError(t, err)
+
+	t.Run("Should keep one chain when several processes append", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		server, err := OpenFileStore(path)
+		require.NoError(t, err)
+		defer server.Close()
+		cli, err := OpenFileStore(path)
+		require.NoError(t, err)
+		defer cli.Close()
+
+		serverRecorder, cliRecorder := NewRecorder(server), NewRecorder(cli)
+		for i := 0; i < 3; i++ {
+			_, err := serverRecorder.Record(ctx, Event{Action: "http.POST", Resource: Resource{Type: "http", ID: "/users"}})
+			require.NoError(t, err)
+			_, err = cliRecorder.Record(ctx, Event{Action: "user.update", Resource: Resource{Type: "user", ID: "1"}})
+			require.NoError(t, err)
+		}
+
+		entries, err := server.Query(ctx, Filter{})
+		require.NoError(t, err)
+		assert.Len(t, entries, 6)
+		assert.NoError(t, Verify(entries))
+	})
+
+	t.Run("Should verify after reopening", func(t *testing.T) {
+		entries, err := store.Query(ctx, Filter{})
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+		assert.NoError(t, Verify(entries))
+	})
+
+	t.Run("Should filter by action and time range", func(t *testing.T) {
+		entries, err := store.Query(ctx, Filter{Action: "user.update"})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, uint64(2), entries[0].Sequence)
+
+		entries, err = store.Query(ctx, Filter{From: start.Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Should export JSON Lines", func(t *testing.T) {
+		entries, err := store.Query(ctx, Filter{})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, ExportJSONL(&buf, entries))
+
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		require.Len(t, lines, 3)
+		var entry Entry
+		require.NoError(t, json.Unmarshal(lines[2], &entry))
+		assert.Equal(t, entries[2].Hash, entry.Hash)
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package audit
+
+import "os"
+
+// lockFile does nothing on this platform, so only one process should append
+// to an audit log at a time
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile does nothing on this platform
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package audit
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an advisory lock on file, exclusive for writers and
+// shared for readers, waiting until it is available
+func lockFile(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return syscall.Flock(int(file.Fd()), how)
+}
+
+// unlockFile releases the lock taken by lockFile
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
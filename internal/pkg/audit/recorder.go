@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event describes an auditable action before it is sealed into an Entry
+type Event struct {
+	Action   string
+	Resource Resource
+	Before   interface{}
+	After    interface{}
+	Metadata map[string]string
+}
+
+// Recorder seals events into hash-chained entries and appends them to a
+// Store. The tail of the chain is cached unless the store is a SharedStore.
+type Recorder struct {
+	mu     sync.Mutex
+	store  Store
+	now    func() time.Time
+	last   *Entry
+	loaded bool
+}
+
+// NewRecorder creates a new Recorder backed by the given store
+func NewRecorder(store Store) *Recorder {
+	return &Recorder{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Store returns the store the recorder appends to
+func (r *Recorder) Store() Store {
+	return r.store
+}
+
+// Record appends an entry for the event, attributing it to the origin
+// stored in ctx
+func (r *Recorder) Record(ctx context.Context, event Event) (Entry, error) {
+	before, err := marshalState(event.Before)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to encode before state: %w", err)
+	}
+	after, err := marshalState(event.After)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to encode after state: %w", err)
+	}
+	changes, err := diff(before, after)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to diff states: %w", err)
+	}
+
+	origin := FromContext(ctx)
+
+	entry := Entry{
+		Timestamp:       r.now().UTC(),
+		Actor:           origin.Actor,
+		ActorUnverified: origin.ActorUnverified,
+		Tenant:          origin.Tenant,
+		Action:          event.Action,
+		Resource:        event.Resource,
+		Before:          before,
+		After:           after,
+		Changes:         changes,
+		SourceIP:        origin.SourceIP,
+		RequestID:       origin.RequestID,
+		Metadata:        event.Metadata,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A shared store links the entry to its tail itself, since other
+	// processes may have appended since the last entry seen here
+	if shared, ok := r.store.(SharedStore); ok {
+		sealed, err := shared.AppendNext(ctx, func(last *Entry) (Entry, error) {
+			return seal(entry, last)
+		})
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to append audit entry: %w", err)
+		}
+		return sealed, nil
+	}
+
+	if !r.loaded {
+		last, ok, err := r.store.Last(ctx)
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to load last audit entry: %w", err)
+		}
+		if ok {
+			r.last = &last
+		}
+		r.loaded = true
+	}
+
+	entry, err = seal(entry, r.last)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := r.store.Append(ctx, entry); err != nil {
+		return Entry{}, fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	r.last = &entry
+
+	return entry, nil
+}
+
+// seal links entry to last, the tail of the chain, and hashes it
+func seal(entry Entry, last *Entry) (Entry, error) {
+	entry.Sequence = 1
+	if last != nil {
+		entry.Sequence = last.Sequence + 1
+		entry.PrevHash = last.Hash
+	}
+
+	var err error
+	entry.Hash, err = entry.ComputeHash()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	return entry, nil
+}
+
+// marshalState encodes a before/after state, leaving nil states empty
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// diff compares the top-level fields of two JSON objects. States that are
+// not objects are compared as a whole under the empty field name.
+func diff(before, after json.RawMessage) ([]Change, error) {
+	if before == nil && after == nil {
+		return nil, nil
+	}
+
+	var beforeFields, afterFields map[string]json.RawMessage
+	beforeErr := decodeObject(before, &beforeFields)
+	afterErr := decodeObject(after, &afterFields)
+	if beforeErr != nil || afterErr != nil {
+		if bytes.Equal(before, after) {
+			return nil, nil
+		}
+		return []Change{{Before: before, After: after}}, nil
+	}
+
+	fields := make(map[string]struct{}, len(beforeFields)+len(afterFields))
+	for field := range beforeFields {
+		fields[field] = struct{}{}
+	}
+	for field := range afterFields {
+		fields[field] = struct{}{}
+	}
+
+	var changes []Change
+	for field := range fields {
+		b, a := beforeFields[field], afterFields[field]
+		if bytes.Equal(b, a) {
+			continue
+		}
+		changes = append(changes, Change{Field: field, Before: b, After: a})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes, nil
+}
+
+// decodeObject decodes data into fields, treating an empty state as an
+// empty object
+func decodeObject(data json.RawMessage, fields *map[string]json.RawMessage) error {
+	if data == nil {
+		*fields = map[string]json.RawMessage{}
+		return nil
+	}
+	return json.Unmarshal(data, fields)
+}
@@ -0,0 +1,293 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultFilePath is the audit log location used when none is configured
+const DefaultFilePath = "audit.log"
+
+// Store persists audit entries in sequence order
+type Store interface {
+	// Append adds an entry to the end of the log
+	Append(ctx context.Context, entry Entry) error
+
+	// Last returns the most recent entry, if any
+	Last(ctx context.Context) (Entry, bool, error)
+
+	// Query returns the entries matching the filter in sequence order
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+}
+
+// SharedStore is a Store other processes may append to as well, such as
+// the file shared by the server and the CLI. Entries are linked to its tail
+// while it is locked, so concurrent writers cannot fork the chain.
+type SharedStore interface {
+	Store
+
+	// AppendNext calls seal with the last entry, nil when the log is
+	// empty, and appends the entry seal returns
+	AppendNext(ctx context.Context, seal func(last *Entry) (Entry, error)) (Entry, error)
+}
+
+// Filter restricts the entries returned by a query. Zero values match
+// everything.
+type Filter struct {
+	From         time.Time
+	To           time.Time
+	Actor        string
+	Tenant       string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Limit        int
+}
+
+// Match reports whether the entry satisfies the filter
+func (f Filter) Match(entry Entry) bool {
+	if !f.From.IsZero() && entry.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !entry.Timestamp.Before(f.To) {
+		return false
+	}
+	if f.Actor != "" && entry.Actor != f.Actor {
+		return false
+	}
+	if f.Tenant != "" && entry.Tenant != f.Tenant {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.ResourceType != "" && entry.Resource.Type != f.ResourceType {
+		return false
+	}
+	if f.ResourceID != "" && entry.Resource.ID != f.ResourceID {
+		return false
+	}
+	return true
+}
+
+// MemoryStore keeps audit entries in memory. It is intended for tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append implements the Store interface
+func (s *MemoryStore) Append(ctx context.Context, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Last implements the Store interface
+func (s *MemoryStore) Last(ctx context.Context) (Entry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.entries) == 0 {
+		return Entry{}, false, nil
+	}
+	return s.entries[len(s.entries)-1], true, nil
+}
+
+// Query implements the Store interface
+func (s *MemoryStore) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []Entry
+	for _, entry := range s.entries {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// FileStore appends audit entries to a JSON Lines file. The file is locked
+// while it is read or appended to, so several processes can share it.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	last *Entry
+	// size is the length of the file read so far
+	size int64
+}
+
+// OpenFileStore opens or creates the audit log at path
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	store := &FileStore{path: path, file: file}
+	if _, _, err := store.Last(context.Background()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Append implements the Store interface
+func (s *FileStore) Append(ctx context.Context, entry Entry) error {
+	_, err := s.AppendNext(ctx, func(*Entry) (Entry, error) {
+		return entry, nil
+	})
+	return err
+}
+
+// AppendNext implements the SharedStore interface
+func (s *FileStore) AppendNext(ctx context.Context, seal func(last *Entry) (Entry, error)) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := lockFile(s.file, true); err != nil {
+		return Entry{}, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlockFile(s.file)
+
+	if err := s.refresh(); err != nil {
+		return Entry{}, err
+	}
+	entry, err := seal(s.last)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	line = append(line, '\n')
+	if _, err := s.file.Write(line); err != nil {
+		return Entry{}, err
+	}
+	if err := s.file.Sync(); err != nil {
+		return Entry{}, err
+	}
+	s.last = &entry
+	s.size += int64(len(line))
+	return entry, nil
+}
+
+// Last implements the Store interface
+func (s *FileStore) Last(ctx context.Context) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := lockFile(s.file, false); err != nil {
+		return Entry{}, false, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlockFile(s.file)
+
+	if err := s.refresh(); err != nil {
+		return Entry{}, false, err
+	}
+	if s.last == nil {
+		return Entry{}, false, nil
+	}
+	return *s.last, true, nil
+}
+
+// refresh reads the entries other processes appended since the file was
+// last read. s.mu and the file lock must be held.
+func (s *FileStore) refresh() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if info.Size() == s.size {
+		return nil
+	}
+	if info.Size() < s.size {
+		// The file was truncated, so read it again from the start
+		s.last, s.size = nil, 0
+	}
+
+	size, err := s.scan(s.size, func(entry Entry) bool {
+		s.last = &entry
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+// Query implements the Store interface
+func (s *FileStore) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := lockFile(s.file, false); err != nil {
+		return nil, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlockFile(s.file)
+
+	var entries []Entry
+	_, err := s.scan(0, func(entry Entry) bool {
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+		return filter.Limit <= 0 || len(entries) < filter.Limit
+	})
+	return entries, err
+}
+
+// Close closes the underlying file
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
+
+// scan decodes the entries in the file from offset on, stopping early when
+// fn returns false. It returns the offset after the last entry read.
+func (s *FileStore) scan(offset int64, fn func(Entry) bool) (int64, error) {
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		return offset, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	reader := bufio.NewReader(s.file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			var entry Entry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return offset, fmt.Errorf("malformed audit entry at offset %d: %w", offset, err)
+			}
+			offset += int64(len(data))
+			if !fn(entry) {
+				return offset, nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+}
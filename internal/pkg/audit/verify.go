@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ChainError reports the first entry at which the audit chain is broken
+type ChainError struct {
+	Sequence uint64
+	Reason   string
+}
+
+// Error returns the string representation of the error
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at sequence %d: %s", e.Sequence, e.Reason)
+}
+
+// Verify checks that entries form an unbroken hash chain starting at the
+// first entry ever written. It returns a *ChainError describing the first
+// inconsistency found.
+func Verify(entries []Entry) error {
+	var prev *Entry
+	for i := range entries {
+		entry := entries[i]
+
+		expectedSeq, expectedPrev := uint64(1), ""
+		if prev != nil {
+			expectedSeq, expectedPrev = prev.Sequence+1, prev.Hash
+		}
+
+		if entry.Sequence != expectedSeq {
+			return &ChainError{
+				Sequence: entry.Sequence,
+				Reason:   fmt.Sprintf("expected sequence %d", expectedSeq),
+			}
+		}
+		if entry.PrevHash != expectedPrev {
+			return &ChainError{Sequence: entry.Sequence, Reason: "previous hash does not match"}
+		}
+
+		hash, err := entry.ComputeHash()
+		if err != nil {
+			return &ChainError{Sequence: entry.Sequence, Reason: err.Error()}
+		}
+		if hash != entry.Hash {
+			return &ChainError{Sequence: entry.Sequence, Reason: "entry hash does not match contents"}
+		}
+
+		prev = &entry
+	}
+	return nil
+}
+
+// ExportJSONL writes entries to w as JSON Lines
+func ExportJSONL(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package bulk loads many rows into a table at once, with COPY where the
+// connection supports it and multi-row INSERT statements otherwise.
+//
+// Rows are sent in batches. Pass a transaction to load all rows or none;
+// on a plain connection, batches before a failing one stay inserted.
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/sqlb"
+)
+
+// DefaultBatchSize is the number of rows per INSERT statement unless
+// configured otherwise
+const DefaultBatchSize = 1000
+
+// maxParameters is the number of placeholders PostgreSQL accepts in one
+// statement
+const maxParameters = 65535
+
+// Execer runs statements, as connections and transactions do
+type Execer interface {
+	Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error)
+}
+
+// options holds the settings of Insert and Upsert
+type options struct {
+	batchSize int
+	dialect   sqlb.Dialect
+	copy      bool
+}
+
+// Option configures Insert and Upsert
+type Option func(*options)
+
+// WithBatchSize sets the number of rows per INSERT statement. Batches are
+// made smaller when their placeholders would exceed the database limit.
+func WithBatchSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.batchSize = size
+		}
+	}
+}
+
+// WithDialect sets the placeholder style of INSERT statements, Postgres
+// by default
+func WithDialect(d sqlb.Dialect) Option {
+	return func(o *options) {
+		o.dialect = d
+	}
+}
+
+// WithoutCopy makes Insert use INSERT statements even where COPY is
+// available
+func WithoutCopy() Option {
+	return func(o *options) {
+		o.copy = false
+	}
+}
+
+// newOptions applies opts to the defaults
+func newOptions(opts []Option) options {
+	o := options{batchSize: DefaultBatchSize, dialect: sqlb.Postgres, copy: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Insert inserts rows with a value per column into table and returns the
+// number inserted. It uses BulkInsert when e is a database.BulkInserter
+// and multi-row INSERT statements otherwise.
+func Insert(ctx context.Context, e Execer, table string, columns []string, rows [][]interface{}, opts ...Option) (int64, error) {
+	o := newOptions(opts)
+	if inserter, ok := e.(database.BulkInserter); ok && o.copy {
+		n, err := inserter.BulkInsert(ctx, table, columns, rows)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return n, err
+		}
+	}
+
+	return insertBatches(ctx, e, o, len(columns), rows, func() *sqlb.RowsBuilder {
+		return sqlb.InsertRows(table, columns...)
+	})
+}
+
+// Upsert inserts rows into table, updating the other columns of existing
+// rows whose keys match instead. It returns the number of rows inserted or
+// updated. Keys must be covered by a unique index.
+func Upsert(ctx context.Context, e Execer, table string, columns, keys []string, rows [][]interface{}, opts ...Option) (int64, error) {
+	var update []string
+	for _, column := range columns {
+		if !slices.Contains(keys, column) {
+			update = append(update, column)
+		}
+	}
+
+	return insertBatches(ctx, e, newOptions(opts), len(columns), rows, func() *sqlb.RowsBuilder {
+		return sqlb.InsertRows(table, columns...).OnConflict(keys...).DoUpdate(update...)
+	})
+}
+
+// insertBatches runs a statement started by start per batch of rows
+func insertBatches(ctx context.Context, e Execer, o options, width int, rows [][]interface{}, start func() *sqlb.RowsBuilder) (int64, error) {
+	size := o.batchSize
+	if width > 0 && size*width > maxParameters {
+		size = maxParameters / width
+	}
+
+	var total int64
+	for begin := 0; begin < len(rows); begin += size {
+		end := min(begin+size, len(rows))
+		b := start()
+		for _, row := range rows[begin:end] {
+			b.Values(row...)
+		}
+		query, args, err := b.Build(o.dialect)
+		if err != nil {
+			return total, err
+		}
+
+		result, err := e.Execute(ctx, query, args...)
+		if err != nil {
+			return total, fmt.Errorf("insert rows %d to %d: %w", begin+1, end, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,178 @@
+package bulk
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/fake"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/postgres"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkDatabaseEnv names the connection string of a PostgreSQL
+// database the benchmarks may create tables in
+const benchmarkDatabaseEnv = "SCRUTINY_BENCH_DATABASE"
+
+func discardLogger() logger.Logger {
+	return logger.NewLogger(logger.LoggerConfig{Output: io.Discard, Formatter: &logrus.JSONFormatter{}, Level: logrus.InfoLevel})
+}
+
+func assetRows(n int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = []interface{}{fmt.Sprintf("a-%d", i), "bucket", "eu-west-1"}
+	}
+	return rows
+}
+
+var assetColumns = []string{"id", "name", "region"}
+
+func TestInsert(t *testing.T) {
+	t.Run("Should insert batches of rows without bulk insert support", func(t *testing.T) {
+		provider := fake.NewProvider()
+		conn, err := provider.Connect(database.Config{ConnectionString: "db"})
+		require.NoError(t, err)
+
+		n, err := Insert(context.Background(), conn, "assets", assetColumns, assetRows(5), WithBatchSize(2))
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n, "the fake reports one row per statement")
+		statements := provider.Conn("db").Statements()
+		require.Len(t, statements, 3)
+		assert.Equal(t, "INSERT INTO assets (id, name, region) VALUES ($1, $2, $3), ($4, $5, $6)", statements[0])
+	})
+
+	t.Run("Should fall back to INSERT when a wrapper cannot bulk insert", func(t *testing.T) {
+		provider := fake.NewProvider()
+		conn, err := database.InterceptProvider(provider, database.Hooks{}).Connect(database.Config{ConnectionString: "db"})
+		require.NoError(t, err)
+
+		_, err = Insert(context.Background(), conn, "assets", assetColumns, assetRows(1))
+
+		require.NoError(t, err)
+		assert.Len(t, provider.Conn("db").Statements(), 1)
+	})
+
+	t.Run("Should use COPY where available", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		mock.ExpectBegin()
+		stmt := mock.ExpectPrepare("COPY")
+		stmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+		stmt.ExpectExec().WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		n, err := Insert(context.Background(), postgres.NewProvider(discardLogger()).Wrap(db), "assets", assetColumns, assetRows(1))
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should keep batches within the placeholder limit", func(t *testing.T) {
+		conn := fake.NewProvider().Conn("db")
+
+		_, err := Insert(context.Background(), conn, "assets", assetColumns, assetRows(maxParameters/3+1), WithBatchSize(100000))
+
+		require.NoError(t, err)
+		assert.Len(t, conn.Statements(), 2)
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	t.Run("Should update the columns that are not keys", func(t *testing.T) {
+		conn := fake.NewProvider().Conn("db")
+
+		_, err := Upsert(context.Background(), conn, "assets", assetColumns, []string{"id"}, assetRows(1))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"INSERT INTO assets (id, name, region) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, region = EXCLUDED.region",
+		}, conn.Statements())
+	})
+
+	t.Run("Should report the batch that failed", func(t *testing.T) {
+		conn := fake.NewProvider().Conn("db")
+		conn.SetError(errors.New("duplicate key"))
+
+		_, err := Upsert(context.Background(), conn, "assets", assetColumns, []string{"id"}, assetRows(3), WithBatchSize(2))
+
+		assert.ErrorContains(t, err, "insert rows 1 to 2")
+	})
+}
+
+// benchmarkConnection connects to the benchmark database and creates an
+// empty assets table, or skips the benchmark without one
+func benchmarkConnection(b *testing.B) database.Connection {
+	dsn := os.Getenv(benchmarkDatabaseEnv)
+	if dsn == "" {
+		b.Skipf("set %s to a PostgreSQL connection string to run", benchmarkDatabaseEnv)
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(b, err)
+	b.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1) // temporary tables live on one session
+
+	conn := postgres.NewProvider(discardLogger()).Wrap(db)
+	_, err = conn.Execute(context.Background(), "CREATE TEMPORARY TABLE IF NOT EXISTS bench_assets (id text PRIMARY KEY, name text, region text)")
+	require.NoError(b, err)
+	return conn
+}
+
+// BenchmarkInsert compares loading 10,000 rows with one INSERT per row,
+// multi-row INSERT statements, COPY and upserts
+func BenchmarkInsert(b *testing.B) {
+	const size = 10000
+	ctx := context.Background()
+	rows := assetRows(size)
+
+	approaches := map[string]func(conn database.Connection) error{
+		"row-by-row": func(conn database.Connection) error {
+			for _, row := range rows {
+				if _, err := conn.Execute(ctx, "INSERT INTO bench_assets (id, name, region) VALUES ($1, $2, $3)", row...); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"multi-row": func(conn database.Connection) error {
+			_, err := Insert(ctx, conn, "bench_assets", assetColumns, rows, WithoutCopy())
+			return err
+		},
+		"copy": func(conn database.Connection) error {
+			_, err := Insert(ctx, conn, "bench_assets", assetColumns, rows)
+			return err
+		},
+		"upsert": func(conn database.Connection) error {
+			_, err := Upsert(ctx, conn, "bench_assets", assetColumns, []string{"id"}, rows)
+			return err
+		},
+	}
+
+	for _, name := range []string{"row-by-row", "multi-row", "copy", "upsert"} {
+		load := approaches[name]
+		b.Run(name, func(b *testing.B) {
+			conn := benchmarkConnection(b)
+			b.ReportMetric(size, "rows/op")
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				_, err := conn.Execute(ctx, "TRUNCATE bench_assets")
+				require.NoError(b, err)
+				b.StartTimer()
+
+				require.NoError(b, load(conn))
+			}
+		})
+	}
+}
@@ -46,6 +46,21 @@ type Connection interface {
 	Health(ctx context.Context) error
 }
 
+// Reconnector is implemented by connections that can replace their
+// connection pool, for example after the credentials were rotated, without
+// interrupting queries already in flight
+type Reconnector interface {
+	Reconnect(config Config) error
+}
+
+// BulkInserter is implemented by connections and transactions that load
+// many rows faster than INSERT statements can, such as with COPY. Wrappers
+// return an error wrapping errors.ErrUnsupported when the connection they
+// wrap cannot bulk insert.
+type BulkInserter interface {
+	BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error)
+}
+
 // Result represents a query result
 type Result interface {
 	// LastInsertId returns the id of the last inserted row
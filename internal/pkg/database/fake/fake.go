@@ -0,0 +1,433 @@
+// Package fake provides an in-memory database.Provider for tests. Its
+// connections record the statements they run and answer queries with
+// canned rows, and can be made unreachable or unhealthy. Notifications
+// published on any of its connections reach the subscribers of all of
+// them.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+)
+
+// ErrClosed is returned by closed connections
+var ErrClosed = errors.New("fake: connection is closed")
+
+// Provider opens fake connections keyed by connection string, so a test
+// can reach the connection a component under test opened
+type Provider struct {
+	mu          sync.Mutex
+	conns       map[string]*Conn
+	unreachable map[string]error
+	subs        map[string]map[*Subscription]struct{}
+}
+
+// NewProvider creates a Provider without connections
+func NewProvider() *Provider {
+	return &Provider{
+		conns:       make(map[string]*Conn),
+		unreachable: make(map[string]error),
+		subs:        make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return "fake"
+}
+
+// Connect returns the connection for config.ConnectionString, unless it
+// was made unreachable
+func (p *Provider) Connect(config database.Config) (database.Connection, error) {
+	p.mu.Lock()
+	err := p.unreachable[config.ConnectionString]
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := p.Conn(config.ConnectionString)
+	conn.mu.Lock()
+	conn.closed = false
+	conn.mu.Unlock()
+	return conn, nil
+}
+
+// Conn returns the connection for a connection string, creating it if
+// needed
+func (p *Provider) Conn(dsn string) *Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, ok := p.conns[dsn]
+	if !ok {
+		conn = &Conn{Name: dsn, provider: p}
+		p.conns[dsn] = conn
+	}
+	return conn
+}
+
+// SetUnreachable makes Connect fail with err for a connection string, or
+// succeed again when err is nil
+func (p *Provider) SetUnreachable(dsn string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		delete(p.unreachable, dsn)
+		return
+	}
+	p.unreachable[dsn] = err
+}
+
+// Conn is a fake database.Connection
+type Conn struct {
+	// Name is the connection string the connection was opened with
+	Name string
+
+	provider   *Provider
+	mu         sync.Mutex
+	health     error
+	err        error
+	rows       [][]interface{}
+	statements []string
+	closed     bool
+}
+
+// SetHealth makes Health fail with err, or succeed when err is nil
+func (c *Conn) SetHealth(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health = err
+}
+
+// SetError makes every statement fail with err, or succeed when err is nil
+func (c *Conn) SetError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// SetRows sets the rows returned by Query and QueryRow
+func (c *Conn) SetRows(rows ...[]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rows = rows
+}
+
+// Statements returns the statements run on the connection, including
+// BEGIN, COMMIT and ROLLBACK of transactions
+func (c *Conn) Statements() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.statements...)
+}
+
+// Closed reports whether Close was called since the connection was opened
+func (c *Conn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// run records a statement and returns the rows it should answer with
+func (c *Conn) run(ctx context.Context, statement string) ([][]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	c.statements = append(c.statements, statement)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.rows, nil
+}
+
+// Execute records the statement
+func (c *Conn) Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
+	if _, err := c.run(ctx, query); err != nil {
+		return nil, err
+	}
+	return result{}, nil
+}
+
+// Query records the statement and returns the canned rows
+func (c *Conn) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
+	rows, err := c.run(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{rows: rows}, nil
+}
+
+// QueryRow records the statement and returns the first canned row
+func (c *Conn) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
+	rows, err := c.run(ctx, query)
+	return row{rows: rows, err: err}
+}
+
+// Begin starts a transaction recording its statements on the connection
+func (c *Conn) Begin(ctx context.Context) (database.Transaction, error) {
+	if _, err := c.run(ctx, "BEGIN"); err != nil {
+		return nil, err
+	}
+	return &Tx{conn: c}, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// Health returns the error set with SetHealth
+func (c *Conn) Health(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	return c.health
+}
+
+// Notify records NOTIFY and delivers payload to the subscribers of
+// channel
+func (c *Conn) Notify(ctx context.Context, channel, payload string) error {
+	if _, err := c.run(ctx, "NOTIFY "+channel); err != nil {
+		return err
+	}
+	c.provider.publish(database.Notification{Channel: channel, Payload: payload})
+	return nil
+}
+
+// Listen subscribes to the notifications of channel
+func (c *Conn) Listen(ctx context.Context, channel string) (database.Subscription, error) {
+	if _, err := c.run(ctx, "LISTEN "+channel); err != nil {
+		return nil, err
+	}
+	return c.provider.subscribe(channel), nil
+}
+
+// Interrupt tells every subscriber that notifications were missed, as a
+// listener does after reconnecting
+func (p *Provider) Interrupt() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for channel, subs := range p.subs {
+		for s := range subs {
+			s.send(database.Notification{Channel: channel, Missed: true})
+		}
+	}
+}
+
+// publish delivers n to the subscribers of its channel
+func (p *Provider) publish(n database.Notification) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for s := range p.subs[n.Channel] {
+		s.send(n)
+	}
+}
+
+// subscribe adds a subscription to channel
+func (p *Provider) subscribe(channel string) *Subscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := &Subscription{provider: p, channel: channel, ch: make(chan database.Notification, 16)}
+	if p.subs[channel] == nil {
+		p.subs[channel] = make(map[*Subscription]struct{})
+	}
+	p.subs[channel][s] = struct{}{}
+	return s
+}
+
+// Subscription is a fake database.Subscription. Notifications that do not
+// fit its buffer are dropped and the next one is marked as missed.
+type Subscription struct {
+	provider *Provider
+	channel  string
+	ch       chan database.Notification
+	missed   bool
+}
+
+// Notifications returns the channel notifications are delivered on
+func (s *Subscription) Notifications() <-chan database.Notification {
+	return s.ch
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+	s.provider.mu.Lock()
+	defer s.provider.mu.Unlock()
+	if _, ok := s.provider.subs[s.channel][s]; ok {
+		delete(s.provider.subs[s.channel], s)
+		close(s.ch)
+	}
+	return nil
+}
+
+// send delivers n without blocking, with the provider lock held
+func (s *Subscription) send(n database.Notification) {
+	n.Missed = n.Missed || s.missed
+	select {
+	case s.ch <- n:
+		s.missed = false
+	default:
+		s.missed = true
+	}
+}
+
+// Tx is a fake database.Transaction. Its notifications are delivered when
+// it commits.
+type Tx struct {
+	conn    *Conn
+	done    bool
+	pending []database.Notification
+}
+
+// Execute records the statement
+func (t *Tx) Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
+	return t.conn.Execute(ctx, query, args...)
+}
+
+// Query records the statement and returns the canned rows
+func (t *Tx) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
+	return t.conn.Query(ctx, query, args...)
+}
+
+// QueryRow records the statement and returns the first canned row
+func (t *Tx) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
+	return t.conn.QueryRow(ctx, query, args...)
+}
+
+// Notify records NOTIFY and delivers payload when the transaction commits
+func (t *Tx) Notify(ctx context.Context, channel, payload string) error {
+	if _, err := t.conn.run(ctx, "NOTIFY "+channel); err != nil {
+		return err
+	}
+	t.pending = append(t.pending, database.Notification{Channel: channel, Payload: payload})
+	return nil
+}
+
+// Commit records COMMIT and delivers the notifications of the transaction
+func (t *Tx) Commit() error {
+	if err := t.finish("COMMIT"); err != nil {
+		return err
+	}
+	for _, n := range t.pending {
+		t.conn.provider.publish(n)
+	}
+	return nil
+}
+
+// Rollback records ROLLBACK
+func (t *Tx) Rollback() error {
+	return t.finish("ROLLBACK")
+}
+
+// finish ends the transaction
+func (t *Tx) finish(statement string) error {
+	if t.done {
+		return database.ErrTxDone
+	}
+	t.done = true
+	_, err := t.conn.run(context.Background(), statement)
+	return err
+}
+
+// result is the result of every fake statement
+type result struct{}
+
+// LastInsertId returns zero
+func (result) LastInsertId() (int64, error) { return 0, nil }
+
+// RowsAffected returns one
+func (result) RowsAffected() (int64, error) { return 1, nil }
+
+// row is the first of the canned rows
+type row struct {
+	rows [][]interface{}
+	err  error
+}
+
+// Scan copies the row into dest
+func (r row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.rows) == 0 {
+		return database.ErrNoRows
+	}
+	return assign(r.rows[0], dest)
+}
+
+// Rows iterates over the canned rows
+type Rows struct {
+	rows    [][]interface{}
+	current int
+}
+
+// Next advances to the next row
+func (r *Rows) Next() bool {
+	if r.current >= len(r.rows) {
+		return false
+	}
+	r.current++
+	return true
+}
+
+// Scan copies the current row into dest
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.current == 0 || r.current > len(r.rows) {
+		return errors.New("fake: Scan called without a current row")
+	}
+	return assign(r.rows[r.current-1], dest)
+}
+
+// Close does nothing
+func (r *Rows) Close() error { return nil }
+
+// Err returns nil
+func (r *Rows) Err() error { return nil }
+
+// assign copies values into the pointers in dest, converting between
+// compatible types
+func assign(values []interface{}, dest []interface{}) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("fake: row has %d columns, scanned into %d", len(values), len(dest))
+	}
+	for i, value := range values {
+		target := reflect.ValueOf(dest[i])
+		if target.Kind() != reflect.Pointer || target.IsNil() {
+			return fmt.Errorf("fake: destination %d is not a pointer", i)
+		}
+		target = target.Elem()
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		v := reflect.ValueOf(value)
+		if !v.Type().ConvertibleTo(target.Type()) {
+			return fmt.Errorf("fake: cannot scan %T into %s", value, target.Type())
+		}
+		target.Set(v.Convert(target.Type()))
+	}
+	return nil
+}
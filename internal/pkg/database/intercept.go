@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// QueryInfo describes a statement passing through the interceptors of a
+// connection. Before hooks may rewrite Query and Args; Duration, which
+// includes delays added by interceptors, and Err are set before After is
+// called.
+type QueryInfo struct {
+	// Method is Execute, Query, QueryRow or BulkInsert. The Query of a
+	// BulkInsert names the table and columns, and its Args are nil.
+	Method string
+	Query  string
+	Args   []interface{}
+	// Name is the query name from WithQueryName
+	Name string
+	// InTx reports whether the statement runs in a transaction
+	InTx     bool
+	Duration time.Duration
+	Err      error
+}
+
+// Interceptor hooks into every statement run on an intercepted connection
+// or one of its transactions
+type Interceptor interface {
+	// Before is called before the statement runs. It may return a derived
+	// context for the statement, or an error to fail it without running it.
+	Before(ctx context.Context, info *QueryInfo) (context.Context, error)
+	// After is called once the statement completed
+	After(ctx context.Context, info *QueryInfo)
+}
+
+// Hooks is an Interceptor built from functions, either of which may be nil
+type Hooks struct {
+	BeforeFunc func(ctx context.Context, info *QueryInfo) (context.Context, error)
+	AfterFunc  func(ctx context.Context, info *QueryInfo)
+}
+
+// Before calls BeforeFunc, if set
+func (h Hooks) Before(ctx context.Context, info *QueryInfo) (context.Context, error) {
+	if h.BeforeFunc == nil {
+		return ctx, nil
+	}
+	return h.BeforeFunc(ctx, info)
+}
+
+// After calls AfterFunc, if set
+func (h Hooks) After(ctx context.Context, info *QueryInfo) {
+	if h.AfterFunc != nil {
+		h.AfterFunc(ctx, info)
+	}
+}
+
+// chain runs interceptors in order before a statement and in reverse order
+// after it
+type chain []Interceptor
+
+// before runs the Before hooks. When one fails, the After hooks of those
+// that already ran are called with the error, so they can release what
+// they acquired.
+func (c chain) before(ctx context.Context, info *QueryInfo) (context.Context, error) {
+	countQuery(ctx)
+	for i, interceptor := range c {
+		next, err := interceptor.Before(ctx, info)
+		if err != nil {
+			info.Err = err
+			c[:i].after(ctx, info)
+			return ctx, err
+		}
+		ctx = next
+	}
+	return ctx, nil
+}
+
+// after runs the After hooks in reverse order
+func (c chain) after(ctx context.Context, info *QueryInfo) {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i].After(ctx, info)
+	}
+}
+
+// finish records the outcome of a statement and runs the After hooks
+func (c chain) finish(ctx context.Context, info *QueryInfo, start time.Time, err error) {
+	info.Duration = time.Since(start)
+	info.Err = err
+	c.after(ctx, info)
+}
+
+// newInfo describes a statement about to run
+func newInfo(ctx context.Context, method, query string, args []interface{}, inTx bool) *QueryInfo {
+	return &QueryInfo{Method: method, Query: query, Args: args, Name: QueryName(ctx), InTx: inTx}
+}
+
+// Intercept returns conn running interceptors around each statement. The
+// returned connection keeps exposing pool statistics and reconnecting when
+// conn supports them.
+func Intercept(conn Connection, interceptors ...Interceptor) Connection {
+	if len(interceptors) == 0 {
+		return conn
+	}
+	return &interceptedConnection{conn: conn, chain: chain(interceptors)}
+}
+
+// InterceptProvider returns provider intercepting every connection it opens
+func InterceptProvider(provider Provider, interceptors ...Interceptor) Provider {
+	return &interceptedProvider{Provider: provider, interceptors: interceptors}
+}
+
+// interceptedProvider opens intercepted connections
+type interceptedProvider struct {
+	Provider
+	interceptors []Interceptor
+}
+
+// Connect opens a connection with the wrapped provider and intercepts it
+func (p *interceptedProvider) Connect(config Config) (Connection, error) {
+	conn, err := p.Provider.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	return Intercept(conn, p.interceptors...), nil
+}
+
+// interceptedConnection runs a chain of interceptors around the statements
+// of a connection
+type interceptedConnection struct {
+	conn  Connection
+	chain chain
+}
+
+// Execute runs a query without returning any rows
+func (c *interceptedConnection) Execute(ctx context.Context, query string, args ...interface{}) (Result, error) {
+	return execute(ctx, c.chain, c.conn, false, query, args)
+}
+
+// Query runs a query that returns rows
+func (c *interceptedConnection) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return queryRows(ctx, c.chain, c.conn, false, query, args)
+}
+
+// QueryRow runs a query that returns a single row
+func (c *interceptedConnection) QueryRow(ctx context.Context, query string, args ...interface{}) Row {
+	return queryRow(ctx, c.chain, c.conn, false, query, args)
+}
+
+// Begin starts a transaction whose statements are intercepted as well
+func (c *interceptedConnection) Begin(ctx context.Context) (Transaction, error) {
+	tx, err := c.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &interceptedTransaction{tx: tx, chain: c.chain}, nil
+}
+
+// BulkInsert bulk inserts rows, if the connection supports it
+func (c *interceptedConnection) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	return bulkInsert(ctx, c.chain, c.conn, false, table, columns, rows)
+}
+
+// Notify publishes a notification, if the connection supports it
+func (c *interceptedConnection) Notify(ctx context.Context, channel, payload string) error {
+	return notify(ctx, c.conn, channel, payload)
+}
+
+// Listen subscribes to a channel, if the connection supports it
+func (c *interceptedConnection) Listen(ctx context.Context, channel string) (Subscription, error) {
+	listener, ok := c.conn.(Listener)
+	if !ok {
+		return nil, fmt.Errorf("listen to %s: %w", channel, errors.ErrUnsupported)
+	}
+	return listener.Listen(ctx, channel)
+}
+
+// Close closes the connection
+func (c *interceptedConnection) Close() error {
+	return c.conn.Close()
+}
+
+// Health checks the connection
+func (c *interceptedConnection) Health(ctx context.Context) error {
+	return c.conn.Health(ctx)
+}
+
+// Stats returns the pool statistics of the connection, if it has any
+func (c *interceptedConnection) Stats() sql.DBStats {
+	if stats, ok := c.conn.(StatsProvider); ok {
+		return stats.Stats()
+	}
+	return sql.DBStats{}
+}
+
+// Reconnect reconnects the connection, if it supports reconnecting
+func (c *interceptedConnection) Reconnect(config Config) error {
+	if reconnector, ok := c.conn.(Reconnector); ok {
+		return reconnector.Reconnect(config)
+	}
+	return errors.New("connection does not support reconnecting")
+}
+
+// interceptedTransaction runs a chain of interceptors around the
+// statements of a transaction
+type interceptedTransaction struct {
+	tx    Transaction
+	chain chain
+}
+
+// Execute runs a query within the transaction
+func (t *interceptedTransaction) Execute(ctx context.Context, query string, args ...interface{}) (Result, error) {
+	return execute(ctx, t.chain, t.tx, true, query, args)
+}
+
+// Query runs a query within the transaction that returns rows
+func (t *interceptedTransaction) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return queryRows(ctx, t.chain, t.tx, true, query, args)
+}
+
+// QueryRow runs a query within the transaction that returns a single row
+func (t *interceptedTransaction) QueryRow(ctx context.Context, query string, args ...interface{}) Row {
+	return queryRow(ctx, t.chain, t.tx, true, query, args)
+}
+
+// BulkInsert bulk inserts rows within the transaction, if it supports it
+func (t *interceptedTransaction) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	return bulkInsert(ctx, t.chain, t.tx, true, table, columns, rows)
+}
+
+// Notify publishes a notification when the transaction commits, if it
+// supports notifications
+func (t *interceptedTransaction) Notify(ctx context.Context, channel, payload string) error {
+	return notify(ctx, t.tx, channel, payload)
+}
+
+// Commit commits the transaction
+func (t *interceptedTransaction) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback rolls back the transaction
+func (t *interceptedTransaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// queryer is the part of Connection and Transaction that runs statements
+type queryer interface {
+	Execute(ctx context.Context, query string, args ...interface{}) (Result, error)
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	QueryRow(ctx context.Context, query string, args ...interface{}) Row
+}
+
+// execute runs Execute on q within the chain
+func execute(ctx context.Context, c chain, q queryer, inTx bool, query string, args []interface{}) (Result, error) {
+	info := newInfo(ctx, "Execute", query, args, inTx)
+	start := time.Now()
+	ctx, err := c.before(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	result, err := q.Execute(ctx, info.Query, info.Args...)
+	c.finish(ctx, info, start, err)
+	return result, err
+}
+
+// queryRows runs Query on q within the chain
+func queryRows(ctx context.Context, c chain, q queryer, inTx bool, query string, args []interface{}) (Rows, error) {
+	info := newInfo(ctx, "Query", query, args, inTx)
+	start := time.Now()
+	ctx, err := c.before(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(ctx, info.Query, info.Args...)
+	c.finish(ctx, info, start, err)
+	return rows, err
+}
+
+// queryRow runs QueryRow on q within the chain. Its error is only known
+// once the row is scanned, so the After hooks run in Scan.
+func queryRow(ctx context.Context, c chain, q queryer, inTx bool, query string, args []interface{}) Row {
+	info := newInfo(ctx, "QueryRow", query, args, inTx)
+	start := time.Now()
+	ctx, err := c.before(ctx, info)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return &interceptedRow{row: q.QueryRow(ctx, info.Query, info.Args...), ctx: ctx, chain: c, info: info, start: start}
+}
+
+// bulkInsert runs BulkInsert on target within the chain
+func bulkInsert(ctx context.Context, c chain, target interface{}, inTx bool, table string, columns []string, rows [][]interface{}) (int64, error) {
+	inserter, ok := target.(BulkInserter)
+	if !ok {
+		return 0, fmt.Errorf("bulk insert into %s: %w", table, errors.ErrUnsupported)
+	}
+
+	info := newInfo(ctx, "BulkInsert", table+" ("+strings.Join(columns, ", ")+")", nil, inTx)
+	start := time.Now()
+	ctx, err := c.before(ctx, info)
+	if err != nil {
+		return 0, err
+	}
+	n, err := inserter.BulkInsert(ctx, table, columns, rows)
+	c.finish(ctx, info, start, err)
+	return n, err
+}
+
+// notify runs Notify on target. Its statement is not intercepted, since
+// target runs it itself.
+func notify(ctx context.Context, target interface{}, channel, payload string) error {
+	notifier, ok := target.(Notifier)
+	if !ok {
+		return fmt.Errorf("notify %s: %w", channel, errors.ErrUnsupported)
+	}
+	return notifier.Notify(ctx, channel, payload)
+}
+
+// interceptedRow runs the After hooks of a QueryRow when it is scanned
+type interceptedRow struct {
+	row   Row
+	ctx   context.Context
+	chain chain
+	info  *QueryInfo
+	start time.Time
+}
+
+// Scan copies the row into dest
+func (r *interceptedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	r.chain.finish(r.ctx, r.info, r.start, err)
+	return err
+}
+
+// errRow is a row of a statement an interceptor failed
+type errRow struct {
+	err error
+}
+
+// Scan returns the error of the statement
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+type queryCounterKey struct{}
+
+// WithQueryCounter returns a copy of ctx counting the statements run with
+// it on intercepted connections, for example during one request
+func WithQueryCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryCounterKey{}, new(atomic.Int64))
+}
+
+// QueryCount returns the number of statements counted in ctx so far
+func QueryCount(ctx context.Context) int {
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		return int(counter.Load())
+	}
+	return 0
+}
+
+// countQuery counts a statement in ctx, if it has a counter
+func countQuery(ctx context.Context) {
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
@@ -0,0 +1,152 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/fake"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInterceptedConnection(t *testing.T, interceptors ...database.Interceptor) (database.Connection, *fake.Conn) {
+	provider := fake.NewProvider()
+	conn, err := database.InterceptProvider(provider, interceptors...).Connect(database.Config{ConnectionString: "db"})
+	require.NoError(t, err)
+	return conn, provider.Conn("db")
+}
+
+// recorder is an interceptor recording the hooks called
+type recorder struct {
+	name  string
+	calls *[]string
+	infos []database.QueryInfo
+}
+
+func (r *recorder) Before(ctx context.Context, info *database.QueryInfo) (context.Context, error) {
+	*r.calls = append(*r.calls, "before "+r.name)
+	return ctx, nil
+}
+
+func (r *recorder) After(ctx context.Context, info *database.QueryInfo) {
+	*r.calls = append(*r.calls, "after "+r.name)
+	r.infos = append(r.infos, *info)
+}
+
+func TestIntercept(t *testing.T) {
+	t.Run("Should run the hooks around statements in order", func(t *testing.T) {
+		var calls []string
+		outer, inner := &recorder{name: "outer", calls: &calls}, &recorder{name: "inner", calls: &calls}
+		conn, _ := newInterceptedConnection(t, outer, inner)
+
+		_, err := conn.Execute(database.WithQueryName(context.Background(), "users.delete"), "DELETE FROM users WHERE id = $1", 7)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"before outer", "before inner", "after inner", "after outer"}, calls)
+		require.Len(t, outer.infos, 1)
+		assert.Equal(t, "Execute", outer.infos[0].Method)
+		assert.Equal(t, "users.delete", outer.infos[0].Name)
+		assert.Equal(t, []interface{}{7}, outer.infos[0].Args)
+		assert.False(t, outer.infos[0].InTx)
+	})
+
+	t.Run("Should intercept transactions and report row errors on Scan", func(t *testing.T) {
+		var calls []string
+		rec := &recorder{name: "rec", calls: &calls}
+		conn, _ := newInterceptedConnection(t, rec)
+
+		tx, err := conn.Begin(context.Background())
+		require.NoError(t, err)
+		var id int
+		err = tx.QueryRow(context.Background(), "SELECT id FROM users").Scan(&id)
+		require.NoError(t, tx.Rollback())
+
+		assert.ErrorIs(t, err, database.ErrNoRows)
+		require.Len(t, rec.infos, 1)
+		assert.True(t, rec.infos[0].InTx)
+		assert.ErrorIs(t, rec.infos[0].Err, database.ErrNoRows)
+	})
+
+	t.Run("Should not run statements an interceptor rejected", func(t *testing.T) {
+		var calls []string
+		rec := &recorder{name: "rec", calls: &calls}
+		rejected := errors.New("rejected")
+		conn, fakeConn := newInterceptedConnection(t, rec, database.Chaos{Err: rejected})
+
+		_, err := conn.Query(context.Background(), "SELECT 1")
+
+		assert.ErrorIs(t, err, rejected)
+		assert.Empty(t, fakeConn.Statements())
+		assert.Equal(t, []string{"before rec", "after rec"}, calls)
+		assert.ErrorIs(t, rec.infos[0].Err, rejected)
+	})
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewLogger(logger.LoggerConfig{Output: &buf, Formatter: &logrus.JSONFormatter{}, Level: logrus.InfoLevel})
+	conn, _ := newInterceptedConnection(t,
+		database.SlowQueryLog(20*time.Millisecond, log),
+		database.Chaos{Latency: 30 * time.Millisecond, Match: func(info *database.QueryInfo) bool { return info.Name == "users.slow" }},
+	)
+
+	t.Run("Should log statements slower than the threshold", func(t *testing.T) {
+		_, err := conn.Execute(database.WithQueryName(context.Background(), "users.slow"), "UPDATE users SET active = $1", false)
+
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `"query_name":"users.slow"`)
+		assert.Contains(t, buf.String(), "Slow query")
+		assert.NotContains(t, buf.String(), "false")
+	})
+
+	t.Run("Should not log fast statements", func(t *testing.T) {
+		buf.Reset()
+		_, err := conn.Execute(context.Background(), "UPDATE users SET active = true")
+
+		require.NoError(t, err)
+		assert.Empty(t, buf.String())
+	})
+}
+
+func TestQueryLimit(t *testing.T) {
+	conn, fakeConn := newInterceptedConnection(t, database.QueryLimit(2))
+
+	t.Run("Should fail statements beyond the limit of the counter", func(t *testing.T) {
+		ctx := database.WithQueryCounter(context.Background())
+		for i := 0; i < 2; i++ {
+			_, err := conn.Execute(ctx, "SELECT 1")
+			require.NoError(t, err)
+		}
+
+		_, err := conn.Execute(ctx, "SELECT 1")
+
+		assert.ErrorIs(t, err, database.ErrQueryLimit)
+		assert.Equal(t, 3, database.QueryCount(ctx))
+		assert.Len(t, fakeConn.Statements(), 2)
+	})
+
+	t.Run("Should not limit statements without a counter", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, err := conn.Execute(context.Background(), "SELECT 1")
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestChaos(t *testing.T) {
+	t.Run("Should give up waiting when the context is done", func(t *testing.T) {
+		conn, _ := newInterceptedConnection(t, database.Chaos{Latency: time.Minute})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := conn.Execute(ctx, "SELECT 1")
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// ErrQueryLimit is returned for statements beyond the limit of QueryLimit
+var ErrQueryLimit = errors.New("query limit exceeded")
+
+// SlowQueryLog logs statements taking threshold or longer as warnings, to
+// the request-scoped logger when there is one. Arguments are not logged as
+// they may hold personal data.
+func SlowQueryLog(threshold time.Duration, log logger.Logger) Interceptor {
+	return Hooks{AfterFunc: func(ctx context.Context, info *QueryInfo) {
+		if info.Duration < threshold {
+			return
+		}
+		entry := logger.FromContextOr(ctx, log).WithFields(map[string]interface{}{
+			"query_name":  info.Name,
+			"query":       info.Query,
+			"duration_ms": info.Duration.Milliseconds(),
+		})
+		if info.Err != nil {
+			entry = entry.WithError(info.Err)
+		}
+		entry.Warn("Slow query")
+	}}
+}
+
+// QueryLimit fails statements once more than max were run with a context
+// from WithQueryCounter, which catches N+1 query patterns. Statements
+// without a counter are not limited.
+func QueryLimit(max int) Interceptor {
+	return Hooks{BeforeFunc: func(ctx context.Context, info *QueryInfo) (context.Context, error) {
+		if count := QueryCount(ctx); count > max {
+			return ctx, fmt.Errorf("%w: %s is statement %d, at most %d are allowed", ErrQueryLimit, info.Name, count, max)
+		}
+		return ctx, nil
+	}}
+}
+
+// Chaos injects latency and failures into statements, to test how callers
+// cope with a slow or failing database
+type Chaos struct {
+	// Latency delays each affected statement
+	Latency time.Duration
+	// Err fails each affected statement without running it
+	Err error
+	// Rate is the fraction of statements affected, all of them when zero
+	Rate float64
+	// Match selects the statements that may be affected, all of them when
+	// nil
+	Match func(info *QueryInfo) bool
+}
+
+// Before delays or fails the statement
+func (c Chaos) Before(ctx context.Context, info *QueryInfo) (context.Context, error) {
+	if c.Match != nil && !c.Match(info) {
+		return ctx, nil
+	}
+	if c.Rate > 0 && rand.Float64() >= c.Rate {
+		return ctx, nil
+	}
+
+	if c.Latency > 0 {
+		timer := time.NewTimer(c.Latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return ctx, c.Err
+}
+
+// After does nothing
+func (c Chaos) After(ctx context.Context, info *QueryInfo) {}
@@ -0,0 +1,38 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("Should load migrations in version order", func(t *testing.T) {
+		migrations, err := Load(fstest.MapFS{
+			"0002_add_roles.sql":    {Data: []byte("ALTER TABLE users ADD role TEXT")},
+			"0001_create_users.sql": {Data: []byte("CREATE TABLE users (id INT)")},
+			"README.md":             {Data: []byte("ignored")},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, 1, migrations[0].Version)
+		assert.Equal(t, "create_users", migrations[0].Name)
+		assert.Equal(t, 2, migrations[1].Version)
+	})
+
+	t.Run("Should reject duplicate versions", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"0001_a.sql": {Data: []byte("SELECT 1")},
+			"1_b.sql":    {Data: []byte("SELECT 1")},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject malformed names", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"create_users.sql": {Data: []byte("SELECT 1")}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Notification is a message published to a channel with a Notifier
+type Notification struct {
+	Channel string
+	Payload string
+	// Missed reports that notifications may have been lost before this
+	// one, for example while the listener reconnected or the subscriber
+	// fell behind. Subscribers caching data should drop their caches. A
+	// notification sent only to report the loss has an empty Payload.
+	Missed bool
+}
+
+// Notifier is implemented by connections and transactions that can
+// publish notifications. Notifications published in a transaction are
+// delivered when it commits and dropped when it rolls back.
+type Notifier interface {
+	Notify(ctx context.Context, channel, payload string) error
+}
+
+// Listener is implemented by connections that can subscribe to the
+// notifications published on a channel. PostgreSQL uses LISTEN; other
+// providers may poll.
+type Listener interface {
+	Listen(ctx context.Context, channel string) (Subscription, error)
+}
+
+// Subscription receives the notifications of a channel until it is closed
+type Subscription interface {
+	// Notifications returns the channel notifications are delivered on,
+	// which is closed with the subscription
+	Notifications() <-chan Notification
+	Close() error
+}
+
+// Event is a notification whose JSON payload was decoded into a T
+type Event[T any] struct {
+	Value T
+	// Missed reports that events may have been lost before this one, see
+	// Notification.Missed. Value is the zero value when the event only
+	// reports the loss.
+	Missed bool
+	// Err is set when the payload could not be decoded
+	Err error
+}
+
+// Publish encodes value as JSON and publishes it on channel. Pass a
+// transaction to publish only if it commits.
+func Publish[T any](ctx context.Context, n Notifier, channel string, value T) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode notification for %s: %w", channel, err)
+	}
+	return n.Notify(ctx, channel, string(payload))
+}
+
+// Subscribe listens to channel and decodes the JSON payload of each
+// notification into a T. The events channel is closed when ctx is done or
+// the subscription ends.
+func Subscribe[T any](ctx context.Context, l Listener, channel string) (<-chan Event[T], error) {
+	sub, err := l.Listen(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event[T])
+	go func() {
+		defer close(events)
+		defer sub.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n, ok := <-sub.Notifications():
+				if !ok {
+					return
+				}
+				select {
+				case events <- decodeEvent[T](n):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// decodeEvent decodes the payload of n
+func decodeEvent[T any](n Notification) Event[T] {
+	event := Event[T]{Missed: n.Missed}
+	if n.Payload == "" {
+		return event
+	}
+	if err := json.Unmarshal([]byte(n.Payload), &event.Value); err != nil {
+		event.Err = fmt.Errorf("decode notification on %s: %w", n.Channel, err)
+	}
+	return event
+}
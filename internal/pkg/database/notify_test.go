@@ -0,0 +1,79 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userChanged struct {
+	ID      int `json:"id"`
+	Version int `json:"version"`
+}
+
+// receive returns the next event, failing the test if none arrives
+func receive[T any](t *testing.T, events <-chan database.Event[T]) database.Event[T] {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return database.Event[T]{}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	provider := fake.NewProvider()
+	publisher, subscriber := provider.Conn("api-1"), provider.Conn("api-2")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := database.Subscribe[userChanged](ctx, subscriber, "users")
+	require.NoError(t, err)
+
+	t.Run("Should deliver events published in a transaction once it commits", func(t *testing.T) {
+		err := database.WithTx(ctx, publisher, func(tx database.Transaction) error {
+			return database.Publish(ctx, tx.(database.Notifier), "users", userChanged{ID: 7, Version: 2})
+		})
+		require.NoError(t, err)
+
+		event := receive(t, events)
+		require.NoError(t, event.Err)
+		assert.Equal(t, userChanged{ID: 7, Version: 2}, event.Value)
+		assert.False(t, event.Missed)
+	})
+
+	t.Run("Should drop events of rolled back transactions", func(t *testing.T) {
+		failed := errors.New("failed")
+		err := database.WithTx(ctx, publisher, func(tx database.Transaction) error {
+			require.NoError(t, database.Publish(ctx, tx.(database.Notifier), "users", userChanged{ID: 8}))
+			return failed
+		})
+		require.ErrorIs(t, err, failed)
+		require.NoError(t, database.Publish(ctx, publisher, "users", userChanged{ID: 9}))
+
+		assert.Equal(t, 9, receive(t, events).Value.ID)
+	})
+
+	t.Run("Should report missed events and undecodable payloads", func(t *testing.T) {
+		provider.Interrupt()
+		require.NoError(t, publisher.Notify(ctx, "users", "not json"))
+
+		assert.True(t, receive(t, events).Missed)
+		assert.Error(t, receive(t, events).Err)
+	})
+
+	t.Run("Should end when the context is done", func(t *testing.T) {
+		cancel()
+
+		for range events {
+		}
+	})
+}
@@ -0,0 +1,312 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// subscriptionBuffer is the number of notifications a subscription holds
+// for a slow subscriber. Later ones are dropped and reported as missed.
+const subscriptionBuffer = 64
+
+// Delays between attempts to re-establish a lost listener connection
+const (
+	minReconnectInterval = 100 * time.Millisecond
+	maxReconnectInterval = 30 * time.Second
+)
+
+// notificationSource is the part of pq.Listener used by a hub
+type notificationSource interface {
+	Listen(channel string) error
+	Unlisten(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Close() error
+}
+
+// sourceFunc opens a notificationSource for a connection string, reporting
+// its connection events to onEvent
+type sourceFunc func(dsn string, onEvent pq.EventCallbackType) notificationSource
+
+// newPQListener opens a pq.Listener, which reconnects on its own
+func newPQListener(dsn string, onEvent pq.EventCallbackType) notificationSource {
+	return pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, onEvent)
+}
+
+// Notify publishes payload on channel with pg_notify
+func (c *Connection) Notify(ctx context.Context, channel, payload string) error {
+	_, err := c.Execute(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// Notify publishes payload on channel when the transaction commits
+func (t *Transaction) Notify(ctx context.Context, channel, payload string) error {
+	_, err := t.Execute(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// Listen subscribes to channel. All subscriptions of a connection share
+// one listener connection, which is re-established when it is lost; the
+// next notification of every subscription is then marked as missed. The
+// subscription ends when it is closed, not with ctx.
+func (c *Connection) Listen(ctx context.Context, channel string) (database.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	h, err := c.notifications()
+	if err != nil {
+		return nil, err
+	}
+	return h.subscribe(channel)
+}
+
+// notifications returns the hub of the connection, starting it on first
+// use
+func (c *Connection) notifications() (*hub, error) {
+	c.hubMu.Lock()
+	defer c.hubMu.Unlock()
+
+	if c.hub != nil {
+		return c.hub, nil
+	}
+	config := c.config.Load()
+	if config == nil || c.provider == nil {
+		return nil, fmt.Errorf("listen without a connection string: %w", errors.ErrUnsupported)
+	}
+	c.hub = newHub(c.logger, func(onEvent pq.EventCallbackType) notificationSource {
+		return c.provider.listen(connectionString(*config), onEvent)
+	})
+	return c.hub, nil
+}
+
+// hub shares a listener connection between the subscriptions of a
+// Connection
+type hub struct {
+	logger logger.Logger
+
+	// listenMu serializes LISTEN, UNLISTEN and replacing the source, which
+	// block on the database. mu guards the rest and is never held while
+	// blocking, so notifications keep flowing.
+	listenMu sync.Mutex
+	mu       sync.Mutex
+	source   notificationSource
+	subs     map[string]map[*subscription]struct{}
+	closed   bool
+}
+
+// newHub starts a hub on the source returned by open
+func newHub(log logger.Logger, open func(onEvent pq.EventCallbackType) notificationSource) *hub {
+	h := &hub{logger: log, subs: make(map[string]map[*subscription]struct{})}
+	h.source = open(h.onEvent)
+	go h.run(h.source)
+	return h
+}
+
+// onEvent logs the connection events of the listener
+func (h *hub) onEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		h.logger.WithError(err).Warn("Notification listener disconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		h.logger.WithError(err).Warn("Notification listener failed to reconnect")
+	case pq.ListenerEventReconnected:
+		h.logger.Info("Notification listener reconnected, notifications may have been missed")
+	}
+}
+
+// run delivers the notifications of source until it is closed. pq sends
+// nil after reconnecting, since notifications sent meanwhile are lost.
+func (h *hub) run(source notificationSource) {
+	for n := range source.NotificationChannel() {
+		if n == nil {
+			h.broadcastMissed()
+			continue
+		}
+		h.deliver(database.Notification{Channel: n.Channel, Payload: n.Extra})
+	}
+}
+
+// deliver sends n to the subscribers of its channel
+func (h *hub) deliver(n database.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[n.Channel] {
+		s.send(n)
+	}
+}
+
+// broadcastMissed tells every subscriber that notifications were lost
+func (h *hub) broadcastMissed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for channel, subs := range h.subs {
+		for s := range subs {
+			s.send(database.Notification{Channel: channel, Missed: true})
+		}
+	}
+}
+
+// subscribe adds a subscription to channel, listening to it if it is the
+// first
+func (h *hub) subscribe(channel string) (*subscription, error) {
+	h.listenMu.Lock()
+	defer h.listenMu.Unlock()
+
+	s := &subscription{hub: h, channel: channel, ch: make(chan database.Notification, subscriptionBuffer)}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, errors.New("connection is closed")
+	}
+	first := len(h.subs[channel]) == 0
+	if first {
+		h.subs[channel] = make(map[*subscription]struct{})
+	}
+	h.subs[channel][s] = struct{}{}
+	source := h.source
+	h.mu.Unlock()
+
+	if first {
+		if err := source.Listen(channel); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			h.remove(s)
+			return nil, fmt.Errorf("listen to %s: %w", channel, err)
+		}
+	}
+	return s, nil
+}
+
+// unsubscribe removes s, no longer listening to its channel if it was the
+// last subscription
+func (h *hub) unsubscribe(s *subscription) error {
+	h.listenMu.Lock()
+	defer h.listenMu.Unlock()
+
+	if last := h.remove(s); !last {
+		return nil
+	}
+	h.mu.Lock()
+	source, closed := h.source, h.closed
+	h.mu.Unlock()
+	if closed {
+		return nil
+	}
+	if err := source.Unlisten(s.channel); err != nil && !errors.Is(err, pq.ErrChannelNotOpen) {
+		return fmt.Errorf("unlisten %s: %w", s.channel, err)
+	}
+	return nil
+}
+
+// remove drops s and closes its channel, reporting whether it was the last
+// subscription to its channel
+func (h *hub) remove(s *subscription) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.subs[s.channel]
+	if !ok {
+		return false
+	}
+	if _, ok := subs[s]; !ok {
+		return false
+	}
+	delete(subs, s)
+	close(s.ch)
+	if len(subs) > 0 {
+		return false
+	}
+	delete(h.subs, s.channel)
+	return true
+}
+
+// replace moves the subscriptions to a new source, for example one using
+// rotated credentials, and closes the previous one. Notifications sent
+// meanwhile may be lost, so every subscriber is told.
+func (h *hub) replace(source notificationSource) error {
+	h.listenMu.Lock()
+	defer h.listenMu.Unlock()
+
+	h.mu.Lock()
+	channels := make([]string, 0, len(h.subs))
+	for channel := range h.subs {
+		channels = append(channels, channel)
+	}
+	h.mu.Unlock()
+
+	for _, channel := range channels {
+		if err := source.Listen(channel); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			source.Close()
+			return fmt.Errorf("listen to %s: %w", channel, err)
+		}
+	}
+
+	h.mu.Lock()
+	previous := h.source
+	h.source = source
+	h.mu.Unlock()
+
+	go h.run(source)
+	h.broadcastMissed()
+	return previous.Close()
+}
+
+// close closes the source and ends every subscription
+func (h *hub) close() error {
+	h.listenMu.Lock()
+	defer h.listenMu.Unlock()
+
+	h.mu.Lock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for s := range subs {
+			close(s.ch)
+		}
+	}
+	h.subs = make(map[string]map[*subscription]struct{})
+	source := h.source
+	h.mu.Unlock()
+
+	return source.Close()
+}
+
+// subscription receives the notifications of one channel from a hub
+type subscription struct {
+	hub     *hub
+	channel string
+	ch      chan database.Notification
+	// missed is set when a notification was dropped, guarded by hub.mu
+	missed bool
+	once   sync.Once
+}
+
+// Notifications returns the channel notifications are delivered on
+func (s *subscription) Notifications() <-chan database.Notification {
+	return s.ch
+}
+
+// Close ends the subscription
+func (s *subscription) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.hub.unsubscribe(s)
+	})
+	return err
+}
+
+// send delivers n without blocking the hub. A notification that does not
+// fit is dropped and the next one delivered is marked as missed. Callers
+// hold hub.mu.
+func (s *subscription) send(n database.Notification) {
+	n.Missed = n.Missed || s.missed
+	select {
+	case s.ch <- n:
+		s.missed = false
+	default:
+		s.missed = true
+	}
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource stands in for pq.Listener
+type fakeSource struct {
+	mu        sync.Mutex
+	dsn       string
+	listening map[string]bool
+	ch        chan *pq.Notification
+	closed    bool
+}
+
+func (s *fakeSource) Listen(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listening[channel] {
+		return pq.ErrChannelAlreadyOpen
+	}
+	s.listening[channel] = true
+	return nil
+}
+
+func (s *fakeSource) Unlisten(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listening, channel)
+	return nil
+}
+
+func (s *fakeSource) NotificationChannel() <-chan *pq.Notification {
+	return s.ch
+}
+
+func (s *fakeSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	return nil
+}
+
+func (s *fakeSource) isListening(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listening[channel]
+}
+
+// newListeningConnection returns a connection whose listeners are fake
+// sources, the first of which is opened right away
+func newListeningConnection(t *testing.T) (*Connection, sqlmock.Sqlmock, func() []*fakeSource) {
+	conn, mock, _ := newTestConnection(t)
+	var mu sync.Mutex
+	var sources []*fakeSource
+	conn.provider = &Provider{logger: conn.logger, listen: func(dsn string, onEvent pq.EventCallbackType) notificationSource {
+		mu.Lock()
+		defer mu.Unlock()
+		source := &fakeSource{dsn: dsn, listening: make(map[string]bool), ch: make(chan *pq.Notification)}
+		sources = append(sources, source)
+		return source
+	}}
+	conn.config.Store(&database.Config{ConnectionString: "host=primary"})
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, mock, func() []*fakeSource {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*fakeSource(nil), sources...)
+	}
+}
+
+func next(t *testing.T, sub database.Subscription) database.Notification {
+	t.Helper()
+	select {
+	case n := <-sub.Notifications():
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+	}
+	return database.Notification{}
+}
+
+func TestConnection_Listen(t *testing.T) {
+	t.Run("Should share one LISTEN between subscribers of a channel", func(t *testing.T) {
+		conn, _, sources := newListeningConnection(t)
+		first, err := conn.Listen(context.Background(), "users")
+		require.NoError(t, err)
+		second, err := conn.Listen(context.Background(), "users")
+		require.NoError(t, err)
+		source := sources()[0]
+
+		source.ch <- &pq.Notification{Channel: "users", Extra: `{"id":7}`}
+
+		assert.Equal(t, `{"id":7}`, next(t, first).Payload)
+		assert.Equal(t, `{"id":7}`, next(t, second).Payload)
+
+		require.NoError(t, first.Close())
+		assert.True(t, source.isListening("users"))
+		require.NoError(t, second.Close())
+		assert.False(t, source.isListening("users"))
+		_, open := <-second.Notifications()
+		assert.False(t, open)
+	})
+
+	t.Run("Should report notifications missed while reconnecting", func(t *testing.T) {
+		conn, _, sources := newListeningConnection(t)
+		sub, err := conn.Listen(context.Background(), "users")
+		require.NoError(t, err)
+
+		sources()[0].ch <- nil
+
+		n := next(t, sub)
+		assert.True(t, n.Missed)
+		assert.Equal(t, "users", n.Channel)
+	})
+
+	t.Run("Should mark the next notification after an overflow as missed", func(t *testing.T) {
+		conn, _, sources := newListeningConnection(t)
+		sub, err := conn.Listen(context.Background(), "users")
+		require.NoError(t, err)
+		source := sources()[0]
+
+		for i := 0; i <= subscriptionBuffer; i++ {
+			source.ch <- &pq.Notification{Channel: "users"}
+		}
+		for i := 0; i < subscriptionBuffer; i++ {
+			assert.False(t, next(t, sub).Missed)
+		}
+		source.ch <- &pq.Notification{Channel: "users", Extra: "after"}
+
+		n := next(t, sub)
+		assert.True(t, n.Missed)
+		assert.Equal(t, "after", n.Payload)
+	})
+
+	t.Run("Should move listeners to rotated credentials", func(t *testing.T) {
+		conn, _, sources := newListeningConnection(t)
+		conn.provider.driver = "sqlmock"
+		sub, err := conn.Listen(context.Background(), "users")
+		require.NoError(t, err)
+		_, _, err = sqlmock.NewWithDSN("host=rotated")
+		require.NoError(t, err)
+
+		require.NoError(t, conn.Reconnect(database.Config{ConnectionString: "host=rotated"}))
+
+		all := sources()
+		require.Len(t, all, 2)
+		assert.Equal(t, "host=rotated", all[1].dsn)
+		assert.True(t, all[1].isListening("users"))
+		assert.True(t, next(t, sub).Missed)
+		all[1].ch <- &pq.Notification{Channel: "users", Extra: "rotated"}
+		assert.Equal(t, "rotated", next(t, sub).Payload)
+	})
+
+	t.Run("Should need a connection string", func(t *testing.T) {
+		conn, _, _ := newTestConnection(t)
+
+		_, err := conn.Listen(context.Background(), "users")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestTransaction_Notify(t *testing.T) {
+	t.Run("Should notify within the transaction", func(t *testing.T) {
+		conn, mock, _ := newTestConnection(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).WithArgs("users", `{"id":7}`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		tx, err := conn.Begin(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, tx.(database.Notifier).Notify(context.Background(), "users", `{"id":7}`))
+		require.NoError(t, tx.Commit())
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -6,24 +6,70 @@ import (
 	"crypto/x509"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq"
 	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
 	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+// LoggerName is the name of the logger used for database entries, so its
+// level can be adjusted independently of the rest of the application
+const LoggerName = "database.postgres"
+
 // Provider implements the database.Provider interface for PostgreSQL
 type Provider struct {
-	logger logger.Logger
+	logger   logger.Logger
+	observer database.QueryObserver
+	tracer   trace.Tracer
+	// driver overrides the database/sql driver name, for tests
+	driver string
+	// listen opens the listener connections of Listen
+	listen sourceFunc
+}
+
+// Option configures optional Provider behaviour
+type Option func(*Provider)
+
+// WithQueryObserver reports the name, duration and outcome of every query
+// run on connections opened by the provider
+func WithQueryObserver(observer database.QueryObserver) Option {
+	return func(p *Provider) {
+		p.observer = observer
+	}
+}
+
+// WithTracerProvider creates a span for every query and transaction run on
+// connections opened by the provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(p *Provider) {
+		p.tracer = tracing.Tracer(tp)
+	}
 }
 
 // NewProvider creates a new PostgreSQL provider
-func NewProvider(logger logger.Logger) *Provider {
-	return &Provider{
-		logger: logger,
+func NewProvider(logger logger.Logger, opts ...Option) *Provider {
+	p := &Provider{
+		logger: logger.Named(LoggerName),
+		tracer: noop.NewTracerProvider().Tracer(tracing.InstrumentationName),
+		listen: newPQListener,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 // Name returns the provider name
@@ -33,25 +79,45 @@ func (p *Provider) Name() string {
 
 // Connect establishes a connection to PostgreSQL
 func (p *Provider) Connect(config database.Config) (database.Connection, error) {
-	connStr := config.ConnectionString
-	
-	// If SSL is enabled, configure TLS
-	if config.SSLMode != "disable" && config.SSLMode != "" {
-		// Setup TLS if certificates are provided
-		if config.SSLCert != "" && config.SSLKey != "" {
-			tlsConfig, err := setupTLS(config)
-			if err != nil {
-				return nil, fmt.Errorf("failed to setup TLS: %w", err)
-			}
-			sql.Register("postgres+tls", &wrappedDriver{tlsConfig: tlsConfig})
-			connStr += " sslmode=require"
-		} else {
-			connStr += fmt.Sprintf(" sslmode=%s", config.SSLMode)
+	db, err := p.open(config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Info("Successfully connected to PostgreSQL database")
+	c := p.Wrap(db)
+	c.config.Store(&config)
+	return c, nil
+}
+
+// Wrap returns a connection using an existing pool, such as one opened by
+// a test driver
+func (p *Provider) Wrap(db *sql.DB) *Connection {
+	c := &Connection{
+		logger:   p.logger,
+		observer: p.observer,
+		tracer:   p.tracer,
+		provider: p,
+	}
+	c.current.Store(newPool(db, c.logger))
+	return c
+}
+
+// open creates and verifies a connection pool for config
+func (p *Provider) open(config database.Config) (*sql.DB, error) {
+	// Setup TLS if SSL is enabled and certificates are provided
+	if config.SSLMode != "disable" && config.SSLMode != "" && config.SSLCert != "" && config.SSLKey != "" {
+		tlsConfig, err := setupTLS(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup TLS: %w", err)
 		}
+		registerTLSDriver.Do(func() {
+			sql.Register("postgres+tls", &wrappedDriver{tlsConfig: tlsConfig})
+		})
 	}
 
 	// Open database connection
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open(p.driverName(), connectionString(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open postgres connection: %w", err)
 	}
@@ -66,26 +132,185 @@ func (p *Provider) Connect(config database.Config) (database.Connection, error)
 		db.Close()
 		return nil, fmt.Errorf("failed to ping postgres: %w", err)
 	}
+	return db, nil
+}
 
-	p.logger.Info("Successfully connected to PostgreSQL database")
-	
-	return &Connection{
-		db:     db,
-		logger: p.logger,
-	}, nil
+// connectionString returns the connection string of config with its SSL
+// mode
+func connectionString(config database.Config) string {
+	switch {
+	case config.SSLMode == "disable" || config.SSLMode == "":
+		return config.ConnectionString
+	case config.SSLCert != "" && config.SSLKey != "":
+		return config.ConnectionString + " sslmode=require"
+	}
+	return config.ConnectionString + fmt.Sprintf(" sslmode=%s", config.SSLMode)
 }
 
+// driverName returns the database/sql driver used to open connections
+func (p *Provider) driverName() string {
+	if p.driver != "" {
+		return p.driver
+	}
+	return "postgres"
+}
+
+// registerTLSDriver guards the one-time registration of the TLS driver,
+// which database/sql does not allow twice
+var registerTLSDriver sync.Once
+
 // Connection implements the database.Connection interface for PostgreSQL
 type Connection struct {
-	db     *sql.DB
-	logger logger.Logger
+	current  atomic.Pointer[pool]
+	logger   logger.Logger
+	observer database.QueryObserver
+	tracer   trace.Tracer
+	provider *Provider
+	// config is the configuration the pool was opened with, unknown for
+	// wrapped pools
+	config atomic.Pointer[database.Config]
+
+	hubMu sync.Mutex
+	hub   *hub
+}
+
+// acquire returns the connection pool queries currently run on. The pool
+// stays open until release is called, even if Reconnect replaces it.
+func (c *Connection) acquire() *pool {
+	for {
+		p := c.current.Load()
+		p.users.Add(1)
+		if c.current.Load() == p {
+			return p
+		}
+		p.release()
+	}
+}
+
+// pool is a connection pool counting the calls about to start work on it,
+// so a pool replaced by Reconnect is not closed under them
+type pool struct {
+	db      *sql.DB
+	logger  logger.Logger
+	users   atomic.Int64
+	retired atomic.Bool
+	closing sync.Once
+}
+
+// newPool wraps db
+func newPool(db *sql.DB, log logger.Logger) *pool {
+	return &pool{db: db, logger: log}
+}
+
+// release ends a use of the pool started by acquire, closing the pool if
+// it was retired and this was the last use
+func (p *pool) release() {
+	if p.users.Add(-1) == 0 && p.retired.Load() {
+		p.close()
+	}
+}
+
+// retire closes the pool once no call is about to start work on it
+func (p *pool) retire() {
+	p.retired.Store(true)
+	if p.users.Load() == 0 {
+		p.close()
+	}
+}
+
+// close closes the pool once. Close waits for in-flight work, so it must
+// not block the caller.
+func (p *pool) close() {
+	p.closing.Do(func() {
+		go func() {
+			if err := p.db.Close(); err != nil {
+				p.logger.WithError(err).Warn("Failed to close previous connection pool")
+			}
+		}()
+	})
+}
+
+// Reconnect opens a new connection pool with config, for example after
+// the credentials were rotated, and swaps it in. Queries and transactions
+// already running on the previous pool are allowed to finish before it is
+// closed. The current pool stays in use if the new one cannot connect.
+func (c *Connection) Reconnect(config database.Config) error {
+	if c.provider == nil {
+		return errors.New("connection does not support reconnecting")
+	}
+	db, err := c.provider.open(config)
+	if err != nil {
+		return err
+	}
+
+	previous := c.current.Swap(newPool(db, c.logger))
+	c.config.Store(&config)
+	c.logger.Info("Reconnected to PostgreSQL database")
+
+	c.hubMu.Lock()
+	if c.hub != nil {
+		if err := c.hub.replace(c.provider.listen(connectionString(config), c.hub.onEvent)); err != nil {
+			c.logger.WithError(err).Warn("Failed to move notification listeners to the new credentials")
+		}
+	}
+	c.hubMu.Unlock()
+
+	previous.retire()
+	return nil
+}
+
+// observe reports a completed query to the observer, if any
+func observe(ctx context.Context, observer database.QueryObserver, start time.Time, err error) {
+	if observer != nil {
+		observer(ctx, database.QueryName(ctx), time.Since(start), err)
+	}
+}
+
+// contextLogger returns the request-scoped logger from ctx, or fallback,
+// annotated with the current trace and named after the package
+func contextLogger(ctx context.Context, fallback logger.Logger) logger.Logger {
+	return tracing.WithTraceFields(ctx, logger.FromContextOr(ctx, fallback).Named(LoggerName))
+}
+
+// startSpan starts a client span for a database call. The SQL text is
+// sanitized before it is attached so literals never reach the exporter.
+func startSpan(ctx context.Context, tracer trace.Tracer, method, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		attribute.String("db.query.name", database.QueryName(ctx)),
+	}
+	if query != "" {
+		attrs = append(attrs,
+			semconv.DBQueryText(tracing.SanitizeSQL(query)),
+			semconv.DBOperationName(tracing.SQLOperation(query)),
+		)
+	}
+	return tracer.Start(ctx, "postgres."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
 
 // Execute runs a query without returning any rows
 func (c *Connection) Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
-	result, err := c.db.ExecContext(ctx, query, args...)
+	ctx, span := startSpan(ctx, c.tracer, "Execute", query)
+	start := time.Now()
+	p := c.acquire()
+	result, err := p.db.ExecContext(ctx, query, args...)
+	p.release()
+	observe(ctx, c.observer, start, err)
+	endSpan(span, err)
 	if err != nil {
-		c.logger.WithField("query", query).WithError(err).Error("Failed to execute query")
+		contextLogger(ctx, c.logger).WithField("query", query).WithError(err).Error("Failed to execute query")
 		return nil, err
 	}
 	return &Result{result: result}, nil
@@ -93,9 +318,15 @@ func (c *Connection) Execute(ctx context.Context, query string, args ...interfac
 
 // Query runs a query that returns rows
 func (c *Connection) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
-	rows, err := c.db.QueryContext(ctx, query, args...)
+	ctx, span := startSpan(ctx, c.tracer, "Query", query)
+	start := time.Now()
+	p := c.acquire()
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	p.release()
+	observe(ctx, c.observer, start, err)
+	endSpan(span, err)
 	if err != nil {
-		c.logger.WithField("query", query).WithError(err).Error("Failed to execute query")
+		contextLogger(ctx, c.logger).WithField("query", query).WithError(err).Error("Failed to execute query")
 		return nil, err
 	}
 	return &Rows{rows: rows}, nil
@@ -103,28 +334,73 @@ func (c *Connection) Query(ctx context.Context, query string, args ...interface{
 
 // QueryRow runs a query that returns a single row
 func (c *Connection) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
-	row := c.db.QueryRowContext(ctx, query, args...)
-	return &Row{row: row}
+	ctx, span := startSpan(ctx, c.tracer, "QueryRow", query)
+	start := time.Now()
+	p := c.acquire()
+	row := p.db.QueryRowContext(ctx, query, args...)
+	p.release()
+	return &Row{row: row, ctx: ctx, start: start, observer: c.observer, span: span}
 }
 
 // Begin starts a transaction
 func (c *Connection) Begin(ctx context.Context) (database.Transaction, error) {
-	tx, err := c.db.BeginTx(ctx, nil)
+	ctx, span := startSpan(ctx, c.tracer, "Begin", "")
+	p := c.acquire()
+	tx, err := p.db.BeginTx(ctx, nil)
+	p.release()
+	endSpan(span, err)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to begin transaction")
+		contextLogger(ctx, c.logger).WithError(err).Error("Failed to begin transaction")
 		return nil, err
 	}
-	return &Transaction{tx: tx, logger: c.logger}, nil
+	return &Transaction{tx: tx, logger: c.logger, observer: c.observer, tracer: c.tracer}, nil
+}
+
+// BulkInsert loads rows into table with COPY FROM STDIN in a transaction
+// of its own, so either all rows are inserted or none
+func (c *Connection) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (n int64, err error) {
+	p := c.acquire()
+	tx, err := p.db.BeginTx(ctx, nil)
+	p.release()
+	if err != nil {
+		contextLogger(ctx, c.logger).WithError(err).Error("Failed to begin transaction")
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if n, err = copyIn(ctx, tx, c.logger, c.observer, c.tracer, table, columns, rows); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
 }
 
-// Close closes the database connection
+// Close closes the database connection and ends its subscriptions
 func (c *Connection) Close() error {
-	return c.db.Close()
+	c.hubMu.Lock()
+	defer c.hubMu.Unlock()
+
+	var err error
+	if c.hub != nil {
+		err = c.hub.close()
+		c.hub = nil
+	}
+	return errors.Join(c.current.Load().db.Close(), err)
 }
 
 // Health checks the database connection
 func (c *Connection) Health(ctx context.Context) error {
-	return c.db.PingContext(ctx)
+	p := c.acquire()
+	defer p.release()
+	return p.db.PingContext(ctx)
+}
+
+// Stats returns the connection pool statistics
+func (c *Connection) Stats() sql.DBStats {
+	return c.current.Load().db.Stats()
 }
 
 // Result implements the database.Result interface
@@ -144,12 +420,20 @@ func (r *Result) RowsAffected() (int64, error) {
 
 // Row implements the database.Row interface
 type Row struct {
-	row *sql.Row
+	row      *sql.Row
+	ctx      context.Context
+	start    time.Time
+	observer database.QueryObserver
+	span     trace.Span
 }
 
-// Scan implements the database.Row interface
+// Scan implements the database.Row interface. Errors from QueryRow are
+// deferred until Scan, so the query is observed and its span ended here.
 func (r *Row) Scan(dest ...interface{}) error {
-	return r.row.Scan(dest...)
+	err := r.row.Scan(dest...)
+	observe(r.ctx, r.observer, r.start, err)
+	endSpan(r.span, err)
+	return err
 }
 
 // Rows implements the database.Rows interface
@@ -179,15 +463,21 @@ func (r *Rows) Err() error {
 
 // Transaction implements the database.Transaction interface
 type Transaction struct {
-	tx     *sql.Tx
-	logger logger.Logger
+	tx       *sql.Tx
+	logger   logger.Logger
+	observer database.QueryObserver
+	tracer   trace.Tracer
 }
 
 // Execute implements the database.Transaction interface
 func (t *Transaction) Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
+	ctx, span := startSpan(ctx, t.tracer, "Execute", query)
+	start := time.Now()
 	result, err := t.tx.ExecContext(ctx, query, args...)
+	observe(ctx, t.observer, start, err)
+	endSpan(span, err)
 	if err != nil {
-		t.logger.WithField("query", query).WithError(err).Error("Failed to execute query in transaction")
+		contextLogger(ctx, t.logger).WithField("query", query).WithError(err).Error("Failed to execute query in transaction")
 		return nil, err
 	}
 	return &Result{result: result}, nil
@@ -195,9 +485,13 @@ func (t *Transaction) Execute(ctx context.Context, query string, args ...interfa
 
 // Query implements the database.Transaction interface
 func (t *Transaction) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
+	ctx, span := startSpan(ctx, t.tracer, "Query", query)
+	start := time.Now()
 	rows, err := t.tx.QueryContext(ctx, query, args...)
+	observe(ctx, t.observer, start, err)
+	endSpan(span, err)
 	if err != nil {
-		t.logger.WithField("query", query).WithError(err).Error("Failed to execute query in transaction")
+		contextLogger(ctx, t.logger).WithField("query", query).WithError(err).Error("Failed to execute query in transaction")
 		return nil, err
 	}
 	return &Rows{rows: rows}, nil
@@ -205,8 +499,16 @@ func (t *Transaction) Query(ctx context.Context, query string, args ...interface
 
 // QueryRow implements the database.Transaction interface
 func (t *Transaction) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
+	ctx, span := startSpan(ctx, t.tracer, "QueryRow", query)
+	start := time.Now()
 	row := t.tx.QueryRowContext(ctx, query, args...)
-	return &Row{row: row}
+	return &Row{row: row, ctx: ctx, start: start, observer: t.observer, span: span}
+}
+
+// BulkInsert loads rows into table with COPY FROM STDIN within the
+// transaction
+func (t *Transaction) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	return copyIn(ctx, t.tx, t.logger, t.observer, t.tracer, table, columns, rows)
 }
 
 // Commit implements the database.Transaction interface
@@ -219,6 +521,47 @@ func (t *Transaction) Rollback() error {
 	return t.tx.Rollback()
 }
 
+// copyIn streams rows into table with COPY FROM STDIN. Table may be
+// qualified with a schema.
+func copyIn(ctx context.Context, tx *sql.Tx, log logger.Logger, observer database.QueryObserver, tracer trace.Tracer, table string, columns []string, rows [][]interface{}) (int64, error) {
+	statement := pq.CopyIn(table, columns...)
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		statement = pq.CopyInSchema(schema, name, columns...)
+	}
+
+	ctx, span := startSpan(ctx, tracer, "CopyIn", statement)
+	start := time.Now()
+	n, err := copyRows(ctx, tx, statement, rows)
+	observe(ctx, observer, start, err)
+	endSpan(span, err)
+	if err != nil {
+		contextLogger(ctx, log).WithField("table", table).WithError(err).Error("Failed to copy rows")
+		return 0, err
+	}
+	return n, nil
+}
+
+// copyRows sends rows to a COPY statement and returns the number copied
+func copyRows(ctx context.Context, tx *sql.Tx, statement string, rows [][]interface{}) (int64, error) {
+	stmt, err := tx.PrepareContext(ctx, statement)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, err
+		}
+	}
+	// Executing without arguments ends the COPY
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // TLS helpers
 func setupTLS(config database.Config) (*tls.Config, error) {
 	// Load client cert
@@ -260,4 +603,4 @@ func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
 	// This is a simplified implementation
 	// In a real implementation, you would use the TLS config
 	return nil, fmt.Errorf("TLS driver not fully implemented")
-}
\ No newline at end of file
+}
@@ -0,0 +1,205 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestConnection(t *testing.T) (*Connection, sqlmock.Sqlmock, *tracetest.SpanRecorder) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	conn := &Connection{
+		logger: logger.NewLogger(logger.LoggerConfig{
+			Output:    io.Discard,
+			Formatter: &logrus.JSONFormatter{},
+			Level:     logrus.InfoLevel,
+		}),
+		tracer: tracing.Tracer(tp),
+	}
+	conn.current.Store(newPool(db, conn.logger))
+	return conn, mock, recorder
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == attribute.Key(key) {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestConnection_Tracing(t *testing.T) {
+	conn, mock, recorder := newTestConnection(t)
+
+	mock.ExpectQuery("SELECT name FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("John"))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := database.WithQueryName(context.Background(), "users.find_name")
+	var name string
+	require.NoError(t, conn.QueryRow(ctx, "SELECT name FROM users WHERE id = $1 AND role = 'admin'", 1).Scan(&name))
+
+	tx, err := conn.Begin(context.Background())
+	require.NoError(t, err)
+	_, err = tx.Execute(context.Background(), "UPDATE users SET active = false WHERE id = 7")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	t.Run("Should name spans after the database call", func(t *testing.T) {
+		assert.Equal(t, "postgres.QueryRow", spans[0].Name())
+		assert.Equal(t, "postgres.Begin", spans[1].Name())
+		assert.Equal(t, "postgres.Execute", spans[2].Name())
+	})
+
+	t.Run("Should record sanitized SQL", func(t *testing.T) {
+		assert.Equal(t, "SELECT name FROM users WHERE id = $1 AND role = ?", spanAttr(spans[0], "db.query.text"))
+		assert.Equal(t, "UPDATE users SET active = false WHERE id = ?", spanAttr(spans[2], "db.query.text"))
+		assert.Equal(t, "users.find_name", spanAttr(spans[0], "db.query.name"))
+		assert.Equal(t, "postgresql", spanAttr(spans[0], "db.system"))
+	})
+}
+
+func TestConnection_Reconnect(t *testing.T) {
+	_, oldMock, err := sqlmock.NewWithDSN("reconnect-old")
+	require.NoError(t, err)
+	_, newMock, err := sqlmock.NewWithDSN("reconnect-new")
+	require.NoError(t, err)
+
+	provider := NewProvider(logger.NewLogger(logger.LoggerConfig{
+		Output:    io.Discard,
+		Formatter: &logrus.JSONFormatter{},
+		Level:     logrus.InfoLevel,
+	}))
+	provider.driver = "sqlmock"
+
+	db, err := provider.Connect(database.Config{ConnectionString: "reconnect-old", MaxOpenConns: 1})
+	require.NoError(t, err)
+	conn := db.(*Connection)
+
+	// A transaction is in flight on the old pool when credentials rotate
+	oldMock.ExpectBegin()
+	oldMock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	oldMock.ExpectCommit()
+	oldMock.ExpectClose()
+	tx, err := conn.Begin(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, conn.Reconnect(database.Config{ConnectionString: "reconnect-new", MaxOpenConns: 1}))
+
+	t.Run("Should run new queries on the new pool", func(t *testing.T) {
+		newMock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := conn.Execute(context.Background(), "DELETE FROM users WHERE id = $1", 1)
+		require.NoError(t, err)
+		assert.NoError(t, newMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should let in-flight transactions finish on the old pool", func(t *testing.T) {
+		_, err := tx.Execute(context.Background(), "UPDATE users SET active = false WHERE id = 7")
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+
+		assert.Eventually(t, func() bool {
+			return oldMock.ExpectationsWereMet() == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should let queries running during the reconnect finish on the old pool", func(t *testing.T) {
+		_, oldMock, err := sqlmock.NewWithDSN("reconnect-running")
+		require.NoError(t, err)
+		db, err := provider.Connect(database.Config{ConnectionString: "reconnect-running"})
+		require.NoError(t, err)
+		conn := db.(*Connection)
+
+		oldMock.ExpectExec("UPDATE users").WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+		oldMock.ExpectExec("UPDATE teams").WillReturnResult(sqlmock.NewResult(0, 1))
+		oldMock.ExpectClose()
+
+		// A call picked the old pool just before the swap
+		picked := conn.acquire()
+		running := make(chan error)
+		go func() {
+			_, err := conn.Execute(context.Background(), "UPDATE users SET active = false WHERE id = 7")
+			running <- err
+		}()
+		require.Eventually(t, func() bool { return conn.current.Load().users.Load() > 1 }, time.Second, time.Millisecond)
+
+		require.NoError(t, conn.Reconnect(database.Config{ConnectionString: "reconnect-new"}))
+
+		_, err = picked.db.ExecContext(context.Background(), "UPDATE teams SET name = 'payments'")
+		picked.release()
+		assert.NoError(t, err)
+		assert.NoError(t, <-running)
+		assert.Eventually(t, func() bool {
+			return oldMock.ExpectationsWereMet() == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should keep the current pool when the new one cannot connect", func(t *testing.T) {
+		err := conn.Reconnect(database.Config{ConnectionString: "reconnect-missing"})
+		assert.Error(t, err)
+
+		newMock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 1))
+		_, err = conn.Execute(context.Background(), "DELETE FROM users WHERE id = $1", 2)
+		assert.NoError(t, err)
+	})
+}
+
+func TestConnection_BulkInsert(t *testing.T) {
+	t.Run("Should copy rows in a transaction", func(t *testing.T) {
+		conn, mock, _ := newTestConnection(t)
+		mock.ExpectBegin()
+		stmt := mock.ExpectPrepare(`COPY "inventory"."assets" \("id", "name"\) FROM STDIN`)
+		stmt.ExpectExec().WithArgs("a-1", "bucket").WillReturnResult(sqlmock.NewResult(0, 0))
+		stmt.ExpectExec().WithArgs("a-2", "queue").WillReturnResult(sqlmock.NewResult(0, 0))
+		stmt.ExpectExec().WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		n, err := conn.BulkInsert(context.Background(), "inventory.assets", []string{"id", "name"},
+			[][]interface{}{{"a-1", "bucket"}, {"a-2", "queue"}})
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should roll back when a row is rejected", func(t *testing.T) {
+		conn, mock, _ := newTestConnection(t)
+		mock.ExpectBegin()
+		stmt := mock.ExpectPrepare("COPY")
+		stmt.ExpectExec().WillReturnError(errors.New("invalid input syntax"))
+		mock.ExpectRollback()
+
+		_, err := conn.BulkInsert(context.Background(), "assets", []string{"id"}, [][]interface{}{{"a-1"}})
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
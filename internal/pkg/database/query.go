@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UnnamedQuery is the name reported for queries executed without a name
+const UnnamedQuery = "unnamed"
+
+type queryNameKey struct{}
+
+// WithQueryName returns a copy of ctx that labels the next query with name.
+// Names identify queries in metrics without exposing the SQL text.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// QueryName returns the query name stored in ctx, or UnnamedQuery
+func QueryName(ctx context.Context) string {
+	if name, ok := ctx.Value(queryNameKey{}).(string); ok && name != "" {
+		return name
+	}
+	return UnnamedQuery
+}
+
+// QueryObserver is notified after each query completes
+type QueryObserver func(ctx context.Context, name string, duration time.Duration, err error)
+
+// StatsProvider is implemented by connections that expose connection pool
+// statistics
+type StatsProvider interface {
+	Stats() sql.DBStats
+}
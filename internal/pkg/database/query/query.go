@@ -0,0 +1,175 @@
+// Package query describes pagination, sorting and filtering of list
+// requests and turns them into parameterised SQL.
+//
+// Options are parsed from a query string such as
+//
+//	?limit=20&sort=-created_at,name&role=admin&active=true&email~=@corp
+//
+// without knowing the resource. A Schema then validates them against the
+// fields a repository allows and builds the SQL clauses. Pagination is
+// keyset based: the opaque cursor returned with a page holds the sort
+// values of its last row, so later pages stay stable while rows are added.
+package query
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+)
+
+// Reserved query parameters. Every other parameter is a filter.
+const (
+	ParamLimit  = "limit"
+	ParamCursor = "cursor"
+	ParamSort   = "sort"
+)
+
+// Operator compares a field with a filter value
+type Operator string
+
+// Supported filter operators, written as field<op>value
+const (
+	// OpEq matches equal values: role=admin
+	OpEq Operator = "="
+	// OpNe matches different values: role!=admin
+	OpNe Operator = "!="
+	// OpContains matches values containing the text, ignoring case: email~=@corp
+	OpContains Operator = "~="
+	// OpGte matches values at or after the given one: created_at>=2024-01-01T00:00:00Z
+	OpGte Operator = ">="
+	// OpLte matches values at or before the given one: created_at<=2024-12-31T00:00:00Z
+	OpLte Operator = "<="
+)
+
+// SortField orders results by a field
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// String returns the field, prefixed with - when descending
+func (s SortField) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Filter restricts results to rows whose field matches a value
+type Filter struct {
+	Field string
+	Op    Operator
+	Value string
+}
+
+// String returns the filter in field<op>value form
+func (f Filter) String() string {
+	return f.Field + string(f.Op) + f.Value
+}
+
+// Options select a page of a list. The zero value requests the first page
+// in the default order and size.
+type Options struct {
+	// Limit is the page size. Zero uses the schema default, larger values
+	// are capped at the schema maximum.
+	Limit int
+	// Cursor is the next_cursor of the previous page
+	Cursor  string
+	Sort    []SortField
+	Filters []Filter
+}
+
+// Parse reads options from query string values. Filters on several values
+// of one field, such as role=admin&role=owner, must all match. Field names
+// are checked later, by the Schema of the resource.
+func Parse(values url.Values) (Options, error) {
+	var opts Options
+
+	if v := values.Get(ParamLimit); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return Options{}, appErrors.NewValidationError("invalid limit parameter, expected a positive number", nil)
+		}
+		opts.Limit = limit
+	}
+	opts.Cursor = values.Get(ParamCursor)
+
+	if v := values.Get(ParamSort); v != "" {
+		sorts, err := ParseSort(v)
+		if err != nil {
+			return Options{}, err
+		}
+		opts.Sort = sorts
+	}
+
+	// Sorted so the generated SQL does not depend on map order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch key {
+		case ParamLimit, ParamCursor, ParamSort:
+			continue
+		}
+		// url.ParseQuery splits email~=@corp into the key "email~" and
+		// the value "@corp", so the expression is rebuilt before parsing
+		for _, value := range values[key] {
+			filter, err := ParseFilter(key + "=" + value)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.Filters = append(opts.Filters, filter)
+		}
+	}
+	return opts, nil
+}
+
+// ParseSort parses a comma-separated list of fields, each prefixed with -
+// for descending order
+func ParseSort(expr string) ([]SortField, error) {
+	var sorts []SortField
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "+")}
+		if strings.HasPrefix(part, "-") {
+			field = SortField{Field: part[1:], Desc: true}
+		}
+		if field.Field == "" {
+			return nil, appErrors.NewValidationError("invalid sort parameter "+strconv.Quote(expr), nil)
+		}
+		sorts = append(sorts, field)
+	}
+	return sorts, nil
+}
+
+// ParseFilter parses a filter expression such as role=admin or email~=@corp
+func ParseFilter(expr string) (Filter, error) {
+	// The operator ends at the first =, so values may contain any character
+	field, value, ok := strings.Cut(expr, "=")
+	op := OpEq
+	if ok && field != "" {
+		switch field[len(field)-1] {
+		case '~':
+			op = OpContains
+		case '!':
+			op = OpNe
+		case '>':
+			op = OpGte
+		case '<':
+			op = OpLte
+		}
+		if op != OpEq {
+			field = field[:len(field)-1]
+		}
+	}
+	if field == "" || !ok {
+		return Filter{}, appErrors.NewValidationError("invalid filter "+strconv.Quote(expr)+", expected field=value", nil)
+	}
+	return Filter{Field: field, Op: op, Value: value}, nil
+}
@@ -0,0 +1,158 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = Schema{
+	Fields: map[string]Field{
+		"id":         {Column: "id", Type: Int, Sortable: true, Filterable: true},
+		"name":       {Column: "name", Type: String, Sortable: true, Filterable: true},
+		"email":      {Column: "email", Type: String, Filterable: true},
+		"active":     {Column: "active", Type: Bool, Filterable: true},
+		"created_at": {Column: "created_at", Type: Time, Sortable: true},
+	},
+	Key:          "id",
+	DefaultLimit: 2,
+	MaxLimit:     10,
+}
+
+// row is a test row sorted by name and id
+type row struct {
+	id   int
+	name string
+}
+
+func (r row) value(field string) interface{} {
+	if field == "name" {
+		return r.name
+	}
+	return r.id
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Should parse paging, sorting and filters", func(t *testing.T) {
+		values, err := url.ParseQuery("limit=20&cursor=abc&sort=-created_at,name&role=admin&active=true&email~=@corp&id>=3&role!=owner")
+		require.NoError(t, err)
+
+		opts, err := Parse(values)
+
+		require.NoError(t, err)
+		assert.Equal(t, 20, opts.Limit)
+		assert.Equal(t, "abc", opts.Cursor)
+		assert.Equal(t, []SortField{{Field: "created_at", Desc: true}, {Field: "name"}}, opts.Sort)
+		assert.Equal(t, []Filter{
+			{Field: "active", Op: OpEq, Value: "true"},
+			{Field: "email", Op: OpContains, Value: "@corp"},
+			{Field: "id", Op: OpGte, Value: "3"},
+			{Field: "role", Op: OpEq, Value: "admin"},
+			{Field: "role", Op: OpNe, Value: "owner"},
+		}, opts.Filters)
+	})
+
+	t.Run("Should reject invalid limits as validation errors", func(t *testing.T) {
+		_, err := Parse(url.Values{"limit": {"-1"}})
+
+		var appErr *appErrors.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, appErrors.ErrorTypeValidation, appErr.Type)
+	})
+
+	t.Run("Should keep operators inside filter values", func(t *testing.T) {
+		filter, err := ParseFilter("name=a!=b")
+
+		require.NoError(t, err)
+		assert.Equal(t, Filter{Field: "name", Op: OpEq, Value: "a!=b"}, filter)
+	})
+}
+
+func TestSchema_Build(t *testing.T) {
+	t.Run("Should bind filter values and add the key to the order", func(t *testing.T) {
+		q, err := testSchema.Build(Options{
+			Sort: []SortField{{Field: "name", Desc: true}},
+			Filters: []Filter{
+				{Field: "active", Op: OpEq, Value: "true"},
+				{Field: "email", Op: OpContains, Value: "50%_off"},
+			},
+		}, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, "active = $1 AND email ILIKE $2", q.Where)
+		assert.Equal(t, "name DESC, id", q.OrderBy)
+		assert.Equal(t, []interface{}{true, `%50\%\_off%`}, q.Args)
+		assert.Equal(t, " WHERE active = $1 AND email ILIKE $2 ORDER BY name DESC, id LIMIT 3", q.Clauses())
+	})
+
+	t.Run("Should cap the page size", func(t *testing.T) {
+		q, err := testSchema.Build(Options{Limit: 1000}, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, 10, q.Limit)
+	})
+
+	t.Run("Should reject fields that are not whitelisted", func(t *testing.T) {
+		_, err := testSchema.Build(Options{Sort: []SortField{{Field: "email"}}}, 1)
+		assert.ErrorContains(t, err, `cannot sort by "email"`)
+
+		_, err = testSchema.Build(Options{Filters: []Filter{{Field: "password", Op: OpEq, Value: "x"}}}, 1)
+		assert.ErrorContains(t, err, `cannot filter by "password"`)
+
+		_, err = testSchema.Build(Options{Filters: []Filter{{Field: "id", Op: OpEq, Value: "1 OR 1=1"}}}, 1)
+		assert.ErrorContains(t, err, `invalid value for "id"`)
+	})
+
+	t.Run("Should continue after the cursor of the previous page", func(t *testing.T) {
+		opts := Options{Sort: []SortField{{Field: "name"}}}
+		first, err := testSchema.Build(opts, 1)
+		require.NoError(t, err)
+
+		page, err := NewPage([]row{{1, "a"}, {4, "b"}, {2, "b"}}, first, row.value)
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 2)
+		require.NotEmpty(t, page.NextCursor)
+
+		opts.Cursor = page.NextCursor
+		next, err := testSchema.Build(opts, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, "((name > $1) OR (name = $1 AND id > $2))", next.Where)
+		assert.Equal(t, []interface{}{"b", int64(4)}, next.Args)
+	})
+
+	t.Run("Should reject cursors for another order or tampered cursors", func(t *testing.T) {
+		q, err := testSchema.Build(Options{}, 1)
+		require.NoError(t, err)
+		page, err := NewPage([]row{{1, "a"}, {2, "b"}, {3, "c"}}, q, row.value)
+		require.NoError(t, err)
+
+		_, err = testSchema.Build(Options{Cursor: page.NextCursor, Sort: []SortField{{Field: "name"}}}, 1)
+		assert.ErrorContains(t, err, "cursor does not match")
+
+		_, err = testSchema.Build(Options{Cursor: "not-a-cursor"}, 1)
+		assert.ErrorContains(t, err, "invalid cursor")
+	})
+
+	t.Run("Should keep time cursors at full precision", func(t *testing.T) {
+		at := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+		q, err := testSchema.Build(Options{Sort: []SortField{{Field: "created_at"}}}, 1)
+		require.NoError(t, err)
+		page, err := NewPage([]int{1, 2, 3}, q, func(id int, field string) interface{} {
+			if field == "created_at" {
+				return at
+			}
+			return id
+		})
+		require.NoError(t, err)
+
+		next, err := testSchema.Build(Options{Cursor: page.NextCursor, Sort: q.sort[:1]}, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, at, next.Args[0])
+	})
+}
@@ -0,0 +1,368 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appErrors "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/errors"
+)
+
+// Default page sizes used when a Schema leaves them unset
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Type is the type of a field's values
+type Type int
+
+// Field types. Filter values and cursor values are converted to the field
+// type before they are bound.
+const (
+	String Type = iota
+	Int
+	Bool
+	Time
+)
+
+// Field is a field clients may sort or filter by
+type Field struct {
+	// Column is the SQL expression the field maps to. It is written into
+	// the query verbatim and must never come from user input.
+	Column string
+	Type   Type
+	// Sortable fields may be used in sort. Their columns must be NOT NULL
+	// for keyset pagination to be correct.
+	Sortable   bool
+	Filterable bool
+}
+
+// Schema is the whitelist of fields of a resource
+type Schema struct {
+	Fields map[string]Field
+	// Key is a sortable field that is unique per row. It is appended to
+	// every sort so the order, and therefore the cursor, is total.
+	Key string
+	// DefaultSort is used when no sort is requested. Key is used when it
+	// is empty too.
+	DefaultSort []SortField
+	// DefaultLimit and MaxLimit default to DefaultLimit and MaxLimit
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Query holds the SQL clauses built for a set of options
+type Query struct {
+	// Where is the filter and cursor condition without the WHERE keyword,
+	// empty when there is none
+	Where   string
+	OrderBy string
+	// Limit is the page size. One more row is fetched to detect whether
+	// there is a next page.
+	Limit int
+	// Args are the values bound to the placeholders of Where
+	Args []interface{}
+
+	sort []SortField
+}
+
+// Clauses returns the WHERE, ORDER BY and LIMIT clauses to append to a
+// SELECT statement
+func (q Query) Clauses() string {
+	var b strings.Builder
+	if q.Where != "" {
+		b.WriteString(" WHERE " + q.Where)
+	}
+	b.WriteString(" ORDER BY " + q.OrderBy)
+	b.WriteString(" LIMIT " + strconv.Itoa(q.Limit+1))
+	return b.String()
+}
+
+// Build validates opts against the schema and builds the SQL clauses.
+// Placeholders are numbered from firstArg, so arguments already used by
+// the rest of the statement can come first. Invalid options return a
+// validation error.
+func (s Schema) Build(opts Options, firstArg int) (Query, error) {
+	q := Query{Limit: s.limit(opts.Limit)}
+
+	sorts, err := s.sort(opts.Sort)
+	if err != nil {
+		return Query{}, err
+	}
+	q.sort = sorts
+
+	order := make([]string, len(sorts))
+	for i, sort := range sorts {
+		order[i] = s.Fields[sort.Field].Column
+		if sort.Desc {
+			order[i] += " DESC"
+		}
+	}
+	q.OrderBy = strings.Join(order, ", ")
+
+	next := firstArg
+	bind := func(value interface{}) string {
+		q.Args = append(q.Args, value)
+		placeholder := "$" + strconv.Itoa(next)
+		next++
+		return placeholder
+	}
+
+	var conditions []string
+	for _, filter := range opts.Filters {
+		condition, err := s.filter(filter, bind)
+		if err != nil {
+			return Query{}, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if opts.Cursor != "" {
+		condition, err := s.after(opts.Cursor, sorts, bind)
+		if err != nil {
+			return Query{}, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	q.Where = strings.Join(conditions, " AND ")
+	return q, nil
+}
+
+// limit applies the default and maximum page size
+func (s Schema) limit(limit int) int {
+	max := s.MaxLimit
+	if max <= 0 {
+		max = MaxLimit
+	}
+	if limit <= 0 {
+		limit = s.DefaultLimit
+		if limit <= 0 {
+			limit = DefaultLimit
+		}
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
+
+// sort validates the requested order and appends the key field
+func (s Schema) sort(requested []SortField) ([]SortField, error) {
+	if len(requested) == 0 {
+		requested = s.DefaultSort
+	}
+
+	sorts := make([]SortField, 0, len(requested)+1)
+	seen := make(map[string]bool)
+	for _, sort := range requested {
+		if field, ok := s.Fields[sort.Field]; !ok || !field.Sortable {
+			return nil, appErrors.NewValidationError(fmt.Sprintf("cannot sort by %q", sort.Field), nil)
+		}
+		if seen[sort.Field] {
+			continue
+		}
+		seen[sort.Field] = true
+		sorts = append(sorts, sort)
+	}
+	if !seen[s.Key] {
+		sorts = append(sorts, SortField{Field: s.Key})
+	}
+	return sorts, nil
+}
+
+// filter builds the condition of a single filter
+func (s Schema) filter(filter Filter, bind func(interface{}) string) (string, error) {
+	field, ok := s.Fields[filter.Field]
+	if !ok || !field.Filterable {
+		return "", appErrors.NewValidationError(fmt.Sprintf("cannot filter by %q", filter.Field), nil)
+	}
+
+	if filter.Op == OpContains {
+		if field.Type != String {
+			return "", appErrors.NewValidationError(fmt.Sprintf("%q does not support %s", filter.Field, filter.Op), nil)
+		}
+		return field.Column + " ILIKE " + bind("%"+escapeLike(filter.Value)+"%"), nil
+	}
+
+	value, err := convert(field.Type, filter.Value)
+	if err != nil {
+		return "", appErrors.NewValidationError(fmt.Sprintf("invalid value for %q", filter.Field), err)
+	}
+
+	switch filter.Op {
+	case OpEq:
+		return field.Column + " = " + bind(value), nil
+	case OpNe:
+		return field.Column + " <> " + bind(value), nil
+	case OpGte, OpLte:
+		if field.Type == Bool {
+			return "", appErrors.NewValidationError(fmt.Sprintf("%q does not support %s", filter.Field, filter.Op), nil)
+		}
+		return field.Column + " " + string(filter.Op) + " " + bind(value), nil
+	}
+	return "", appErrors.NewValidationError(fmt.Sprintf("unknown filter operator %q", filter.Op), nil)
+}
+
+// after builds the keyset condition selecting the rows that follow the
+// cursor position. For the order a, -b it is
+//
+//	a > $1 OR (a = $1 AND b < $2)
+func (s Schema) after(token string, sorts []SortField, bind func(interface{}) string) (string, error) {
+	values, err := decodeCursor(token, sorts)
+	if err != nil {
+		return "", err
+	}
+
+	placeholders := make([]string, len(sorts))
+	for i, sort := range sorts {
+		field := s.Fields[sort.Field]
+		value, err := convert(field.Type, values[i])
+		if err != nil {
+			return "", invalidCursor(err)
+		}
+		placeholders[i] = bind(value)
+	}
+
+	alternatives := make([]string, len(sorts))
+	for i, sort := range sorts {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, s.Fields[sorts[j].Field].Column+" = "+placeholders[j])
+		}
+		op := " > "
+		if sort.Desc {
+			op = " < "
+		}
+		terms = append(terms, s.Fields[sort.Field].Column+op+placeholders[i])
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", nil
+}
+
+// convert parses a filter or cursor value into the field type
+func convert(t Type, value string) (interface{}, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(value, 10, 64)
+	case Bool:
+		return strconv.ParseBool(value)
+	case Time:
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	return value, nil
+}
+
+// escapeLike escapes the LIKE wildcards in value
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// cursor is the decoded form of a page token
+type cursor struct {
+	// Sort is the order the cursor was created for
+	Sort string `json:"s"`
+	// Values are the sort values of the last row of the page
+	Values []string `json:"v"`
+}
+
+// sortKey identifies an order, such as "-created_at,id"
+func sortKey(sorts []SortField) string {
+	parts := make([]string, len(sorts))
+	for i, sort := range sorts {
+		parts[i] = sort.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor creates the token for the row with the given sort values
+func encodeCursor(sorts []SortField, values []interface{}) (string, error) {
+	c := cursor{Sort: sortKey(sorts), Values: make([]string, len(values))}
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			c.Values[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			c.Values[i] = fmt.Sprint(v)
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the sort values stored in token, rejecting tokens
+// created for a different order
+func decodeCursor(token string, sorts []SortField) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalidCursor(err)
+	}
+
+	var c cursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, invalidCursor(err)
+	}
+	if c.Sort != sortKey(sorts) || len(c.Values) != len(sorts) {
+		return nil, appErrors.NewValidationError("cursor does not match the requested sort", nil)
+	}
+	return c.Values, nil
+}
+
+// invalidCursor reports a cursor that could not be decoded
+func invalidCursor(err error) error {
+	return appErrors.NewValidationError("invalid cursor", err)
+}
+
+// Page is one page of a list
+type Page[T any] struct {
+	Items []T `json:"items" yaml:"items"`
+	// NextCursor selects the following page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty" yaml:"next_cursor,omitempty"`
+}
+
+// NewPage builds the page from the rows fetched with q, which may include
+// one row more than the page size. value returns the value of a sort field
+// of a row; time values should keep their full precision.
+func NewPage[T any](rows []T, q Query, value func(row T, field string) interface{}) (Page[T], error) {
+	page := Page[T]{Items: rows}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(rows) <= q.Limit {
+		return page, nil
+	}
+
+	page.Items = rows[:q.Limit]
+	last := page.Items[q.Limit-1]
+	values := make([]interface{}, len(q.sort))
+	for i, sort := range q.sort {
+		values[i] = value(last, sort.Field)
+	}
+
+	next, err := encodeCursor(q.sort, values)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	page.NextCursor = next
+	return page, nil
+}
+
+// Map converts the items of a page, keeping its cursor
+func Map[T, U any](page Page[T], fn func(T) U) Page[U] {
+	mapped := Page[U]{Items: make([]U, len(page.Items)), NextCursor: page.NextCursor}
+	for i, item := range page.Items {
+		mapped.Items[i] = fn(item)
+	}
+	return mapped
+}
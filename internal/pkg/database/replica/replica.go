@@ -0,0 +1,572 @@
+// Package replica routes queries across a primary database and its read
+// replicas.
+//
+// A Router is a database.Connection sending writes and transactions to
+// the primary and plain reads to a healthy replica. Probes check the
+// health and replication lag of every replica, and fail over to the next
+// configured primary host when the primary stops answering. Reads made
+// after a write within a session, usually one HTTP request, go to the
+// primary so they see the write.
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// LoggerName is the name of the logger used by routers
+const LoggerName = "database.replica"
+
+// Balancer picks the replica serving a read
+type Balancer string
+
+// Supported balancers
+const (
+	// RoundRobin rotates reads across the healthy replicas
+	RoundRobin Balancer = "round-robin"
+	// LeastLatency sends reads to the healthy replica whose health probes
+	// answered fastest
+	LeastLatency Balancer = "least-latency"
+)
+
+// DefaultProbeInterval is how often Run probes the databases unless
+// configured otherwise
+const DefaultProbeInterval = 10 * time.Second
+
+// Node is a database server the router can connect to
+type Node struct {
+	// Name identifies the node in logs. Connection strings may hold
+	// credentials, so they are never logged.
+	Name   string
+	Config database.Config
+}
+
+// LagFunc measures how far a replica is behind its primary
+type LagFunc func(ctx context.Context, conn database.Connection) (time.Duration, error)
+
+// PostgresLag measures the replication lag of a PostgreSQL standby, which
+// is zero while it has replayed everything it received
+func PostgresLag(ctx context.Context, conn database.Connection) (time.Duration, error) {
+	var seconds float64
+	err := conn.QueryRow(database.WithQueryName(ctx, "replica.lag"), `
+		SELECT CASE
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END
+	`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// RecoveryFunc reports whether a database is a standby still replaying
+// the changes of another server, which cannot be promoted to primary
+type RecoveryFunc func(ctx context.Context, conn database.Connection) (bool, error)
+
+// PostgresInRecovery reports whether a PostgreSQL server is a standby
+func PostgresInRecovery(ctx context.Context, conn database.Connection) (bool, error) {
+	var inRecovery bool
+	err := conn.QueryRow(database.WithQueryName(ctx, "replica.in_recovery"), `SELECT pg_is_in_recovery()`).Scan(&inRecovery)
+	return inRecovery, err
+}
+
+// member is a connected node
+type member struct {
+	node Node
+	// mu guards connecting conn. Reads only use conn of healthy members,
+	// which are connected.
+	mu   sync.Mutex
+	conn database.Connection
+
+	healthy atomic.Bool
+	// latency is a moving average of the probe durations
+	latency atomic.Int64
+	lag     atomic.Int64
+}
+
+// Option configures optional Router behaviour
+type Option func(*Router)
+
+// WithBalancer sets how reads are spread across replicas
+func WithBalancer(balancer Balancer) Option {
+	return func(r *Router) {
+		if balancer != "" {
+			r.balancer = balancer
+		}
+	}
+}
+
+// WithMaxLag excludes replicas further behind the primary than maxLag,
+// measured by PostgresLag unless WithLagFunc says otherwise
+func WithMaxLag(maxLag time.Duration) Option {
+	return func(r *Router) {
+		r.maxLag = maxLag
+	}
+}
+
+// WithLagFunc sets how replication lag is measured
+func WithLagFunc(lag LagFunc) Option {
+	return func(r *Router) {
+		r.lag = lag
+	}
+}
+
+// WithRecoveryFunc sets how primary hosts are checked before they are
+// used, PostgresInRecovery by default
+func WithRecoveryFunc(inRecovery RecoveryFunc) Option {
+	return func(r *Router) {
+		r.inRecovery = inRecovery
+	}
+}
+
+// WithLogger logs failovers and replica health changes to log
+func WithLogger(log logger.Logger) Option {
+	return func(r *Router) {
+		r.logger = log.Named(LoggerName)
+	}
+}
+
+// Router is a database.Connection routing queries across a primary and
+// its replicas
+type Router struct {
+	provider   database.Provider
+	balancer   Balancer
+	maxLag     time.Duration
+	lag        LagFunc
+	inRecovery RecoveryFunc
+	logger     logger.Logger
+	// primaryDown is set while the primary is down and failing over
+	// fails, so the failure is logged once rather than on every probe
+	primaryDown atomic.Bool
+
+	mu sync.RWMutex
+	// primaries are the primary hosts in failover order, and current the
+	// index of the one in use
+	primaries []Node
+	current   int
+	primary   *member
+	replicas  []*member
+	next      atomic.Uint64
+}
+
+// New connects to the first reachable primary and to every replica, and
+// probes them once. Replicas that cannot be reached are retried by later
+// probes.
+func New(ctx context.Context, provider database.Provider, primaries, replicas []Node, opts ...Option) (*Router, error) {
+	if len(primaries) == 0 {
+		return nil, errors.New("replica: no primary configured")
+	}
+
+	r := &Router{
+		provider:   provider,
+		balancer:   RoundRobin,
+		lag:        PostgresLag,
+		inRecovery: PostgresInRecovery,
+		logger:     logger.Named(LoggerName),
+		primaries:  primaries,
+		current:    -1,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := r.failover(ctx); err != nil {
+		return nil, err
+	}
+	for _, node := range replicas {
+		r.replicas = append(r.replicas, &member{node: node})
+	}
+	r.Probe(ctx)
+	return r, nil
+}
+
+// Run probes the databases every interval until ctx is done
+func (r *Router) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.Probe(ctx)
+		}
+	}
+}
+
+// Probe checks the primary, failing over when it is down, and updates the
+// health, latency and lag of every replica
+func (r *Router) Probe(ctx context.Context) {
+	err := r.currentPrimary().conn.Health(ctx)
+	switch {
+	case err != nil && ctx.Err() == nil:
+		down := r.primaryDown.Swap(true)
+		if !down {
+			r.logger.WithError(err).WithField("node", r.currentPrimary().node.Name).Warn("Primary database is unhealthy, failing over")
+		}
+		if err := r.failover(ctx); err != nil {
+			if !down {
+				r.logger.WithError(err).Error("Failed to fail over the primary database, retrying on every probe")
+			}
+		} else {
+			r.primaryDown.Store(false)
+		}
+	case err == nil && r.primaryDown.Swap(false):
+		r.logger.WithField("node", r.currentPrimary().node.Name).Info("Primary database is healthy again")
+	}
+
+	var wg sync.WaitGroup
+	for _, replica := range r.members() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.probeReplica(ctx, replica)
+		}()
+	}
+	wg.Wait()
+}
+
+// probeReplica updates the health of a replica, connecting it first if
+// needed
+func (r *Router) probeReplica(ctx context.Context, m *member) {
+	err := r.checkReplica(ctx, m)
+	healthy := err == nil
+	if m.healthy.Swap(healthy) != healthy {
+		entry := r.logger.WithField("node", m.node.Name)
+		if healthy {
+			entry.Info("Replica is healthy")
+		} else {
+			entry.WithError(err).Warn("Replica is unhealthy, reads avoid it")
+		}
+	}
+}
+
+// checkReplica probes a replica and reports why it must not serve reads
+func (r *Router) checkReplica(ctx context.Context, m *member) error {
+	m.mu.Lock()
+	if m.conn == nil {
+		conn, err := r.provider.Connect(m.node.Config)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		m.conn = conn
+	}
+	conn := m.conn
+	m.mu.Unlock()
+
+	start := time.Now()
+	if err := conn.Health(ctx); err != nil {
+		return err
+	}
+	observed := time.Since(start)
+	if previous := m.latency.Load(); previous > 0 {
+		observed = (time.Duration(previous)*4 + observed) / 5
+	}
+	m.latency.Store(int64(observed))
+
+	if r.maxLag <= 0 || r.lag == nil {
+		return nil
+	}
+	lag, err := r.lag(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("measuring replication lag: %w", err)
+	}
+	m.lag.Store(int64(lag))
+	if lag > r.maxLag {
+		return fmt.Errorf("replication lag of %s exceeds %s", lag, r.maxLag)
+	}
+	return nil
+}
+
+// failover connects to the first healthy primary host after the current
+// one, wrapping around the list, and makes it the primary. Hosts that are
+// still standbys are skipped.
+func (r *Router) failover(ctx context.Context) error {
+	r.mu.RLock()
+	current := r.current
+	r.mu.RUnlock()
+
+	var errs []error
+	for i := 1; i <= len(r.primaries); i++ {
+		index := (current + i) % len(r.primaries)
+		if index == current {
+			// The failing primary is only retried by the next probe
+			continue
+		}
+		node := r.primaries[index]
+
+		conn, err := r.provider.Connect(node.Config)
+		if err == nil {
+			if err = r.checkPrimary(ctx, conn); err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+			continue
+		}
+
+		m := &member{node: node, conn: conn}
+		m.healthy.Store(true)
+
+		r.mu.Lock()
+		previous := r.primary
+		r.primary, r.current = m, index
+		r.mu.Unlock()
+
+		if previous != nil {
+			r.logger.WithField("node", node.Name).Warn("Failed over to a new primary database")
+			// Close waits for in-flight work, so it must not block the probe
+			go previous.conn.Close()
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return errors.New("replica: no other primary host configured")
+	}
+	return fmt.Errorf("replica: no primary reachable: %w", errors.Join(errs...))
+}
+
+// checkPrimary reports why a primary host must not be used
+func (r *Router) checkPrimary(ctx context.Context, conn database.Connection) error {
+	if err := conn.Health(ctx); err != nil {
+		return err
+	}
+	if r.inRecovery == nil {
+		return nil
+	}
+	inRecovery, err := r.inRecovery(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("checking recovery: %w", err)
+	}
+	if inRecovery {
+		return errors.New("still in recovery, not promoted")
+	}
+	return nil
+}
+
+// currentPrimary returns the primary in use
+func (r *Router) currentPrimary() *member {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.primary
+}
+
+// members returns the replicas
+func (r *Router) members() []*member {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replicas
+}
+
+// reader picks the connection serving a read in ctx
+func (r *Router) reader(ctx context.Context) (*member, bool) {
+	if usePrimary(ctx) {
+		return r.currentPrimary(), false
+	}
+
+	var healthy []*member
+	for _, m := range r.members() {
+		if m.healthy.Load() {
+			healthy = append(healthy, m)
+		}
+	}
+	if len(healthy) == 0 {
+		return r.currentPrimary(), false
+	}
+
+	if r.balancer == LeastLatency {
+		best := healthy[0]
+		for _, m := range healthy[1:] {
+			if m.latency.Load() < best.latency.Load() {
+				best = m
+			}
+		}
+		return best, true
+	}
+	return healthy[int((r.next.Add(1)-1)%uint64(len(healthy)))], true
+}
+
+// writer returns the primary, remembering the write in the session of ctx
+func (r *Router) writer(ctx context.Context) database.Connection {
+	markWrite(ctx)
+	return r.currentPrimary().conn
+}
+
+// Execute runs a statement on the primary
+func (r *Router) Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
+	return r.writer(ctx).Execute(ctx, query, args...)
+}
+
+// Query runs a query on a replica, or on the primary when no replica is
+// healthy or the session has written. A replica that lost its connection
+// is marked unhealthy and the query retried on the primary.
+func (r *Router) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
+	m, isReplica := r.reader(ctx)
+	rows, err := m.conn.Query(ctx, query, args...)
+	if isReplica && isConnectionError(err) {
+		m.healthy.Store(false)
+		r.logger.WithError(err).WithField("node", m.node.Name).Warn("Replica connection failed, reads avoid it")
+		return r.currentPrimary().conn.Query(ctx, query, args...)
+	}
+	return rows, err
+}
+
+// QueryRow runs a single row query like Query
+func (r *Router) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
+	m, _ := r.reader(ctx)
+	return m.conn.QueryRow(ctx, query, args...)
+}
+
+// Begin starts a transaction on the primary
+func (r *Router) Begin(ctx context.Context) (database.Transaction, error) {
+	return r.writer(ctx).Begin(ctx)
+}
+
+// BulkInsert bulk inserts rows on the primary, if it supports it
+func (r *Router) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	inserter, ok := r.writer(ctx).(database.BulkInserter)
+	if !ok {
+		return 0, fmt.Errorf("bulk insert into %s: %w", table, errors.ErrUnsupported)
+	}
+	return inserter.BulkInsert(ctx, table, columns, rows)
+}
+
+// Notify publishes a notification on the primary, if it supports it
+func (r *Router) Notify(ctx context.Context, channel, payload string) error {
+	notifier, ok := r.writer(ctx).(database.Notifier)
+	if !ok {
+		return fmt.Errorf("notify %s: %w", channel, errors.ErrUnsupported)
+	}
+	return notifier.Notify(ctx, channel, payload)
+}
+
+// Listen subscribes to a channel on the primary, since standbys cannot
+// listen. The subscription stays with the primary it was made on, so
+// subscribers should subscribe again when it ends after a failover.
+func (r *Router) Listen(ctx context.Context, channel string) (database.Subscription, error) {
+	listener, ok := r.currentPrimary().conn.(database.Listener)
+	if !ok {
+		return nil, fmt.Errorf("listen to %s: %w", channel, errors.ErrUnsupported)
+	}
+	return listener.Listen(ctx, channel)
+}
+
+// Health checks the primary. Replicas are optional, since reads fall back
+// to the primary.
+func (r *Router) Health(ctx context.Context) error {
+	return r.currentPrimary().conn.Health(ctx)
+}
+
+// Close closes the primary and all replicas
+func (r *Router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errs := []error{r.primary.conn.Close()}
+	for _, m := range r.replicas {
+		m.mu.Lock()
+		if m.conn != nil {
+			errs = append(errs, m.conn.Close())
+		}
+		m.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the connection pool statistics of the primary
+func (r *Router) Stats() sql.DBStats {
+	if stats, ok := r.currentPrimary().conn.(database.StatsProvider); ok {
+		return stats.Stats()
+	}
+	return sql.DBStats{}
+}
+
+// Primary returns a connection always using the current primary, for work
+// that must never read from a replica such as migrations
+func (r *Router) Primary() database.Connection {
+	return primaryConnection{r}
+}
+
+// ReplicaStatus describes a replica as seen by the last probe
+type ReplicaStatus struct {
+	Name    string
+	Healthy bool
+	Latency time.Duration
+	Lag     time.Duration
+}
+
+// Status returns the name of the primary in use and the status of every
+// replica
+func (r *Router) Status() (string, []ReplicaStatus) {
+	var replicas []ReplicaStatus
+	for _, m := range r.members() {
+		replicas = append(replicas, ReplicaStatus{
+			Name:    m.node.Name,
+			Healthy: m.healthy.Load(),
+			Latency: time.Duration(m.latency.Load()),
+			Lag:     time.Duration(m.lag.Load()),
+		})
+	}
+	return r.currentPrimary().node.Name, replicas
+}
+
+// isConnectionError reports whether err means the connection is unusable
+// rather than the query failed
+func isConnectionError(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone)
+}
+
+// primaryConnection is a Router restricted to its primary
+type primaryConnection struct {
+	r *Router
+}
+
+func (p primaryConnection) conn() database.Connection {
+	return p.r.currentPrimary().conn
+}
+
+// Execute runs a statement on the primary
+func (p primaryConnection) Execute(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
+	return p.conn().Execute(ctx, query, args...)
+}
+
+// Query runs a query on the primary
+func (p primaryConnection) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
+	return p.conn().Query(ctx, query, args...)
+}
+
+// QueryRow runs a single row query on the primary
+func (p primaryConnection) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
+	return p.conn().QueryRow(ctx, query, args...)
+}
+
+// Begin starts a transaction on the primary
+func (p primaryConnection) Begin(ctx context.Context) (database.Transaction, error) {
+	return p.conn().Begin(ctx)
+}
+
+// Close does nothing, the router owns the connections
+func (p primaryConnection) Close() error {
+	return nil
+}
+
+// Health checks the primary
+func (p primaryConnection) Health(ctx context.Context) error {
+	return p.conn().Health(ctx)
+}
@@ -0,0 +1,186 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/fake"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nodes(names ...string) []Node {
+	var nodes []Node
+	for _, name := range names {
+		nodes = append(nodes, Node{Name: name, Config: database.Config{ConnectionString: name}})
+	}
+	return nodes
+}
+
+// primaryHosts treats every connection as a primary, unless it is one of
+// standbys
+func primaryHosts(standbys ...*fake.Conn) RecoveryFunc {
+	return func(ctx context.Context, conn database.Connection) (bool, error) {
+		for _, standby := range standbys {
+			if conn == standby {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+func newTestRouter(t *testing.T, provider *fake.Provider, primaries, replicas []string, opts ...Option) *Router {
+	opts = append([]Option{WithRecoveryFunc(primaryHosts())}, opts...)
+	r, err := New(context.Background(), provider, nodes(primaries...), nodes(replicas...), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRouter_Routing(t *testing.T) {
+	t.Run("Should send writes to the primary and spread reads across replicas", func(t *testing.T) {
+		provider := fake.NewProvider()
+		r := newTestRouter(t, provider, []string{"primary"}, []string{"replica-a", "replica-b"})
+		ctx := context.Background()
+
+		_, err := r.Execute(ctx, "UPDATE users")
+		require.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			_, err := r.Query(ctx, "SELECT users")
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{"UPDATE users"}, provider.Conn("primary").Statements())
+		assert.Len(t, provider.Conn("replica-a").Statements(), 2)
+		assert.Len(t, provider.Conn("replica-b").Statements(), 2)
+	})
+
+	t.Run("Should read from the primary after a write in the session", func(t *testing.T) {
+		provider := fake.NewProvider()
+		r := newTestRouter(t, provider, []string{"primary"}, []string{"replica"})
+		ctx := WithSession(context.Background())
+
+		r.QueryRow(ctx, "SELECT before")
+		_, err := r.Execute(ctx, "UPDATE users")
+		require.NoError(t, err)
+		r.QueryRow(ctx, "SELECT after")
+		r.QueryRow(context.Background(), "SELECT elsewhere")
+
+		assert.Equal(t, []string{"UPDATE users", "SELECT after"}, provider.Conn("primary").Statements())
+		assert.Equal(t, []string{"SELECT before", "SELECT elsewhere"}, provider.Conn("replica").Statements())
+	})
+
+	t.Run("Should prefer the replica answering fastest", func(t *testing.T) {
+		provider := fake.NewProvider()
+		r := newTestRouter(t, provider, []string{"primary"}, []string{"slow", "fast"}, WithBalancer(LeastLatency))
+		r.replicas[0].latency.Store(int64(50 * time.Millisecond))
+		r.replicas[1].latency.Store(int64(time.Millisecond))
+
+		r.QueryRow(context.Background(), "SELECT users")
+
+		assert.Len(t, provider.Conn("fast").Statements(), 1)
+	})
+}
+
+func TestRouter_Probe(t *testing.T) {
+	t.Run("Should avoid unhealthy and lagging replicas", func(t *testing.T) {
+		provider := fake.NewProvider()
+		provider.Conn("lagging").SetRows([]interface{}{5.0})
+		provider.Conn("down").SetHealth(errors.New("connection refused"))
+		provider.Conn("current").SetRows([]interface{}{0.2})
+		r := newTestRouter(t, provider, []string{"primary"}, []string{"lagging", "down", "current"}, WithMaxLag(time.Second))
+
+		_, replicas := r.Status()
+		assert.Equal(t, []bool{false, false, true}, []bool{replicas[0].Healthy, replicas[1].Healthy, replicas[2].Healthy})
+		assert.Equal(t, 5*time.Second, replicas[0].Lag)
+
+		m, isReplica := r.reader(context.Background())
+		assert.True(t, isReplica)
+		assert.Equal(t, "current", m.node.Name)
+	})
+
+	t.Run("Should read from the primary without healthy replicas", func(t *testing.T) {
+		provider := fake.NewProvider()
+		provider.SetUnreachable("replica", errors.New("no route to host"))
+		r := newTestRouter(t, provider, []string{"primary"}, []string{"replica"})
+
+		r.QueryRow(context.Background(), "SELECT users")
+		assert.Len(t, provider.Conn("primary").Statements(), 1)
+
+		provider.SetUnreachable("replica", nil)
+		r.Probe(context.Background())
+		r.QueryRow(context.Background(), "SELECT users")
+		assert.Len(t, provider.Conn("replica").Statements(), 1)
+	})
+
+	t.Run("Should fail over to the next primary host", func(t *testing.T) {
+		provider := fake.NewProvider()
+		provider.SetUnreachable("primary-a", errors.New("connection refused"))
+		r := newTestRouter(t, provider, []string{"primary-a", "primary-b", "primary-c"}, nil)
+		primary, _ := r.Status()
+		assert.Equal(t, "primary-b", primary)
+
+		provider.Conn("primary-b").SetHealth(errors.New("shutting down"))
+		provider.SetUnreachable("primary-a", nil)
+		r.Probe(context.Background())
+
+		primary, _ = r.Status()
+		assert.Equal(t, "primary-c", primary)
+		_, err := r.Execute(context.Background(), "UPDATE users")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"UPDATE users"}, provider.Conn("primary-c").Statements())
+		assert.Eventually(t, provider.Conn("primary-b").Closed, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should not promote a standby", func(t *testing.T) {
+		provider := fake.NewProvider()
+		r := newTestRouter(t, provider, []string{"primary-a", "primary-b", "primary-c"}, nil,
+			WithRecoveryFunc(primaryHosts(provider.Conn("primary-b"))))
+
+		provider.Conn("primary-a").SetHealth(errors.New("shutting down"))
+		r.Probe(context.Background())
+
+		primary, _ := r.Status()
+		assert.Equal(t, "primary-c", primary)
+	})
+
+	t.Run("Should log a failed failover once until the primary recovers", func(t *testing.T) {
+		log, capture := logger.NewCaptureLogger(logger.BackendLogrus)
+		provider := fake.NewProvider()
+		r := newTestRouter(t, provider, []string{"primary"}, nil, WithLogger(log))
+
+		provider.Conn("primary").SetHealth(errors.New("shutting down"))
+		provider.SetUnreachable("primary", errors.New("connection refused"))
+		for i := 0; i < 3; i++ {
+			r.Probe(context.Background())
+		}
+		provider.Conn("primary").SetHealth(nil)
+		r.Probe(context.Background())
+
+		var failures, recoveries int
+		for _, msg := range capture.Messages() {
+			switch msg {
+			case "Failed to fail over the primary database, retrying on every probe":
+				failures++
+			case "Primary database is healthy again":
+				recoveries++
+			}
+		}
+		assert.Equal(t, 1, failures)
+		assert.Equal(t, 1, recoveries)
+	})
+
+	t.Run("Should fail without a reachable primary", func(t *testing.T) {
+		provider := fake.NewProvider()
+		provider.SetUnreachable("primary", errors.New("connection refused"))
+
+		_, err := New(context.Background(), provider, nodes("primary"), nil)
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,43 @@
+package replica
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type sessionKey struct{}
+
+type primaryKey struct{}
+
+// session remembers whether a unit of work has written
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns a copy of ctx starting a read-your-writes session:
+// once a write was routed with the session, later reads with it go to the
+// primary, so they see the write even while replicas lag behind
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// WithPrimary returns a copy of ctx whose reads always go to the primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// markWrite records a write in the session of ctx, if any
+func markWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// usePrimary reports whether reads in ctx must go to the primary
+func usePrimary(ctx context.Context) bool {
+	if forced, _ := ctx.Value(primaryKey{}).(bool); forced {
+		return true
+	}
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structFields caches the db tagged fields of struct types
+var structFields sync.Map // map[reflect.Type][]taggedField
+
+// taggedField is a struct field mapped to a column by its db tag
+type taggedField struct {
+	column string
+	index  []int
+}
+
+// fieldsOf returns the db tagged fields of a struct type, in declaration
+// order. Fields of embedded structs without a tag are included.
+func fieldsOf(t reflect.Type) []taggedField {
+	if cached, ok := structFields.Load(t); ok {
+		return cached.([]taggedField)
+	}
+
+	var fields []taggedField
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag, ok := field.Tag.Lookup("db")
+			path := append(append([]int(nil), index...), i)
+			if !ok && field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type, path)
+				continue
+			}
+			column, _, _ := strings.Cut(tag, ",")
+			if column == "" || column == "-" || !field.IsExported() {
+				continue
+			}
+			fields = append(fields, taggedField{column: column, index: path})
+		}
+	}
+	walk(t, nil)
+
+	structFields.Store(t, fields)
+	return fields
+}
+
+// Columns returns the columns of the db tagged fields of T, in the order
+// ScanStruct and ScanAll scan them
+func Columns[T any]() []string {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("database: Columns of non-struct type %s", t))
+	}
+	fields := fieldsOf(t)
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.column
+	}
+	return columns
+}
+
+// ScanStruct scans row into the db tagged fields of dest, a pointer to a
+// struct. The row must have been selected with the columns returned by
+// Columns. A missing row is reported as ErrNoRows.
+func ScanStruct(row Row, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("database: ScanStruct destination must be a pointer to a struct, not %T", dest)
+	}
+
+	err := row.Scan(targets(v.Elem())...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoRows
+	}
+	return err
+}
+
+// ScanAll scans every row into a struct of type T and closes rows
+func ScanAll[T any](rows Rows) ([]T, error) {
+	defer rows.Close()
+
+	var all []T
+	for rows.Next() {
+		var item T
+		if err := ScanStruct(rows, &item); err != nil {
+			return nil, err
+		}
+		all = append(all, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// targets returns pointers to the db tagged fields of the struct v
+func targets(v reflect.Value) []interface{} {
+	fields := fieldsOf(v.Type())
+	dest := make([]interface{}, len(fields))
+	for i, field := range fields {
+		dest[i] = v.FieldByIndex(field.index).Addr().Interface()
+	}
+	return dest
+}
@@ -0,0 +1,62 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timestamps struct {
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type account struct {
+	ID     int    `db:"id"`
+	Name   string `db:"name"`
+	Note   string
+	Hidden string `db:"-"`
+	timestamps
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+func TestColumns(t *testing.T) {
+	t.Run("Should list tagged and embedded fields in order", func(t *testing.T) {
+		assert.Equal(t, []string{"id", "name", "created_at", "deleted_at"}, database.Columns[account]())
+	})
+}
+
+func TestScanAll(t *testing.T) {
+	t.Run("Should scan rows into structs", func(t *testing.T) {
+		conn, mock := newMockConnection(t)
+		now := time.Now()
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(database.Columns[account]()).
+			AddRow(1, "Ada", now, nil).
+			AddRow(2, "Grace", now, now))
+
+		rows, err := conn.Query(context.Background(), "SELECT id, name, created_at, deleted_at FROM accounts")
+		require.NoError(t, err)
+		accounts, err := database.ScanAll[account](rows)
+
+		require.NoError(t, err)
+		require.Len(t, accounts, 2)
+		assert.Equal(t, "Grace", accounts[1].Name)
+		assert.Nil(t, accounts[0].DeletedAt)
+		assert.NotNil(t, accounts[1].DeletedAt)
+		assert.True(t, now.Equal(accounts[0].CreatedAt))
+	})
+
+	t.Run("Should report missing rows as ErrNoRows", func(t *testing.T) {
+		conn, mock := newMockConnection(t)
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(database.Columns[account]()))
+
+		var a account
+		err := database.ScanStruct(conn.QueryRow(context.Background(), "SELECT id FROM accounts"), &a)
+
+		assert.ErrorIs(t, err, database.ErrNoRows)
+	})
+}
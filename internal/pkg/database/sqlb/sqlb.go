@@ -0,0 +1,508 @@
+// Package sqlb builds INSERT, UPDATE, SELECT and DELETE statements.
+//
+// Table and column names are checked to be plain identifiers, and values
+// are always bound to placeholders. Conditions and expressions are written
+// with ? placeholders, which Build rewrites for the dialect of the
+// database, so
+//
+//	sqlb.Update("users").Set("name", name).Where("id = ?", id).Build(sqlb.Postgres)
+//
+// returns "UPDATE users SET name = $1 WHERE (id = $2)" with name and id as
+// arguments. Write ?? for a literal question mark. Expressions are SQL
+// text and must never contain input.
+package sqlb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect renders the placeholders of a database
+type Dialect struct {
+	name        string
+	placeholder func(n int) string
+}
+
+// Dialects of the supported databases
+var (
+	// Postgres numbers placeholders: $1, $2, ...
+	Postgres = Dialect{name: "postgres", placeholder: func(n int) string { return "$" + strconv.Itoa(n) }}
+	// Question uses ? for every placeholder, as MySQL and SQLite do
+	Question = Dialect{name: "question", placeholder: func(int) string { return "?" }}
+)
+
+// DialectFor returns the dialect of a database provider, by its name
+func DialectFor(provider string) (Dialect, error) {
+	switch provider {
+	case "postgres", "postgresql", "pgx":
+		return Postgres, nil
+	case "mysql", "sqlite", "sqlite3":
+		return Question, nil
+	}
+	return Dialect{}, fmt.Errorf("no SQL dialect for provider %q", provider)
+}
+
+// String returns the name of the dialect
+func (d Dialect) String() string {
+	return d.name
+}
+
+// identifier matches table and column names, optionally qualified
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ordering matches ORDER BY terms
+var ordering = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?( (?i:ASC|DESC))?$`)
+
+// expr is a SQL fragment with ? placeholders and their arguments
+type expr struct {
+	sql  string
+	args []interface{}
+}
+
+// assignment sets a column to a value or an expression
+type assignment struct {
+	column string
+	value  interface{}
+	expr   *expr
+}
+
+// base holds what all statements share
+type base struct {
+	err       error
+	table     string
+	where     []expr
+	returning []string
+}
+
+// fail records the first error of a builder
+func (b *base) fail(format string, args ...interface{}) {
+	if b.err == nil {
+		b.err = fmt.Errorf("sqlb: "+format, args...)
+	}
+}
+
+// checkIdentifiers records names that are not identifiers
+func (b *base) checkIdentifiers(names ...string) {
+	for _, name := range names {
+		if !identifier.MatchString(name) {
+			b.fail("invalid identifier %q", name)
+		}
+	}
+}
+
+// statement renders a statement for a dialect
+type statement struct {
+	dialect Dialect
+	sql     strings.Builder
+	args    []interface{}
+}
+
+// bind adds a value and writes its placeholder
+func (s *statement) bind(value interface{}) {
+	s.args = append(s.args, value)
+	s.sql.WriteString(s.dialect.placeholder(len(s.args)))
+}
+
+// writeExpr writes an expression, replacing its ? placeholders
+func (s *statement) writeExpr(e expr) error {
+	used := 0
+	for i := 0; i < len(e.sql); i++ {
+		c := e.sql[i]
+		if c != '?' {
+			s.sql.WriteByte(c)
+			continue
+		}
+		if i+1 < len(e.sql) && e.sql[i+1] == '?' {
+			s.sql.WriteByte('?')
+			i++
+			continue
+		}
+		if used == len(e.args) {
+			return fmt.Errorf("sqlb: %q has more placeholders than arguments", e.sql)
+		}
+		s.bind(e.args[used])
+		used++
+	}
+	if used != len(e.args) {
+		return fmt.Errorf("sqlb: %q has %d placeholders for %d arguments", e.sql, used, len(e.args))
+	}
+	return nil
+}
+
+// writeWhere writes the conditions, joined by AND
+func (s *statement) writeWhere(where []expr) error {
+	for i, condition := range where {
+		if i == 0 {
+			s.sql.WriteString(" WHERE ")
+		} else {
+			s.sql.WriteString(" AND ")
+		}
+		s.sql.WriteString("(")
+		if err := s.writeExpr(condition); err != nil {
+			return err
+		}
+		s.sql.WriteString(")")
+	}
+	return nil
+}
+
+// writeReturning writes the RETURNING clause
+func (s *statement) writeReturning(columns []string) {
+	if len(columns) > 0 {
+		s.sql.WriteString(" RETURNING " + strings.Join(columns, ", "))
+	}
+}
+
+// errUnconditional is returned for UPDATE and DELETE without conditions,
+// which would change every row
+var errUnconditional = errors.New("sqlb: UPDATE and DELETE need a WHERE condition")
+
+// SelectBuilder builds a SELECT statement
+type SelectBuilder struct {
+	base
+	columns []string
+	orderBy []string
+	limit   int
+}
+
+// Select starts a SELECT of columns
+func Select(columns ...string) *SelectBuilder {
+	b := &SelectBuilder{columns: columns}
+	if len(columns) == 0 {
+		b.fail("SELECT needs columns")
+	}
+	b.checkIdentifiers(columns...)
+	return b
+}
+
+// From sets the table to select from
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.checkIdentifiers(table)
+	b.table = table
+	return b
+}
+
+// Where adds a condition, ANDed with the others
+func (b *SelectBuilder) Where(condition string, args ...interface{}) *SelectBuilder {
+	b.where = append(b.where, expr{condition, args})
+	return b
+}
+
+// OrderBy adds terms such as "created_at DESC" to the ordering
+func (b *SelectBuilder) OrderBy(terms ...string) *SelectBuilder {
+	for _, term := range terms {
+		if !ordering.MatchString(term) {
+			b.fail("invalid ORDER BY term %q", term)
+		}
+	}
+	b.orderBy = append(b.orderBy, terms...)
+	return b
+}
+
+// Limit caps the number of rows, if positive
+func (b *SelectBuilder) Limit(limit int) *SelectBuilder {
+	b.limit = limit
+	return b
+}
+
+// Build returns the statement and its arguments for dialect d
+func (b *SelectBuilder) Build(d Dialect) (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if b.table == "" {
+		return "", nil, errors.New("sqlb: SELECT needs a table")
+	}
+
+	s := &statement{dialect: d}
+	s.sql.WriteString("SELECT " + strings.Join(b.columns, ", ") + " FROM " + b.table)
+	if err := s.writeWhere(b.where); err != nil {
+		return "", nil, err
+	}
+	if len(b.orderBy) > 0 {
+		s.sql.WriteString(" ORDER BY " + strings.Join(b.orderBy, ", "))
+	}
+	if b.limit > 0 {
+		s.sql.WriteString(" LIMIT ")
+		s.bind(b.limit)
+	}
+	return s.sql.String(), s.args, nil
+}
+
+// InsertBuilder builds an INSERT statement of a single row
+type InsertBuilder struct {
+	base
+	values []assignment
+}
+
+// Insert starts an INSERT into table
+func Insert(table string) *InsertBuilder {
+	b := &InsertBuilder{}
+	b.checkIdentifiers(table)
+	b.table = table
+	return b
+}
+
+// Set adds a column and its value
+func (b *InsertBuilder) Set(column string, value interface{}) *InsertBuilder {
+	b.checkIdentifiers(column)
+	b.values = append(b.values, assignment{column: column, value: value})
+	return b
+}
+
+// Returning selects columns of the inserted row
+func (b *InsertBuilder) Returning(columns ...string) *InsertBuilder {
+	b.checkIdentifiers(columns...)
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Build returns the statement and its arguments for dialect d
+func (b *InsertBuilder) Build(d Dialect) (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if len(b.values) == 0 {
+		return "", nil, errors.New("sqlb: INSERT needs values")
+	}
+
+	s := &statement{dialect: d}
+	columns := make([]string, len(b.values))
+	for i, value := range b.values {
+		columns[i] = value.column
+	}
+	s.sql.WriteString("INSERT INTO " + b.table + " (" + strings.Join(columns, ", ") + ") VALUES (")
+	for i, value := range b.values {
+		if i > 0 {
+			s.sql.WriteString(", ")
+		}
+		s.bind(value.value)
+	}
+	s.sql.WriteString(")")
+	s.writeReturning(b.returning)
+	return s.sql.String(), s.args, nil
+}
+
+// RowsBuilder builds an INSERT statement of many rows, optionally
+// resolving conflicts with existing rows
+type RowsBuilder struct {
+	base
+	columns   []string
+	rows      [][]interface{}
+	conflict  []string
+	update    []string
+	upserting bool
+}
+
+// InsertRows starts an INSERT of rows with columns into table
+func InsertRows(table string, columns ...string) *RowsBuilder {
+	b := &RowsBuilder{columns: columns}
+	if len(columns) == 0 {
+		b.fail("INSERT needs columns")
+	}
+	b.checkIdentifiers(table)
+	b.checkIdentifiers(columns...)
+	b.table = table
+	return b
+}
+
+// Values adds a row, with a value per column
+func (b *RowsBuilder) Values(values ...interface{}) *RowsBuilder {
+	if len(values) != len(b.columns) {
+		b.fail("row %d has %d values for %d columns", len(b.rows)+1, len(values), len(b.columns))
+	}
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// OnConflict skips rows whose keys match an existing row, unless DoUpdate
+// says which columns to update instead
+func (b *RowsBuilder) OnConflict(keys ...string) *RowsBuilder {
+	if len(keys) == 0 {
+		b.fail("ON CONFLICT needs key columns")
+	}
+	b.checkIdentifiers(keys...)
+	b.conflict = keys
+	b.upserting = true
+	return b
+}
+
+// DoUpdate updates columns of existing rows with the values of the
+// conflicting rows
+func (b *RowsBuilder) DoUpdate(columns ...string) *RowsBuilder {
+	b.checkIdentifiers(columns...)
+	b.update = append(b.update, columns...)
+	return b
+}
+
+// Returning selects columns of the inserted rows
+func (b *RowsBuilder) Returning(columns ...string) *RowsBuilder {
+	b.checkIdentifiers(columns...)
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Build returns the statement and its arguments for dialect d
+func (b *RowsBuilder) Build(d Dialect) (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if len(b.rows) == 0 {
+		return "", nil, errors.New("sqlb: INSERT needs values")
+	}
+	if len(b.update) > 0 && !b.upserting {
+		return "", nil, errors.New("sqlb: DoUpdate needs OnConflict")
+	}
+
+	s := &statement{dialect: d, args: make([]interface{}, 0, len(b.rows)*len(b.columns))}
+	s.sql.WriteString("INSERT INTO " + b.table + " (" + strings.Join(b.columns, ", ") + ") VALUES ")
+	for i, row := range b.rows {
+		if i > 0 {
+			s.sql.WriteString(", ")
+		}
+		s.sql.WriteString("(")
+		for j, value := range row {
+			if j > 0 {
+				s.sql.WriteString(", ")
+			}
+			s.bind(value)
+		}
+		s.sql.WriteString(")")
+	}
+	if b.upserting {
+		s.sql.WriteString(" ON CONFLICT (" + strings.Join(b.conflict, ", ") + ") DO ")
+		if len(b.update) == 0 {
+			s.sql.WriteString("NOTHING")
+		} else {
+			s.sql.WriteString("UPDATE SET ")
+			for i, column := range b.update {
+				if i > 0 {
+					s.sql.WriteString(", ")
+				}
+				s.sql.WriteString(column + " = EXCLUDED." + column)
+			}
+		}
+	}
+	s.writeReturning(b.returning)
+	return s.sql.String(), s.args, nil
+}
+
+// UpdateBuilder builds an UPDATE statement
+type UpdateBuilder struct {
+	base
+	set []assignment
+}
+
+// Update starts an UPDATE of table
+func Update(table string) *UpdateBuilder {
+	b := &UpdateBuilder{}
+	b.checkIdentifiers(table)
+	b.table = table
+	return b
+}
+
+// Set assigns a value to a column
+func (b *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	b.checkIdentifiers(column)
+	b.set = append(b.set, assignment{column: column, value: value})
+	return b
+}
+
+// SetExpr assigns an expression such as "version + 1" to a column
+func (b *UpdateBuilder) SetExpr(column, expression string, args ...interface{}) *UpdateBuilder {
+	b.checkIdentifiers(column)
+	b.set = append(b.set, assignment{column: column, expr: &expr{expression, args}})
+	return b
+}
+
+// Where adds a condition, ANDed with the others
+func (b *UpdateBuilder) Where(condition string, args ...interface{}) *UpdateBuilder {
+	b.where = append(b.where, expr{condition, args})
+	return b
+}
+
+// Returning selects columns of the updated rows
+func (b *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	b.checkIdentifiers(columns...)
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Build returns the statement and its arguments for dialect d
+func (b *UpdateBuilder) Build(d Dialect) (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if len(b.set) == 0 {
+		return "", nil, errors.New("sqlb: UPDATE needs assignments")
+	}
+	if len(b.where) == 0 {
+		return "", nil, errUnconditional
+	}
+
+	s := &statement{dialect: d}
+	s.sql.WriteString("UPDATE " + b.table + " SET ")
+	for i, set := range b.set {
+		if i > 0 {
+			s.sql.WriteString(", ")
+		}
+		s.sql.WriteString(set.column + " = ")
+		if set.expr == nil {
+			s.bind(set.value)
+		} else if err := s.writeExpr(*set.expr); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := s.writeWhere(b.where); err != nil {
+		return "", nil, err
+	}
+	s.writeReturning(b.returning)
+	return s.sql.String(), s.args, nil
+}
+
+// DeleteBuilder builds a DELETE statement
+type DeleteBuilder struct {
+	base
+}
+
+// Delete starts a DELETE from table
+func Delete(table string) *DeleteBuilder {
+	b := &DeleteBuilder{}
+	b.checkIdentifiers(table)
+	b.table = table
+	return b
+}
+
+// Where adds a condition, ANDed with the others
+func (b *DeleteBuilder) Where(condition string, args ...interface{}) *DeleteBuilder {
+	b.where = append(b.where, expr{condition, args})
+	return b
+}
+
+// Returning selects columns of the deleted rows
+func (b *DeleteBuilder) Returning(columns ...string) *DeleteBuilder {
+	b.checkIdentifiers(columns...)
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Build returns the statement and its arguments for dialect d
+func (b *DeleteBuilder) Build(d Dialect) (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if len(b.where) == 0 {
+		return "", nil, errUnconditional
+	}
+
+	s := &statement{dialect: d}
+	s.sql.WriteString("DELETE FROM " + b.table)
+	if err := s.writeWhere(b.where); err != nil {
+		return "", nil, err
+	}
+	s.writeReturning(b.returning)
+	return s.sql.String(), s.args, nil
+}
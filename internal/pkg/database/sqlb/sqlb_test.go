@@ -0,0 +1,84 @@
+package sqlb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	t.Run("Should number placeholders for Postgres", func(t *testing.T) {
+		sql, args, err := Update("users").
+			Set("name", "Ada").
+			SetExpr("version", "version + 1").
+			Where("id = ? AND version = ?", 1, 3).
+			Where("deleted_at IS NULL").
+			Returning("version").
+			Build(Postgres)
+
+		require.NoError(t, err)
+		assert.Equal(t, "UPDATE users SET name = $1, version = version + 1 WHERE (id = $2 AND version = $3) AND (deleted_at IS NULL) RETURNING version", sql)
+		assert.Equal(t, []interface{}{"Ada", 1, 3}, args)
+	})
+
+	t.Run("Should keep question marks for other dialects", func(t *testing.T) {
+		sql, args, err := Select("id", "name").From("users").Where("role = ?", "admin").OrderBy("name DESC", "id").Limit(10).Build(Question)
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id, name FROM users WHERE (role = ?) ORDER BY name DESC, id LIMIT ?", sql)
+		assert.Equal(t, []interface{}{"admin", 10}, args)
+	})
+
+	t.Run("Should build inserts and deletes", func(t *testing.T) {
+		sql, args, err := Insert("users").Set("name", "Ada").Set("active", true).Returning("id").Build(Postgres)
+		require.NoError(t, err)
+		assert.Equal(t, "INSERT INTO users (name, active) VALUES ($1, $2) RETURNING id", sql)
+		assert.Equal(t, []interface{}{"Ada", true}, args)
+
+		sql, _, err = Delete("users").Where("tags ?? 'owner' AND id = ?", 1).Build(Postgres)
+		require.NoError(t, err)
+		assert.Equal(t, "DELETE FROM users WHERE (tags ? 'owner' AND id = $1)", sql)
+	})
+
+	t.Run("Should build multi-row upserts", func(t *testing.T) {
+		sql, args, err := InsertRows("assets", "id", "name", "region").
+			Values("a-1", "bucket", "eu").
+			Values("a-2", "queue", "us").
+			OnConflict("id").
+			DoUpdate("name", "region").
+			Build(Postgres)
+
+		require.NoError(t, err)
+		assert.Equal(t, "INSERT INTO assets (id, name, region) VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, region = EXCLUDED.region", sql)
+		assert.Equal(t, []interface{}{"a-1", "bucket", "eu", "a-2", "queue", "us"}, args)
+
+		sql, _, err = InsertRows("assets", "id").Values("a-1").OnConflict("id").Build(Question)
+		require.NoError(t, err)
+		assert.Equal(t, "INSERT INTO assets (id) VALUES (?) ON CONFLICT (id) DO NOTHING", sql)
+	})
+
+	t.Run("Should reject unsafe statements", func(t *testing.T) {
+		for name, build := range map[string]func(Dialect) (string, []interface{}, error){
+			"identifier":    Select("name; DROP TABLE users").From("users").Build,
+			"ordering":      Select("id").From("users").OrderBy("id; --").Build,
+			"arguments":     Select("id").From("users").Where("id = ? AND role = ?", 1).Build,
+			"unconditional": Update("users").Set("active", false).Build,
+			"row width":     InsertRows("assets", "id", "name").Values("a-1").Build,
+		} {
+			_, _, err := build(Postgres)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestDialectFor(t *testing.T) {
+	t.Run("Should pick the dialect of known providers", func(t *testing.T) {
+		d, err := DialectFor("postgres")
+		require.NoError(t, err)
+		assert.Equal(t, Postgres.String(), d.String())
+
+		_, err = DialectFor("oracle")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+)
+
+// Stream scans rows into structs of type T, like ScanAll, and sends them
+// on the returned channel as they are read. The channel buffers up to
+// buffer values and reading waits while it is full, so a slow consumer
+// holds back the query instead of rows piling up in memory.
+//
+// The channel is closed when the rows are exhausted, scanning fails or ctx
+// is done; wait then returns the error, if any. Rows are closed in every
+// case. A consumer that stops reading early must cancel ctx.
+func Stream[T any](ctx context.Context, rows Rows, buffer int) (values <-chan T, wait func() error) {
+	ch := make(chan T, buffer)
+	done := make(chan struct{})
+	var err error
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+		defer rows.Close()
+		err = stream(ctx, rows, ch)
+	}()
+
+	return ch, func() error {
+		<-done
+		return err
+	}
+}
+
+// stream sends every row to ch until ctx is done
+func stream[T any](ctx context.Context, rows Rows, ch chan<- T) error {
+	for rows.Next() {
+		var item T
+		if err := ScanStruct(rows, &item); err != nil {
+			return err
+		}
+		select {
+		case ch <- item:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,48 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type asset struct {
+	ID   string `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestStream(t *testing.T) {
+	conn := fake.NewProvider().Conn("db")
+	conn.SetRows([]interface{}{"a-1", "bucket"}, []interface{}{"a-2", "queue"}, []interface{}{"a-3", "topic"})
+
+	t.Run("Should send every row", func(t *testing.T) {
+		rows, err := conn.Query(context.Background(), "SELECT id, name FROM assets")
+		require.NoError(t, err)
+
+		values, wait := database.Stream[asset](context.Background(), rows, 1)
+		var names []string
+		for value := range values {
+			names = append(names, value.Name)
+		}
+
+		require.NoError(t, wait())
+		assert.Equal(t, []string{"bucket", "queue", "topic"}, names)
+	})
+
+	t.Run("Should stop reading when the consumer gives up", func(t *testing.T) {
+		rows, err := conn.Query(context.Background(), "SELECT id, name FROM assets")
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		values, wait := database.Stream[asset](ctx, rows, 0)
+		first := <-values
+		cancel()
+
+		assert.Equal(t, "a-1", first.ID)
+		assert.ErrorIs(t, wait(), context.Canceled)
+	})
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Defaults used by WithTx unless configured otherwise
+const (
+	DefaultTxAttempts = 3
+	DefaultTxBackoff  = 20 * time.Millisecond
+)
+
+// SQLSTATE codes of failures that succeed when the transaction is retried
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// txOptions holds the settings of WithTx
+type txOptions struct {
+	attempts int
+	backoff  time.Duration
+	onRetry  func(attempt int, err error)
+}
+
+// TxOption configures WithTx
+type TxOption func(*txOptions)
+
+// WithTxAttempts sets how often a transaction is run before a retryable
+// failure is returned
+func WithTxAttempts(attempts int) TxOption {
+	return func(o *txOptions) {
+		if attempts > 0 {
+			o.attempts = attempts
+		}
+	}
+}
+
+// WithTxBackoff sets the delay before the first retry, which doubles for
+// every further retry
+func WithTxBackoff(backoff time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.backoff = backoff
+	}
+}
+
+// OnTxRetry calls fn with the failure of each attempt that is retried
+func OnTxRetry(fn func(attempt int, err error)) TxOption {
+	return func(o *txOptions) {
+		o.onRetry = fn
+	}
+}
+
+// WithTx runs fn in a transaction on conn, committing it when fn succeeds
+// and rolling it back otherwise. Transactions failing on a serialization
+// failure or deadlock are run again, so fn must not have effects outside
+// the transaction.
+func WithTx(ctx context.Context, conn Connection, fn func(tx Transaction) error, opts ...TxOption) error {
+	o := txOptions{attempts: DefaultTxAttempts, backoff: DefaultTxBackoff}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	backoff := o.backoff
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, conn, fn)
+		if err == nil || attempt >= o.attempts || !IsRetryable(err) {
+			return err
+		}
+		if o.onRetry != nil {
+			o.onRetry(attempt, err)
+		}
+
+		// Jitter keeps conflicting transactions from retrying in lockstep
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// runTx runs fn in a single transaction
+func runTx(ctx context.Context, conn Connection, fn func(tx Transaction) error) (err error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, ErrTxDone) && !errors.Is(rbErr, sql.ErrTxDone) {
+				err = errors.Join(err, rbErr)
+			}
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock,
+// as reported by drivers exposing the SQLSTATE of errors
+func IsRetryable(err error) bool {
+	var state interface{ SQLState() string }
+	if !errors.As(err, &state) {
+		return false
+	}
+	code := state.SQLState()
+	return code == serializationFailure || code == deadlockDetected
+}
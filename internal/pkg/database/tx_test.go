@@ -0,0 +1,94 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/postgres"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockConnection(t *testing.T) (database.Connection, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	log := logger.NewLogger(logger.LoggerConfig{
+		Output:    io.Discard,
+		Formatter: &logrus.JSONFormatter{},
+		Level:     logrus.InfoLevel,
+	})
+	return postgres.NewProvider(log).Wrap(db), mock
+}
+
+func TestWithTx(t *testing.T) {
+	insert := func(tx database.Transaction) error {
+		_, err := tx.Execute(context.Background(), "INSERT INTO users (name) VALUES ($1)", "Ada")
+		return err
+	}
+
+	t.Run("Should commit when fn succeeds", func(t *testing.T) {
+		conn, mock := newMockConnection(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, database.WithTx(context.Background(), conn, insert))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should roll back when fn fails", func(t *testing.T) {
+		conn, mock := newMockConnection(t)
+		failure := errors.New("boom")
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err := database.WithTx(context.Background(), conn, func(database.Transaction) error { return failure })
+
+		assert.ErrorIs(t, err, failure)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should retry serialization failures", func(t *testing.T) {
+		conn, mock := newMockConnection(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").WillReturnError(&pq.Error{Code: "40001"})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		var retries int
+		err := database.WithTx(context.Background(), conn, insert,
+			database.WithTxBackoff(time.Millisecond),
+			database.OnTxRetry(func(int, error) { retries++ }))
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, retries)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Should give up after the configured attempts", func(t *testing.T) {
+		conn, mock := newMockConnection(t)
+		for i := 0; i < 2; i++ {
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO users").WillReturnError(&pq.Error{Code: "40P01"})
+			mock.ExpectRollback()
+		}
+
+		err := database.WithTx(context.Background(), conn, insert,
+			database.WithTxAttempts(2), database.WithTxBackoff(time.Millisecond))
+
+		assert.True(t, database.IsRetryable(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
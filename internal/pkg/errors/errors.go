@@ -16,6 +16,8 @@ const (
     ErrorTypeDatabase
     // ErrorTypeNotFound is returned when a resource is not found
     ErrorTypeNotFound
+    // ErrorTypeConflict is returned when a resource was changed concurrently
+    ErrorTypeConflict
 )
 
 // Error defines a standard application error
@@ -55,4 +57,15 @@ func NewDatabaseError(message string, err error) *Error {
 // NewNotFoundError creates a new not found error
 func NewNotFoundError(message string, err error) *Error {
     return New(ErrorTypeNotFound, message, err)
-}
\ No newline at end of file
+}
+
+// NewConflictError creates a new conflict error
+func NewConflictError(message string, err error) *Error {
+    return New(ErrorTypeConflict, message, err)
+}
+
+// Unwrap returns the underlying error, so errors.Is and errors.As see
+// through application errors
+func (e *Error) Unwrap() error {
+    return e.Err
+}
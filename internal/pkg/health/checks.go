@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database/migrate"
+)
+
+// DatabaseCheck pings the database connection
+func DatabaseCheck(db database.Connection) CheckFunc {
+	return func(ctx context.Context) error {
+		return db.Health(ctx)
+	}
+}
+
+// MigrationsCheck fails while the database schema has pending migrations
+func MigrationsCheck(migrator *migrate.Migrator) CheckFunc {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations, next is %d_%s",
+				len(pending), pending[0].Version, pending[0].Name)
+		}
+		return nil
+	}
+}
+
+// QueueLagCheck fails when the age of the oldest unprocessed item in a
+// background queue, as reported by lag, exceeds max
+func QueueLagCheck(lag func(ctx context.Context) (time.Duration, error), max time.Duration) CheckFunc {
+	return func(ctx context.Context) error {
+		current, err := lag(ctx)
+		if err != nil {
+			return err
+		}
+		if current > max {
+			return fmt.Errorf("queue lag %s exceeds %s", current, max)
+		}
+		return nil
+	}
+}
+
+// DiskSpaceCheck fails when the filesystem containing path has less than
+// minFree bytes available
+func DiskSpaceCheck(path string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		free, err := freeDiskSpace(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free on %s, need at least %d", free, path, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package health
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace returns the bytes available to the calling user
+func freeDiskSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
@@ -0,0 +1,194 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of a health check or report
+type Status string
+
+const (
+	// StatusUp means every check passed
+	StatusUp Status = "up"
+	// StatusDegraded means only non-critical checks failed
+	StatusDegraded Status = "degraded"
+	// StatusDown means at least one critical check failed
+	StatusDown Status = "down"
+)
+
+// Default settings applied when a Registry or Check leaves them unset
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// CheckFunc probes a dependency and returns an error if it is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named health check registered by a component
+type Check struct {
+	Name    string
+	Check   CheckFunc
+	Timeout time.Duration
+	// Critical checks make the service unready when they fail. Failing
+	// non-critical checks only degrade the report.
+	Critical bool
+}
+
+// Result is the outcome of running a single check
+type Result struct {
+	Name      string        `json:"name"`
+	Status    Status        `json:"status"`
+	Critical  bool          `json:"critical"`
+	Latency   time.Duration `json:"-"`
+	LatencyMS float64       `json:"latency_ms"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Report is the aggregated outcome of every registered check
+type Report struct {
+	Status    Status    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Ready reports whether every critical check passed
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+// Registry holds the health checks registered by components and caches
+// their results so frequent probes do not overload dependencies
+type Registry struct {
+	mu     sync.RWMutex
+	checks []Check
+
+	runMu    sync.Mutex
+	cacheTTL time.Duration
+	cached   *Report
+	now      func() time.Time
+}
+
+// NewRegistry creates a registry that caches reports for cacheTTL. A zero
+// TTL uses DefaultCacheTTL; a negative TTL disables caching.
+func NewRegistry(cacheTTL time.Duration) *Registry {
+	if cacheTTL == 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+	return &Registry{
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+	}
+}
+
+// Register adds a check to the registry
+func (r *Registry) Register(check Check) {
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, check)
+}
+
+// Run returns the current health report, running the checks only when the
+// cached report has expired. Concurrent callers share a single run. The
+// report is shared, so the checks run detached from the cancellation of
+// ctx, bounded by their own timeouts; a caller giving up does not cache a
+// failed report for everyone else.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	if r.cached != nil && r.cacheTTL > 0 && r.now().Sub(r.cached.CheckedAt) < r.cacheTTL {
+		return *r.cached
+	}
+
+	report := r.run(context.WithoutCancel(ctx))
+	r.cached = &report
+	return report
+}
+
+// run executes every check concurrently
+func (r *Registry) run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make([]Check, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:    StatusUp,
+		CheckedAt: r.now(),
+		Checks:    results,
+	}
+	for _, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+// runCheck executes a single check within its timeout
+func runCheck(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", check.Timeout)
+	}
+
+	latency := time.Since(start)
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		Latency:   latency,
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
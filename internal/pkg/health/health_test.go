@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Run(t *testing.T) {
+	t.Run("Should report up when every check passes", func(t *testing.T) {
+		registry := NewRegistry(-1)
+		registry.Register(Check{Name: "database", Check: func(ctx context.Context) error { return nil }, Critical: true})
+
+		report := registry.Run(context.Background())
+
+		assert.Equal(t, StatusUp, report.Status)
+		assert.True(t, report.Ready())
+		require.Len(t, report.Checks, 1)
+		assert.Equal(t, "database", report.Checks[0].Name)
+		assert.Equal(t, StatusUp, report.Checks[0].Status)
+	})
+
+	t.Run("Should degrade on non-critical failures", func(t *testing.T) {
+		registry := NewRegistry(-1)
+		registry.Register(Check{Name: "database", Check: func(ctx context.Context) error { return nil }, Critical: true})
+		registry.Register(Check{Name: "disk", Check: func(ctx context.Context) error { return errors.New("full") }})
+
+		report := registry.Run(context.Background())
+
+		assert.Equal(t, StatusDegraded, report.Status)
+		assert.True(t, report.Ready())
+		assert.Equal(t, "full", report.Checks[1].Error)
+	})
+
+	t.Run("Should be down on critical failures", func(t *testing.T) {
+		registry := NewRegistry(-1)
+		registry.Register(Check{Name: "database", Check: func(ctx context.Context) error { return errors.New("refused") }, Critical: true})
+
+		report := registry.Run(context.Background())
+
+		assert.Equal(t, StatusDown, report.Status)
+		assert.False(t, report.Ready())
+	})
+
+	t.Run("Should time out slow checks", func(t *testing.T) {
+		registry := NewRegistry(-1)
+		registry.Register(Check{
+			Name:     "database",
+			Timeout:  10 * time.Millisecond,
+			Critical: true,
+			Check: func(ctx context.Context) error {
+				<-ctx.Done()
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			},
+		})
+
+		report := registry.Run(context.Background())
+
+		assert.Equal(t, StatusDown, report.Status)
+		assert.Contains(t, report.Checks[0].Error, "timed out")
+		assert.Less(t, report.Checks[0].Latency, 50*time.Millisecond)
+	})
+
+	t.Run("Should cache results between probes", func(t *testing.T) {
+		var calls atomic.Int32
+		registry := NewRegistry(time.Minute)
+		registry.Register(Check{Name: "database", Check: func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		}})
+
+		now := time.Now()
+		registry.now = func() time.Time { return now }
+
+		for i := 0; i < 10; i++ {
+			registry.Run(context.Background())
+		}
+		assert.Equal(t, int32(1), calls.Load())
+
+		now = now.Add(2 * time.Minute)
+		registry.Run(context.Background())
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Should not cache the failure of a cancelled caller", func(t *testing.T) {
+		registry := NewRegistry(time.Minute)
+		registry.Register(Check{Name: "database", Critical: true, Check: func(ctx context.Context) error {
+			return ctx.Err()
+		}})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.Equal(t, StatusUp, registry.Run(ctx).Status)
+		assert.Equal(t, StatusUp, registry.Run(context.Background()).Status)
+	})
+}
+
+func TestQueueLagCheck(t *testing.T) {
+	lag := time.Second
+	check := QueueLagCheck(func(ctx context.Context) (time.Duration, error) { return lag, nil }, 5*time.Second)
+
+	assert.NoError(t, check(context.Background()))
+
+	lag = time.Minute
+	assert.Error(t, check(context.Background()))
+}
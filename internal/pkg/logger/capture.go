@@ -0,0 +1,18 @@
+package logger
+
+import "github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger/sink"
+
+// NewCaptureLogger returns a debug level logger using backend whose entries
+// are recorded in the returned Capture, for asserting on logs in tests
+func NewCaptureLogger(backend string) (Logger, *sink.Capture) {
+	capture := sink.NewCapture()
+	log, err := New(Options{
+		Backend: backend,
+		Output:  capture,
+		Levels:  NewLevelRegistry(DebugLevel),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return log, capture
+}
@@ -0,0 +1,301 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int32
+
+// Supported levels, from most to least verbose
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// RootLoggerName identifies the root of the logger hierarchy
+const RootLoggerName = "root"
+
+// String returns the lower-case name of the level
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel converts a level name into a Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug", "trace":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "fatal", "panic":
+		return FatalLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", name)
+}
+
+// levelNode holds the level of one named logger. Loggers keep a pointer
+// to their node so checking the level is a single atomic load.
+type levelNode struct {
+	effective  atomic.Int32
+	explicit   *Level
+	configured bool
+	generation uint64
+	timer      *time.Timer
+	expiresAt  time.Time
+	// restore is the level a pending revert returns to, the one in place
+	// before the first temporary level
+	restore *Level
+}
+
+// enabled reports whether entries at level should be written
+func (n *levelNode) enabled(level Level) bool {
+	return level >= Level(n.effective.Load())
+}
+
+// LevelInfo describes the level of a named logger
+type LevelInfo struct {
+	Name      string     `json:"name"`
+	Level     string     `json:"level"`
+	Explicit  bool       `json:"explicit"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// LevelRegistry tracks the levels of named loggers. Names form a
+// dot-separated hierarchy: a logger without its own level inherits from
+// its nearest ancestor, so "database.postgres" inherits from "database",
+// which inherits from the root.
+type LevelRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]*levelNode
+}
+
+// NewLevelRegistry creates a registry with the given root level
+func NewLevelRegistry(root Level) *LevelRegistry {
+	r := &LevelRegistry{nodes: make(map[string]*levelNode)}
+	rootNode := &levelNode{explicit: &root}
+	rootNode.effective.Store(int32(root))
+	r.nodes[""] = rootNode
+	return r
+}
+
+// normalizeName maps the root aliases to the empty name
+func normalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == RootLoggerName {
+		return ""
+	}
+	return name
+}
+
+// node returns the node for name, creating it if needed. r.mu must be held.
+func (r *LevelRegistry) node(name string) *levelNode {
+	if n, ok := r.nodes[name]; ok {
+		return n
+	}
+	n := &levelNode{}
+	n.effective.Store(int32(r.resolve(name)))
+	r.nodes[name] = n
+	return n
+}
+
+// resolve finds the nearest explicit level for name. r.mu must be held.
+func (r *LevelRegistry) resolve(name string) Level {
+	for {
+		if n, ok := r.nodes[name]; ok && n.explicit != nil {
+			return *n.explicit
+		}
+		if name == "" {
+			return InfoLevel
+		}
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[:i]
+		} else {
+			name = ""
+		}
+	}
+}
+
+// recompute refreshes the effective level of every node. r.mu must be held.
+func (r *LevelRegistry) recompute() {
+	for name, n := range r.nodes {
+		n.effective.Store(int32(r.resolve(name)))
+	}
+}
+
+// Level returns the effective level of the named logger
+func (r *LevelRegistry) Level(name string) Level {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resolve(normalizeName(name))
+}
+
+// SetLevel sets the level of the named logger and its descendants that do
+// not have their own level
+func (r *LevelRegistry) SetLevel(name string, level Level) {
+	r.SetLevelFor(name, level, 0)
+}
+
+// SetLevelFor sets the level of the named logger. When ttl is positive the
+// previous level is restored once it elapses, so a debugging session
+// cannot be forgotten in production.
+func (r *LevelRegistry) SetLevelFor(name string, level Level, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name = normalizeName(name)
+	n := r.node(name)
+	// A temporary level replacing another one reverts to the level before
+	// both, not to the level it replaced
+	restore := n.explicit
+	if n.timer != nil {
+		restore = n.restore
+	}
+	r.set(n, &level)
+
+	if ttl > 0 {
+		generation := n.generation
+		n.restore = restore
+		n.expiresAt = time.Now().Add(ttl)
+		n.timer = time.AfterFunc(ttl, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			// Only revert if nothing changed the level in the meantime
+			if n.generation == generation {
+				r.set(n, n.restore)
+			}
+		})
+	}
+}
+
+// ResetLevel removes the level of the named logger so it inherits from its
+// ancestors again. The root level cannot be reset.
+func (r *LevelRegistry) ResetLevel(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name = normalizeName(name)
+	if name == "" {
+		return
+	}
+	if n, ok := r.nodes[name]; ok {
+		n.configured = false
+		r.set(n, nil)
+	}
+}
+
+// set changes a node's explicit level, cancelling any pending revert.
+// r.mu must be held.
+func (r *LevelRegistry) set(n *levelNode, level *Level) {
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	n.generation++
+	n.expiresAt = time.Time{}
+	n.restore = nil
+	if level != nil {
+		l := *level
+		level = &l
+	}
+	n.explicit = level
+	r.recompute()
+}
+
+// Apply sets the root and named levels from configuration. Named levels set
+// by a previous Apply that are no longer configured are reset.
+func (r *LevelRegistry) Apply(root string, levels map[string]string) error {
+	parsed := make(map[string]Level, len(levels))
+	for name, value := range levels {
+		level, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("logger %q: %w", name, err)
+		}
+		parsed[normalizeName(name)] = level
+	}
+	if root != "" {
+		level, err := ParseLevel(root)
+		if err != nil {
+			return err
+		}
+		parsed[""] = level
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, n := range r.nodes {
+		if _, ok := parsed[name]; !ok && n.configured && name != "" {
+			n.configured = false
+			r.set(n, nil)
+		}
+	}
+	for name, level := range parsed {
+		n := r.node(name)
+		n.configured = true
+		r.set(n, &level)
+	}
+	return nil
+}
+
+// List returns the levels of every known logger, sorted by name
+func (r *LevelRegistry) List() []LevelInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]LevelInfo, 0, len(r.nodes))
+	for name, n := range r.nodes {
+		info := LevelInfo{
+			Name:     name,
+			Level:    Level(n.effective.Load()).String(),
+			Explicit: n.explicit != nil,
+		}
+		if info.Name == "" {
+			info.Name = RootLoggerName
+		}
+		if !n.expiresAt.IsZero() {
+			expiresAt := n.expiresAt
+			info.ExpiresAt = &expiresAt
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// handle returns the level node for name, used by loggers to check levels
+func (r *LevelRegistry) handle(name string) *levelNode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.node(normalizeName(name))
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelRegistry_Inheritance(t *testing.T) {
+	levels := NewLevelRegistry(InfoLevel)
+
+	t.Run("Should inherit from the nearest ancestor", func(t *testing.T) {
+		levels.SetLevel("database", DebugLevel)
+
+		assert.Equal(t, DebugLevel, levels.Level("database.postgres"))
+		assert.Equal(t, InfoLevel, levels.Level("handler"))
+	})
+
+	t.Run("Should inherit again after a reset", func(t *testing.T) {
+		levels.SetLevel("database.postgres", ErrorLevel)
+		assert.Equal(t, ErrorLevel, levels.Level("database.postgres"))
+
+		levels.ResetLevel("database.postgres")
+		assert.Equal(t, DebugLevel, levels.Level("database.postgres"))
+	})
+
+	t.Run("Should not reset the root level", func(t *testing.T) {
+		levels.ResetLevel(RootLoggerName)
+		assert.Equal(t, InfoLevel, levels.Level(RootLoggerName))
+	})
+}
+
+func TestLevelRegistry_TTL(t *testing.T) {
+	levels := NewLevelRegistry(InfoLevel)
+	levels.SetLevel("handler", WarnLevel)
+
+	levels.SetLevelFor("handler", DebugLevel, 20*time.Millisecond)
+	assert.Equal(t, DebugLevel, levels.Level("handler"))
+	require.NotNil(t, levels.List()[0].ExpiresAt)
+
+	assert.Eventually(t, func() bool {
+		return levels.Level("handler") == WarnLevel
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestLevelRegistry_NestedTTL(t *testing.T) {
+	levels := NewLevelRegistry(InfoLevel)
+	levels.SetLevel("handler", ErrorLevel)
+
+	levels.SetLevelFor("handler", DebugLevel, time.Minute)
+	levels.SetLevelFor("handler", WarnLevel, 20*time.Millisecond)
+	assert.Equal(t, WarnLevel, levels.Level("handler"))
+
+	assert.Eventually(t, func() bool {
+		return levels.Level("handler") == ErrorLevel
+	}, time.Second, 5*time.Millisecond)
+	assert.Nil(t, levels.List()[0].ExpiresAt)
+}
+
+func TestLevelRegistry_Apply(t *testing.T) {
+	levels := NewLevelRegistry(InfoLevel)
+
+	require.NoError(t, levels.Apply("warn", map[string]string{"database.postgres": "debug"}))
+	assert.Equal(t, WarnLevel, levels.Level("handler"))
+	assert.Equal(t, DebugLevel, levels.Level("database.postgres"))
+
+	t.Run("Should reset loggers removed from the configuration", func(t *testing.T) {
+		require.NoError(t, levels.Apply("", nil))
+		assert.Equal(t, WarnLevel, levels.Level("database.postgres"))
+	})
+
+	t.Run("Should reject unknown levels", func(t *testing.T) {
+		assert.Error(t, levels.Apply("loud", nil))
+	})
+}
+
+func TestNamedLogger_IndependentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewLogger(LoggerConfig{
+		Output:    &buf,
+		Formatter: &logrus.JSONFormatter{},
+		Level:     logrus.InfoLevel,
+	})
+	db := log.WithField("request_id", "abc").Named("database.postgres")
+
+	db.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	log.(*logrusLogger).levels.SetLevel("database.postgres", DebugLevel)
+	db.Debug("query")
+	log.Debug("still hidden")
+
+	out := buf.String()
+	assert.Contains(t, out, `"logger":"database.postgres"`)
+	assert.Contains(t, out, `"request_id":"abc"`)
+	assert.Contains(t, out, "query")
+	assert.NotContains(t, out, "still hidden")
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
 
@@ -22,32 +24,153 @@ type Logger interface {
 	WithField(key string, value interface{}) Logger
 	WithFields(fields map[string]interface{}) Logger
 	WithError(err error) Logger
+	// Named returns a logger for a component. Its level is looked up by
+	// name in the logger's LevelRegistry and can be changed at runtime.
+	Named(name string) Logger
 }
 
 // logrusLogger wraps logrus.Logger to implement our Logger interface
 type logrusLogger struct {
 	logger *logrus.Logger
 	entry  *logrus.Entry
+	levels *LevelRegistry
+	level  *levelNode
+}
+
+// Supported logging backends
+const (
+	BackendLogrus = "logrus"
+	BackendSlog   = "slog"
+)
+
+// Supported output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Options configures a logger created with New
+type Options struct {
+	// Backend is BackendLogrus (the default) or BackendSlog
+	Backend string
+	// Format is FormatJSON (the default) or FormatText
+	Format string
+	// Output defaults to os.Stdout
+	Output io.Writer
+	// Levels holds the logger levels. A registry at info level is created
+	// when nil.
+	Levels *LevelRegistry
+	// Redaction overrides the default redaction rules
+	Redaction *RedactionConfig
+}
+
+// redactable is implemented by loggers whose redaction rules can be
+// replaced after creation
+type redactable interface {
+	setRedactor(redactor *Redactor)
 }
 
 // standard logger instance
-var stdLogger *logrusLogger
+var stdLogger Logger
+
+// stdLevels holds the levels of the standard logger and its named loggers
+var stdLevels *LevelRegistry
 
 func init() {
-	log := logrus.New()
-	log.SetOutput(os.Stdout)
-	log.SetFormatter(&logrus.JSONFormatter{})
-	
 	// Set log level from environment variable or default to info
-	logLevel, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
 	if err != nil {
-		logLevel = logrus.InfoLevel
+		level = InfoLevel
+	}
+	stdLevels = NewLevelRegistry(level)
+
+	stdLogger, err = New(Options{Levels: stdLevels})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// New creates a logger using the selected backend
+func New(opts Options) (Logger, error) {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Levels == nil {
+		opts.Levels = NewLevelRegistry(InfoLevel)
+	}
+	redaction := DefaultRedactionConfig()
+	if opts.Redaction != nil {
+		redaction = *opts.Redaction
 	}
-	log.SetLevel(logLevel)
-	
-	stdLogger = &logrusLogger{
+	redactor := NewRedactor(redaction)
+
+	switch opts.Format {
+	case "", FormatJSON, FormatText:
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	switch opts.Backend {
+	case "", BackendLogrus:
+		log := logrus.New()
+		log.SetOutput(opts.Output)
+		if opts.Format == FormatText {
+			log.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+		} else {
+			log.SetFormatter(&logrus.JSONFormatter{})
+		}
+		// Levels are enforced per named logger, so logrus itself lets everything through
+		log.SetLevel(logrus.DebugLevel)
+		log.AddHook(&redactionHook{redactor: redactor})
+		return newLogrusLogger(log, opts.Levels), nil
+	case BackendSlog:
+		return newSlogLogger(opts.Output, opts.Format, opts.Levels, redactor), nil
+	}
+	return nil, fmt.Errorf("unknown logging backend %q", opts.Backend)
+}
+
+// Configure replaces the standard logger. The new logger shares the level
+// registry returned by Levels. It should be called during startup, before
+// loggers are handed out to other components.
+func Configure(opts Options) error {
+	opts.Levels = stdLevels
+	log, err := New(opts)
+	if err != nil {
+		return err
+	}
+	stdLogger = log
+	return nil
+}
+
+// newLogrusLogger creates the root logger backed by log and levels
+func newLogrusLogger(log *logrus.Logger, levels *LevelRegistry) *logrusLogger {
+	return &logrusLogger{
 		logger: log,
 		entry:  logrus.NewEntry(log),
+		levels: levels,
+		level:  levels.handle(""),
+	}
+}
+
+// fromLogrusLevel maps a logrus level onto a Level
+func fromLogrusLevel(level logrus.Level) Level {
+	switch {
+	case level >= logrus.DebugLevel:
+		return DebugLevel
+	case level == logrus.InfoLevel:
+		return InfoLevel
+	case level == logrus.WarnLevel:
+		return WarnLevel
+	case level == logrus.ErrorLevel:
+		return ErrorLevel
+	}
+	return FatalLevel
+}
+
+// SetRedaction replaces the redaction rules of the standard logger
+func SetRedaction(config RedactionConfig) {
+	if log, ok := stdLogger.(redactable); ok {
+		log.setRedactor(NewRedactor(config))
 	}
 }
 
@@ -56,17 +179,35 @@ func GetLogger() Logger {
 	return stdLogger
 }
 
+// Named returns a component logger derived from the standard logger
+func Named(name string) Logger {
+	return stdLogger.Named(name)
+}
+
+// Levels returns the level registry of the standard logger
+func Levels() *LevelRegistry {
+	return stdLevels
+}
+
+// ApplyLevels sets the root and per-logger levels of the standard logger
+func ApplyLevels(root string, levels map[string]string) error {
+	return stdLevels.Apply(root, levels)
+}
+
 // NewLogger creates a new logger with the specified configuration
 func NewLogger(config LoggerConfig) Logger {
 	log := logrus.New()
 	log.SetOutput(config.Output)
 	log.SetFormatter(config.Formatter)
-	log.SetLevel(config.Level)
-	
-	return &logrusLogger{
-		logger: log,
-		entry:  logrus.NewEntry(log),
+	log.SetLevel(logrus.DebugLevel)
+
+	redaction := DefaultRedactionConfig()
+	if config.Redaction != nil {
+		redaction = *config.Redaction
 	}
+	log.AddHook(&redactionHook{redactor: NewRedactor(redaction)})
+
+	return newLogrusLogger(log, NewLevelRegistry(fromLogrusLevel(config.Level)))
 }
 
 // LoggerConfig holds the configuration for creating a new logger
@@ -74,118 +215,138 @@ type LoggerConfig struct {
 	Output    io.Writer
 	Formatter logrus.Formatter
 	Level     logrus.Level
+	// Redaction overrides the default redaction rules
+	Redaction *RedactionConfig
 }
 
 // Info logs at the info level
 func (l *logrusLogger) Info(args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(InfoLevel) {
 		l.entry.Info(args...)
-	} else {
-		l.logger.Info(args...)
 	}
 }
 
 // Infof logs at the info level with formatting
 func (l *logrusLogger) Infof(format string, args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(InfoLevel) {
 		l.entry.Infof(format, args...)
-	} else {
-		l.logger.Infof(format, args...)
 	}
 }
 
 // Warn logs at the warning level
 func (l *logrusLogger) Warn(args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(WarnLevel) {
 		l.entry.Warn(args...)
-	} else {
-		l.logger.Warn(args...)
 	}
 }
 
 // Warnf logs at the warning level with formatting
 func (l *logrusLogger) Warnf(format string, args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(WarnLevel) {
 		l.entry.Warnf(format, args...)
-	} else {
-		l.logger.Warnf(format, args...)
 	}
 }
 
 // Error logs at the error level
 func (l *logrusLogger) Error(args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(ErrorLevel) {
 		l.entry.Error(args...)
-	} else {
-		l.logger.Error(args...)
 	}
 }
 
 // Errorf logs at the error level with formatting
 func (l *logrusLogger) Errorf(format string, args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(ErrorLevel) {
 		l.entry.Errorf(format, args...)
-	} else {
-		l.logger.Errorf(format, args...)
 	}
 }
 
 // Debug logs at the debug level
 func (l *logrusLogger) Debug(args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(DebugLevel) {
 		l.entry.Debug(args...)
-	} else {
-		l.logger.Debug(args...)
 	}
 }
 
 // Debugf logs at the debug level with formatting
 func (l *logrusLogger) Debugf(format string, args ...interface{}) {
-	if l.entry != nil {
+	if l.level.enabled(DebugLevel) {
 		l.entry.Debugf(format, args...)
-	} else {
-		l.logger.Debugf(format, args...)
 	}
 }
 
 // Fatal logs at the fatal level
 func (l *logrusLogger) Fatal(args ...interface{}) {
-	if l.entry != nil {
-		l.entry.Fatal(args...)
-	} else {
-		l.logger.Fatal(args...)
-	}
+	l.entry.Fatal(args...)
 }
 
 // Fatalf logs at the fatal level with formatting
 func (l *logrusLogger) Fatalf(format string, args ...interface{}) {
-	if l.entry != nil {
-		l.entry.Fatalf(format, args...)
-	} else {
-		l.logger.Fatalf(format, args...)
-	}
+	l.entry.Fatalf(format, args...)
 }
 
 // WithField returns a new Logger with the field added
 func (l *logrusLogger) WithField(key string, value interface{}) Logger {
-	return &logrusLogger{
-		logger: l.logger,
-		entry:  l.entry.WithField(key, value),
-	}
+	return l.with(l.entry.WithField(key, value))
 }
 
 // WithFields returns a new Logger with the fields added
 func (l *logrusLogger) WithFields(fields map[string]interface{}) Logger {
+	return l.with(l.entry.WithFields(logrus.Fields(fields)))
+}
+
+// WithError returns a new Logger with the error field added
+func (l *logrusLogger) WithError(err error) Logger {
+	return l.with(l.entry.WithError(err))
+}
+
+// Named returns a new Logger whose level is controlled by name
+func (l *logrusLogger) Named(name string) Logger {
 	return &logrusLogger{
 		logger: l.logger,
-		entry:  l.entry.WithFields(logrus.Fields(fields)),
+		entry:  l.entry.WithField("logger", name),
+		levels: l.levels,
+		level:  l.levels.handle(name),
 	}
 }
 
-// WithError returns a new Logger with the error field added
-func (l *logrusLogger) WithError(err error) Logger {
+// setRedactor replaces the redaction hook of the underlying logrus logger
+func (l *logrusLogger) setRedactor(redactor *Redactor) {
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(&redactionHook{redactor: redactor})
+	l.logger.ReplaceHooks(hooks)
+}
+
+// with returns a copy of l writing through entry
+func (l *logrusLogger) with(entry *logrus.Entry) *logrusLogger {
 	return &logrusLogger{
 		logger: l.logger,
-		entry:  l.entry.WithError(err),
+		entry:  entry,
+		levels: l.levels,
+		level:  l.level,
 	}
-}
\ No newline at end of file
+}
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying logger. Code further down the
+// call chain retrieves it with FromContext so its entries share the
+// request-scoped fields.
+func WithContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or the standard logger
+func FromContext(ctx context.Context) Logger {
+	return FromContextOr(ctx, stdLogger)
+}
+
+// FromContextOr returns the logger stored in ctx, or fallback
+func FromContextOr(ctx context.Context, fallback Logger) Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+			return logger
+		}
+	}
+	return fallback
+}
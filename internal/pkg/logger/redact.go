@@ -0,0 +1,187 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces values that must never be logged
+const Redacted = "[REDACTED]"
+
+// RedactionConfig controls which values are removed from log entries
+type RedactionConfig struct {
+	// SensitiveFields are case-insensitive substrings of field names whose
+	// values are always redacted, e.g. "password" matches "db_password"
+	SensitiveFields []string
+
+	// SQLFields are fields holding SQL text. Their literals are scrubbed
+	// while the statement structure is kept for debugging.
+	SQLFields []string
+
+	// HashEmails replaces email addresses with a keyed hash instead of
+	// redacting them, so entries for the same address can be correlated
+	HashEmails bool
+
+	// HashKey is the HMAC key used when hashing email addresses
+	HashKey string
+}
+
+// DefaultRedactionConfig returns the rules applied when none are configured
+func DefaultRedactionConfig() RedactionConfig {
+	return RedactionConfig{
+		SensitiveFields: []string{
+			"password", "passwd", "secret", "token", "authorization",
+			"api_key", "apikey", "cookie", "credential", "private_key",
+		},
+		SQLFields: []string{"query", "sql", "statement"},
+	}
+}
+
+var (
+	jwtPattern       = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`)
+	bearerPattern    = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	awsKeyIDPattern  = regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)
+	awsSecretPattern = regexp.MustCompile(`(?i)(aws_?secret_?access_?key["']?\s*[:=]\s*["']?)[A-Za-z0-9/+=]{40}`)
+	emailPattern     = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`\$\d+|\b\d+(?:\.\d+)?\b`)
+)
+
+// Redactor removes secrets and personal data from log fields and messages
+type Redactor struct {
+	config RedactionConfig
+}
+
+// NewRedactor creates a Redactor applying the given rules
+func NewRedactor(config RedactionConfig) *Redactor {
+	lower := func(values []string) []string {
+		out := make([]string, len(values))
+		for i, v := range values {
+			out[i] = strings.ToLower(v)
+		}
+		return out
+	}
+	config.SensitiveFields = lower(config.SensitiveFields)
+	config.SQLFields = lower(config.SQLFields)
+
+	return &Redactor{config: config}
+}
+
+// String redacts tokens, keys and email addresses found in s
+func (r *Redactor) String(s string) string {
+	s = jwtPattern.ReplaceAllString(s, Redacted)
+	s = bearerPattern.ReplaceAllString(s, "$1 "+Redacted)
+	s = awsKeyIDPattern.ReplaceAllString(s, Redacted)
+	s = awsSecretPattern.ReplaceAllString(s, "${1}"+Redacted)
+	s = emailPattern.ReplaceAllStringFunc(s, r.email)
+	return s
+}
+
+// Field redacts a single field value according to its name and contents
+func (r *Redactor) Field(key string, value interface{}) interface{} {
+	name := strings.ToLower(key)
+	for _, sensitive := range r.config.SensitiveFields {
+		if strings.Contains(name, sensitive) {
+			return Redacted
+		}
+	}
+
+	for _, sqlField := range r.config.SQLFields {
+		if name == sqlField {
+			if s, ok := value.(string); ok {
+				return r.String(ScrubSQL(s))
+			}
+		}
+	}
+
+	return r.value(value)
+}
+
+// value redacts the contents of a field value, descending into maps
+func (r *Redactor) value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case []byte:
+		return r.String(string(v))
+	case error:
+		return r.String(v.Error())
+	case fmt.Stringer:
+		return r.String(v.String())
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			out[k] = r.Field(k, nested)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			out[k] = r.Field(k, nested)
+		}
+		return out
+	case http.Header:
+		return r.value(map[string][]string(v))
+	case url.Values:
+		return r.value(map[string][]string(v))
+	case map[string][]string:
+		out := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			out[k] = r.Field(k, strings.Join(nested, ", "))
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// email redacts or hashes a single email address
+func (r *Redactor) email(address string) string {
+	if !r.config.HashEmails {
+		return "[REDACTED_EMAIL]"
+	}
+	mac := hmac.New(sha256.New, []byte(r.config.HashKey))
+	mac.Write([]byte(strings.ToLower(address)))
+	return "email:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ScrubSQL replaces string and numeric literals in query with ?. Bind
+// parameters such as $1 are preserved.
+func ScrubSQL(query string) string {
+	query = sqlStringLiteral.ReplaceAllString(query, "?")
+	return sqlNumericLiteral.ReplaceAllStringFunc(query, func(match string) string {
+		if strings.HasPrefix(match, "$") {
+			return match
+		}
+		return "?"
+	})
+}
+
+// redactionHook applies a Redactor to every logrus entry before it is
+// formatted and written
+type redactionHook struct {
+	redactor *Redactor
+}
+
+// Levels implements the logrus.Hook interface
+func (h *redactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements the logrus.Hook interface
+func (h *redactionHook) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		entry.Data[key] = h.redactor.Field(key, value)
+	}
+	entry.Message = h.redactor.String(entry.Message)
+	return nil
+}
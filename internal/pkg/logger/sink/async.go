@@ -0,0 +1,147 @@
+package sink
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned when writing to a closed Async writer
+var ErrClosed = errors.New("sink: writer is closed")
+
+// DropPolicy decides what happens when the Async buffer is full
+type DropPolicy string
+
+// Supported drop policies
+const (
+	// Block waits for room in the buffer
+	Block DropPolicy = "block"
+	// DropNewest discards the entry being written
+	DropNewest DropPolicy = "drop_newest"
+	// DropOldest discards the oldest buffered entry to make room
+	DropOldest DropPolicy = "drop_oldest"
+)
+
+// defaultBufferSize is the number of entries buffered when unset
+const defaultBufferSize = 1024
+
+// AsyncConfig holds the settings of an Async writer
+type AsyncConfig struct {
+	// BufferSize is the number of entries buffered, 1024 when zero
+	BufferSize int
+	// Policy defaults to DropNewest so a slow sink never stalls requests
+	Policy DropPolicy
+}
+
+// Async writes entries to another writer from a background goroutine so
+// callers never wait for slow sinks such as remote syslog servers
+type Async struct {
+	out     io.Writer
+	policy  DropPolicy
+	entries chan []byte
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// NewAsync starts a background writer for out
+func NewAsync(out io.Writer, config AsyncConfig) (*Async, error) {
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultBufferSize
+	}
+	switch config.Policy {
+	case "":
+		config.Policy = DropNewest
+	case Block, DropNewest, DropOldest:
+	default:
+		return nil, errors.New("sink: unknown drop policy " + string(config.Policy))
+	}
+
+	a := &Async{
+		out:     out,
+		policy:  config.Policy,
+		entries: make(chan []byte, config.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// run writes buffered entries until the writer is closed
+func (a *Async) run() {
+	defer close(a.done)
+	for entry := range a.entries {
+		if _, err := a.out.Write(entry); err != nil {
+			a.errors.Add(1)
+		}
+	}
+}
+
+// Write buffers a copy of p. It never fails because of a full buffer;
+// entries dropped by the policy are counted instead.
+func (a *Async) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, ErrClosed
+	}
+	entry := append([]byte(nil), p...)
+
+	switch a.policy {
+	case Block:
+		a.entries <- entry
+	case DropOldest:
+		for {
+			select {
+			case a.entries <- entry:
+				return len(p), nil
+			default:
+			}
+			select {
+			case <-a.entries:
+				a.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case a.entries <- entry:
+		default:
+			a.dropped.Add(1)
+		}
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of entries discarded because the buffer was full
+func (a *Async) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Errors returns the number of entries the underlying writer failed to write
+func (a *Async) Errors() uint64 {
+	return a.errors.Load()
+}
+
+// Close flushes the buffered entries and closes the underlying writer if
+// it is an io.Closer
+func (a *Async) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.entries)
+	a.mu.Unlock()
+
+	<-a.done
+	if closer, ok := a.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Entry is a decoded log entry
+type Entry map[string]interface{}
+
+// Message returns the entry's message
+func (e Entry) Message() string {
+	msg, _ := e["msg"].(string)
+	return msg
+}
+
+// Level returns the entry's level in lower case
+func (e Entry) Level() string {
+	level, _ := e["level"].(string)
+	return strings.ToLower(level)
+}
+
+// Capture records JSON log entries in memory so tests can assert on them
+type Capture struct {
+	mu      sync.Mutex
+	entries []Entry
+	partial []byte
+}
+
+// NewCapture creates an empty Capture
+func NewCapture() *Capture {
+	return &Capture{}
+}
+
+// Write decodes every complete line in p. Lines that are not JSON are
+// kept as entries with only a message.
+func (c *Capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := c.partial[:i]
+		c.partial = c.partial[i+1:]
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			entry = Entry{"msg": string(line)}
+		}
+		c.entries = append(c.entries, entry)
+	}
+	return len(p), nil
+}
+
+// Entries returns a copy of the captured entries
+func (c *Capture) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Entry(nil), c.entries...)
+}
+
+// Messages returns the messages of the captured entries
+func (c *Capture) Messages() []string {
+	entries := c.Entries()
+	messages := make([]string, len(entries))
+	for i, entry := range entries {
+		messages[i] = entry.Message()
+	}
+	return messages
+}
+
+// Find returns the first entry with the given message
+func (c *Capture) Find(msg string) (Entry, bool) {
+	for _, entry := range c.Entries() {
+		if entry.Message() == msg {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Reset discards the captured entries
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	c.partial = nil
+}
@@ -0,0 +1,33 @@
+package sink
+
+import (
+	"io"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RotatingFileConfig holds the limits of a rotating log file
+type RotatingFileConfig struct {
+	// Path is the file written to. Rotated files are kept next to it.
+	Path string
+	// MaxSizeMB is the size at which the file is rotated, 100 when zero
+	MaxSizeMB int
+	// MaxAgeDays removes rotated files older than this many days
+	MaxAgeDays int
+	// MaxBackups is the number of rotated files kept, all when zero
+	MaxBackups int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// NewRotatingFile returns a writer that rotates the file at config.Path
+// once it reaches the size limit
+func NewRotatingFile(config RotatingFileConfig) io.WriteCloser {
+	return &lumberjack.Logger{
+		Filename:   config.Path,
+		MaxSize:    config.MaxSizeMB,
+		MaxAge:     config.MaxAgeDays,
+		MaxBackups: config.MaxBackups,
+		Compress:   config.Compress,
+	}
+}
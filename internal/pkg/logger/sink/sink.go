@@ -0,0 +1,71 @@
+// Package sink provides the destinations log entries are written to.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Supported outputs
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+	File   = "file"
+	Sys    = "syslog"
+)
+
+// Config selects and configures the output of the logger
+type Config struct {
+	// Output is stdout (the default), stderr, file or syslog
+	Output string
+	File   RotatingFileConfig
+	Syslog SyslogConfig
+	// Async buffers entries and writes them in the background when set
+	Async *AsyncConfig
+}
+
+// Open returns the writer described by config. Closing it flushes and
+// releases the underlying resources; closing stdout or stderr is a no-op.
+func Open(config Config) (io.WriteCloser, error) {
+	var out io.WriteCloser
+	switch config.Output {
+	case "", Stdout:
+		out = nopCloser{os.Stdout}
+	case Stderr:
+		out = nopCloser{os.Stderr}
+	case File:
+		if config.File.Path == "" {
+			return nil, fmt.Errorf("log file path is required")
+		}
+		out = NewRotatingFile(config.File)
+	case Sys:
+		syslog, err := DialSyslog(config.Syslog)
+		if err != nil {
+			return nil, err
+		}
+		out = syslog
+	default:
+		return nil, fmt.Errorf("unknown log output %q", config.Output)
+	}
+
+	if config.Async == nil {
+		return out, nil
+	}
+	async, err := NewAsync(out, *config.Async)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return async, nil
+}
+
+// nopCloser is a writer whose Close does nothing
+type nopCloser struct {
+	io.Writer
+}
+
+// Close implements the io.Closer interface
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,168 @@
+package sink
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWriter holds every write until release is closed
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	lines   []string
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, string(p))
+	return len(p), nil
+}
+
+func TestAsync_DropPolicies(t *testing.T) {
+	t.Run("Should drop new entries when the buffer is full", func(t *testing.T) {
+		out := &blockingWriter{release: make(chan struct{})}
+		async, err := NewAsync(out, AsyncConfig{BufferSize: 2, Policy: DropNewest})
+		require.NoError(t, err)
+
+		for _, line := range []string{"1", "2", "3", "4", "5"} {
+			_, err := async.Write([]byte(line))
+			require.NoError(t, err)
+		}
+		close(out.release)
+		require.NoError(t, async.Close())
+
+		// The first entry may already be held by the background writer
+		assert.GreaterOrEqual(t, async.Dropped(), uint64(2))
+		assert.Equal(t, "1", out.lines[0])
+		assert.Equal(t, uint64(5), async.Dropped()+uint64(len(out.lines)))
+	})
+
+	t.Run("Should drop the oldest entries when the buffer is full", func(t *testing.T) {
+		out := &blockingWriter{release: make(chan struct{})}
+		async, err := NewAsync(out, AsyncConfig{BufferSize: 2, Policy: DropOldest})
+		require.NoError(t, err)
+
+		for _, line := range []string{"1", "2", "3", "4", "5"} {
+			_, err := async.Write([]byte(line))
+			require.NoError(t, err)
+		}
+		close(out.release)
+		require.NoError(t, async.Close())
+
+		assert.Equal(t, "5", out.lines[len(out.lines)-1])
+		assert.Equal(t, uint64(5), async.Dropped()+uint64(len(out.lines)))
+	})
+
+	t.Run("Should reject writes after close", func(t *testing.T) {
+		async, err := NewAsync(NewCapture(), AsyncConfig{})
+		require.NoError(t, err)
+		require.NoError(t, async.Close())
+
+		_, err = async.Write([]byte("late"))
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+func TestSyslog_RFC5424(t *testing.T) {
+	t.Run("Should send framed messages over TCP", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		received := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			line, _ := bufio.NewReader(conn).ReadString('}')
+			received <- line
+		}()
+
+		s, err := DialSyslog(SyslogConfig{Network: "tcp", Address: ln.Addr().String(), AppName: "scrutiny", Hostname: "host1"})
+		require.NoError(t, err)
+		defer s.Close()
+		s.timeNow = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+		_, err = s.Write([]byte(`{"level":"error","msg":"boom"}` + "\n"))
+		require.NoError(t, err)
+
+		msg := `<131>1 2024-01-02T03:04:05.000000Z host1 scrutiny ` + s.procID + ` - - {"level":"error","msg":"boom"}`
+		select {
+		case got := <-received:
+			assert.Equal(t, strconv.Itoa(len(msg)), strings.SplitN(got, " ", 2)[0])
+			assert.True(t, strings.HasSuffix(got, msg))
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	})
+
+	t.Run("Should send one datagram per entry over UDP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		s, err := DialSyslog(SyslogConfig{Network: "udp", Address: conn.LocalAddr().String()})
+		require.NoError(t, err)
+		defer s.Close()
+
+		_, err = s.Write([]byte("time=now level=debug msg=hello\n"))
+		require.NoError(t, err)
+
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(buf[:n]), "<135>1 "))
+		assert.True(t, strings.HasSuffix(string(buf[:n]), "msg=hello"))
+	})
+
+	t.Run("Should reject unsupported networks", func(t *testing.T) {
+		_, err := DialSyslog(SyslogConfig{Network: "unix", Address: "/dev/log"})
+		assert.Error(t, err)
+	})
+}
+
+func TestOpen_RotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrutiny.log")
+	out, err := Open(Config{Output: File, File: RotatingFileConfig{Path: path}, Async: &AsyncConfig{Policy: Block}})
+	require.NoError(t, err)
+
+	_, err = out.Write([]byte("{\"msg\":\"hello\"}\n"))
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"msg\":\"hello\"}\n", string(data))
+}
+
+func TestCapture(t *testing.T) {
+	capture := NewCapture()
+
+	_, err := capture.Write([]byte(`{"level":"INFO","msg":"first"}` + "\n" + `{"msg":"sec`))
+	require.NoError(t, err)
+	_, err = capture.Write([]byte(`ond"}` + "\nplain text\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"first", "second", "plain text"}, capture.Messages())
+	entry, ok := capture.Find("first")
+	require.True(t, ok)
+	assert.Equal(t, "info", entry.Level())
+
+	capture.Reset()
+	assert.Empty(t, capture.Entries())
+}
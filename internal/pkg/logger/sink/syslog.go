@@ -0,0 +1,217 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog severities from RFC 5424
+const (
+	severityCrit    = 2
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// FacilityLocal0 is the default syslog facility
+const FacilityLocal0 = 16
+
+// defaultDialTimeout bounds connecting to the syslog server
+const defaultDialTimeout = 5 * time.Second
+
+// levelPattern finds the level of a JSON or text formatted entry
+var levelPattern = regexp.MustCompile(`(?i)"?level"?[=:]\s*"?([a-z]+)`)
+
+// SyslogConfig holds the settings of a syslog sink
+type SyslogConfig struct {
+	// Network is udp, tcp or tls
+	Network string
+	// Address is the host:port of the syslog server
+	Address string
+	// Facility defaults to FacilityLocal0
+	Facility int
+	// AppName defaults to the executable name
+	AppName string
+	// Hostname defaults to os.Hostname
+	Hostname string
+	// TLSConfig is used when Network is tls
+	TLSConfig   *tls.Config
+	DialTimeout time.Duration
+}
+
+// Syslog writes entries as RFC 5424 messages. Each Write must contain a
+// single formatted entry, which is what the loggers produce. Messages sent
+// over TCP and TLS use octet-counting framing from RFC 6587.
+type Syslog struct {
+	config  SyslogConfig
+	procID  string
+	mu      sync.Mutex
+	conn    net.Conn
+	framed  bool
+	timeNow func() time.Time
+	buf     bytes.Buffer
+}
+
+// DialSyslog connects to the syslog server described by config
+func DialSyslog(config SyslogConfig) (*Syslog, error) {
+	switch config.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, errors.New("syslog address is required")
+	}
+	if config.Facility == 0 {
+		config.Facility = FacilityLocal0
+	}
+	if config.AppName == "" {
+		config.AppName = strings.TrimSuffix(baseName(os.Args[0]), ".exe")
+	}
+	if config.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "-"
+		}
+		config.Hostname = hostname
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+
+	s := &Syslog{
+		config:  config,
+		procID:  fmt.Sprint(os.Getpid()),
+		framed:  config.Network != "udp",
+		timeNow: time.Now,
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect dials the syslog server. s.mu must be held or s unshared.
+func (s *Syslog) connect() error {
+	dialer := &net.Dialer{Timeout: s.config.DialTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.config.Network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.Address, s.config.TLSConfig)
+	} else {
+		conn, err = dialer.Dial(s.config.Network, s.config.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog server: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Write sends p as a single syslog message, reconnecting once if the
+// connection was lost
+func (s *Syslog) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.format(p)
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := s.conn.Write(msg); err != nil {
+		// Stream connections may have been closed by the server
+		s.conn.Close()
+		s.conn = nil
+		if !s.framed {
+			return 0, err
+		}
+		if err := s.connect(); err != nil {
+			return 0, err
+		}
+		if _, err := s.conn.Write(msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// format builds the RFC 5424 message for entry
+func (s *Syslog) format(entry []byte) []byte {
+	entry = bytes.TrimRight(entry, "\r\n")
+	pri := s.config.Facility*8 + severity(entry)
+
+	s.buf.Reset()
+	fmt.Fprintf(&s.buf, "<%d>1 %s %s %s %s - - ",
+		pri,
+		s.timeNow().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(s.config.Hostname),
+		nilValue(s.config.AppName),
+		s.procID,
+	)
+	s.buf.Write(entry)
+
+	if !s.framed {
+		return append([]byte(nil), s.buf.Bytes()...)
+	}
+	return append([]byte(fmt.Sprintf("%d ", s.buf.Len())), s.buf.Bytes()...)
+}
+
+// Close closes the connection to the syslog server
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// severity maps the level of a formatted entry onto a syslog severity
+func severity(entry []byte) int {
+	match := levelPattern.FindSubmatch(entry)
+	if match == nil {
+		return severityInfo
+	}
+	switch strings.ToLower(string(match[1])) {
+	case "debug", "trace":
+		return severityDebug
+	case "warn", "warning":
+		return severityWarning
+	case "error":
+		return severityError
+	case "fatal", "panic":
+		return severityCrit
+	}
+	return severityInfo
+}
+
+// nilValue returns the RFC 5424 NILVALUE for empty header fields
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+// baseName returns the last element of a path
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
@@ -0,0 +1,288 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync/atomic"
+)
+
+// slogFatalLevel is the slog level used for fatal entries
+const slogFatalLevel = slog.LevelError + 4
+
+// slogLogger implements Logger on top of log/slog
+type slogLogger struct {
+	logger   *slog.Logger
+	redactor *atomic.Pointer[Redactor]
+	name     string
+	levels   *LevelRegistry
+	level    *levelNode
+}
+
+// newSlogLogger creates the root slog logger writing to out
+func newSlogLogger(out io.Writer, format string, levels *LevelRegistry, redactor *Redactor) *slogLogger {
+	opts := &slog.HandlerOptions{
+		// Levels are enforced per named logger, so the handler lets everything through
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				if level, ok := a.Value.Any().(slog.Level); ok && level >= slogFatalLevel {
+					a.Value = slog.StringValue("FATAL")
+				}
+			}
+			return a
+		},
+	}
+
+	var handler slog.Handler
+	if format == FormatText {
+		handler = slog.NewTextHandler(out, opts)
+	} else {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+
+	ref := &atomic.Pointer[Redactor]{}
+	ref.Store(redactor)
+
+	return &slogLogger{
+		logger:   slog.New(&redactingHandler{next: handler, redactor: ref}),
+		redactor: ref,
+		levels:   levels,
+		level:    levels.handle(""),
+	}
+}
+
+// toSlogLevel maps a Level onto a slog level
+func toSlogLevel(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	}
+	return slogFatalLevel
+}
+
+// log writes msg at level if the logger's level allows it
+func (l *slogLogger) log(level Level, msg string) {
+	if !l.level.enabled(level) {
+		return
+	}
+	if l.name != "" {
+		l.logger.Log(context.Background(), toSlogLevel(level), msg, "logger", l.name)
+	} else {
+		l.logger.Log(context.Background(), toSlogLevel(level), msg)
+	}
+}
+
+// Info logs at the info level
+func (l *slogLogger) Info(args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprint(args...))
+}
+
+// Infof logs at the info level with formatting
+func (l *slogLogger) Infof(format string, args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+// Warn logs at the warning level
+func (l *slogLogger) Warn(args ...interface{}) {
+	l.log(WarnLevel, fmt.Sprint(args...))
+}
+
+// Warnf logs at the warning level with formatting
+func (l *slogLogger) Warnf(format string, args ...interface{}) {
+	l.log(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+// Error logs at the error level
+func (l *slogLogger) Error(args ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprint(args...))
+}
+
+// Errorf logs at the error level with formatting
+func (l *slogLogger) Errorf(format string, args ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+// Debug logs at the debug level
+func (l *slogLogger) Debug(args ...interface{}) {
+	l.log(DebugLevel, fmt.Sprint(args...))
+}
+
+// Debugf logs at the debug level with formatting
+func (l *slogLogger) Debugf(format string, args ...interface{}) {
+	l.log(DebugLevel, fmt.Sprintf(format, args...))
+}
+
+// Fatal logs at the fatal level and exits
+func (l *slogLogger) Fatal(args ...interface{}) {
+	l.log(FatalLevel, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+// Fatalf logs at the fatal level with formatting and exits
+func (l *slogLogger) Fatalf(format string, args ...interface{}) {
+	l.log(FatalLevel, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// WithField returns a new Logger with the field added
+func (l *slogLogger) WithField(key string, value interface{}) Logger {
+	return l.with(l.logger.With(key, value))
+}
+
+// WithFields returns a new Logger with the fields added
+func (l *slogLogger) WithFields(fields map[string]interface{}) Logger {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields))
+	for _, key := range keys {
+		args = append(args, slog.Any(key, fields[key]))
+	}
+	return l.with(l.logger.With(args...))
+}
+
+// WithError returns a new Logger with the error field added
+func (l *slogLogger) WithError(err error) Logger {
+	return l.with(l.logger.With("error", err))
+}
+
+// Named returns a new Logger whose level is controlled by name
+func (l *slogLogger) Named(name string) Logger {
+	named := l.with(l.logger)
+	named.name = name
+	named.level = l.levels.handle(name)
+	return named
+}
+
+// setRedactor replaces the redaction rules of the logger and its children
+func (l *slogLogger) setRedactor(redactor *Redactor) {
+	l.redactor.Store(redactor)
+}
+
+// with returns a copy of l writing through logger
+func (l *slogLogger) with(logger *slog.Logger) *slogLogger {
+	return &slogLogger{
+		logger:   logger,
+		redactor: l.redactor,
+		name:     l.name,
+		levels:   l.levels,
+		level:    l.level,
+	}
+}
+
+// redactingHandler applies a Redactor to the message and attributes of
+// every record before passing it on. Attributes added with WithAttrs are
+// kept unredacted and applied to next when the handler is first used with
+// a redactor, so replacing the redactor also covers derived loggers.
+type redactingHandler struct {
+	next     slog.Handler
+	redactor *atomic.Pointer[Redactor]
+	// steps are the groups and attributes added since next
+	steps []handlerStep
+	built atomic.Pointer[builtHandler]
+}
+
+// handlerStep is a group or a set of attributes added to a handler
+type handlerStep struct {
+	group string
+	attrs []slog.Attr
+}
+
+// builtHandler is next with the steps applied, redacted by redactor
+type builtHandler struct {
+	redactor *Redactor
+	handler  slog.Handler
+}
+
+// Enabled implements the slog.Handler interface
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements the slog.Handler interface
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redactor := h.redactor.Load()
+
+	redacted := slog.NewRecord(record.Time, record.Level, redactor.String(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(redactor, a))
+		return true
+	})
+	return h.handler(redactor).Handle(ctx, redacted)
+}
+
+// handler returns next with the steps applied and redacted by redactor,
+// rebuilding it when the redactor was replaced
+func (h *redactingHandler) handler(redactor *Redactor) slog.Handler {
+	if built := h.built.Load(); built != nil && built.redactor == redactor {
+		return built.handler
+	}
+
+	handler := h.next
+	for _, step := range h.steps {
+		if step.attrs == nil {
+			handler = handler.WithGroup(step.group)
+			continue
+		}
+		redacted := make([]slog.Attr, len(step.attrs))
+		for i, a := range step.attrs {
+			redacted[i] = redactAttr(redactor, a)
+		}
+		handler = handler.WithAttrs(redacted)
+	}
+	h.built.Store(&builtHandler{redactor: redactor, handler: handler})
+	return handler
+}
+
+// WithAttrs implements the slog.Handler interface
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.derive(handlerStep{attrs: attrs})
+}
+
+// WithGroup implements the slog.Handler interface
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.derive(handlerStep{group: name})
+}
+
+// derive returns a handler adding step to those of h
+func (h *redactingHandler) derive(step handlerStep) *redactingHandler {
+	return &redactingHandler{
+		next:     h.next,
+		redactor: h.redactor,
+		steps:    append(slices.Clip(h.steps), step),
+	}
+}
+
+// redactAttr redacts a single attribute, descending into groups
+func redactAttr(redactor *Redactor, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, nested := range group {
+			redacted[i] = redactAttr(redactor, nested)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	return slog.Any(a.Key, redactor.Field(a.Key, a.Value.Any()))
+}
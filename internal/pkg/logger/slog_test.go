@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Backends(t *testing.T) {
+	for _, backend := range []string{BackendLogrus, BackendSlog} {
+		t.Run("Should write structured entries with "+backend, func(t *testing.T) {
+			log, capture := NewCaptureLogger(backend)
+
+			log.Named("database.postgres").
+				WithFields(map[string]interface{}{"rows": 3, "password": "hunter2"}).
+				WithError(errors.New("boom")).
+				Warnf("query %s failed", "users.find_all")
+
+			entries := capture.Entries()
+			require.Len(t, entries, 1)
+			entry := entries[0]
+			assert.Equal(t, "query users.find_all failed", entry.Message())
+			assert.Contains(t, []string{"warn", "warning"}, entry.Level())
+			assert.Equal(t, "database.postgres", entry["logger"])
+			assert.Equal(t, float64(3), entry["rows"])
+			assert.Equal(t, Redacted, entry["password"])
+			assert.Equal(t, "boom", entry["error"])
+		})
+	}
+
+	t.Run("Should reject unknown backends and formats", func(t *testing.T) {
+		_, err := New(Options{Backend: "zap"})
+		assert.Error(t, err)
+		_, err = New(Options{Format: "xml"})
+		assert.Error(t, err)
+	})
+}
+
+func TestSlogLogger_Levels(t *testing.T) {
+	levels := NewLevelRegistry(WarnLevel)
+	var buf bytes.Buffer
+	log, err := New(Options{Backend: BackendSlog, Output: &buf, Levels: levels})
+	require.NoError(t, err)
+	db := log.Named("database")
+
+	db.Info("hidden")
+	assert.Empty(t, buf.String())
+
+	levels.SetLevel("database", DebugLevel)
+	db.Debug("visible")
+	log.Info("still hidden")
+
+	assert.Contains(t, buf.String(), "visible")
+	assert.NotContains(t, buf.String(), "hidden")
+}
+
+func TestSlogLogger_Redaction(t *testing.T) {
+	log, capture := NewCaptureLogger(BackendSlog)
+
+	log.WithField("query", "SELECT * FROM users WHERE email = 'jane@example.com'").
+		Infof("token %s", testJWT)
+
+	entry, ok := capture.Find("token " + Redacted)
+	require.True(t, ok)
+	assert.Equal(t, "SELECT * FROM users WHERE email = ?", entry["query"])
+
+	t.Run("Should apply replaced redaction rules", func(t *testing.T) {
+		config := DefaultRedactionConfig()
+		config.SensitiveFields = append(config.SensitiveFields, "ssn")
+		log.(redactable).setRedactor(NewRedactor(config))
+
+		log.WithField("ssn", "123-45-6789").Info("lookup")
+
+		entry, ok := capture.Find("lookup")
+		require.True(t, ok)
+		assert.Equal(t, Redacted, entry["ssn"])
+	})
+
+	t.Run("Should apply replaced redaction rules to derived loggers", func(t *testing.T) {
+		derived := log.WithField("card", "4111-1111-1111-1111")
+
+		config := DefaultRedactionConfig()
+		config.SensitiveFields = append(config.SensitiveFields, "card")
+		log.(redactable).setRedactor(NewRedactor(config))
+
+		derived.Info("charge")
+
+		entry, ok := capture.Find("charge")
+		require.True(t, ok)
+		assert.Equal(t, Redacted, entry["card"])
+	})
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// File writes every message to its own .eml file in a directory, where it
+// can be opened with a mail client
+type File struct {
+	dir   string
+	count atomic.Uint64
+}
+
+// NewFile creates a File mailer writing to dir, creating it if needed
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &File{dir: dir}, nil
+}
+
+// Send writes msg to a new file
+func (f *File) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405.000000000"), f.count.Add(1))
+	return os.WriteFile(filepath.Join(f.dir, name), msg.Bytes(), 0o640)
+}
@@ -0,0 +1,106 @@
+// Package mailer sends email through SMTP, or records it in files or in
+// memory for development and tests.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// validate checks the addresses of msg
+func (msg Message) validate() error {
+	if len(msg.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	for _, address := range append([]string{msg.From}, msg.To...) {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		if strings.ContainsAny(address, "\r\n") {
+			return fmt.Errorf("invalid address %q", address)
+		}
+	}
+	return nil
+}
+
+// Bytes renders msg in the Internet Message Format
+func (msg Message) Bytes() []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("From", msg.From)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(msg.From))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// messageID creates a unique Message-ID in the sender's domain
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "<> ")
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
+
+// Memory keeps sent messages in memory
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemory creates an empty Memory mailer
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send records msg
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
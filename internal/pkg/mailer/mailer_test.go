@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMessage = Message{
+	From:    "Scrutiny <noreply@example.com>",
+	To:      []string{"ada@example.com"},
+	Subject: "You are invited",
+	Body:    "Hello Ada\nAccept here",
+}
+
+// fakeSMTP accepts one SMTP session on a local port and returns the
+// commands and message data it received
+func fakeSMTP(t *testing.T) (port int, received <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	out := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var lines []string
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				text.PrintfLine("250 localhost")
+			case line == "DATA":
+				text.PrintfLine("354 go ahead")
+				data, _ := text.ReadDotLines()
+				lines = append(lines, data...)
+				text.PrintfLine("250 queued")
+			case line == "QUIT":
+				text.PrintfLine("221 bye")
+				out <- lines
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+		out <- lines
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, out
+}
+
+func TestSMTP_Send(t *testing.T) {
+	t.Run("Should deliver the message", func(t *testing.T) {
+		port, received := fakeSMTP(t)
+		m := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: port, TLS: TLSNone})
+
+		require.NoError(t, m.Send(context.Background(), testMessage))
+
+		lines := <-received
+		assert.Contains(t, lines, "MAIL FROM:<noreply@example.com>")
+		assert.Contains(t, lines, "RCPT TO:<ada@example.com>")
+		assert.Contains(t, lines, "Subject: You are invited")
+		assert.Contains(t, lines, "Accept here")
+	})
+
+	t.Run("Should require STARTTLS by default", func(t *testing.T) {
+		port, _ := fakeSMTP(t)
+		m := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: port})
+
+		err := m.Send(context.Background(), testMessage)
+
+		assert.ErrorContains(t, err, "does not support STARTTLS")
+	})
+
+	t.Run("Should give up when the context ends", func(t *testing.T) {
+		// A server that never greets
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				bufio.NewReader(conn).ReadString('\n')
+				conn.Close()
+			}
+		}()
+
+		m := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, TLS: TLSNone})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err = m.Send(ctx, testMessage)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestFile_Send(t *testing.T) {
+	t.Run("Should write each message to its own file", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "mail")
+		m, err := NewFile(dir)
+		require.NoError(t, err)
+
+		require.NoError(t, m.Send(context.Background(), testMessage))
+		require.NoError(t, m.Send(context.Background(), testMessage))
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "To: ada@example.com\r\n")
+		assert.Contains(t, string(data), "Hello Ada\r\nAccept here")
+	})
+}
+
+func TestMemory_Send(t *testing.T) {
+	t.Run("Should reject header injection", func(t *testing.T) {
+		m := NewMemory()
+		msg := testMessage
+		msg.To = []string{"ada@example.com\r\nBcc: eve@example.com"}
+
+		assert.Error(t, m.Send(context.Background(), msg))
+		assert.Empty(t, m.Messages())
+	})
+
+	t.Run("Should record messages", func(t *testing.T) {
+		m := NewMemory()
+		for i := 0; i < 3; i++ {
+			msg := testMessage
+			msg.Subject = strconv.Itoa(i)
+			require.NoError(t, m.Send(context.Background(), msg))
+		}
+
+		assert.Len(t, m.Messages(), 3)
+		assert.Equal(t, "2", m.Messages()[2].Subject)
+	})
+}
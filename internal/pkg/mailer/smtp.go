@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// TLS modes of an SMTP connection
+const (
+	// TLSStartTLS upgrades the connection with STARTTLS and fails if the
+	// server does not offer it
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS, usually on port 465
+	TLSImplicit = "tls"
+	// TLSNone sends in plain text, for local relays only
+	TLSNone = "none"
+)
+
+// DefaultSMTPTimeout bounds sending a message when SMTPConfig leaves
+// Timeout unset and the context has no deadline
+const DefaultSMTPTimeout = 30 * time.Second
+
+// SMTPConfig holds the settings of an SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// TLS is one of TLSStartTLS, TLSImplicit or TLSNone
+	TLS     string
+	Timeout time.Duration
+	// TLSConfig overrides the TLS settings, such as trusted roots
+	TLSConfig *tls.Config
+}
+
+// SMTP sends messages through an SMTP server, opening a connection per
+// message
+type SMTP struct {
+	config SMTPConfig
+}
+
+// NewSMTP creates an SMTP mailer
+func NewSMTP(config SMTPConfig) *SMTP {
+	if config.TLS == "" {
+		config.TLS = TLSStartTLS
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultSMTPTimeout
+	}
+	return &SMTP{config: config}
+}
+
+// Send delivers msg to the server. Cancelling ctx aborts the transfer.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+
+	// net/smtp is not context aware, so the deadline is enforced on the
+	// connection and cancellation closes it
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := s.send(conn, msg); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return err
+	}
+	return nil
+}
+
+// dial connects to the server, over TLS in implicit mode
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{}
+	if s.config.TLS == TLSImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig()}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// tlsConfig returns the TLS settings for the server
+func (s *SMTP) tlsConfig() *tls.Config {
+	if s.config.TLSConfig != nil {
+		config := s.config.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = s.config.Host
+		}
+		return config
+	}
+	return &tls.Config{ServerName: s.config.Host, MinVersion: tls.VersionTLS12}
+}
+
+// send runs the SMTP transaction for msg on conn
+func (s *SMTP) send(conn net.Conn, msg Message) error {
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if s.config.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS", s.config.Host)
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	for _, to := range msg.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := client.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("SMTP server rejected recipient %s: %w", rcpt.Address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/database"
+)
+
+// Namespace prefixes every metric exported by the application
+const Namespace = "scrutiny"
+
+// Metrics holds the collectors for a single server. Each instance has its
+// own registry so tests can create isolated instances and assert on values.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPRequests        *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+	HTTPInFlight        prometheus.Gauge
+
+	QueryDuration *prometheus.HistogramVec
+
+	Users *UserMetrics
+}
+
+// UserMetrics holds the domain counters for user management
+type UserMetrics struct {
+	Created     prometheus.Counter
+	Updated     prometheus.Counter
+	Deactivated prometheus.Counter
+	Deleted     prometheus.Counter
+	Restored    prometheus.Counter
+	// Retained counts deleted users anonymized or purged by the retention
+	// job, by mode
+	Retained *prometheus.CounterVec
+}
+
+// New creates a Metrics instance with a fresh registry
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Total HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		HTTPInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+		QueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "database",
+			Name:      "query_duration_seconds",
+			Help:      "Database query latency by query name and outcome.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"query", "outcome"}),
+		Users: &UserMetrics{
+			Created: prometheus.NewCounter(prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "users",
+				Name:      "created_total",
+				Help:      "Users created.",
+			}),
+			Updated: prometheus.NewCounter(prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "users",
+				Name:      "updated_total",
+				Help:      "Users updated.",
+			}),
+			Deactivated: prometheus.NewCounter(prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "users",
+				Name:      "deactivated_total",
+				Help:      "Users deactivated.",
+			}),
+			Deleted: prometheus.NewCounter(prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "users",
+				Name:      "deleted_total",
+				Help:      "Users deleted.",
+			}),
+			Restored: prometheus.NewCounter(prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "users",
+				Name:      "restored_total",
+				Help:      "Deleted users restored.",
+			}),
+			Retained: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "users",
+				Name:      "retained_total",
+				Help:      "Deleted users anonymized or purged after the retention period, by mode.",
+			}, []string{"mode"}),
+		},
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPRequestDuration,
+		m.HTTPInFlight,
+		m.QueryDuration,
+		m.Users.Created,
+		m.Users.Updated,
+		m.Users.Deactivated,
+		m.Users.Deleted,
+		m.Users.Restored,
+		m.Users.Retained,
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler exposing the registry in the Prometheus
+// text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// ObserveRequest records a completed HTTP request
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	m.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.HTTPRequestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveQuery records a completed database query. It satisfies
+// database.QueryObserver.
+func (m *Metrics) ObserveQuery(ctx context.Context, name string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, database.ErrNoRows) {
+		outcome = "error"
+	}
+	m.QueryDuration.WithLabelValues(name, outcome).Observe(duration.Seconds())
+}
+
+// RegisterDatabase exports the connection pool statistics of db
+func (m *Metrics) RegisterDatabase(name string, db database.StatsProvider) error {
+	return m.Registry.Register(newDBStatsCollector(name, db))
+}
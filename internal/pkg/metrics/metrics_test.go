@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStats struct {
+	stats sql.DBStats
+}
+
+func (f *fakeStats) Stats() sql.DBStats {
+	return f.stats
+}
+
+func TestMetrics_ObserveQuery(t *testing.T) {
+	m := New()
+
+	m.ObserveQuery(context.Background(), "users.find_by_id", 5*time.Millisecond, nil)
+	m.ObserveQuery(context.Background(), "users.find_by_id", 5*time.Millisecond, sql.ErrNoRows)
+	m.ObserveQuery(context.Background(), "users.find_by_id", 5*time.Millisecond, errors.New("connection reset"))
+
+	sampleCount := func(outcome string) uint64 {
+		var metric dto.Metric
+		observer := m.QueryDuration.WithLabelValues("users.find_by_id", outcome)
+		require.NoError(t, observer.(prometheus.Histogram).Write(&metric))
+		return metric.GetHistogram().GetSampleCount()
+	}
+
+	// Missing rows are an expected outcome, not a query failure
+	assert.Equal(t, uint64(2), sampleCount("success"))
+	assert.Equal(t, uint64(1), sampleCount("error"))
+}
+
+func TestMetrics_RegisterDatabase(t *testing.T) {
+	m := New()
+	db := &fakeStats{stats: sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          7,
+		WaitDuration:       2 * time.Second,
+	}}
+	require.NoError(t, m.RegisterDatabase("primary", db))
+
+	expected := `
+# HELP scrutiny_database_in_use_connections Connections currently in use.
+# TYPE scrutiny_database_in_use_connections gauge
+scrutiny_database_in_use_connections{db="primary"} 3
+# HELP scrutiny_database_wait_count_total Total connections waited for.
+# TYPE scrutiny_database_wait_count_total counter
+scrutiny_database_wait_count_total{db="primary"} 7
+`
+	err := testutil.GatherAndCompare(m.Registry, strings.NewReader(expected),
+		"scrutiny_database_in_use_connections", "scrutiny_database_wait_count_total")
+	assert.NoError(t, err)
+
+	t.Run("Should keep instances isolated", func(t *testing.T) {
+		other := New()
+		assert.NoError(t, other.RegisterDatabase("primary", db))
+		assert.Equal(t, float64(0), testutil.ToFloat64(other.Users.Created))
+	})
+}
@@ -0,0 +1,262 @@
+// Package ownership maps cloud, cluster and code resources to the teams
+// owning them, so findings can be routed to the people who can fix them.
+package ownership
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind is the resource attribute a rule matches
+type Kind string
+
+// Rule kinds, from the most to the least specific. When rules of the same
+// priority match, the more specific kind wins.
+const (
+	// KindTag matches a resource tag, with a pattern such as owner=payments
+	KindTag Kind = "tag"
+	// KindRepository matches a repository path such as
+	// github.com/acme/payments-*
+	KindRepository Kind = "repository"
+	// KindNamespace matches a Kubernetes namespace
+	KindNamespace Kind = "namespace"
+	// KindAccount matches a cloud account, project or subscription ID
+	KindAccount Kind = "account"
+)
+
+// rank orders the kinds by specificity
+var rank = map[Kind]int{
+	KindTag:        4,
+	KindRepository: 3,
+	KindNamespace:  2,
+	KindAccount:    1,
+}
+
+// MaxPatternLength is the longest pattern a rule may have
+const MaxPatternLength = 256
+
+// Rule assigns the resources matching Pattern to a team. Patterns are
+// globs where * matches within a path segment, ** across segments and ?
+// a single character. Tag patterns are key=value with a glob value.
+type Rule struct {
+	ID     int
+	TeamID int
+	Kind   Kind
+	// Pattern is matched against the attribute selected by Kind
+	Pattern string
+	// Priority overrides the precedence of kinds, higher first
+	Priority  int
+	CreatedAt time.Time
+}
+
+// Validate checks the kind and pattern of the rule
+func (r Rule) Validate() error {
+	if _, ok := rank[r.Kind]; !ok {
+		return fmt.Errorf("unknown rule kind %q, use tag, repository, namespace or account", r.Kind)
+	}
+	if strings.TrimSpace(r.Pattern) == "" {
+		return fmt.Errorf("rule pattern cannot be empty")
+	}
+	if len(r.Pattern) > MaxPatternLength {
+		return fmt.Errorf("rule pattern cannot be longer than %d characters", MaxPatternLength)
+	}
+	if r.Kind == KindTag {
+		key, _, ok := strings.Cut(r.Pattern, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("tag pattern %q must be key=value", r.Pattern)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the rule matches resource
+func (r Rule) Matches(resource Resource) bool {
+	switch r.Kind {
+	case KindTag:
+		key, value, _ := strings.Cut(r.Pattern, "=")
+		tag, ok := resource.Tags[key]
+		return ok && matchGlob(value, tag)
+	case KindRepository:
+		return resource.Repository != "" && matchGlob(r.Pattern, resource.Repository)
+	case KindNamespace:
+		return resource.Namespace != "" && matchGlob(r.Pattern, resource.Namespace)
+	case KindAccount:
+		return resource.Account != "" && matchGlob(r.Pattern, resource.Account)
+	}
+	return false
+}
+
+// specificity counts the literal characters of the pattern, so
+// payments-api wins over payments-*
+func (r Rule) specificity() int {
+	return len(r.Pattern) - strings.Count(r.Pattern, "*") - strings.Count(r.Pattern, "?")
+}
+
+// precedes reports whether r takes precedence over other. Ties are broken
+// by the older rule.
+func (r Rule) precedes(other Rule) bool {
+	if r.Priority != other.Priority {
+		return r.Priority > other.Priority
+	}
+	if c := r.compare(other); c != 0 {
+		return c > 0
+	}
+	return r.ID < other.ID
+}
+
+// compare orders rules of equal priority by kind and specificity, zero
+// when neither is more specific
+func (r Rule) compare(other Rule) int {
+	if rank[r.Kind] != rank[other.Kind] {
+		return rank[r.Kind] - rank[other.Kind]
+	}
+	return r.specificity() - other.specificity()
+}
+
+// Resolution is the outcome of resolving the owner of a resource
+type Resolution struct {
+	// Rule is the matching rule with the highest precedence, nil when no
+	// rule matches
+	Rule *Rule
+	// Matches are all matching rules, by precedence
+	Matches []Rule
+	// Conflicts are matching rules as specific as Rule that assign the
+	// resource to other teams. Rule only wins them by age, so they should
+	// be reviewed.
+	Conflicts []Rule
+}
+
+// Resolve finds the rule deciding the owner of resource
+func Resolve(rules []Rule, resource Resource) Resolution {
+	var resolution Resolution
+	for _, rule := range rules {
+		if rule.Matches(resource) {
+			resolution.Matches = append(resolution.Matches, rule)
+		}
+	}
+	if len(resolution.Matches) == 0 {
+		return resolution
+	}
+
+	sort.SliceStable(resolution.Matches, func(i, j int) bool {
+		return resolution.Matches[i].precedes(resolution.Matches[j])
+	})
+
+	winner := resolution.Matches[0]
+	resolution.Rule = &winner
+	for _, rule := range resolution.Matches[1:] {
+		if rule.Priority == winner.Priority && rule.compare(winner) == 0 && rule.TeamID != winner.TeamID {
+			resolution.Conflicts = append(resolution.Conflicts, rule)
+		}
+	}
+	return resolution
+}
+
+// Glob tokens besides literal bytes
+const (
+	globAny = 256 + iota
+	globStar
+	globDeep
+)
+
+// matchGlob reports whether value matches the glob pattern, where *
+// matches within a path segment, ** across segments and ? one character
+// other than /. It tracks the set of pattern positions reachable after
+// each character of value, so it runs in O(len(pattern) * len(value)).
+func matchGlob(pattern, value string) bool {
+	tokens := make([]int, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			tokens = append(tokens, globDeep)
+			i++
+		case pattern[i] == '*':
+			tokens = append(tokens, globStar)
+		case pattern[i] == '?':
+			tokens = append(tokens, globAny)
+		default:
+			tokens = append(tokens, int(pattern[i]))
+		}
+	}
+
+	current := make([]bool, len(tokens)+1)
+	next := make([]bool, len(tokens)+1)
+	current[0] = true
+	skipStars(tokens, current)
+	for i := 0; i < len(value); i++ {
+		clear(next)
+		c := value[i]
+		for j, token := range tokens {
+			if !current[j] {
+				continue
+			}
+			switch token {
+			case globDeep:
+				next[j] = true
+			case globStar:
+				next[j] = next[j] || c != '/'
+			case globAny:
+				next[j+1] = next[j+1] || c != '/'
+			default:
+				next[j+1] = next[j+1] || token == int(c)
+			}
+		}
+		skipStars(tokens, next)
+		current, next = next, current
+	}
+	return current[len(tokens)]
+}
+
+// skipStars marks the positions after stars reachable, since stars match
+// the empty string
+func skipStars(tokens []int, states []bool) {
+	for j, token := range tokens {
+		if states[j] && (token == globStar || token == globDeep) {
+			states[j+1] = true
+		}
+	}
+}
+
+// Resource holds the attributes of a resource that rules match
+type Resource struct {
+	// ID is the reference the resource was parsed from
+	ID         string
+	Account    string            `json:",omitempty" yaml:",omitempty"`
+	Repository string            `json:",omitempty" yaml:",omitempty"`
+	Namespace  string            `json:",omitempty" yaml:",omitempty"`
+	Tags       map[string]string `json:",omitempty" yaml:",omitempty"`
+}
+
+// ParseResource derives the attributes of a resource from its reference:
+//
+//	aws://123456789012/..., gcp://my-project/..., azure://<subscription>/...
+//	k8s://<cluster>/<namespace>/...
+//	git://github.com/acme/payments, or an https URL of a repository
+//
+// Tags are not part of references and are added by the caller.
+func ParseResource(ref string) (Resource, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return Resource{}, fmt.Errorf("invalid resource reference %q", ref)
+	}
+
+	resource := Resource{ID: ref}
+	switch u.Scheme {
+	case "aws", "gcp", "azure":
+		resource.Account = u.Host
+	case "k8s", "kubernetes":
+		namespace, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		if namespace == "" {
+			return Resource{}, fmt.Errorf("resource reference %q has no namespace", ref)
+		}
+		resource.Namespace = namespace
+	case "git", "http", "https":
+		resource.Repository = strings.TrimSuffix(u.Host+strings.TrimSuffix(u.Path, "/"), ".git")
+	default:
+		return Resource{}, fmt.Errorf("unsupported resource scheme %q", u.Scheme)
+	}
+	return resource, nil
+}
@@ -0,0 +1,161 @@
+package ownership
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResource(t *testing.T) {
+	t.Run("Should derive the attributes from references", func(t *testing.T) {
+		cases := map[string]Resource{
+			"aws://123456789012/s3/invoices":            {Account: "123456789012"},
+			"gcp://payments-prod/compute/vm-1":          {Account: "payments-prod"},
+			"k8s://prod-eu/payments/deployments/api":    {Namespace: "payments"},
+			"https://github.com/acme/payments-api.git":  {Repository: "github.com/acme/payments-api"},
+			"git://github.com/acme/payments/services/x": {Repository: "github.com/acme/payments/services/x"},
+		}
+		for ref, expected := range cases {
+			resource, err := ParseResource(ref)
+			require.NoError(t, err, ref)
+			expected.ID = ref
+			assert.Equal(t, expected, resource)
+		}
+	})
+
+	t.Run("Should reject unknown references", func(t *testing.T) {
+		for _, ref := range []string{"payments", "ftp://host/x", "k8s://cluster"} {
+			_, err := ParseResource(ref)
+			assert.Error(t, err, ref)
+		}
+	})
+}
+
+func TestRule_Matches(t *testing.T) {
+	resource := Resource{
+		Account:    "123456789012",
+		Repository: "github.com/acme/payments/services/ledger",
+		Namespace:  "payments-prod",
+		Tags:       map[string]string{"owner": "payments"},
+	}
+
+	t.Run("Should match each kind of attribute", func(t *testing.T) {
+		for _, rule := range []Rule{
+			{Kind: KindTag, Pattern: "owner=payments"},
+			{Kind: KindTag, Pattern: "owner=pay*"},
+			{Kind: KindRepository, Pattern: "github.com/acme/payments/**"},
+			{Kind: KindNamespace, Pattern: "payments-*"},
+			{Kind: KindAccount, Pattern: "123456789012"},
+		} {
+			assert.True(t, rule.Matches(resource), rule.Pattern)
+		}
+	})
+
+	t.Run("Should keep single stars within a path segment", func(t *testing.T) {
+		assert.False(t, Rule{Kind: KindRepository, Pattern: "github.com/acme/*"}.Matches(resource))
+		assert.False(t, Rule{Kind: KindTag, Pattern: "team=payments"}.Matches(resource))
+		assert.False(t, Rule{Kind: KindNamespace, Pattern: "payments"}.Matches(resource))
+	})
+}
+
+func TestMatchGlob(t *testing.T) {
+	t.Run("Should match stars, double stars and question marks", func(t *testing.T) {
+		for _, c := range []struct {
+			pattern, value string
+			match          bool
+		}{
+			{"payments-*", "payments-prod", true},
+			{"payments-*", "payments-prod/eu", false},
+			{"acme/**", "acme/payments/api", true},
+			{"acme/**/api", "acme/payments/eu/api", true},
+			{"acme/*/api", "acme/payments/eu/api", false},
+			{"team-?", "team-a", true},
+			{"team-?", "team-ab", false},
+			{"a?c", "a/c", false},
+			{"a.c", "abc", false},
+			{"*", "", true},
+			{"a**", "a", true},
+			{"**/api", "acme/api", true},
+			{"*-*-prod", "eu-west-prod", true},
+			{"*-*-prod", "eu-prod", false},
+		} {
+			assert.Equal(t, c.match, matchGlob(c.pattern, c.value), "%s %s", c.pattern, c.value)
+		}
+	})
+
+	t.Run("Should match pathological patterns in linear time", func(t *testing.T) {
+		pattern := strings.Repeat("*a", 50) + "*b"
+		value := strings.Repeat("a", 10000)
+
+		start := time.Now()
+		assert.False(t, matchGlob(pattern, value))
+		assert.False(t, matchGlob(strings.Repeat("**a", 50)+"**b", value))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestRule_Validate(t *testing.T) {
+	t.Run("Should reject overlong patterns", func(t *testing.T) {
+		rule := Rule{Kind: KindNamespace, Pattern: strings.Repeat("*a", MaxPatternLength)}
+		assert.Error(t, rule.Validate())
+
+		rule.Pattern = "payments-*"
+		assert.NoError(t, rule.Validate())
+	})
+}
+
+func TestResolve(t *testing.T) {
+	resource := Resource{
+		Account:   "123456789012",
+		Namespace: "payments-prod",
+		Tags:      map[string]string{"owner": "payments"},
+	}
+
+	t.Run("Should prefer more specific kinds and patterns", func(t *testing.T) {
+		rules := []Rule{
+			{ID: 1, TeamID: 10, Kind: KindAccount, Pattern: "123456789012"},
+			{ID: 2, TeamID: 20, Kind: KindNamespace, Pattern: "payments-*"},
+			{ID: 3, TeamID: 30, Kind: KindNamespace, Pattern: "payments-prod"},
+		}
+
+		resolution := Resolve(rules, resource)
+
+		require.NotNil(t, resolution.Rule)
+		assert.Equal(t, 3, resolution.Rule.ID)
+		assert.Len(t, resolution.Matches, 3)
+		assert.Empty(t, resolution.Conflicts)
+	})
+
+	t.Run("Should let priority override the kind", func(t *testing.T) {
+		rules := []Rule{
+			{ID: 1, TeamID: 10, Kind: KindTag, Pattern: "owner=payments"},
+			{ID: 2, TeamID: 20, Kind: KindAccount, Pattern: "123456789012", Priority: 10},
+		}
+
+		assert.Equal(t, 2, Resolve(rules, resource).Rule.ID)
+	})
+
+	t.Run("Should report equally specific rules of other teams", func(t *testing.T) {
+		rules := []Rule{
+			{ID: 2, TeamID: 20, Kind: KindNamespace, Pattern: "payments-*"},
+			{ID: 1, TeamID: 10, Kind: KindNamespace, Pattern: "*ents-prod"},
+			{ID: 3, TeamID: 10, Kind: KindAccount, Pattern: "123456789012"},
+		}
+
+		resolution := Resolve(rules, resource)
+
+		assert.Equal(t, 1, resolution.Rule.ID)
+		require.Len(t, resolution.Conflicts, 1)
+		assert.Equal(t, 2, resolution.Conflicts[0].ID)
+	})
+
+	t.Run("Should resolve nothing without matches", func(t *testing.T) {
+		resolution := Resolve([]Rule{{ID: 1, Kind: KindAccount, Pattern: "999"}}, resource)
+
+		assert.Nil(t, resolution.Rule)
+		assert.Empty(t, resolution.Matches)
+	})
+}
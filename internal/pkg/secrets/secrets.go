@@ -0,0 +1,283 @@
+// Package secrets resolves references to secrets kept outside the
+// configuration, such as secret://file/run/secrets/db_password,
+// secret://env/DB_PASSWORD or vault://secret/data/db#password.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// Supported reference schemes
+const (
+	SchemeSecret = "secret"
+	SchemeVault  = "vault"
+)
+
+// Default timings used when a Resolver leaves them unset
+const (
+	// DefaultTTL is how long a secret without its own lease is cached
+	DefaultTTL = 5 * time.Minute
+	// RetryInterval is how long Watch waits after a failed refresh or a
+	// change that could not be applied
+	RetryInterval = 30 * time.Second
+	// minRefreshInterval stops Watch from spinning on very short leases
+	minRefreshInterval = time.Second
+)
+
+// ErrNotFound is returned when a referenced secret does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// Secret is a resolved secret value
+type Secret struct {
+	Value string
+	// TTL is how long the value may be cached. Zero uses the resolver's
+	// default.
+	TTL time.Duration
+}
+
+// Provider resolves references of one scheme
+type Provider interface {
+	Resolve(ctx context.Context, ref *url.URL) (Secret, error)
+}
+
+// cached is a resolved value and when it must be fetched again
+type cached struct {
+	value   string
+	expires time.Time
+}
+
+// Resolver expands secret references using the provider registered for
+// their scheme and caches the values until their TTL elapses
+type Resolver struct {
+	logger     logger.Logger
+	providers  map[string]Provider
+	defaultTTL time.Duration
+	// retryInterval is RetryInterval, shortened by tests
+	retryInterval time.Duration
+	now           func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// Option configures optional Resolver behaviour
+type Option func(*Resolver)
+
+// WithProvider registers a provider for references with the given scheme
+func WithProvider(scheme string, provider Provider) Option {
+	return func(r *Resolver) {
+		r.providers[scheme] = provider
+	}
+}
+
+// WithDefaultTTL sets how long secrets without their own lease are cached
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		if ttl > 0 {
+			r.defaultTTL = ttl
+		}
+	}
+}
+
+// NewResolver creates a resolver for secret:// references. Other schemes,
+// such as vault://, are enabled with WithProvider.
+func NewResolver(logger logger.Logger, opts ...Option) *Resolver {
+	r := &Resolver{
+		logger:        logger,
+		providers:     map[string]Provider{SchemeSecret: Local{}},
+		defaultTTL:    DefaultTTL,
+		retryInterval: RetryInterval,
+		now:           time.Now,
+		cache:         make(map[string]cached),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// IsReference reports whether value refers to a secret with a registered
+// scheme. Other values are used literally.
+func (r *Resolver) IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok {
+		return false
+	}
+	_, registered := r.providers[scheme]
+	return registered
+}
+
+// Resolve returns the secret value refers to, or value itself when it is
+// not a reference
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !r.IsReference(value) {
+		return value, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.cache[value]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expires) {
+		return entry.value, nil
+	}
+	return r.refresh(ctx, value)
+}
+
+// refresh fetches a reference from its provider and caches the result
+func (r *Resolver) refresh(ctx context.Context, value string) (string, error) {
+	ref, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret reference: %w", err)
+	}
+
+	secret, err := r.providers[ref.Scheme].Resolve(ctx, ref)
+	if err != nil {
+		// The reference itself is not secret, only the value it points to
+		return "", fmt.Errorf("failed to resolve %s: %w", value, err)
+	}
+
+	ttl := secret.TTL
+	if ttl <= 0 {
+		ttl = r.defaultTTL
+	}
+	r.mu.Lock()
+	r.cache[value] = cached{value: secret.Value, expires: r.now().Add(ttl)}
+	r.mu.Unlock()
+	return secret.Value, nil
+}
+
+// Watch resolves refs again whenever their TTL elapses and calls onChange
+// with the values of all refs when any of them changed. Failed refreshes
+// are logged and retried while the previous value stays in use. When
+// onChange fails, the change is logged and offered again after
+// RetryInterval. Watch returns when ctx is cancelled.
+func (r *Resolver) Watch(ctx context.Context, refs []string, onChange func(values map[string]string) error) error {
+	values := make(map[string]string)
+	var watched []string
+	for _, ref := range refs {
+		if !r.IsReference(ref) {
+			continue
+		}
+		value, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+		values[ref] = value
+		watched = append(watched, ref)
+	}
+	if len(watched) == 0 {
+		return nil
+	}
+
+	for {
+		timer := time.NewTimer(r.nextRefresh(watched))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		next := maps.Clone(values)
+		var changed []string
+		for _, ref := range watched {
+			if !r.expired(ref) {
+				continue
+			}
+			value, err := r.refresh(ctx, ref)
+			if err != nil {
+				r.logger.WithError(err).Warn("Failed to refresh secret, keeping the previous value")
+				r.retryAfter(ref, r.retryInterval)
+				continue
+			}
+			if value != values[ref] {
+				next[ref] = value
+				changed = append(changed, ref)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		// Values are only committed once applied, so a failed change is
+		// detected again by the next refresh
+		if err := onChange(maps.Clone(next)); err != nil {
+			r.logger.WithError(err).Error("Failed to apply rotated secrets, retrying")
+			for _, ref := range changed {
+				r.retryAfter(ref, r.retryInterval)
+			}
+			continue
+		}
+		values = next
+	}
+}
+
+// nextRefresh returns how long to wait until the first of refs expires
+func (r *Resolver) nextRefresh(refs []string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wait := r.defaultTTL
+	for _, ref := range refs {
+		if until := r.cache[ref].expires.Sub(r.now()); until < wait {
+			wait = until
+		}
+	}
+	if wait < minRefreshInterval {
+		wait = minRefreshInterval
+	}
+	return wait
+}
+
+// expired reports whether the cached value of ref must be fetched again
+func (r *Resolver) expired(ref string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !r.now().Before(r.cache[ref].expires)
+}
+
+// retryAfter keeps the cached value of ref for another interval
+func (r *Resolver) retryAfter(ref string, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := r.cache[ref]
+	entry.expires = r.now().Add(interval)
+	r.cache[ref] = entry
+}
+
+// Local resolves secret://file/<path> and secret://env/<NAME> references
+type Local struct{}
+
+// Resolve implements the Provider interface
+func (Local) Resolve(ctx context.Context, ref *url.URL) (Secret, error) {
+	switch ref.Host {
+	case "file":
+		data, err := os.ReadFile(ref.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			return Secret{}, ErrNotFound
+		}
+		if err != nil {
+			return Secret{}, err
+		}
+		return Secret{Value: strings.TrimRight(string(data), "\r\n")}, nil
+	case "env":
+		value, ok := os.LookupEnv(strings.TrimPrefix(ref.Path, "/"))
+		if !ok {
+			return Secret{}, ErrNotFound
+		}
+		return Secret{Value: value}, nil
+	}
+	return Secret{}, fmt.Errorf("unsupported secret source %q, expected file or env", ref.Host)
+}
@@ -0,0 +1,205 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	log, _ := logger.NewCaptureLogger(logger.BackendLogrus)
+
+	t.Run("Should return values that are not references unchanged", func(t *testing.T) {
+		r := NewResolver(log)
+
+		value, err := r.Resolve(context.Background(), "plain-password")
+
+		require.NoError(t, err)
+		assert.Equal(t, "plain-password", value)
+	})
+
+	t.Run("Should read file and environment references", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "password")
+		require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+		t.Setenv("SCRUTINY_TEST_SECRET", "from-env")
+		r := NewResolver(log)
+
+		value, err := r.Resolve(context.Background(), "secret://file"+path)
+		require.NoError(t, err)
+		assert.Equal(t, "from-file", value)
+
+		value, err = r.Resolve(context.Background(), "secret://env/SCRUTINY_TEST_SECRET")
+		require.NoError(t, err)
+		assert.Equal(t, "from-env", value)
+	})
+
+	t.Run("Should return ErrNotFound for a missing secret", func(t *testing.T) {
+		r := NewResolver(log)
+
+		_, err := r.Resolve(context.Background(), "secret://file"+filepath.Join(t.TempDir(), "missing"))
+
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Should cache values until their TTL elapses", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "password")
+		require.NoError(t, os.WriteFile(path, []byte("first"), 0600))
+		now := time.Now()
+		r := NewResolver(log, WithDefaultTTL(time.Minute))
+		r.now = func() time.Time { return now }
+		ref := "secret://file" + path
+
+		value, err := r.Resolve(context.Background(), ref)
+		require.NoError(t, err)
+		assert.Equal(t, "first", value)
+
+		require.NoError(t, os.WriteFile(path, []byte("second"), 0600))
+		value, err = r.Resolve(context.Background(), ref)
+		require.NoError(t, err)
+		assert.Equal(t, "first", value)
+
+		now = now.Add(time.Minute)
+		value, err = r.Resolve(context.Background(), ref)
+		require.NoError(t, err)
+		assert.Equal(t, "second", value)
+	})
+}
+
+func TestResolver_Watch(t *testing.T) {
+	t.Run("Should report rotated secrets", func(t *testing.T) {
+		log, _ := logger.NewCaptureLogger(logger.BackendLogrus)
+		path := filepath.Join(t.TempDir(), "password")
+		require.NoError(t, os.WriteFile(path, []byte("first"), 0600))
+		r := NewResolver(log, WithDefaultTTL(time.Millisecond))
+		ref := "secret://file" + path
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := make(chan map[string]string, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Watch(ctx, []string{ref, "literal"}, func(values map[string]string) error {
+				changes <- values
+				return nil
+			})
+		}()
+
+		// Rotate only once Watch has read the first value
+		require.Eventually(t, func() bool {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			_, ok := r.cache[ref]
+			return ok
+		}, time.Second, time.Millisecond)
+		require.NoError(t, os.WriteFile(path, []byte("second"), 0600))
+		select {
+		case values := <-changes:
+			assert.Equal(t, map[string]string{ref: "second"}, values)
+		case <-time.After(5 * time.Second):
+			t.Fatal("rotation was not reported")
+		}
+
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("Should offer a change again until it is applied", func(t *testing.T) {
+		log, _ := logger.NewCaptureLogger(logger.BackendLogrus)
+		path := filepath.Join(t.TempDir(), "password")
+		require.NoError(t, os.WriteFile(path, []byte("first"), 0600))
+		r := NewResolver(log, WithDefaultTTL(time.Millisecond))
+		r.retryInterval = time.Millisecond
+		ref := "secret://file" + path
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := make(chan map[string]string, 2)
+		failed := false
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Watch(ctx, []string{ref}, func(values map[string]string) error {
+				changes <- values
+				if !failed {
+					failed = true
+					return errors.New("connection refused")
+				}
+				return nil
+			})
+		}()
+
+		require.Eventually(t, func() bool {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			_, ok := r.cache[ref]
+			return ok
+		}, time.Second, time.Millisecond)
+		require.NoError(t, os.WriteFile(path, []byte("second"), 0600))
+		for i := 0; i < 2; i++ {
+			select {
+			case values := <-changes:
+				assert.Equal(t, map[string]string{ref: "second"}, values)
+			case <-time.After(5 * time.Second):
+				t.Fatal("rotation was not offered again")
+			}
+		}
+
+		cancel()
+		assert.NoError(t, <-done)
+	})
+}
+
+func TestVault_Resolve(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			w.Write([]byte(`{"data":{"data":{"password":"kv2"},"metadata":{"version":3}},"lease_duration":0}`))
+		case "/v1/kv/db":
+			w.Write([]byte(`{"data":{"password":"kv1"},"lease_duration":60}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer vault.Close()
+
+	log, _ := logger.NewCaptureLogger(logger.BackendLogrus)
+	r := NewResolver(log, WithProvider(SchemeVault, NewVault(VaultConfig{
+		Address: vault.URL,
+		Token:   "test-token",
+	})))
+
+	t.Run("Should read KV version 2 secrets", func(t *testing.T) {
+		value, err := r.Resolve(context.Background(), "vault://secret/data/db#password")
+
+		require.NoError(t, err)
+		assert.Equal(t, "kv2", value)
+	})
+
+	t.Run("Should read KV version 1 secrets", func(t *testing.T) {
+		value, err := r.Resolve(context.Background(), "vault://kv/db#password")
+
+		require.NoError(t, err)
+		assert.Equal(t, "kv1", value)
+	})
+
+	t.Run("Should return ErrNotFound for a missing path or key", func(t *testing.T) {
+		_, err := r.Resolve(context.Background(), "vault://secret/data/missing#password")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = r.Resolve(context.Background(), "vault://secret/data/db#username")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultVaultTimeout bounds requests to Vault when no client is given
+const defaultVaultTimeout = 10 * time.Second
+
+// VaultConfig holds the settings of a Vault provider
+type VaultConfig struct {
+	// Address is the Vault server, such as https://vault.internal:8200
+	Address string
+	Token   string
+	// Namespace is sent as X-Vault-Namespace when set
+	Namespace string
+	// Client defaults to an http.Client with a 10 second timeout
+	Client *http.Client
+}
+
+// Vault resolves vault://<path>#<key> references against the Vault HTTP
+// API. Both KV version 1 and version 2 mounts are supported; for version 2
+// the path includes the data/ segment, as in vault://secret/data/db#password.
+type Vault struct {
+	config VaultConfig
+}
+
+// NewVault creates a Vault provider
+func NewVault(config VaultConfig) *Vault {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: defaultVaultTimeout}
+	}
+	config.Address = strings.TrimRight(config.Address, "/")
+	return &Vault{config: config}
+}
+
+// vaultResponse is the subset of a Vault read response that is used
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// Resolve implements the Provider interface
+func (v *Vault) Resolve(ctx context.Context, ref *url.URL) (Secret, error) {
+	path := strings.Trim(ref.Host+ref.Path, "/")
+	if path == "" || ref.Fragment == "" {
+		return Secret{}, errors.New("vault references must have the form vault://<path>#<key>")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.Address+"/v1/"+path, nil)
+	if err != nil {
+		return Secret{}, err
+	}
+	req.Header.Set("X-Vault-Token", v.config.Token)
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.config.Client.Do(req)
+	if err != nil {
+		return Secret{}, err
+	}
+	defer resp.Body.Close()
+
+	var body vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return Secret{}, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Secret{}, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return Secret{}, fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(body.Errors, "; "))
+	}
+
+	data := body.Data
+	// KV version 2 nests the secret under data.data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	value, ok := data[ref.Fragment]
+	if !ok {
+		return Secret{}, ErrNotFound
+	}
+	s, ok := value.(string)
+	if !ok {
+		return Secret{}, fmt.Errorf("vault key %q is not a string", ref.Fragment)
+	}
+	return Secret{Value: s, TTL: time.Duration(body.LeaseDuration) * time.Second}, nil
+}
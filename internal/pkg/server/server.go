@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// Default timeouts applied when the corresponding Config field is zero
+const (
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultIdleTimeout       = 60 * time.Second
+	DefaultShutdownTimeout   = 15 * time.Second
+	DefaultCloseTimeout      = 5 * time.Second
+)
+
+// Config holds the HTTP server and lifecycle settings
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// DrainPeriod is how long readiness reports failing before the server
+	// stops accepting connections, giving load balancers time to notice
+	DrainPeriod time.Duration
+
+	// ShutdownTimeout bounds how long in-flight requests and background
+	// workers are given to finish
+	ShutdownTimeout time.Duration
+
+	// CloseTimeout bounds how long each registered resource is given to close
+	CloseTimeout time.Duration
+}
+
+// resource is something closed when the server shuts down
+type resource struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// Server runs an HTTP server and manages the lifecycle of the resources
+// and background workers it depends on
+type Server struct {
+	config Config
+	http   *http.Server
+	logger logger.Logger
+	ready  atomic.Bool
+
+	mu        sync.Mutex
+	resources []resource
+	workers   sync.WaitGroup
+	workerCtx context.Context
+	stop      context.CancelFunc
+}
+
+// New creates a new Server serving handler with the given configuration
+func New(config Config, handler http.Handler, logger logger.Logger) *Server {
+	if config.ReadHeaderTimeout == 0 {
+		config.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = DefaultIdleTimeout
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.CloseTimeout == 0 {
+		config.CloseTimeout = DefaultCloseTimeout
+	}
+
+	workerCtx, stop := context.WithCancel(context.Background())
+
+	return &Server{
+		config: config,
+		http: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		},
+		logger:    logger,
+		workerCtx: workerCtx,
+		stop:      stop,
+	}
+}
+
+// Ready reports whether the server is accepting traffic. It turns false as
+// soon as shutdown begins.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Register adds a resource that is closed when the server shuts down.
+// Resources are closed in reverse registration order.
+func (s *Server) Register(name string, close func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resources = append(s.resources, resource{name: name, close: close})
+}
+
+// RegisterCloser adds an io.Closer, such as a database.Connection, that is
+// closed when the server shuts down
+func (s *Server) RegisterCloser(name string, closer io.Closer) {
+	s.Register(name, func(ctx context.Context) error {
+		return closer.Close()
+	})
+}
+
+// Go starts a background worker. The worker's context is cancelled when the
+// server shuts down and the server waits for it to return before closing
+// registered resources.
+func (s *Server) Go(name string, worker func(ctx context.Context) error) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		if err := worker(s.workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger.WithField("worker", name).WithError(err).Error("Background worker failed")
+		}
+	}()
+}
+
+// Run listens on the configured address and serves until ctx is cancelled,
+// then shuts down gracefully. Resources are closed when listening fails too.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to listen on %s: %w", s.config.Addr, err), s.shutdown(nil))
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is cancelled, then shuts down gracefully
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.http.Serve(ln)
+	}()
+
+	s.ready.Store(true)
+	s.logger.Infof("Server listening on %s", ln.Addr())
+
+	select {
+	case err := <-serveErr:
+		// The server stopped on its own, so there is nothing left to drain
+		s.ready.Store(false)
+		return errors.Join(fmt.Errorf("server stopped unexpectedly: %w", err), s.shutdown(nil))
+	case <-ctx.Done():
+	}
+
+	return s.shutdown(serveErr)
+}
+
+// Close stops the workers and closes the registered resources of a server
+// that is not serving, for example because setting it up failed. Use Run
+// or Serve to shut down a serving server.
+func (s *Server) Close() error {
+	return s.shutdown(nil)
+}
+
+// shutdown drains traffic, stops the HTTP server and workers, and closes
+// registered resources in reverse order
+func (s *Server) shutdown(serveErr <-chan error) error {
+	s.ready.Store(false)
+	s.logger.Info("Shutting down server")
+
+	var errs []error
+
+	if serveErr != nil {
+		if s.config.DrainPeriod > 0 {
+			s.logger.Infof("Draining for %s", s.config.DrainPeriod)
+			time.Sleep(s.config.DrainPeriod)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+		if err := s.http.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down http server: %w", err))
+		}
+		cancel()
+
+		if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+
+	s.stop()
+	if !waitTimeout(&s.workers, s.config.ShutdownTimeout) {
+		errs = append(errs, errors.New("timed out waiting for background workers"))
+	}
+
+	s.mu.Lock()
+	resources := s.resources
+	s.mu.Unlock()
+
+	for i := len(resources) - 1; i >= 0; i-- {
+		res := resources[i]
+		if err := closeWithTimeout(res, s.config.CloseTimeout); err != nil {
+			s.logger.WithField("resource", res.name).WithError(err).Error("Failed to close resource")
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", res.name, err))
+			continue
+		}
+		s.logger.WithField("resource", res.name).Debug("Closed resource")
+	}
+
+	s.logger.Info("Server stopped")
+	return errors.Join(errs...)
+}
+
+// closeWithTimeout closes a resource, giving up once the timeout elapses
+func closeWithTimeout(res resource, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- res.close(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitTimeout waits for wg, returning false if the timeout elapses first
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
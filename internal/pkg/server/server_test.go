@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger() logger.Logger {
+	return logger.NewLogger(logger.LoggerConfig{
+		Output:    io.Discard,
+		Formatter: &logrus.JSONFormatter{},
+		Level:     logrus.InfoLevel,
+	})
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	srv := New(Config{DrainPeriod: 50 * time.Millisecond}, mux, newTestLogger())
+
+	var mu sync.Mutex
+	var closed []string
+	record := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			closed = append(closed, name)
+			return nil
+		}
+	}
+	srv.Register("first", record("first"))
+	srv.Register("second", record("second"))
+
+	workerStopped := make(chan struct{})
+	srv.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(workerStopped)
+		return ctx.Err()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, ln)
+	}()
+
+	// Start a request that is still in flight when shutdown begins
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-started
+	assert.True(t, srv.Ready())
+
+	cancel()
+
+	t.Run("Should fail readiness before shutting down", func(t *testing.T) {
+		assert.Eventually(t, func() bool { return !srv.Ready() }, time.Second, time.Millisecond)
+	})
+
+	close(release)
+
+	t.Run("Should complete in-flight requests", func(t *testing.T) {
+		assert.Equal(t, "done", <-response)
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("Should stop workers and close resources in reverse order", func(t *testing.T) {
+		<-workerStopped
+		assert.Equal(t, []string{"second", "first"}, closed)
+	})
+}
+
+func TestServer_CloseTimeout(t *testing.T) {
+	srv := New(Config{CloseTimeout: 10 * time.Millisecond}, http.NewServeMux(), newTestLogger())
+
+	var closed bool
+	srv.RegisterCloser("quick", closerFunc(func() error {
+		closed = true
+		return nil
+	}))
+	srv.Register("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	})
+	srv.Register("broken", func(ctx context.Context) error {
+		return errors.New("boom")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = srv.Serve(ctx, ln)
+
+	t.Run("Should report failed and timed out resources", func(t *testing.T) {
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "failed to close broken: boom")
+	})
+
+	t.Run("Should keep closing after a failure", func(t *testing.T) {
+		assert.True(t, closed)
+	})
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func TestServer_Close(t *testing.T) {
+	srv := New(Config{}, http.NewServeMux(), newTestLogger())
+	var closed bool
+	srv.Register("database", func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+	workerStopped := make(chan struct{})
+	srv.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(workerStopped)
+		return ctx.Err()
+	})
+
+	t.Run("Should stop workers and close resources without serving", func(t *testing.T) {
+		require.NoError(t, srv.Close())
+		assert.True(t, closed)
+		<-workerStopped
+	})
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte(strings.Repeat("s", MinSecretLength))
+
+func TestSigner(t *testing.T) {
+	signer, err := NewSigner(testSecret)
+	require.NoError(t, err)
+
+	t.Run("Should verify the tokens it signed", func(t *testing.T) {
+		tok, err := signer.Sign("invite", "42", time.Hour)
+		require.NoError(t, err)
+
+		subject, err := signer.Verify(tok, "invite")
+
+		require.NoError(t, err)
+		assert.Equal(t, "42", subject)
+	})
+
+	t.Run("Should reject tokens for another purpose or secret", func(t *testing.T) {
+		tok, err := signer.Sign("invite", "42", time.Hour)
+		require.NoError(t, err)
+
+		_, err = signer.Verify(tok, "reset")
+		assert.ErrorIs(t, err, ErrInvalid)
+
+		other, err := NewSigner([]byte(strings.Repeat("o", MinSecretLength)))
+		require.NoError(t, err)
+		_, err = other.Verify(tok, "invite")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Should reject tampered tokens", func(t *testing.T) {
+		tok, err := signer.Sign("invite", "42", time.Hour)
+		require.NoError(t, err)
+		forged, err := signer.Sign("invite", "43", time.Hour)
+		require.NoError(t, err)
+
+		payload, _, _ := strings.Cut(forged, ".")
+		_, signature, _ := strings.Cut(tok, ".")
+
+		_, err = signer.Verify(payload+"."+signature, "invite")
+		assert.ErrorIs(t, err, ErrInvalid)
+		_, err = signer.Verify("garbage", "invite")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Should reject expired tokens", func(t *testing.T) {
+		tok, err := signer.Sign("invite", "42", time.Hour)
+		require.NoError(t, err)
+
+		later := *signer
+		later.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+		_, err = later.Verify(tok, "invite")
+		assert.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("Should require a long secret", func(t *testing.T) {
+		_, err := NewSigner([]byte("short"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,26 @@
+package tracing
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// SanitizeSQL replaces string and numeric literals in query with ? and
+// collapses whitespace, so statements can be recorded on spans without
+// leaking data. Bind parameters such as $1 are preserved.
+func SanitizeSQL(query string) string {
+	return strings.TrimSpace(whitespace.ReplaceAllString(logger.ScrubSQL(query), " "))
+}
+
+// SQLOperation returns the leading keyword of query, such as SELECT
+func SQLOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
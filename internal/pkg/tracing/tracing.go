@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+)
+
+// InstrumentationName identifies the tracers created by this application
+const InstrumentationName = "github.com/robertfischer3/scrutiny_cnapp"
+
+// Supported exporters
+const (
+	ExporterNone     = "none"
+	ExporterStdout   = "stdout"
+	ExporterFile     = "file"
+	ExporterOTLPHTTP = "otlphttp"
+)
+
+// Config holds the tracing configuration
+type Config struct {
+	// Exporter selects where spans are sent: none, stdout, file or otlphttp
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint string
+	// Insecure disables TLS for the OTLP/HTTP exporter
+	Insecure bool
+	// FilePath is the file spans are written to by the file exporter
+	FilePath string
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// SampleRatio is the fraction of new traces sampled. Zero samples all.
+	SampleRatio float64
+	// Writer overrides the destination of the stdout exporter
+	Writer io.Writer
+}
+
+// Provider wraps the SDK tracer provider together with the resources its
+// exporter owns
+type Provider struct {
+	trace.TracerProvider
+	shutdown func(ctx context.Context) error
+}
+
+// Shutdown flushes pending spans and releases the exporter
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.shutdown(ctx)
+}
+
+// NewProvider creates a tracer provider for the configured exporter. The
+// "none" exporter returns a no-op provider.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	if config.Exporter == "" || config.Exporter == ExporterNone {
+		return &Provider{
+			TracerProvider: noop.NewTracerProvider(),
+			shutdown:       func(context.Context) error { return nil },
+		}, nil
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = "scrutiny"
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(config.SampleRatio)
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	}
+
+	var closeOutput func() error
+	switch config.Exporter {
+	case ExporterStdout, ExporterFile:
+		writer := config.Writer
+		if config.Exporter == ExporterFile {
+			file, err := os.OpenFile(config.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open trace file: %w", err)
+			}
+			writer, closeOutput = file, file.Close
+		} else if writer == nil {
+			writer = os.Stdout
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		// Export synchronously so spans are visible as soon as they end
+		opts = append(opts, sdktrace.WithSyncer(exporter))
+	case ExporterOTLPHTTP:
+		clientOpts := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+
+	return &Provider{
+		TracerProvider: tp,
+		shutdown: func(ctx context.Context) error {
+			err := tp.Shutdown(ctx)
+			if closeOutput != nil {
+				if closeErr := closeOutput(); err == nil {
+					err = closeErr
+				}
+			}
+			return err
+		},
+	}, nil
+}
+
+// Propagator returns the W3C trace context propagator used for incoming
+// and outgoing requests
+func Propagator() propagation.TextMapPropagator {
+	return propagation.TraceContext{}
+}
+
+// Tracer returns the application tracer from tp, falling back to the
+// global provider when tp is nil
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(InstrumentationName)
+}
+
+// WithTraceFields adds the trace and span IDs of the span in ctx to log
+func WithTraceFields(ctx context.Context, log logger.Logger) logger.Logger {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return log
+	}
+	return log.WithFields(map[string]interface{}{
+		"trace_id": spanContext.TraceID().String(),
+		"span_id":  spanContext.SpanID().String(),
+	})
+}
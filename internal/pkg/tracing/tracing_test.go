@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robertfischer3/scrutiny_cnapp/internal/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvider(t *testing.T) {
+	t.Run("Should write spans to the stdout exporter", func(t *testing.T) {
+		var buf bytes.Buffer
+		tp, err := NewProvider(context.Background(), Config{Exporter: ExporterStdout, Writer: &buf})
+		require.NoError(t, err)
+
+		_, span := Tracer(tp).Start(context.Background(), "test-span")
+		span.End()
+		require.NoError(t, tp.Shutdown(context.Background()))
+
+		var exported struct{ Name string }
+		require.NoError(t, json.NewDecoder(&buf).Decode(&exported))
+		assert.Equal(t, "test-span", exported.Name)
+	})
+
+	t.Run("Should write spans to the file exporter", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "spans.json")
+		tp, err := NewProvider(context.Background(), Config{Exporter: ExporterFile, FilePath: path})
+		require.NoError(t, err)
+
+		_, span := Tracer(tp).Start(context.Background(), "file-span")
+		span.End()
+		require.NoError(t, tp.Shutdown(context.Background()))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"Name":"file-span"`)
+	})
+
+	t.Run("Should reject unknown exporters", func(t *testing.T) {
+		_, err := NewProvider(context.Background(), Config{Exporter: "carrier-pigeon"})
+		assert.Error(t, err)
+	})
+}
+
+func TestWithTraceFields(t *testing.T) {
+	var out bytes.Buffer
+	log := logger.NewLogger(logger.LoggerConfig{Output: &out, Formatter: &logrus.JSONFormatter{}, Level: logrus.InfoLevel})
+
+	tp, err := NewProvider(context.Background(), Config{Exporter: ExporterStdout, Writer: io.Discard})
+	require.NoError(t, err)
+	ctx, span := Tracer(tp).Start(context.Background(), "request")
+	defer span.End()
+
+	WithTraceFields(ctx, log).Info("handled")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, span.SpanContext().TraceID().String(), entry["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), entry["span_id"])
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    "SELECT id FROM users WHERE email = 'john@example.com' AND id = 42",
+			expected: "SELECT id FROM users WHERE email = ? AND id = ?",
+		},
+		{
+			query:    "UPDATE users\n\t\tSET name = $1\n\t\tWHERE id = $2",
+			expected: "UPDATE users SET name = $1 WHERE id = $2",
+		},
+		{
+			query:    "SELECT t1.id FROM t1 WHERE note = 'it''s' LIMIT 10.5",
+			expected: "SELECT t1.id FROM t1 WHERE note = ? LIMIT ?",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, SanitizeSQL(tt.query))
+	}
+	assert.Equal(t, "UPDATE", SQLOperation("\n update users"))
+}